@@ -0,0 +1,179 @@
+// Package ais decodes the 6-bit armoured payload of AIVDM/AIVDO sentences.
+//
+// All standard message types 1 to 27 are decoded into structs embedding Header;
+// binary application payloads (types 6, 8, 17, 25, 26) are returned as raw bits.
+package ais
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrPayload = errors.New("ais: invalid payload character")
+	ErrShort   = errors.New("ais: payload too short for message type")
+	ErrType    = errors.New("ais: unsupported message type")
+)
+
+// Message is implemented by every decoded message type.
+type Message interface {
+	Base() *Header
+}
+
+// Header holds the fields common to all message types.
+type Header struct {
+	Type   int
+	Repeat int
+	MMSI   uint32
+}
+
+func (h *Header) Base() *Header { return h }
+
+// reader gives bit level access to an unarmoured payload
+type reader struct {
+	bits []byte // one 6-bit value per payload character
+	n    int    // number of valid bits, fill bits excluded
+}
+
+func newReader(payload string, fill int) (*reader, error) {
+	r := &reader{bits: make([]byte, len(payload))}
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		if c < '0' || c > 'w' || c > 'W' && c < '`' {
+			return nil, ErrPayload
+		}
+		c -= '0'
+		if c > 40 {
+			c -= 8
+		}
+		r.bits[i] = c
+	}
+	r.n = len(payload)*6 - fill
+	if fill < 0 || fill > 5 || r.n < 0 {
+		r.n = len(payload) * 6
+	}
+	return r, nil
+}
+
+func (r *reader) len() int {
+	return r.n
+}
+
+func (r *reader) uint(start int, size int) uint64 {
+	// bits past the end read as 0, some transmitters send short messages
+	var v uint64
+	for i := start; i < start+size; i++ {
+		v <<= 1
+		if i < r.n && r.bits[i/6]&(0x20>>(i%6)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+func (r *reader) int(start int, size int) int64 {
+	// two's complement
+	v := r.uint(start, size)
+	if v&(1<<(size-1)) != 0 {
+		return int64(v) - 1<<size
+	}
+	return int64(v)
+}
+
+func (r *reader) bool(start int) bool {
+	return r.uint(start, 1) == 1
+}
+
+const sixbitASCII = "@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_ !\"#$%&'()*+,-./0123456789:;<=>?"
+
+func (r *reader) text(start int, size int) string {
+	// 6-bit ASCII, trailing @ padding and spaces removed
+	var b strings.Builder
+	for i := start; i+6 <= start+size; i += 6 {
+		b.WriteByte(sixbitASCII[r.uint(i, 6)])
+	}
+	return strings.TrimRight(b.String(), "@ ")
+}
+
+func (r *reader) header() Header {
+	return Header{
+		Type:   int(r.uint(0, 6)),
+		Repeat: int(r.uint(6, 2)),
+		MMSI:   uint32(r.uint(8, 30)),
+	}
+}
+
+// MessageType returns the message type of a payload without decoding the rest.
+func MessageType(payload string) int {
+	if payload == "" {
+		return 0
+	}
+	r, err := newReader(payload[:1], 0)
+	if err != nil {
+		return 0
+	}
+	return int(r.uint(0, 6))
+}
+
+// MMSI returns the source MMSI of a payload, or of the first part of a
+// multipart message, without decoding the rest.
+func MMSI(payload string) (uint32, bool) {
+	r, err := newReader(payload, 0)
+	if err != nil || r.len() < 38 {
+		return 0, false
+	}
+	return uint32(r.uint(8, 30)), true
+}
+
+// Decode unpacks a complete payload, for multipart messages the joined payload
+// of all parts and the fill bits of the last part.
+func Decode(payload string, fill int) (Message, error) {
+	r, err := newReader(payload, fill)
+	if err != nil {
+		return nil, err
+	}
+	t := int(r.uint(0, 6))
+	d, ok := decoders[t]
+	if !ok {
+		return nil, ErrType
+	}
+	if r.len() < d.bits {
+		return nil, ErrShort
+	}
+	return d.decode(r), nil
+}
+
+// shortest length accepted for each type, the last field or two is often
+// missing from real messages and reads as zero
+var decoders = map[int]struct {
+	bits   int
+	decode func(*reader) Message
+}{
+	1:  {149, func(r *reader) Message { return decodePositionA(r) }},
+	2:  {149, func(r *reader) Message { return decodePositionA(r) }},
+	3:  {149, func(r *reader) Message { return decodePositionA(r) }},
+	4:  {149, func(r *reader) Message { return decodeBaseStation(r) }},
+	5:  {420, func(r *reader) Message { return decodeStaticVoyage(r) }},
+	6:  {88, func(r *reader) Message { return decodeBinaryAddressed(r) }},
+	7:  {72, func(r *reader) Message { return decodeAck(r) }},
+	8:  {56, func(r *reader) Message { return decodeBinaryBroadcast(r) }},
+	9:  {148, func(r *reader) Message { return decodeSAR(r) }},
+	10: {70, func(r *reader) Message { return decodeUTCInquiry(r) }},
+	11: {149, func(r *reader) Message { return decodeBaseStation(r) }},
+	12: {72, func(r *reader) Message { return decodeSafety(r) }},
+	13: {72, func(r *reader) Message { return decodeAck(r) }},
+	14: {40, func(r *reader) Message { return decodeSafety(r) }},
+	15: {88, func(r *reader) Message { return decodeInterrogation(r) }},
+	16: {92, func(r *reader) Message { return decodeAssignedMode(r) }},
+	17: {80, func(r *reader) Message { return decodeDGNSS(r) }},
+	18: {139, func(r *reader) Message { return decodePositionB(r) }},
+	19: {307, func(r *reader) Message { return decodeExtendedB(r) }},
+	20: {70, func(r *reader) Message { return decodeDataLink(r) }},
+	21: {271, func(r *reader) Message { return decodeAidToNav(r) }},
+	22: {145, func(r *reader) Message { return decodeChannelManagement(r) }},
+	23: {154, func(r *reader) Message { return decodeGroupAssignment(r) }},
+	24: {160, func(r *reader) Message { return decodeStaticData(r) }},
+	25: {40, func(r *reader) Message { return decodeBinarySlot(r) }},
+	26: {60, func(r *reader) Message { return decodeBinarySlot(r) }},
+	27: {95, func(r *reader) Message { return decodeLongRange(r) }},
+}
@@ -0,0 +1,193 @@
+package ais
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDecodePosition(t *testing.T) {
+	for _, c := range []struct {
+		payload string
+		want    Position
+	}{
+		{"15M67FC000G?ufbE`FepT@3n00Sa", Position{Header: Header{Type: 1, MMSI: 366053209}, Status: 3,
+			Coord: Coord{Lon: -122.341618, Lat: 37.802118}, COG: 219.3, Heading: 1, Second: 59}},
+		{"13u?etPv2;0n:dDPwUM1U1Cb069D", Position{Header: Header{Type: 1, MMSI: 265547250}, ROT: -8, SOG: 13.9,
+			Coord: Coord{Lon: 11.832977, Lat: 57.660353}, COG: 40.4, Heading: 41, Second: 53}},
+	} {
+		m, err := Decode(c.payload, 0)
+		if err != nil {
+			t.Errorf("Decode(%q): %v", c.payload, err)
+			continue
+		}
+		p, ok := m.(*Position)
+		if !ok {
+			t.Errorf("Decode(%q) = %T, want *Position", c.payload, m)
+			continue
+		}
+		if math.Abs(p.Lon-c.want.Lon) > 1e-6 || math.Abs(p.Lat-c.want.Lat) > 1e-6 {
+			t.Errorf("Decode(%q) position = %v, want %v", c.payload, p.Coord, c.want.Coord)
+		}
+		p.Coord = c.want.Coord
+		if *p != c.want {
+			t.Errorf("Decode(%q) = %+v, want %+v", c.payload, *p, c.want)
+		}
+		if !p.HasPosition() || !p.HasCOG() || !p.HasHeading() {
+			t.Errorf("Decode(%q) has position %v, COG %v, heading %v", c.payload, p.HasPosition(), p.HasCOG(), p.HasHeading())
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, c := range []struct {
+		payload string
+		fill    int
+		want    error
+	}{
+		{"15M67FC000G?ufbE`FepT@3n00Sa", 0, nil},
+		// short of the 168 bits but not of the 149 decoders takes, the rest read as zero
+		{"15M67FC000G?ufbE`FepT@3n00S", 0, nil},
+		{"15M67FC000G?ufbE`FepT@3n00Sx", 0, ErrPayload},
+		{"15M67FC000G?ufbE`FepT@3n00S ", 0, ErrPayload},
+		{"15M67FC000G?ufbE`FepT@3n", 0, ErrShort},
+		{"15M67FC", 0, ErrShort},
+		{"05M67FC000G?ufbE`FepT@3n00Sa", 0, ErrType},
+		{"t5M67FC000G?ufbE`FepT@3n00Sa", 0, ErrType},
+		{"", 0, ErrType},
+	} {
+		if _, err := Decode(c.payload, c.fill); err != c.want {
+			t.Errorf("Decode(%q, %d) error = %v, want %v", c.payload, c.fill, err, c.want)
+		}
+	}
+}
+
+func TestDecodeShort(t *testing.T) {
+	// a payload the shortest length a type takes decodes, a bit less is ErrShort
+	for _, c := range []struct {
+		typ, bits int
+	}{
+		{1, 149},
+		{5, 420},
+		{18, 139},
+		{24, 160},
+	} {
+		for _, n := range []int{c.bits, c.bits - 1, c.bits - 6, 38} {
+			var w Writer
+			w.Uint(uint64(c.typ), 6)
+			w.Uint(0, 2)
+			w.Uint(366053209, 30)
+			w.Uint(0, n-38)
+			payload, fill := w.Payload()
+			want := ErrShort
+			if n == c.bits {
+				want = nil
+			}
+			if _, err := Decode(payload, fill); err != want {
+				t.Errorf("type %d of %d bits: error = %v, want %v", c.typ, n, err, want)
+			}
+		}
+	}
+}
+
+func TestQuickFields(t *testing.T) {
+	for _, c := range []struct {
+		payload string
+		typ     int
+		mmsi    uint32
+		ok      bool
+	}{
+		{"15M67FC000G?ufbE`FepT@3n00Sa", 1, 366053209, true},
+		{"13u?etPv2;0n:dDPwUM1U1Cb069D", 1, 265547250, true},
+		{"55P5TL01VIaAL@7WKO@mBplU@<PDhh000000001S;AJ::4A80?4i@E53", 5, 369190000, true},
+		{"B5M67FC", 18, 366053209, true},
+		{"15M67F", 1, 0, false},
+		{"15M67Fx", 1, 0, false},
+		{"x", 0, 0, false},
+		{"", 0, 0, false},
+	} {
+		if got := MessageType(c.payload); got != c.typ {
+			t.Errorf("MessageType(%q) = %d, want %d", c.payload, got, c.typ)
+		}
+		if got, ok := MMSI(c.payload); got != c.mmsi || ok != c.ok {
+			t.Errorf("MMSI(%q) = %d, %v, want %d, %v", c.payload, got, ok, c.mmsi, c.ok)
+		}
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	// a class B position and static and voyage data, as feeds build them
+	var w Writer
+	w.Uint(18, 6)
+	w.Uint(0, 2)
+	w.Uint(512345678, 30)
+	w.Uint(0, 8)
+	w.Uint(123, 10)
+	w.Uint(1, 1)
+	w.Int(int64(math.Round(-122.5*600000)), 28)
+	w.Int(int64(math.Round(-36.75*600000)), 27)
+	w.Uint(2195, 12)
+	w.Uint(511, 9)
+	w.Uint(30, 6)
+	w.Uint(0, 29)
+	if w.Len() != 168 {
+		t.Fatalf("Len = %d, want 168", w.Len())
+	}
+	payload, fill := w.Payload()
+	if len(payload) != 28 || fill != 0 {
+		t.Fatalf("Payload = %q, %d, want 28 characters and no fill", payload, fill)
+	}
+	m, err := Decode(payload, fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := m.(*Position)
+	want := Position{Header: Header{Type: 18, MMSI: 512345678}, Status: 15, ROT: -128, SOG: 12.3, Accuracy: true,
+		Coord: Coord{Lon: -122.5, Lat: -36.75}, COG: 219.5, Heading: 511, Second: 30}
+	if !ok || *p != want {
+		t.Errorf("Decode = %+v, want %+v", m, want)
+	}
+	if p.HasHeading() {
+		t.Errorf("heading 511 should be not available")
+	}
+
+	w = Writer{}
+	w.Uint(5, 6)
+	w.Uint(0, 2)
+	w.Uint(512345678, 30)
+	w.Uint(0, 2)
+	w.Uint(9876543, 30)
+	w.Text("zmab", 42)
+	w.Text("Spirit of Akl", 120)
+	w.Uint(37, 8)
+	w.Uint(10, 9)
+	w.Uint(5, 9)
+	w.Uint(2, 6)
+	w.Uint(3, 6)
+	w.Uint(1, 4)
+	w.Uint(10, 4)
+	w.Uint(16, 5)
+	w.Uint(14, 5)
+	w.Uint(30, 6)
+	w.Uint(21, 8)
+	w.Text("NZAKL", 120)
+	w.Uint(0, 1)
+	w.Uint(0, 1)
+	payload, fill = w.Payload()
+	if fill != 2 {
+		t.Errorf("fill = %d, want 2", fill)
+	}
+	m, err = Decode(payload, fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := m.(*StaticVoyage)
+	sv := StaticVoyage{Header: Header{Type: 5, MMSI: 512345678}, IMO: 9876543, CallSign: "ZMAB", Name: "SPIRIT OF AKL", ShipType: 37,
+		Dimensions: Dimensions{ToBow: 10, ToStern: 5, ToPort: 2, ToStarboard: 3}, EPFD: 1,
+		ETAMonth: 10, ETADay: 16, ETAHour: 14, ETAMinute: 30, Draught: 2.1, Destination: "NZAKL"}
+	if !ok || *s != sv {
+		t.Errorf("Decode = %+v, want %+v", m, sv)
+	}
+	if s.Length() != 15 || s.Beam() != 5 {
+		t.Errorf("length %d, beam %d, want 15, 5", s.Length(), s.Beam())
+	}
+}
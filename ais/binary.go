@@ -0,0 +1,139 @@
+package ais
+
+// BinaryAddressed is an addressed binary message, type 6.
+type BinaryAddressed struct {
+	Header
+	Seq        int
+	Dest       uint32
+	Retransmit bool
+	DAC        int // designated area code
+	FID        int // function id
+	Data       []byte
+	DataBits   int
+}
+
+// BinaryBroadcast is a broadcast binary message, type 8.
+type BinaryBroadcast struct {
+	Header
+	DAC      int
+	FID      int
+	Data     []byte
+	DataBits int
+}
+
+// Ack is one acknowledgement in a message type 7 or 13.
+type Ack struct {
+	MMSI uint32
+	Seq  int
+}
+
+// BinaryAck acknowledges addressed messages, type 7 for binary and 13 for safety.
+type BinaryAck struct {
+	Header
+	Acks []Ack
+}
+
+// SafetyMessage is safety related text, type 12 addressed or 14 broadcast.
+type SafetyMessage struct {
+	Header
+	Seq        int
+	Dest       uint32 // 0 for broadcast
+	Retransmit bool
+	Text       string
+}
+
+// BinarySlot is a single slot (type 25) or multiple slot (type 26) binary message.
+type BinarySlot struct {
+	Header
+	Addressed  bool
+	Structured bool
+	Dest       uint32
+	AppID      int // DAC and FID if structured
+	Data       []byte
+	DataBits   int
+}
+
+func (r *reader) bytes(start int, end int) ([]byte, int) {
+	// bits start to end packed into bytes, last byte zero padded
+	if end > r.n {
+		end = r.n
+	}
+	n := end - start
+	if n <= 0 {
+		return nil, 0
+	}
+	b := make([]byte, (n+7)/8)
+	for i := 0; i < n; i += 8 {
+		size := min(8, n-i)
+		b[i/8] = byte(r.uint(start+i, size) << (8 - size))
+	}
+	return b, n
+}
+
+func decodeBinaryAddressed(r *reader) *BinaryAddressed {
+	m := &BinaryAddressed{
+		Header:     r.header(),
+		Seq:        int(r.uint(38, 2)),
+		Dest:       uint32(r.uint(40, 30)),
+		Retransmit: r.bool(70),
+		DAC:        int(r.uint(72, 10)),
+		FID:        int(r.uint(82, 6)),
+	}
+	m.Data, m.DataBits = r.bytes(88, r.len())
+	return m
+}
+
+func decodeBinaryBroadcast(r *reader) *BinaryBroadcast {
+	m := &BinaryBroadcast{
+		Header: r.header(),
+		DAC:    int(r.uint(40, 10)),
+		FID:    int(r.uint(50, 6)),
+	}
+	m.Data, m.DataBits = r.bytes(56, r.len())
+	return m
+}
+
+func decodeAck(r *reader) *BinaryAck {
+	m := &BinaryAck{Header: r.header()}
+	for i := 40; i+32 <= r.len(); i += 32 {
+		m.Acks = append(m.Acks, Ack{MMSI: uint32(r.uint(i, 30)), Seq: int(r.uint(i+30, 2))})
+	}
+	return m
+}
+
+func decodeSafety(r *reader) *SafetyMessage {
+	m := &SafetyMessage{Header: r.header(), Seq: int(r.uint(38, 2))}
+	start := 40
+	if m.Type == 12 {
+		m.Dest = uint32(r.uint(40, 30))
+		m.Retransmit = r.bool(70)
+		start = 72
+	}
+	n := r.len() - start
+	m.Text = r.text(start, n-n%6)
+	return m
+}
+
+func decodeBinarySlot(r *reader) *BinarySlot {
+	m := &BinarySlot{Header: r.header(), Addressed: r.bool(38), Structured: r.bool(39)}
+	i := 40
+	if m.Addressed {
+		m.Dest = uint32(r.uint(i, 30))
+		i += 30
+		if m.Type == 25 {
+			// spare to byte boundary
+			i += 2
+		}
+	}
+	if m.Structured {
+		m.AppID = int(r.uint(i, 16))
+		i += 16
+	}
+	end := r.len()
+	if m.Type == 26 {
+		// radio status
+		end -= 20
+	}
+	m.Data, m.DataBits = r.bytes(i, end)
+	return m
+}
@@ -0,0 +1,192 @@
+package ais
+
+import (
+	"time"
+)
+
+// BaseStation is the base station report (type 4) or UTC/date response (type 11).
+type BaseStation struct {
+	Header
+	Time     time.Time // zero if not available
+	Accuracy bool
+	Coord
+	EPFD int
+	RAIM bool
+}
+
+func decodeBaseStation(r *reader) *BaseStation {
+	b := &BaseStation{
+		Header:   r.header(),
+		Accuracy: r.bool(78),
+		Coord:    r.coord(79),
+		EPFD:     int(r.uint(134, 4)),
+		RAIM:     r.bool(148),
+	}
+	year, month, day := int(r.uint(38, 14)), int(r.uint(52, 4)), int(r.uint(56, 5))
+	hour, minute, second := int(r.uint(61, 5)), int(r.uint(66, 6)), int(r.uint(72, 6))
+	if year > 0 && month > 0 && day > 0 && hour < 24 && minute < 60 && second < 60 {
+		b.Time = time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+	}
+	return b
+}
+
+// UTCInquiry asks a station for UTC and date, type 10.
+type UTCInquiry struct {
+	Header
+	Dest uint32
+}
+
+func decodeUTCInquiry(r *reader) *UTCInquiry {
+	return &UTCInquiry{Header: r.header(), Dest: uint32(r.uint(40, 30))}
+}
+
+// InterrogationRequest asks station MMSI for message MsgType.
+type InterrogationRequest struct {
+	MMSI    uint32
+	MsgType int
+	Offset  int // slot offset
+}
+
+// Interrogation is type 15.
+type Interrogation struct {
+	Header
+	Requests []InterrogationRequest
+}
+
+func decodeInterrogation(r *reader) *Interrogation {
+	m := &Interrogation{Header: r.header()}
+	mmsi1 := uint32(r.uint(40, 30))
+	m.Requests = append(m.Requests, InterrogationRequest{mmsi1, int(r.uint(70, 6)), int(r.uint(76, 12))})
+	if r.len() >= 110 {
+		m.Requests = append(m.Requests, InterrogationRequest{mmsi1, int(r.uint(90, 6)), int(r.uint(96, 12))})
+	}
+	if r.len() >= 158 {
+		m.Requests = append(m.Requests, InterrogationRequest{uint32(r.uint(110, 30)), int(r.uint(140, 6)), int(r.uint(146, 12))})
+	}
+	return m
+}
+
+// Assignment gives station MMSI a reporting schedule.
+type Assignment struct {
+	MMSI      uint32
+	Offset    int
+	Increment int
+}
+
+// AssignedMode is the assignment mode command, type 16.
+type AssignedMode struct {
+	Header
+	Assignments []Assignment
+}
+
+func decodeAssignedMode(r *reader) *AssignedMode {
+	m := &AssignedMode{Header: r.header()}
+	for i := 40; i+52 <= r.len(); i += 52 {
+		m.Assignments = append(m.Assignments, Assignment{uint32(r.uint(i, 30)), int(r.uint(i+30, 12)), int(r.uint(i+42, 10))})
+	}
+	return m
+}
+
+// DGNSS is the DGNSS broadcast binary message, type 17.
+type DGNSS struct {
+	Header
+	Coord    // reference station, reduced resolution
+	Data     []byte
+	DataBits int
+}
+
+func decodeDGNSS(r *reader) *DGNSS {
+	m := &DGNSS{Header: r.header(), Coord: r.coordShort(40)}
+	m.Data, m.DataBits = r.bytes(80, r.len())
+	return m
+}
+
+// Reservation is one slot reservation in a data link management message.
+type Reservation struct {
+	Offset    int
+	Slots     int
+	Timeout   int // minutes
+	Increment int
+}
+
+// DataLink is the data link management message, type 20.
+type DataLink struct {
+	Header
+	Reservations []Reservation
+}
+
+func decodeDataLink(r *reader) *DataLink {
+	m := &DataLink{Header: r.header()}
+	for i := 40; i+30 <= r.len(); i += 30 {
+		res := Reservation{int(r.uint(i, 12)), int(r.uint(i+12, 4)), int(r.uint(i+16, 3)), int(r.uint(i+19, 11))}
+		if res.Offset == 0 && res.Slots == 0 {
+			break
+		}
+		m.Reservations = append(m.Reservations, res)
+	}
+	return m
+}
+
+// ChannelManagement is type 22, for an area (NE, SW corners) or for two addressed stations.
+type ChannelManagement struct {
+	Header
+	ChannelA  int
+	ChannelB  int
+	TxRx      int
+	HighPower bool
+	NE        Coord
+	SW        Coord
+	Dest1     uint32
+	Dest2     uint32
+	Addressed bool
+	BandA     bool
+	BandB     bool
+	ZoneSize  int
+}
+
+func decodeChannelManagement(r *reader) *ChannelManagement {
+	m := &ChannelManagement{
+		Header:    r.header(),
+		ChannelA:  int(r.uint(40, 12)),
+		ChannelB:  int(r.uint(52, 12)),
+		TxRx:      int(r.uint(64, 4)),
+		HighPower: !r.bool(68),
+		Addressed: r.bool(139),
+		BandA:     r.bool(140),
+		BandB:     r.bool(141),
+		ZoneSize:  int(r.uint(142, 3)),
+	}
+	if m.Addressed {
+		m.Dest1 = uint32(r.uint(69, 30))
+		m.Dest2 = uint32(r.uint(104, 30))
+	} else {
+		m.NE = r.coordShort(69)
+		m.SW = r.coordShort(104)
+	}
+	return m
+}
+
+// GroupAssignment is the group assignment command, type 23.
+type GroupAssignment struct {
+	Header
+	NE          Coord
+	SW          Coord
+	StationType int
+	ShipType    int
+	TxRx        int
+	Interval    int
+	Quiet       int // minutes
+}
+
+func decodeGroupAssignment(r *reader) *GroupAssignment {
+	return &GroupAssignment{
+		Header:      r.header(),
+		NE:          r.coordShort(40),
+		SW:          r.coordShort(75),
+		StationType: int(r.uint(110, 4)),
+		ShipType:    int(r.uint(114, 8)),
+		TxRx:        int(r.uint(144, 2)),
+		Interval:    int(r.uint(146, 4)),
+		Quiet:       int(r.uint(150, 4)),
+	}
+}
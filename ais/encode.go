@@ -0,0 +1,63 @@
+package ais
+
+import (
+	"strings"
+)
+
+// Writer builds a payload field by field, for feeds that deliver decoded
+// messages and have to be recorded as sentences.
+type Writer struct {
+	bits []byte // one bit per byte, simplest to append to
+}
+
+// Uint appends the low size bits of v.
+func (w *Writer) Uint(v uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		w.bits = append(w.bits, byte(v>>i)&1)
+	}
+}
+
+// Int appends v in two's complement.
+func (w *Writer) Int(v int64, size int) {
+	w.Uint(uint64(v), size)
+}
+
+// Text appends s in 6-bit ASCII, padded with @ or cut to size bits.
+func (w *Writer) Text(s string, size int) {
+	s = strings.ToUpper(s)
+	for i := 0; i < size/6; i++ {
+		c := 0
+		if i < len(s) {
+			if c = strings.IndexByte(sixbitASCII, s[i]); c < 0 {
+				c = 0
+			}
+		}
+		w.Uint(uint64(c), 6)
+	}
+}
+
+// Len is the number of bits written so far.
+func (w *Writer) Len() int {
+	return len(w.bits)
+}
+
+// Payload returns the armoured payload and the number of fill bits in its last character.
+func (w *Writer) Payload() (string, int) {
+	fill := (6 - len(w.bits)%6) % 6
+	var b strings.Builder
+	for i := 0; i < len(w.bits); i += 6 {
+		c := byte(0)
+		for j := i; j < i+6; j++ {
+			c <<= 1
+			if j < len(w.bits) {
+				c |= w.bits[j]
+			}
+		}
+		c += '0'
+		if c > 'W' {
+			c += 8
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), fill
+}
@@ -0,0 +1,201 @@
+package ais
+
+import (
+	"math"
+)
+
+// values the standard uses for "not available"
+const (
+	NoLon     = 181.0
+	NoLat     = 91.0
+	NoSOG     = 102.3
+	NoCOG     = 360.0
+	NoHeading = 511
+)
+
+// Coord is a position in decimal degrees, north and east positive.
+type Coord struct {
+	Lon float64
+	Lat float64
+}
+
+// HasPosition reports whether latitude and longitude are available.
+func (c Coord) HasPosition() bool {
+	return math.Abs(c.Lon) <= 180 && math.Abs(c.Lat) <= 90
+}
+
+// Location returns the position, for any message type embedding Coord.
+func (c Coord) Location() Coord {
+	return c
+}
+
+// Located is implemented by messages that carry a position.
+type Located interface {
+	Location() Coord
+}
+
+// Position is a position report, message types 1, 2, 3, 18, 19 and 27.
+type Position struct {
+	Header
+	Status   int     // navigation status, 15 if not defined or not sent (class B)
+	ROT      int     // raw rate of turn indicator, -128 if not available
+	SOG      float64 // knots
+	Accuracy bool    // true for DGPS quality fix
+	Coord
+	COG     float64 // degrees true
+	Heading int     // degrees true
+	Second  int     // UTC second of the report, 60+ if not available
+	RAIM    bool
+}
+
+func (p *Position) HasSOG() bool {
+	return p.SOG < NoSOG
+}
+
+func (p *Position) HasCOG() bool {
+	return p.COG < NoCOG
+}
+
+func (p *Position) HasHeading() bool {
+	return p.Heading < 360
+}
+
+func (r *reader) coord(start int) Coord {
+	// 28 bit longitude then 27 bit latitude in 1/10000 minute
+	return Coord{
+		Lon: float64(r.int(start, 28)) / 600000,
+		Lat: float64(r.int(start+28, 27)) / 600000,
+	}
+}
+
+func (r *reader) coordShort(start int) Coord {
+	// 18 bit longitude then 17 bit latitude in 1/10 minute
+	return Coord{
+		Lon: float64(r.int(start, 18)) / 600,
+		Lat: float64(r.int(start+18, 17)) / 600,
+	}
+}
+
+func decodePositionA(r *reader) *Position {
+	return &Position{
+		Header:   r.header(),
+		Status:   int(r.uint(38, 4)),
+		ROT:      int(r.int(42, 8)),
+		SOG:      float64(r.uint(50, 10)) / 10,
+		Accuracy: r.bool(60),
+		Coord:    r.coord(61),
+		COG:      float64(r.uint(116, 12)) / 10,
+		Heading:  int(r.uint(128, 9)),
+		Second:   int(r.uint(137, 6)),
+		RAIM:     r.bool(148),
+	}
+}
+
+func decodePositionB(r *reader) *Position {
+	return &Position{
+		Header:   r.header(),
+		Status:   15,
+		ROT:      -128,
+		SOG:      float64(r.uint(46, 10)) / 10,
+		Accuracy: r.bool(56),
+		Coord:    r.coord(57),
+		COG:      float64(r.uint(112, 12)) / 10,
+		Heading:  int(r.uint(124, 9)),
+		Second:   int(r.uint(133, 6)),
+		RAIM:     r.bool(147),
+	}
+}
+
+// ExtendedB is the class B extended position report, message type 19.
+type ExtendedB struct {
+	Position
+	Name     string
+	ShipType int
+	Dimensions
+	EPFD int
+}
+
+// Dimensions are distances from the reference point to the bow, stern, port and starboard in metres.
+type Dimensions struct {
+	ToBow       int
+	ToStern     int
+	ToPort      int
+	ToStarboard int
+}
+
+// Length and Beam are 0 if not known.
+func (d Dimensions) Length() int { return d.ToBow + d.ToStern }
+func (d Dimensions) Beam() int   { return d.ToPort + d.ToStarboard }
+
+func (r *reader) dimensions(start int) Dimensions {
+	return Dimensions{
+		ToBow:       int(r.uint(start, 9)),
+		ToStern:     int(r.uint(start+9, 9)),
+		ToPort:      int(r.uint(start+18, 6)),
+		ToStarboard: int(r.uint(start+24, 6)),
+	}
+}
+
+func decodeExtendedB(r *reader) *ExtendedB {
+	p := decodePositionB(r)
+	p.RAIM = r.bool(305)
+	return &ExtendedB{
+		Position:   *p,
+		Name:       r.text(143, 120),
+		ShipType:   int(r.uint(263, 8)),
+		Dimensions: r.dimensions(271),
+		EPFD:       int(r.uint(301, 4)),
+	}
+}
+
+func decodeLongRange(r *reader) *Position {
+	// type 27, reduced resolution, positions in 1/10 minute
+	p := &Position{
+		Header:   r.header(),
+		Accuracy: r.bool(38),
+		RAIM:     r.bool(39),
+		Status:   int(r.uint(40, 4)),
+		ROT:      -128,
+		Coord:    r.coordShort(44),
+		SOG:      float64(r.uint(79, 6)),
+		COG:      float64(r.uint(85, 9)),
+		Heading:  NoHeading,
+		Second:   60,
+	}
+	if p.SOG == 63 {
+		p.SOG = NoSOG
+	}
+	if p.COG == 511 {
+		p.COG = NoCOG
+	}
+	return p
+}
+
+// SARAircraft is the search and rescue aircraft position report, message type 9.
+type SARAircraft struct {
+	Header
+	Altitude int     // metres, 4095 if not available
+	SOG      float64 // knots, 1023 if not available
+	Accuracy bool
+	Coord
+	COG      float64 // degrees true
+	Second   int
+	DTE      bool
+	Assigned bool
+	RAIM     bool
+}
+
+func decodeSAR(r *reader) *SARAircraft {
+	return &SARAircraft{
+		Header:   r.header(),
+		Altitude: int(r.uint(38, 12)),
+		SOG:      float64(r.uint(50, 10)),
+		Accuracy: r.bool(60),
+		Coord:    r.coord(61),
+		COG:      float64(r.uint(116, 12)) / 10,
+		Second:   int(r.uint(128, 6)),
+		DTE:      r.bool(142),
+		Assigned: r.bool(146),
+		RAIM:     r.bool(147),
+	}
+}
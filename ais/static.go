@@ -0,0 +1,116 @@
+package ais
+
+// StaticVoyage is static and voyage related data, message type 5.
+type StaticVoyage struct {
+	Header
+	AISVersion int
+	IMO        uint32
+	CallSign   string
+	Name       string
+	ShipType   int
+	Dimensions
+	EPFD        int
+	ETAMonth    int     // 0 if not available
+	ETADay      int     // 0 if not available
+	ETAHour     int     // 24 if not available
+	ETAMinute   int     // 60 if not available
+	Draught     float64 // metres
+	Destination string
+	DTE         bool // false if data terminal ready
+}
+
+func decodeStaticVoyage(r *reader) *StaticVoyage {
+	return &StaticVoyage{
+		Header:      r.header(),
+		AISVersion:  int(r.uint(38, 2)),
+		IMO:         uint32(r.uint(40, 30)),
+		CallSign:    r.text(70, 42),
+		Name:        r.text(112, 120),
+		ShipType:    int(r.uint(232, 8)),
+		Dimensions:  r.dimensions(240),
+		EPFD:        int(r.uint(270, 4)),
+		ETAMonth:    int(r.uint(274, 4)),
+		ETADay:      int(r.uint(278, 5)),
+		ETAHour:     int(r.uint(283, 5)),
+		ETAMinute:   int(r.uint(288, 6)),
+		Draught:     float64(r.uint(294, 8)) / 10,
+		Destination: r.text(302, 120),
+		DTE:         r.bool(422),
+	}
+}
+
+// StaticData is the class B static data report, message type 24.
+// Part A (PartNo 0) carries the name, part B (PartNo 1) the rest.
+type StaticData struct {
+	Header
+	PartNo   int
+	Name     string
+	ShipType int
+	VendorID string
+	Model    int
+	Serial   int
+	CallSign string
+	Dimensions
+	Mothership uint32 // instead of dimensions for auxiliary craft
+}
+
+// Auxiliary reports whether the sender is a craft associated with a parent ship.
+func (s *StaticData) Auxiliary() bool {
+	return s.MMSI/10000000 == 98
+}
+
+func decodeStaticData(r *reader) *StaticData {
+	s := &StaticData{Header: r.header(), PartNo: int(r.uint(38, 2))}
+	if s.PartNo == 0 {
+		s.Name = r.text(40, 120)
+		return s
+	}
+	s.ShipType = int(r.uint(40, 8))
+	s.VendorID = r.text(48, 18)
+	s.Model = int(r.uint(66, 4))
+	s.Serial = int(r.uint(70, 20))
+	s.CallSign = r.text(90, 42)
+	if s.Auxiliary() {
+		s.Mothership = uint32(r.uint(132, 30))
+	} else {
+		s.Dimensions = r.dimensions(132)
+	}
+	return s
+}
+
+// AidToNav is the aid-to-navigation report, message type 21.
+type AidToNav struct {
+	Header
+	AidType  int
+	Name     string // including the name extension
+	Accuracy bool
+	Coord
+	Dimensions
+	EPFD        int
+	Second      int
+	OffPosition bool
+	RAIM        bool
+	Virtual     bool
+	Assigned    bool
+}
+
+func decodeAidToNav(r *reader) *AidToNav {
+	a := &AidToNav{
+		Header:      r.header(),
+		AidType:     int(r.uint(38, 5)),
+		Name:        r.text(43, 120),
+		Accuracy:    r.bool(163),
+		Coord:       r.coord(164),
+		Dimensions:  r.dimensions(219),
+		EPFD:        int(r.uint(249, 4)),
+		Second:      int(r.uint(253, 6)),
+		OffPosition: r.bool(259),
+		RAIM:        r.bool(268),
+		Virtual:     r.bool(269),
+		Assigned:    r.bool(270),
+	}
+	if ext := r.len() - 272; ext >= 6 {
+		a.Name += r.text(272, ext-ext%6)
+	}
+	return a
+}
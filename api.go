@@ -0,0 +1,74 @@
+//go:build !edge
+
+package logais
+
+/*
+Optional HTTP API for monitoring, started with -http [host]:port, eg -http :8080
+ GET /	status page for a browser, see dashboard.go
+ GET /api/dashboard	what the status page shows
+ GET /api/status	stream counters, active profile, host resources (load, memory, disk, temperature) and the clock check
+ GET /api/events[?since=seq]	recent events, see events.go
+ GET /api/du	archive size by stream, month and format, JSON as logais du -json
+ GET /api/sync...	daily files for a warm standby peer, see sync.go
+ GET /api/cluster	this member's view of the cluster, see cluster.go
+ POST /api/ingest/{port}	sentences from agents for an ingest stream, see ingest.go
+ POST /api/annotate	an operator's note for the data files and logs, see annotate.go
+ GET /healthz	each stream's health, 503 if one isn't, see health.go
+ /api/streams...	list, stop, start, pause and roll over streams, with a token, see control.go
+ POST /api/profile/{name}	switch profile, with the same token
+Users, tokens and TLS for all of it are in apiauth.go.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"example.com/logais/input"
+)
+
+var (
+	apiMux  = http.NewServeMux()
+	apiAddr string // -http, empty if the API isn't served
+)
+
+func serveAPI(addr string) {
+	apiMux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, currentStatus())
+	})
+	apiMux.HandleFunc("GET /api/events", eventsHandler)
+	apiMux.HandleFunc("GET /api/du", func(w http.ResponseWriter, r *http.Request) {
+		u, err := measureArchive(archiveRoots())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, u)
+	})
+	apiMux.HandleFunc("GET /api/sync", syncListHandler)
+	apiMux.HandleFunc("GET /api/sync/{name}", syncFileHandler)
+	apiMux.HandleFunc("GET /api/cluster", clusterHandler)
+	apiMux.HandleFunc("POST /api/ingest/{port}", input.IngestHandler)
+	apiMux.HandleFunc("POST /api/annotate", annotateHandler)
+	apiMux.HandleFunc("GET /healthz", healthHandler)
+	apiMux.HandleFunc("GET /{$}", dashboardHandler)
+	apiMux.HandleFunc("GET /api/dashboard", dashboardData)
+	apiMux.HandleFunc("GET /api/streams", controlAuth(streamsHandler))
+	apiMux.HandleFunc("GET /api/streams/{port}", controlAuth(streamHandler))
+	apiMux.HandleFunc("POST /api/streams/{port}/{action}", controlAuth(streamActionHandler))
+	apiMux.HandleFunc("POST /api/profile/{name}", controlAuth(profileHandler))
+	ln, err := listenHTTP(addr, Conf)
+	if err == nil {
+		Logit.Info("API listening", "addr", addr, "tls", Conf.HTTPTLS != nil, "auth", !Conf.httpOpen())
+		err = http.Serve(ln, requireAuth(apiMux))
+	}
+	if err != nil {
+		Logit.Error("API server", "err", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	enc.Encode(v)
+}
@@ -0,0 +1,101 @@
+//go:build !edge
+
+package logais
+
+/*
+Reading the application log back, so exported or replayed data can carry the
+log entries (reconnects, gaps, errors) from the same time.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// log lines are "2006/01/02 15:04:05 UTC message", or JSON objects with
+// "time" with -log-format json (see logging.go)
+const appLogLayout = "2006/01/02 15:04:05"
+
+// margin either side of the data time range when picking log entries
+const logMargin = 5 * time.Minute
+
+type logLine struct {
+	Time time.Time
+	Text string
+}
+
+func logFiles() []string {
+	// current logfile and the rotated ones, numbered or dated (see logrotate.go), oldest first
+	return append(append(oldLogs(LogfName+"[0-9]*.log"), oldLogs(datedLogs)...), Logpath+LogfName+".log")
+}
+
+func logWindow(from time.Time, until time.Time) ([]logLine, error) {
+	// application log entries between from and until, with a margin
+	from, until = from.Add(-logMargin), until.Add(logMargin)
+	var lines []logLine
+	for _, name := range logFiles() {
+		f, err := os.Open(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			text := sc.Text()
+			t, err := logLineTime(text)
+			if err != nil || t.Before(from) || t.After(until) {
+				continue
+			}
+			lines = append(lines, logLine{Time: t, Text: text})
+		}
+		f.Close()
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	return lines, nil
+}
+
+func logLineTime(text string) (time.Time, error) {
+	if strings.HasPrefix(text, "{") {
+		var entry struct {
+			Time time.Time `json:"time"`
+		}
+		err := json.Unmarshal([]byte(text), &entry)
+		return entry.Time, err
+	}
+	if len(text) < len(appLogLayout) {
+		return time.Time{}, errors.New("short log line")
+	}
+	return time.Parse(appLogLayout, text[:len(appLogLayout)])
+}
+
+func recordingSpan(names []string) (time.Time, time.Time, error) {
+	// first and last record times over all files
+	var first, last time.Time
+	for _, name := range names {
+		rr, err := openRecording(name)
+		if err != nil {
+			return first, last, err
+		}
+		for {
+			rec, err := rr.Next()
+			if err != nil {
+				break
+			}
+			if first.IsZero() || rec.Time.Before(first) {
+				first = rec.Time
+			}
+			if rec.Time.After(last) {
+				last = rec.Time
+			}
+		}
+		rr.Close()
+	}
+	return first, last, nil
+}
@@ -0,0 +1,302 @@
+//go:build !edge
+
+package logais
+
+/*
+Export bundle: a zip that checks itself.
+ data/...	recordings
+ logs/...	application log context, if asked for
+ metadata.json	what, when and where from
+ manifest.sha256	SHA-256 of every other file, sha256sum format
+ manifest.sig	optional Ed25519 signature of manifest.sha256, base64
+ manifest.pub	public key for the signature, base64
+Keys are made with: logais export -keygen name (writes name and name.pub)
+*/
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const bundleFormat = "logais-bundle-1"
+
+type bundleFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	First   time.Time `json:"first_record,omitzero"`
+	Last    time.Time `json:"last_record,omitzero"`
+	Records int       `json:"records,omitempty"`
+}
+
+type bundleMeta struct {
+	Format   string       `json:"format"`
+	Created  time.Time    `json:"created"`
+	Software string       `json:"software"`
+	Host     string       `json:"host"`
+	Station  string       `json:"station,omitempty"`
+	Command  string       `json:"command"`
+	Files    []bundleFile `json:"files"`
+}
+
+type bundleWriter struct {
+	f    *os.File
+	zw   *zip.Writer
+	sums map[string]string // zip name to hex sha256
+	meta bundleMeta
+}
+
+func newBundle(path string, command string) (*bundleWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	b := &bundleWriter{f: f, zw: zip.NewWriter(f), sums: make(map[string]string)}
+	b.meta = bundleMeta{Format: bundleFormat, Created: time.Now().UTC(), Software: "LogAIS v" + Version,
+		Host: host, Command: command}
+	if _, _, ok := Station.get(); ok {
+		b.meta.Station = Station.String()
+	}
+	return b, nil
+}
+
+func (b *bundleWriter) create(as string, modified time.Time) (io.Writer, func(), error) {
+	// zip entry that is hashed as it is written
+	w, err := b.zw.CreateHeader(&zip.FileHeader{Name: as, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return nil, nil, err
+	}
+	h := sha256.New()
+	done := func() { b.sums[as] = hex.EncodeToString(h.Sum(nil)) }
+	return io.MultiWriter(w, h), done, nil
+}
+
+func (b *bundleWriter) addFile(name string, as string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	w, done, err := b.create(as, info.ModTime())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, in); err != nil {
+		return err
+	}
+	done()
+	bf := bundleFile{Name: as, Size: info.Size()}
+	if strings.HasSuffix(name, ".csv") {
+		bf.First, bf.Last, bf.Records = recordingCount(name)
+	}
+	b.meta.Files = append(b.meta.Files, bf)
+	return nil
+}
+
+func (b *bundleWriter) addBytes(as string, data []byte) error {
+	w, done, err := b.create(as, time.Now())
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	done()
+	b.meta.Files = append(b.meta.Files, bundleFile{Name: as, Size: int64(len(data))})
+	return nil
+}
+
+func (b *bundleWriter) close(key ed25519.PrivateKey) error {
+	// metadata, manifest and signature, then finish the zip
+	meta, err := json.MarshalIndent(b.meta, "", " ")
+	if err != nil {
+		return err
+	}
+	w, done, err := b.create("metadata.json", time.Now())
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(meta); err != nil {
+		return err
+	}
+	done()
+
+	manifest := b.manifest()
+	if err = b.plain("manifest.sha256", manifest); err != nil {
+		return err
+	}
+	if key != nil {
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+		pub := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+		if err = b.plain("manifest.sig", []byte(sig+"\n")); err != nil {
+			return err
+		}
+		if err = b.plain("manifest.pub", []byte(pub+"\n")); err != nil {
+			return err
+		}
+	}
+	if err = b.zw.Close(); err != nil {
+		return err
+	}
+	return b.f.Close()
+}
+
+func (b *bundleWriter) manifest() []byte {
+	names := make([]string, 0, len(b.sums))
+	for name := range b.sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var m bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&m, "%s  %s\n", b.sums[name], name)
+	}
+	return m.Bytes()
+}
+
+func (b *bundleWriter) plain(as string, data []byte) error {
+	w, err := b.zw.CreateHeader(&zip.FileHeader{Name: as, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func recordingCount(name string) (time.Time, time.Time, int) {
+	var first, last time.Time
+	n := 0
+	rr, err := openRecording(name)
+	if err != nil {
+		return first, last, 0
+	}
+	defer rr.Close()
+	for {
+		rec, err := rr.Next()
+		if err != nil {
+			return first, last, n
+		}
+		if n == 0 {
+			first = rec.Time
+		}
+		last = rec.Time
+		n++
+	}
+}
+
+func keygen(name string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(name, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(name+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644)
+}
+
+func readKey(name string, public bool) ([]byte, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if public {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New(name + ": not an Ed25519 public key")
+		}
+		return key, nil
+	}
+	if len(key) != ed25519.SeedSize {
+		return nil, errors.New(name + ": not an Ed25519 private key")
+	}
+	return ed25519.NewKeyFromSeed(key), nil
+}
+
+func verifyBundle(path string, pubfile string) error {
+	// every file listed with the right hash, nothing unlisted, signature good if present
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	contents := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		contents[f.Name] = b
+	}
+	manifest, ok := contents["manifest.sha256"]
+	if !ok {
+		return errors.New("no manifest.sha256 in bundle")
+	}
+	listed := map[string]bool{"manifest.sha256": true, "manifest.sig": true, "manifest.pub": true}
+	for _, line := range strings.Split(strings.TrimSpace(string(manifest)), "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			return errors.New("bad manifest line: " + line)
+		}
+		data, ok := contents[name]
+		if !ok {
+			return errors.New("missing from bundle: " + name)
+		}
+		h := sha256.Sum256(data)
+		if hex.EncodeToString(h[:]) != sum {
+			return errors.New("checksum mismatch: " + name)
+		}
+		listed[name] = true
+	}
+	for name := range contents {
+		if !listed[name] {
+			return errors.New("not in manifest: " + name)
+		}
+	}
+
+	sig, signed := contents["manifest.sig"]
+	if !signed {
+		if pubfile != "" {
+			return errors.New("bundle is not signed")
+		}
+		return nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents["manifest.pub"])))
+	if pubfile != "" {
+		// trust the key we were given, not the one in the bundle
+		pub, err = readKey(pubfile, true)
+	}
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("no usable public key for the signature")
+	}
+	s, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(pub, manifest, s) {
+		return errors.New("signature does not match manifest")
+	}
+	return nil
+}
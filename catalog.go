@@ -0,0 +1,162 @@
+//go:build !edge
+
+package logais
+
+/*
+Catalog of finished daily files: stream, time range, record count, size,
+SHA-256 and upload status, so tools can look files up instead of walking and
+reading the archive. Kept in catalog.db (SQLite) in the data folder, brought up
+to date at startup and after each UTC midnight, and when days move to cold storage.
+ logais catalog [-update] [-day yyyy-mm-dd] [-stream port]
+Builds without cgo have no SQLite, the tools then walk the folders as before.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errNoCatalog = errors.New("catalog not available in this build (needs cgo for SQLite)")
+
+type CatalogEntry struct {
+	Path    string
+	Day     string // yyyy-mm-dd
+	Stream  string // port
+	Format  string // as logais du, csv, quality, geojsonl, ...
+	First   time.Time
+	Last    time.Time
+	Records int
+	Size    int64
+	SHA256  string
+	Upload  string // upload status, empty if not uploaded, cleared when the file changes
+}
+
+type catalogStore interface {
+	put(e *CatalogEntry) error
+	get(path string) (*CatalogEntry, bool)
+	byName(name string) (string, bool) // path of a daily file by its file name
+	find(day string, stream string) ([]CatalogEntry, error)
+	move(from string, to string) error // folder moved, eg to cold storage
+	remove(path string) error          // file or folder deleted, eg by retention
+	setUpload(path string, status string) error
+	Close() error
+}
+
+var Catalog catalogStore // open while recording, nil if not available
+
+func describeFile(path string) (*CatalogEntry, error) {
+	day, port, ok := dailyFileDay(filepath.Base(path))
+	if !ok {
+		return nil, errors.New("not a daily file: " + path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	e := &CatalogEntry{Path: path, Day: day.Format(time.DateOnly), Stream: port, Format: fileFormat(filepath.Base(path)),
+		Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	if filepath.Ext(strings.TrimSuffix(path, ".gz")) == ".csv" {
+		e.First, e.Last, e.Records = recordingCount(path)
+	}
+	return e, nil
+}
+
+func updateCatalog(cat catalogStore, now time.Time) (int, error) {
+	// catalog files of days before today that are new or have changed size
+	today := now.UTC().Format("20060102")
+	n := 0
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		day, _, ok := dailyFileDay(d.Name())
+		if !ok || day.Format("20060102") >= today {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if e, ok := cat.get(path); ok && e.Size == info.Size() {
+			return nil
+		}
+		e, err := describeFile(path)
+		if err != nil {
+			return err
+		}
+		n++
+		return cat.put(e)
+	}
+	for _, root := range archiveRoots() {
+		if err := filepath.WalkDir(root, walk); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func keepCatalog() {
+	// at start, then just after each UTC midnight when the daily files are finished
+	for {
+		n, err := updateCatalog(Catalog, time.Now())
+		if err != nil {
+			Logit.Error("updating catalog", "err", err)
+		}
+		if n > 0 {
+			Logit.Info("files added to the catalog", "files", n)
+		}
+		now := time.Now().UTC()
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 5, 0, 0, time.UTC)
+		time.Sleep(next.Sub(now))
+	}
+}
+
+func catalogCmd(args []string) int {
+	fset := flag.NewFlagSet("catalog", flag.ExitOnError)
+	update := fset.Bool("update", false, "catalog finished days now")
+	day := fset.String("day", "", "only this day, yyyy-mm-dd")
+	stream := fset.String("stream", "", "only this stream's port")
+	fset.Parse(args)
+	cat, err := openCatalog()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cat.Close()
+	if *update {
+		n, err := updateCatalog(cat, time.Now())
+		fmt.Printf("%d files catalogued\n", n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	entries, err := cat.find(*day, *stream)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, e := range entries {
+		span := ""
+		if e.Records > 0 {
+			span = e.First.Format("15:04:05") + "-" + e.Last.Format("15:04:05")
+		}
+		fmt.Printf("%s\t%d\t%s\t%s\t%s\t%s\n", e.Path, e.Records, span, humanBytes(e.Size), e.SHA256[:12], e.Upload)
+	}
+	return 0
+}
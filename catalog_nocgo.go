@@ -0,0 +1,9 @@
+//go:build !cgo && !edge
+
+package logais
+
+// no SQLite without cgo, tools walk the folders instead
+
+func openCatalog() (catalogStore, error) {
+	return nil, errNoCatalog
+}
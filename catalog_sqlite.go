@@ -0,0 +1,131 @@
+//go:build cgo && !edge
+
+package logais
+
+/*
+SQLite catalog store, see catalog.go
+*/
+
+import (
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	path TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	day TEXT NOT NULL,
+	stream TEXT NOT NULL,
+	format TEXT NOT NULL,
+	first TEXT,
+	last TEXT,
+	records INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	upload TEXT NOT NULL DEFAULT '',
+	cataloged TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS files_day ON files(day, stream);
+CREATE INDEX IF NOT EXISTS files_name ON files(name);
+`
+
+type sqliteCatalog struct {
+	db *sql.DB
+}
+
+func openCatalog() (catalogStore, error) {
+	db, err := sql.Open("sqlite3", Datapath+"catalog.db?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(catalogSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteCatalog{db: db}, nil
+}
+
+func (c *sqliteCatalog) put(e *CatalogEntry) error {
+	// a changed file needs uploading again
+	_, err := c.db.Exec(`INSERT INTO files (path, name, day, stream, format, first, last, records, size, sha256, cataloged)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET first = excluded.first, last = excluded.last, records = excluded.records,
+		size = excluded.size, cataloged = excluded.cataloged, sha256 = excluded.sha256,
+		upload = CASE WHEN files.sha256 = excluded.sha256 THEN files.upload ELSE '' END`,
+		e.Path, filepath.Base(e.Path), e.Day, e.Stream, e.Format, catalogTime(e.First), catalogTime(e.Last),
+		e.Records, e.Size, e.SHA256, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func catalogTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+const catalogColumns = "path, day, stream, format, first, last, records, size, sha256, upload"
+
+func scanEntry(row interface{ Scan(...any) error }) (*CatalogEntry, error) {
+	e := &CatalogEntry{}
+	var first, last string
+	err := row.Scan(&e.Path, &e.Day, &e.Stream, &e.Format, &first, &last, &e.Records, &e.Size, &e.SHA256, &e.Upload)
+	e.First, _ = time.Parse(time.RFC3339Nano, first)
+	e.Last, _ = time.Parse(time.RFC3339Nano, last)
+	return e, err
+}
+
+func (c *sqliteCatalog) get(path string) (*CatalogEntry, bool) {
+	e, err := scanEntry(c.db.QueryRow("SELECT "+catalogColumns+" FROM files WHERE path = ?", path))
+	return e, err == nil
+}
+
+func (c *sqliteCatalog) byName(name string) (string, bool) {
+	var path string
+	err := c.db.QueryRow("SELECT path FROM files WHERE name = ? ORDER BY cataloged DESC LIMIT 1", name).Scan(&path)
+	return path, err == nil
+}
+
+func (c *sqliteCatalog) find(day string, stream string) ([]CatalogEntry, error) {
+	rows, err := c.db.Query("SELECT "+catalogColumns+" FROM files WHERE (? = '' OR day = ?) AND (? = '' OR stream = ?) ORDER BY day, stream, path",
+		day, day, stream, stream)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []CatalogEntry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
+	}
+	return list, rows.Err()
+}
+
+func (c *sqliteCatalog) move(from string, to string) error {
+	from, to = filepath.Clean(from)+string(filepath.Separator), filepath.Clean(to)+string(filepath.Separator)
+	_, err := c.db.Exec("UPDATE files SET path = ? || substr(path, ?) WHERE substr(path, 1, ?) = ?",
+		to, len(from)+1, len(from), from)
+	return err
+}
+
+func (c *sqliteCatalog) remove(path string) error {
+	dir := filepath.Clean(path) + string(filepath.Separator)
+	_, err := c.db.Exec("DELETE FROM files WHERE path = ? OR substr(path, 1, ?) = ?", path, len(dir), dir)
+	return err
+}
+
+func (c *sqliteCatalog) setUpload(path string, status string) error {
+	_, err := c.db.Exec("UPDATE files SET upload = ? WHERE path = ?", status, path)
+	return err
+}
+
+func (c *sqliteCatalog) Close() error {
+	return c.db.Close()
+}
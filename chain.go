@@ -0,0 +1,304 @@
+//go:build !edge
+
+package logais
+
+/*
+Tamper-evident recordings, for incident and legal use. With the stream option
+ chain[=seconds]	every this many seconds (default 60) while records
+	are being written, and when the file closes, a line
+	# Chain 2026-10-16T10:30:00Z 1234 <sha256> [<signature>]
+	goes into the daily file giving the SHA-256 of everything in the file before
+	it and how many lines that aren't comments it has; the one written when the
+	file closes says "# Chain closed ..."
+ chain-key=file	and signs each one with this Ed25519 private key (PEM, eg from
+	openssl genpkey -algorithm ed25519 -out chain.key), so nobody without it can
+	write the lines again to match a changed file
+ logais verify [-key file] [-stream port] file|folder|yyyy-mm-dd|yyyy-mm ...
+reads the files through and checks every chain line, with the public key (or
+the private key) if given: a changed, added or removed byte breaks the first
+chain line after it, and a file cut short loses its closing line. Files still
+being written aren't closed yet, and one whose logger stopped without closing
+it (a power cut) looks truncated, the day's run-manifest.json tells which.
+A stream starting again during the day reads the file through to carry on its
+chain, warning if it doesn't verify. Compressed files verify as they are;
+purge and the warm standby's gap filling rewrite files, so a purged file no
+longer verifies (purge-audit.log records why) and chained files aren't filled.
+Not with vdr-strict or the output presets, which can't have comment lines.
+*/
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/config"
+)
+
+const chainPrefix = "# Chain "
+
+// a daily file's running hash, written out in chain lines
+type hashChain struct {
+	h      hash.Hash
+	name   string             // file name signed with each line, without .gz
+	key    ed25519.PrivateKey // nil to leave the lines unsigned
+	every  time.Duration
+	last   time.Time
+	lines  int // lines that aren't comments, hashed so far
+	sealed int // lines when the last chain line was written
+}
+
+func parseChainPublic(name string) (ed25519.PublicKey, error) {
+	// a public key, or the public half of a private one
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM key in " + name)
+	}
+	var k crypto.PublicKey
+	if strings.Contains(block.Type, "PRIVATE") {
+		priv, err := config.ReadChainKey(name)
+		if err != nil {
+			return nil, err
+		}
+		k = priv.Public()
+	} else if k, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return nil, err
+	}
+	pub, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 key: " + name)
+	}
+	return pub, nil
+}
+
+func chainName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".gz")
+}
+
+func (c *hashChain) add(text string) {
+	// bytes written to the file, nil safe for streams without the chain option
+	if c == nil {
+		return
+	}
+	c.h.Write([]byte(text))
+	for line := range strings.Lines(text) {
+		if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
+			c.lines++
+		}
+	}
+}
+
+func (c *hashChain) line(now time.Time, closed bool) string {
+	// the next chain line, for everything added so far
+	text := chainPrefix
+	if closed {
+		text += "closed "
+	}
+	text += now.UTC().Format(time.RFC3339) + " " + strconv.Itoa(c.lines) + " " + hex.EncodeToString(c.h.Sum(nil))
+	if c.key != nil {
+		text += " " + base64.StdEncoding.EncodeToString(ed25519.Sign(c.key, []byte(c.name+" "+text)))
+	}
+	c.last, c.sealed = now, c.lines
+	return text + "\r\n"
+}
+
+func (c *hashChain) due(now time.Time) bool {
+	return c != nil && c.lines > c.sealed && now.Sub(c.last) >= c.every
+}
+
+func openChain(path string, o *Options, size int64) (*hashChain, *chainCheck, error) {
+	// the chain for a stream's daily file of size bytes, carried on from what's in it
+	c := &hashChain{h: sha256.New(), name: chainName(path), every: o.Chain, last: time.Now()}
+	if o.ChainKey != "" {
+		var err error
+		if c.key, err = config.ReadChainKey(o.ChainKey); err != nil {
+			return nil, nil, err
+		}
+	}
+	if size == 0 {
+		return c, nil, nil
+	}
+	var pub ed25519.PublicKey
+	if c.key != nil {
+		pub = c.key.Public().(ed25519.PublicKey)
+	}
+	check, err := verifyChain(path, pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.h, c.lines, c.sealed = check.h, check.lines, check.lines
+	return c, check, nil
+}
+
+// what verifying a file found
+type chainCheck struct {
+	h         hash.Hash
+	lines     int    // lines that aren't comments
+	chains    int    // chain lines that matched
+	signed    bool   // and were signed
+	closed    bool   // the file ends with a closing chain line
+	uncovered int    // lines after the last chain line
+	broken    string // the first chain line that didn't match, empty if none
+}
+
+func verifyChain(path string, pub ed25519.PublicKey) (*chainCheck, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		if in, err = gzip.NewReader(bufio.NewReaderSize(f, 65536)); err != nil {
+			return nil, err
+		}
+	}
+	rd := bufio.NewReaderSize(in, 65536)
+	check := &chainCheck{h: sha256.New(), signed: pub != nil}
+	name := chainName(path)
+	for n := 1; ; n++ {
+		line, err := rd.ReadString('\n')
+		if line == "" && err == io.EOF {
+			return check, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, chainPrefix) {
+			if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
+				check.lines++
+				check.uncovered++
+			}
+			check.closed = false
+			check.h.Write([]byte(line))
+			continue
+		}
+		if check.broken == "" {
+			if why := check.match(name, strings.TrimRight(line, "\r\n"), pub); why != "" {
+				check.broken = "line " + strconv.Itoa(n) + ": " + why
+			} else {
+				check.chains++
+			}
+		}
+		check.closed = strings.HasPrefix(line, chainPrefix+"closed ")
+		check.uncovered = 0
+		check.h.Write([]byte(line))
+	}
+}
+
+func (check *chainCheck) match(name string, line string, pub ed25519.PublicKey) string {
+	// why a chain line doesn't fit what came before it, empty if it does
+	f := strings.Fields(strings.TrimPrefix(line, chainPrefix))
+	if len(f) > 0 && f[0] == "closed" {
+		f = f[1:]
+	}
+	if len(f) < 3 {
+		return "not a chain line"
+	}
+	if n, err := strconv.Atoi(f[1]); err != nil || n != check.lines {
+		return "chain line counts " + f[1] + " lines, the file has " + strconv.Itoa(check.lines) + " before it"
+	}
+	if f[2] != hex.EncodeToString(check.h.Sum(nil)) {
+		return "SHA-256 doesn't match, something before it was changed"
+	}
+	if pub == nil {
+		return ""
+	}
+	if len(f) < 4 {
+		return "not signed"
+	}
+	sig, err := base64.StdEncoding.DecodeString(f[3])
+	signed := strings.TrimSuffix(line, " "+f[3])
+	if err != nil || !ed25519.Verify(pub, []byte(name+" "+signed), sig) {
+		return "signature doesn't match the key"
+	}
+	return ""
+}
+
+func chained(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, chainPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyCmd(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyFile := fs.String("key", "", "Ed25519 public (or private) key `file` to check the signatures with")
+	stream := fs.String("stream", "", "only this stream's files, by port, for days and folders")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais verify [options] file|folder|yyyy-mm-dd|yyyy-mm ...\n")
+		fs.PrintDefaults()
+	}
+	args = parseInterleaved(fs, args)
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	var pub ed25519.PublicKey
+	var err error
+	if *keyFile != "" {
+		if pub, err = parseChainPublic(*keyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	files, err := statsFiles(args, *stream)
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("no recordings found for %s", strings.Join(args, " "))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, name := range files {
+		check, err := verifyChain(name, pub)
+		var problem string
+		switch {
+		case err != nil:
+			problem = err.Error()
+		case check.broken != "":
+			problem = "CHANGED, " + check.broken
+		case check.chains == 0:
+			problem = "no chain lines, not recorded with the chain option"
+		case !check.closed && check.uncovered > 0:
+			problem = "NOT CLOSED, " + strconv.Itoa(check.uncovered) + " lines after the last chain line: truncated, still being written or its logger stopped without closing it"
+		case !check.closed:
+			problem = "NOT CLOSED after its last chain line: truncated there, still being written or its logger stopped without closing it"
+		}
+		if problem != "" {
+			fmt.Printf("%s: %s\n", name, problem)
+			status = 1
+			continue
+		}
+		how := "unsigned"
+		if check.signed {
+			how = "signature ok"
+		}
+		fmt.Printf("%s: ok, %d lines, %d chain lines, %s\n", name, check.lines, check.chains, how)
+	}
+	return status
+}
@@ -0,0 +1,95 @@
+//go:build !edge
+
+package logais
+
+/*
+Config check without recording, for after editing the config file:
+ logais check
+reads the config as the recorder would and reports what it would skip or
+trip over: errors, lines without a description, duplicate and out of range
+ports, merged streams naming missing ports, and folders it can't write to.
+Exits 1 if there is anything to fix. No sockets are opened, so it can run
+next to the recorder. The recorder logs the same problems as warnings when it starts.
+*/
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"example.com/logais/config"
+)
+
+func checkCmd(args []string) int {
+	fset := flag.NewFlagSet("check", flag.ExitOnError)
+	strict := fset.Bool("strict", false, "exit 1 on lint warnings too")
+	fset.Parse(args)
+	path := configPath()
+	conf, err := readConfig(path)
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return 1
+	}
+	problems := checkConfig(path, conf)
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", path, p)
+	}
+	lint := config.Lint(conf.Config)
+	for _, f := range lint {
+		fmt.Printf("%s: warning %s\n", path, f)
+	}
+	if len(problems) > 0 || *strict && len(lint) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: ok, %d streams\n", path, len(conf.Streams))
+	return 0
+}
+
+func checkConfig(path string, conf *Config) []string {
+	// problems with a config readConfig accepted
+	var problems []string
+	if !config.IsTOML(path) {
+		// lines the tab separated reader skips
+		content, _ := config.Content(path)
+		problems = config.Skipped(content)
+	}
+	seen := make(map[string]bool)
+	for _, st := range conf.Streams {
+		if seen[st.Port] {
+			problems = append(problems, "port "+st.Port+" is used by more than one stream, only the first can listen")
+		}
+		seen[st.Port] = true
+		if _, err := checkPort(st.Port); err != nil {
+			problems = append(problems, "port "+st.Port+" is not a port from 1025 to 65535, stream skipped")
+		}
+	}
+	if err := checkMerges(conf.Streams); err != nil {
+		problems = append(problems, err.Error())
+	}
+	// the log folder is made if it's missing, the others must be there
+	logDir := filepath.Clean(Logpath)
+	for _, err := os.Stat(logDir); os.IsNotExist(err) && filepath.Dir(logDir) != logDir; _, err = os.Stat(logDir) {
+		logDir = filepath.Dir(logDir)
+	}
+	dirs := []string{Datapath, logDir}
+	if conf.Cold != nil {
+		dirs = append(dirs, conf.Cold.Path)
+	}
+	for _, dir := range dirs {
+		if err := checkWritable(dir); err != nil {
+			problems = append(problems, "can't write to "+dir+": "+err.Error())
+		}
+	}
+	return problems
+}
+
+func checkWritable(dir string) error {
+	// by writing a file, permissions alone don't say, eg on a read-only mount
+	f, err := os.CreateTemp(dir, ".logais-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,186 @@
+//go:build !edge
+
+package logais
+
+/*
+The station clock, as recorded timestamps are only as good as it is. It is
+checked at startup and every clockInterval: the system's own synchronization
+status where it can be read (Linux, as ntpd, chrony or systemd-timesyncd set
+it in the kernel), or with the config line
+ ntp <tab> server [server ...] [<tab> seconds]
+the offset from the first of these NTP servers to answer, unsynchronized when
+it is more than seconds off (default clockMaxOffset). If none answers, eg a
+ship out of reach of the internet, the system's status is used, and without
+that the clock counts as unsynchronized.
+While it's unsynchronized a warning is logged at each check; going out of sync
+also raises an alert and puts a "# Clock unsynchronized" line in each stream's
+daily file, and coming back a "# Clock synchronized" one. New daily files say
+how the clock was in a "# Clock:" header line. /api/status has the last check.
+Where there's no ntp line and the system's status can't be read nothing is
+flagged. A reload takes a changed ntp line at the next check.
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clockInterval = 10 * time.Minute
+	ntpTimeout    = 3 * time.Second
+	ntpEpoch      = 2208988800 // seconds from 1900, where NTP times start, to 1970
+)
+
+type clockStatus struct {
+	Checked time.Time `json:"checked"`
+	Synced  bool      `json:"synchronized"`
+	Source  string    `json:"source"`           // system, or the NTP server
+	Offset  *float64  `json:"offset,omitempty"` // seconds the NTP server is ahead
+	Problem string    `json:"problem,omitempty"`
+}
+
+var Clock atomic.Pointer[clockStatus] // last check, nil if the clock can't be checked
+
+func ntpTime(t time.Time) uint64 {
+	return uint64(t.Unix()+ntpEpoch)<<32 | uint64(t.Nanosecond())<<32/1e9
+}
+
+func fromNTP(b []byte) time.Time {
+	v := binary.BigEndian.Uint64(b)
+	return time.Unix(int64(v>>32)-ntpEpoch, int64((v&0xffffffff)*1e9>>32))
+}
+
+func queryNTP(server string) (time.Duration, error) {
+	// how far ahead of this clock the server's is, by SNTP (RFC 4330)
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ntpTimeout))
+	req := make([]byte, 48)
+	req[0] = 4<<3 | 3 // version 4, client
+	sent := time.Now()
+	binary.BigEndian.PutUint64(req[40:], ntpTime(sent))
+	if _, err = conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	back := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case n < 48 || resp[0]&7 != 4 || string(resp[24:32]) != string(req[40:48]):
+		return 0, errors.New("not an answer to the query")
+	case resp[0]>>6 == 3 || resp[1] == 0 || resp[1] > 15:
+		return 0, errors.New("the server isn't synchronized itself")
+	}
+	recv, xmit := fromNTP(resp[32:40]), fromNTP(resp[40:48])
+	return (recv.Sub(sent) + xmit.Sub(back)) / 2, nil
+}
+
+func checkClock(n *NTPCheck) *clockStatus {
+	now := time.Now().UTC()
+	var failed []string
+	if n != nil {
+		for _, server := range n.Servers {
+			offset, err := queryNTP(server)
+			if err != nil {
+				Logit.Debug("NTP server didn't answer", "server", server, "err", err)
+				failed = append(failed, server)
+				continue
+			}
+			secs := offset.Seconds()
+			s := &clockStatus{Checked: now, Synced: offset.Abs() <= n.MaxOffset, Source: server, Offset: &secs}
+			if !s.Synced {
+				s.Problem = fmt.Sprintf("%.3f s off %s, more than the %g s allowed", offset.Abs().Seconds(), server, n.MaxOffset.Seconds())
+			}
+			return s
+		}
+	}
+	problem := ""
+	if n != nil {
+		problem = "no answer from " + strings.Join(failed, ", ") + "; "
+	}
+	synced, known := systemClockSynced()
+	switch {
+	case known && synced:
+		return &clockStatus{Checked: now, Synced: true, Source: "system"}
+	case known:
+		return &clockStatus{Checked: now, Source: "system", Problem: problem + "the system clock isn't synchronized (no NTP daemon, or it can't reach a time source)"}
+	case n != nil:
+		return &clockStatus{Checked: now, Source: "ntp", Problem: strings.TrimSuffix(problem, "; ")}
+	}
+	return nil
+}
+
+func (s *clockStatus) header() string {
+	// the file header line, empty if the clock can't be checked
+	switch {
+	case s == nil:
+		return ""
+	case s.Synced:
+		return "# Clock: synchronized (" + s.Source + ", checked " + s.Checked.Format(timeLayout) + ")\r\n"
+	}
+	return "# Clock: NOT SYNCHRONIZED, " + s.Problem + " (checked " + s.Checked.Format(timeLayout) + ")\r\n"
+}
+
+func startClock() {
+	// the first check before the streams start, so their files have it
+	s := checkClock(Conf.NTP)
+	Clock.Store(s)
+	switch {
+	case s == nil:
+		Logit.Info("clock synchronization can't be checked here, add an ntp line to check it")
+	case s.Synced:
+		Logit.Info("clock synchronized", "source", s.Source)
+	default:
+		Logit.Warn("CLOCK NOT SYNCHRONIZED, timestamps recorded may be wrong", "problem", s.Problem)
+		Events.publish(EventAlert, "", "clock not synchronized: "+s.Problem)
+	}
+	go keepClock()
+}
+
+func keepClock() {
+	for {
+		time.Sleep(clockInterval)
+		s := checkClock(currentConfig().NTP)
+		was := Clock.Swap(s)
+		switch {
+		case s == nil || s.Synced && (was == nil || was.Synced):
+		case s.Synced:
+			Logit.Info("clock synchronized again", "source", s.Source)
+			clockNote("# Clock synchronized: " + s.Checked.Format(timeLayout) + " " + s.Source + "\r\n")
+		case was == nil || was.Synced:
+			Logit.Warn("CLOCK NOT SYNCHRONIZED, timestamps recorded may be wrong", "problem", s.Problem)
+			Events.publish(EventAlert, "", "clock not synchronized: "+s.Problem)
+			clockNote("# Clock unsynchronized: " + s.Checked.Format(timeLayout) + " " + s.Problem + "\r\n")
+		default:
+			Logit.Warn("CLOCK STILL NOT SYNCHRONIZED, timestamps recorded may be wrong", "problem", s.Problem)
+		}
+	}
+}
+
+func clockNote(line string) {
+	// into every daily file that can take comments
+	for _, st := range liveStreams() {
+		if st.opts().VdrStrict || st.opts().Output != "" {
+			continue
+		}
+		select {
+		case st.notes <- line:
+		default:
+			Logit.Warn("clock note not written, the stream is behind", "port", st.Port)
+		}
+	}
+}
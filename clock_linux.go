@@ -0,0 +1,19 @@
+//go:build !edge
+
+package logais
+
+// the kernel's clock synchronization status, as the NTP daemon keeps it
+
+import "syscall"
+
+const timeError = 5 // adjtimex's TIME_ERROR, the clock isn't synchronized
+
+func systemClockSynced() (bool, bool) {
+	// synchronized, and whether that could be read
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return false, false
+	}
+	return state != timeError, true
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !edge
+
+package logais
+
+// no clock synchronization status, only the ntp line's servers
+
+func systemClockSynced() (bool, bool) {
+	return false, false
+}
@@ -0,0 +1,166 @@
+//go:build !edge
+
+package logais
+
+/*
+Cluster mode for loggers feeding shared sinks (a database or message queue
+every logger can reach): each stream is owned by one live logger, which alone
+writes it to shared sinks, so failover doesn't double-write. Daily files are
+still written by every logger.
+Every logger gets the same member list and runs with -http, eg
+ node <tab> shore1 <tab> http://shore1:8080
+ node <tab> shore2 <tab> http://shore2:8080
+A logger is the member named by -node, default the host name. Members check
+each other every few seconds through /api/cluster; a stream belongs to the live
+member with the highest hash of member name and port (rendezvous hashing), so
+a failure only moves that member's streams.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clusterBeat    = 5 * time.Second
+	clusterTimeout = 15 * time.Second // member counted as down after this long without an answer
+)
+
+type cluster struct {
+	self  string
+	nodes []Node
+
+	mu    sync.RWMutex
+	seen  map[string]time.Time // last answer from each member
+	owned map[string]bool      // streams this logger owns
+}
+
+var Cluster *cluster // nil if not in a cluster
+
+type clusterStatus struct {
+	Node  string   `json:"node"`
+	Alive []string `json:"alive"`
+	Owns  []string `json:"owns"`
+}
+
+func newCluster(self string, nodes []Node) (*cluster, error) {
+	for _, n := range nodes {
+		if n.Name == self {
+			return &cluster{self: self, nodes: nodes, seen: make(map[string]time.Time), owned: make(map[string]bool)}, nil
+		}
+	}
+	return nil, errors.New("this logger, " + self + ", is not one of the config file's nodes (use -node name)")
+}
+
+func (c *cluster) owns(port string) bool {
+	// whether this logger writes port to shared sinks, always true outside a cluster
+	if c == nil {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.owned[port]
+}
+
+func (c *cluster) alive(now time.Time) []string {
+	var names []string
+	for _, n := range c.nodes {
+		if n.Name == c.self || now.Sub(c.seen[n.Name]) < clusterTimeout {
+			names = append(names, n.Name)
+		}
+	}
+	return names
+}
+
+func owner(alive []string, port string) string {
+	best, bestHash := "", uint64(0)
+	for _, name := range alive {
+		sum := sha256.Sum256([]byte(name + "\x00" + port))
+		if v := binary.BigEndian.Uint64(sum[:8]); best == "" || v > bestHash {
+			best, bestHash = name, v
+		}
+	}
+	return best
+}
+
+func (c *cluster) status() clusterStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := clusterStatus{Node: c.self, Alive: c.alive(time.Now()), Owns: []string{}}
+	for port := range c.owned {
+		s.Owns = append(s.Owns, port)
+	}
+	sort.Strings(s.Owns)
+	return s
+}
+
+func (c *cluster) beat(client *http.Client) {
+	// ask every other member, then work out which streams are ours
+	for _, n := range c.nodes {
+		if n.Name == c.self {
+			continue
+		}
+		resp, err := client.Get(strings.TrimRight(n.URL, "/") + "/api/cluster")
+		if err != nil {
+			continue
+		}
+		var s clusterStatus
+		err = json.NewDecoder(resp.Body).Decode(&s)
+		resp.Body.Close()
+		if err == nil && resp.StatusCode == http.StatusOK && s.Node == n.Name {
+			c.mu.Lock()
+			c.seen[n.Name] = time.Now()
+			c.mu.Unlock()
+		}
+	}
+
+	c.mu.Lock()
+	alive := c.alive(time.Now())
+	var gained, lost []string
+	for _, st := range Conf.Streams {
+		mine := owner(alive, st.Port) == c.self
+		if mine && !c.owned[st.Port] {
+			gained = append(gained, st.Port)
+		}
+		if !mine && c.owned[st.Port] {
+			lost = append(lost, st.Port)
+		}
+		if mine {
+			c.owned[st.Port] = true
+		} else {
+			delete(c.owned, st.Port)
+		}
+	}
+	c.mu.Unlock()
+	if len(gained) > 0 {
+		Logit.Info("cluster: now writing shared sinks", "ports", strings.Join(gained, ","), "members_up", strings.Join(alive, ","))
+		Events.publish(EventHandover, "", "now writing "+strings.Join(gained, ","))
+	}
+	if len(lost) > 0 {
+		Logit.Info("cluster: handed over", "ports", strings.Join(lost, ","), "members_up", strings.Join(alive, ","))
+		Events.publish(EventHandover, "", "handed over "+strings.Join(lost, ","))
+	}
+}
+
+func (c *cluster) run() {
+	client := &http.Client{Timeout: clusterBeat}
+	for {
+		c.beat(client)
+		time.Sleep(clusterBeat)
+	}
+}
+
+func clusterHandler(w http.ResponseWriter, r *http.Request) {
+	if Cluster == nil {
+		http.Error(w, "not in a cluster", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, Cluster.status())
+}
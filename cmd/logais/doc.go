@@ -0,0 +1,4 @@
+// Command logais records AIS and NMEA 0183 streams to daily files, and has
+// the tools for working on them; built with -tags edge it's the edge agent.
+// The recorder is package logais, see there.
+package main
@@ -0,0 +1,54 @@
+//go:build edge
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"example.com/logais"
+)
+
+func main() {
+	var s logais.EdgeSettings
+	flag.Func("udp", "UDP `port` to listen on, can be repeated", func(v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("not a port: %s", v)
+		}
+		s.UDP = append(s.UDP, v)
+		return nil
+	})
+	flag.Func("serial", "serial `device` to read NMEA lines from, can be repeated", func(v string) error {
+		s.Serial = append(s.Serial, v)
+		return nil
+	})
+	flag.StringVar(&s.Push, "push", "", "collector `URL`, eg https://central:8080/api/ingest/10110")
+	flag.StringVar(&s.PushToken, "push-token", "", "bearer `token` for the collector")
+	flag.StringVar(&s.PushCA, "push-ca", "", "PEM `file` of the CAs to check the collector's certificate against instead of the system's")
+	flag.StringVar(&s.PushCert, "push-cert", "", "PEM `file` of a client certificate to present to the collector")
+	flag.StringVar(&s.PushKey, "push-key", "", "PEM `file` of the client certificate's key")
+	flag.StringVar(&s.LogLevel, "log-level", os.Getenv("LOGAIS_LOG_LEVEL"), "least important log entries written: debug, info, warning or error")
+	flag.StringVar(&s.LogFormat, "log-format", os.Getenv("LOGAIS_LOG_FORMAT"), "log as text lines or json")
+	flag.Parse()
+	if s.Push == "" || len(s.UDP)+len(s.Serial) == 0 {
+		fmt.Fprintln(os.Stderr, "logais-edge needs -push and at least one -udp or -serial input")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	quit := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		close(quit)
+	}()
+	if err := logais.Edge(s, quit); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,114 @@
+//go:build !edge
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/logais"
+)
+
+func main() {
+	// tools that work on recordings rather than recording
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if tool := logais.Tool(os.Args[1]); tool != nil {
+			os.Exit(tool(os.Args[2:]))
+		}
+	}
+
+	var s logais.Settings
+	hostname, _ := os.Hostname()
+	flag.StringVar(&s.Profile, "profile", logais.DefaultProfile, "name of the config file profile to start with")
+	flag.StringVar(&s.HTTP, "http", os.Getenv("LOGAIS_HTTP"), "serve the monitoring API on this address, eg :8080 (or set LOGAIS_HTTP)")
+	flag.StringVar(&s.Node, "node", hostname, "this logger's name in the config file's cluster nodes")
+	flag.BoolVar(&s.Watch, "watch", false, "reload the config file when it changes, as SIGHUP does (for Windows)")
+	flag.StringVar(&s.Config, "config", "", "config `file` (default LogAIS.toml or LogAIS.txt in the data folder, or $LOGAIS_CONFIG)")
+	flag.StringVar(&s.DataDir, "data-dir", "", "`folder` for recordings (default "+logais.Datapath+", or $LOGAIS_DATA_DIR)")
+	flag.StringVar(&s.LogDir, "log-dir", "", "`folder` for the log file (default "+logais.Logpath+", or $LOGAIS_LOG_DIR)")
+	flag.StringVar(&s.Storage, "storage", "local", "where streams write their files: local (the data folder) or memory")
+	flag.Bool("container", logais.Container, "log to stdout, data in /data, config from $LOGAIS_CONFIG_TOML (or set LOGAIS_CONTAINER=1)")
+	flag.StringVar(&s.LogLevel, "log-level", os.Getenv("LOGAIS_LOG_LEVEL"), "least important log entries written: debug, info, warning or error (default info, or $LOGAIS_LOG_LEVEL)")
+	flag.StringVar(&s.LogFormat, "log-format", os.Getenv("LOGAIS_LOG_FORMAT"), "log as text lines or json (default text, or $LOGAIS_LOG_FORMAT)")
+	flag.Parse()
+
+	if !logais.Container {
+		// trap panics etc
+		logais.LogOpened = func(f *os.File) { os.Stderr = f }
+	}
+	// relative file names in the config, eg certificates, are in the data folder
+	for _, p := range []*string{&s.Config, &s.DataDir, &s.LogDir} {
+		if *p != "" {
+			*p, _ = filepath.Abs(*p)
+		}
+	}
+	dir := logais.Datapath
+	if s.DataDir != "" {
+		dir = s.DataDir
+	}
+	os.Chdir(dir) // if it isn't there Start says so
+	if err := logais.Start(s); err != nil {
+		abort(err.Error())
+	}
+	os.Chdir(logais.Datapath) // a container's fresh volume is made by Start
+	go watchSignals()
+
+	if !logais.Container {
+		fmt.Printf("%s Z\n", time.Now().UTC().Format(time.DateTime))
+		fmt.Printf("\t\tAll processes started\n")
+		fmt.Printf("\t\t****** DO NOT CLOSE THIS WINDOW! ******\n")
+		fmt.Printf("\t\tunless the command prompt has returned!\n\n")
+	}
+	logais.Wait()
+}
+
+func abort(text string) {
+	// Start failed, the log may not be open, tries to log it, ignore errors
+	if logais.Container {
+		fmt.Fprintln(os.Stderr, text)
+		os.Exit(1)
+	}
+	lhandle, _ := os.OpenFile(logais.Logpath+logais.LogfName+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	logx := log.New(lhandle, "UTC ", log.LUTC|log.LstdFlags|log.Lmsgprefix)
+	logx.Print("Fatal: " + text)
+	lhandle.Close()
+	fmt.Printf("Exiting program, error: %s\n", text)
+	os.Exit(1)
+}
+
+func watchSignals() {
+	// Ctrl-C or SIGTERM (systemd, docker stop) stops, SIGHUP reloads the config
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range sig {
+		if s == syscall.SIGHUP {
+			logais.Logit.Info("SIGHUP, reloading config")
+			go logais.Reload()
+			continue
+		}
+		logais.Logit.Info("stopping all streams", "signal", s.String())
+		go func() {
+			for s2 := range sig {
+				if s2 != syscall.SIGHUP {
+					logais.Logit.Warn("second signal, exiting without waiting for the streams", "signal", s2.String())
+					logais.Logfile.Close()
+					os.Exit(1)
+				}
+			}
+		}()
+		if err := logais.Stop(); err != nil {
+			logais.Logit.Warn("exiting anyway", "err", err)
+			logais.Logfile.Close()
+			os.Exit(1)
+		}
+		// Wait finishes up
+		return
+	}
+}
@@ -0,0 +1,220 @@
+//go:build !edge
+
+package logais
+
+/*
+Cold storage: day folders older than a number of days are moved from the data
+folder to a secondary path, eg an archive disk, configured with
+ coldstore <tab> path <tab> days
+Moved days are listed in coldstore.json in the data folder so the tools (play,
+export, du, purge) still find them, by name or yyyy/mm/dd path, without reading
+the config file.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/rotation"
+)
+
+// day folder, yyyy/mm/dd with the local separator, to the root it was moved to
+type coldIndex map[string]string
+
+func coldIndexPath() string {
+	return Datapath + "coldstore.json"
+}
+
+func loadColdIndex() coldIndex {
+	ci := make(coldIndex)
+	if b, err := os.ReadFile(coldIndexPath()); err == nil {
+		json.Unmarshal(b, &ci)
+	}
+	return ci
+}
+
+func (ci coldIndex) save() error {
+	b, err := json.MarshalIndent(ci, "", " ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(coldIndexPath()+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(coldIndexPath()+".tmp", coldIndexPath())
+}
+
+func archiveRoots() []string {
+	// the data folder then every cold storage folder days have been moved to
+	roots := []string{Datapath}
+	seen := map[string]bool{Datapath: true}
+	ci := loadColdIndex()
+	days := make([]string, 0, len(ci))
+	for day := range ci {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		if !seen[ci[day]] {
+			seen[ci[day]] = true
+			roots = append(roots, ci[day])
+		}
+	}
+	return roots
+}
+
+func recordingAt(path string) (string, bool) {
+	// path, or path.gz once retention has compressed it
+	for _, p := range []string{path, path + ".gz"} {
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return path, false
+}
+
+func findRecording(name string) string {
+	// name as given if it exists, otherwise a daily file name looked up in the catalog, then the data and cold storage folders
+	if path, ok := recordingAt(name); ok {
+		return path
+	}
+	day, _, ok := dailyFileDay(filepath.Base(name))
+	if !ok {
+		return name
+	}
+	cat := Catalog
+	if cat == nil {
+		if c, err := openCatalog(); err == nil {
+			defer c.Close()
+			cat = c
+		}
+	}
+	if cat != nil {
+		if path, ok := cat.byName(filepath.Base(name)); ok {
+			if path, ok = recordingAt(path); ok {
+				return path
+			}
+		}
+	}
+	dir := rotation.Folder(day)
+	for _, root := range archiveRoots() {
+		if path, ok := recordingAt(filepath.Join(root, dir, filepath.Base(name))); ok {
+			return path
+		}
+	}
+	return name
+}
+
+func copyFile(from string, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(to+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, in)
+	if err == nil && n != info.Size() {
+		err = errors.New("size changed while copying " + from)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(to + ".tmp")
+		return err
+	}
+	os.Chtimes(to+".tmp", info.ModTime(), info.ModTime())
+	return os.Rename(to+".tmp", to)
+}
+
+func moveDay(day string, cold string) error {
+	// copy then delete, the cold store is usually another disk
+	from := Datapath + day
+	to := filepath.Join(cold, day)
+	if err := os.MkdirAll(to, 0775); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err = copyFile(filepath.Join(from, e.Name()), filepath.Join(to, e.Name())); err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			os.Remove(filepath.Join(from, e.Name()))
+		}
+	}
+	os.Remove(from)
+	return nil
+}
+
+func tierOld(cs ColdStore, now time.Time) (int, error) {
+	// move day folders older than cs.Days, returns the number moved
+	// the cold store folder must already exist so an unmounted disk isn't filled in
+	if info, err := os.Stat(cs.Path); err != nil || !info.IsDir() {
+		return 0, errors.New("cold storage folder not found, not mounted?")
+	}
+	cutoff := rotation.Folder(now.UTC().AddDate(0, 0, -cs.Days))
+	dirs, _ := filepath.Glob(Datapath + "[0-9][0-9][0-9][0-9]" + Sep + "[0-9][0-9]" + Sep + "[0-9][0-9]")
+	ci := loadColdIndex()
+	moved := 0
+	for _, dir := range dirs {
+		day := strings.TrimPrefix(dir, Datapath)
+		if day >= cutoff {
+			continue
+		}
+		if err := moveDay(day, cs.Path); err != nil {
+			return moved, err
+		}
+		ci[day] = cs.Path
+		if Catalog != nil {
+			if err := Catalog.move(Datapath+day, filepath.Join(cs.Path, day)); err != nil {
+				Logit.Error("updating catalog", "day", day, "err", err)
+			}
+		}
+		moved++
+		if err := ci.save(); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+func keepTiering(cs ColdStore) {
+	// check at start and then daily
+	for {
+		n, err := tierOld(cs, time.Now())
+		if err != nil {
+			Logit.Error("moving old days to cold storage", "dir", cs.Path, "err", err)
+		}
+		if n > 0 {
+			Logit.Info("day folders moved to cold storage", "days", n, "dir", cs.Path)
+			Events.publish(EventUploaded, "", strconv.Itoa(n)+" day folders moved to cold storage "+cs.Path)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
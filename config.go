@@ -0,0 +1,166 @@
+//go:build !edge
+
+package logais
+
+/*
+The config as running: the streams of the config file with their effective
+options, which change with the profile, and the profile schedule. The file
+itself is read and checked by package config, which describes its lines.
+*/
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/logais/config"
+	"example.com/logais/input"
+)
+
+const DefaultProfile = config.DefaultProfile
+
+type (
+	Options       = config.Options
+	Profile       = config.Profile
+	ScheduleEntry = config.ScheduleEntry
+	ColdStore     = config.ColdStore
+	Node          = config.Node
+	RestartSpec   = config.RestartSpec
+	LowDisk       = config.LowDisk
+	NTPCheck      = config.NTPCheck
+	SyslogTarget  = config.SyslogTarget
+	LogRotate     = config.LogRotate
+	QualitySpec   = config.QualitySpec
+)
+
+type Stream struct {
+	config.Stream // port, description and options as in the config file
+
+	eff    atomic.Pointer[Options] // effective options, stream options with active profile applied
+	stats  streamStats
+	inside map[uint32]bool // geofence, whether each vessel was last seen inside
+	dupes  *seenCache      // recently written messages for dedup
+	rate   *rateLimit      // last position report of each vessel for rate
+
+	mergeIn  chan mergedGroup           // messages from the streams merged into this one
+	mergeTo  atomic.Pointer[[]*Stream]  // merged streams taking this one's messages
+	quit     chan struct{}              // closed to stop the stream, see reload.go
+	stopped  chan struct{}              // closed when it has
+	beat     atomic.Int64               // last time round the stream's loop, UnixNano, for the systemd watchdog
+	notes    chan string                // annotation lines for the data file, see annotate.go
+	bound    atomic.Bool                // listening, or its feed or merge started, see health.go
+	heard    atomic.Int64               // last time anything arrived, UnixNano
+	writeErr atomic.Pointer[writeError] // last error writing its files
+	file     atomic.Pointer[string]     // current data file, for the dashboard
+	paused   atomic.Bool                // recording nothing, see control.go
+	halted   atomic.Bool                // stopped through the control API
+	roll     chan struct{}              // rollover asked for through the control API
+	relays   *relay                     // relay sockets and addresses
+	feed     <-chan input.Datagram      // network feed, kept when the stream is restarted, see supervise.go
+	server   *tcpServer                 // tcp-serve clients, kept likewise
+	pusher   *pusher                    // batches for the push option
+	seq      uint64                     // last sentence number for seq
+}
+
+// a config file and its streams
+type Config struct {
+	*config.Config
+	Streams []*Stream // shadows the file's streams, the same in the same order
+}
+
+var (
+	Conf       *Config
+	ActiveProf = DefaultProfile
+	profMutex  sync.Mutex
+)
+
+func newStream(cs config.Stream) *Stream {
+	return &Stream{Stream: cs, quit: make(chan struct{}), stopped: make(chan struct{}),
+		notes: make(chan string, noteBuffer), roll: make(chan struct{}, 1)}
+}
+
+func readConfig(fname string) (*Config, error) {
+	c, err := config.Read(fname)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{Config: c}
+	for _, cs := range c.Streams {
+		conf.Streams = append(conf.Streams, newStream(*cs))
+	}
+	return conf, nil
+}
+
+func wantNMEA(o *Options, sentence string) bool {
+	// a $ sentence the nmea or dsc option asks for, by formatter from any talker or by talker and formatter
+	if o.DSC && isDSC(sentence) {
+		return true
+	}
+	if o.NMEA == nil || !strings.HasPrefix(sentence, "$") {
+		return false
+	}
+	typ := sentenceType(sentence)
+	return o.NMEA["*"] || o.NMEA[typ] || len(typ) == 5 && o.NMEA[typ[2:]]
+}
+
+func (st *Stream) opts() *Options {
+	// current effective options, safe to call from the stream's goroutine
+	if o := st.eff.Load(); o != nil {
+		return o
+	}
+	st.apply(nil)
+	return st.eff.Load()
+}
+
+func (st *Stream) apply(p *Profile) {
+	o, err := st.WithProfile(p)
+	if err != nil {
+		// readConfig checks every stream with every profile, so only a config changed since
+		Logit.Warn("profile options don't go with the stream's, it keeps its own", "port", st.Port, "profile", p.Name, "err", err)
+		o, _ = config.ParseOptions(st.Opts)
+	}
+	st.eff.Store(o)
+}
+
+func setProfile(name string) error {
+	// switch every stream to profile name, "default" means no profile
+	profMutex.Lock()
+	defer profMutex.Unlock()
+	var p *Profile
+	if name != DefaultProfile {
+		var ok bool
+		if p, ok = Conf.Profiles[name]; !ok {
+			return errors.New("unknown profile: " + name)
+		}
+	}
+	for _, st := range Conf.Streams {
+		st.apply(p)
+	}
+	if name != ActiveProf {
+		Logit.Info("profile changed", "from", ActiveProf, "to", name)
+		Events.publish(EventProfile, "", name)
+	}
+	ActiveProf = name
+	return nil
+}
+
+func runSchedule(keep bool) {
+	// check the profile schedule every minute
+	// keep leaves a profile chosen on the command line in place until the next scheduled change
+	last := ""
+	if keep {
+		last = config.ScheduledProfile(currentConfig().Schedule, time.Now().UTC())
+	}
+	for {
+		// the schedule can be emptied by a config reload
+		if name := config.ScheduledProfile(currentConfig().Schedule, time.Now().UTC()); name != last && name != "" {
+			if err := setProfile(name); err != nil {
+				Logit.Error("scheduled profile", "err", err)
+			}
+			last = name
+		}
+		time.Sleep(time.Minute)
+	}
+}
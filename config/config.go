@@ -0,0 +1,401 @@
+// Package config reads the LogAIS config file and checks and converts the
+// options of its streams and profiles, so mistakes show when the file is read
+// rather than while recording. Package logais records what it says; what each
+// option and keyword line does is described there, in the files named below.
+//
+// Each line of the config file is tab separated:
+//
+//	port <tab> description [<tab> option ...]
+//
+// Options are name or name=value, a leading -- is allowed so the same spelling
+// works on the command line and in the file, eg:
+//
+//	10110	Harbour receiver	--vdr-strict
+//
+// Lines starting with a keyword instead of a port number:
+//
+//	profile <tab> name <tab> option ...	named set of options applied over every stream's own options
+//	schedule <tab> hh:mm <tab> name	switch to profile name at hh:mm UTC, name "default" clears the profile
+//	station <tab> lat,lon	fixed station position in decimal degrees
+//	station-id <tab> id	the station's name or number, written in every data file's header
+//	coldstore <tab> path <tab> days	move day folders older than days to path
+//	peer <tab> url	other instance of a warm standby pair, eg http://standby:8080
+//	node <tab> name <tab> url	member of a cluster sharing sinks, one line for each member
+//	restart <tab> [day] hh:mm	restart the program at hh:mm UTC, every day or on that day, see restart.go
+//	vessel-lost <tab> minutes	vessel acquired and lost events, see sightings.go
+//	lint-ignore <tab> rule[,rule...]	config lint rules not to warn about, see Lint
+//	api-token <tab> token	bearer token for the control API, see control.go
+//	http-user <tab> name:password [name:password ...]	who may use the -http address, see apiauth.go
+//	http-token <tab> token [token ...]	bearer tokens likewise
+//	http-tls <tab> cert <tab> key [<tab> client-ca]	serve -http over TLS
+//	low-disk <tab> size|percent [<tab> warn|pause|delete]	what to do when the disk is nearly full, see diskspace.go
+//	ntp <tab> server [<tab> server ...] [<tab> seconds]	check the clock against NTP, off by more than seconds (default 0.5) is unsynchronized, see clock.go
+//	syslog <tab> local|host:port [<tab> only]	application log to syslog too, or only, see syslog.go
+//	log-rotate <tab> [daily|hourly|weekly|interval] [<tab> size=size] [<tab> keep=n]	when LogAIS.log is rotated, see logrotate.go
+//
+// The same can be written as LogAIS.toml, which is turned into these lines so
+// both are checked the same way, see Read.
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultProfile is the profile name for no profile, streams use their own options.
+const DefaultProfile = "default"
+
+// Vars are the environment variables a whole config can be given in instead
+// of a file, named as a path the way the -config flag would name a file.
+var Vars = []string{"$LOGAIS_CONFIG_TOML", "$LOGAIS_CONFIG_TEXT"}
+
+// Stream is a stream's line of the config file.
+type Stream struct {
+	Port string            // UDP port as written in the config file
+	Name string            // description
+	Opts map[string]string // options from the config file
+}
+
+type Profile struct {
+	Name  string
+	Opts  map[string]string
+	Ports map[string]bool // if not empty profile only applies to these ports
+}
+
+type ScheduleEntry struct {
+	At      int // minutes after midnight UTC
+	Profile string
+}
+
+// Config is what a config file says.
+type Config struct {
+	Streams    []*Stream
+	Profiles   map[string]*Profile
+	Schedule   []ScheduleEntry   // sorted by time
+	Station    *[2]float64       // fixed station lat,lon if configured
+	Cold       *ColdStore        // secondary storage for old days if configured
+	Peer       string            // API address of the other recorder of a warm standby pair
+	Nodes      []Node            // cluster members
+	Restart    *RestartSpec      // scheduled restart if configured
+	StationID  string            // written in file headers, empty if not configured
+	VesselLost time.Duration     // vessel lost after this long unheard, 0 for no vessel events
+	LintIgnore []string          // lint rules switched off for the whole file
+	APIToken   string            // bearer token for the control API, empty for no control API
+	HTTPUsers  map[string]string // name and password of -http basic auth users, see apiauth.go
+	HTTPTokens []string          // bearer tokens for -http
+	HTTPTLS    *TLSFiles         // -http certificate and client CAs if it's HTTPS
+	LowDisk    *LowDisk          // low disk space policy if configured
+	NTP        *NTPCheck         // servers to check the clock against if configured, see clock.go
+	Syslog     *SyslogTarget     // application log to syslog if configured
+	LogRotate  *LogRotate        // application log rotation if configured
+	Path       string            // file the config was read from
+	Hash       string            // its SHA-256, hex, so files can be traced to the config that wrote them
+}
+
+// one config line split into fields, num counts from 1
+type configLine struct {
+	num    int
+	fields []string
+}
+
+// Content returns the config at path, a file or one of Vars.
+func Content(path string) ([]byte, error) {
+	if slices.Contains(Vars, path) {
+		return []byte(os.Getenv(path[1:])), nil
+	}
+	return os.ReadFile(path)
+}
+
+// IsTOML reports whether the config at path is TOML rather than tab separated.
+func IsTOML(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".toml") || path == Vars[0]
+}
+
+// Read reads and checks the config at path, a file or one of Vars. Lines
+// without a description are skipped, see Skipped.
+func Read(path string) (*Config, error) {
+	// read file into memory
+	content, err := Content(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := textLines(content)
+	if IsTOML(path) {
+		if lines, err = tomlLines(content); err != nil {
+			return nil, err
+		}
+	}
+	sum := sha256.Sum256(content)
+	conf := &Config{Profiles: make(map[string]*Profile), Path: path, Hash: hex.EncodeToString(sum[:])}
+
+	for _, cl := range lines {
+		n, fields := cl.num, cl.fields
+		switch strings.ToLower(fields[0]) {
+		case "profile":
+			p := &Profile{Name: fields[1], Opts: RawOptions(fields[2:]), Ports: make(map[string]bool)}
+			if ports, ok := p.Opts["ports"]; ok {
+				for _, port := range strings.Split(ports, ",") {
+					p.Ports[strings.TrimSpace(port)] = true
+				}
+				delete(p.Opts, "ports")
+			}
+			if _, err := ParseOptions(p.Opts); err != nil {
+				return nil, fmt.Errorf("line %d: profile %s: %v", n, p.Name, err)
+			}
+			conf.Profiles[p.Name] = p
+		case "schedule":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: schedule needs a time and a profile name", n)
+			}
+			at, err := parseClock(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.Schedule = append(conf.Schedule, ScheduleEntry{At: at, Profile: fields[2]})
+		case "station":
+			lat, lon, err := ParseLatLon(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.Station = &[2]float64{lat, lon}
+		case "station-id":
+			conf.StationID = fields[1]
+		case "lint-ignore":
+			rules, err := parseLintIgnore(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.LintIgnore = append(conf.LintIgnore, rules...)
+		case "low-disk":
+			l, err := parseLowDisk(strings.Join(fields[1:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.LowDisk = l
+		case "ntp":
+			t, err := parseNTP(strings.Join(fields[1:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.NTP = t
+		case "syslog":
+			t, err := parseSyslog(strings.Join(fields[1:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.Syslog = t
+		case "log-rotate":
+			r, err := parseLogRotate(strings.Join(fields[1:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.LogRotate = r
+		case "api-token":
+			conf.APIToken = fields[1]
+		case "http-user":
+			users, err := ParseHTTPUsers(strings.Join(fields[1:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			if conf.HTTPUsers == nil {
+				conf.HTTPUsers = make(map[string]string)
+			}
+			maps.Copy(conf.HTTPUsers, users)
+		case "http-token":
+			conf.HTTPTokens = append(conf.HTTPTokens, strings.Fields(strings.Join(fields[1:], " "))...)
+		case "http-tls":
+			t, err := parseHTTPTLS(strings.Fields(strings.Join(fields[1:], " ")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.HTTPTLS = t
+		case "vessel-lost":
+			d, err := parseVesselLost(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.VesselLost = d
+		case "restart":
+			r, err := parseRestart(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			conf.Restart = r
+		case "peer":
+			if !strings.HasPrefix(fields[1], "http://") && !strings.HasPrefix(fields[1], "https://") {
+				return nil, fmt.Errorf("line %d: peer needs the other instance's API address, eg http://standby:8080", n)
+			}
+			conf.Peer = fields[1]
+		case "node":
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "http") {
+				return nil, fmt.Errorf("line %d: node needs a name and the member's API address, eg http://shore1:8080", n)
+			}
+			conf.Nodes = append(conf.Nodes, Node{Name: fields[1], URL: fields[2]})
+		case "coldstore":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: coldstore needs a path and a number of days", n)
+			}
+			days, err := strconv.Atoi(fields[2])
+			if err != nil || days < 1 {
+				return nil, fmt.Errorf("line %d: coldstore days must be a whole number of at least 1: %s", n, fields[2])
+			}
+			conf.Cold = &ColdStore{Path: fields[1], Days: days}
+		default:
+			// any fields beyond 2 are options
+			st := &Stream{Port: fields[0], Name: fields[1], Opts: RawOptions(fields[2:])}
+			if _, err := ParseOptions(st.Opts); err != nil {
+				return nil, fmt.Errorf("line %d: port %s: %v", n, st.Port, err)
+			}
+			conf.Streams = append(conf.Streams, st)
+		}
+	}
+
+	for _, s := range conf.Schedule {
+		if _, ok := conf.Profiles[s.Profile]; !ok && s.Profile != DefaultProfile {
+			return nil, errors.New("schedule refers to unknown profile: " + s.Profile)
+		}
+	}
+	// a profile's options can be fine alone and not with a stream's, eg one option needing another
+	names := make([]string, 0, len(conf.Profiles))
+	for name := range conf.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := conf.Profiles[name]
+		for _, st := range conf.Streams {
+			if _, err := st.WithProfile(p); err != nil {
+				return nil, fmt.Errorf("profile %s with port %s: %v", p.Name, st.Port, err)
+			}
+		}
+	}
+	gps, ref := 0, 0
+	for _, st := range conf.Streams {
+		if _, ok := st.Opts["gps"]; ok {
+			gps++
+		}
+		if _, ok := st.Opts["reference"]; ok {
+			ref++
+		}
+	}
+	if gps > 1 {
+		return nil, errors.New("only one stream can have the gps option")
+	}
+	if ref > 1 {
+		return nil, errors.New("only one stream can have the reference option")
+	}
+	sort.SliceStable(conf.Schedule, func(i, j int) bool { return conf.Schedule[i].At < conf.Schedule[j].At })
+	return conf, nil
+}
+
+// Skipped returns the lines of a tab separated config that Read skips as
+// they have no description, eg spaces instead of tabs, as problems to report.
+func Skipped(content []byte) []string {
+	var problems []string
+	for n, buf := range bytes.Split(content, []byte("\n")) {
+		line := strings.TrimSpace(string(buf))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if fields := strings.Split(line, "\t"); len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+			problems = append(problems, fmt.Sprintf("line %d: no description (or not tab separated), line skipped: %s", n+1, line))
+		}
+	}
+	return problems
+}
+
+func textLines(content []byte) []configLine {
+	// Break up content into lines
+	var lines []configLine
+	afoArray := bytes.Split(content, []byte("\n"))
+	for n, buf := range afoArray {
+		// byte slice for each line
+		// trim leading & trailing spaces, double spaces
+		line := strings.TrimSpace(string(buf))
+		line = strings.ReplaceAll(line, "  ", " ")
+		if line == "" || line[0] == '#' {
+			// ignore # comments
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			// must have a description
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		// strip spaces except for description
+		fields[0] = strings.ReplaceAll(fields[0], " ", "")
+		lines = append(lines, configLine{num: n + 1, fields: fields})
+	}
+	return lines
+}
+
+// RawOptions reads a line's options, name or name=value with leading dashes
+// dropped, into names, which are case insensitive, and values as ParseOptions takes them.
+func RawOptions(fields []string) map[string]string {
+	opts := make(map[string]string)
+	for _, f := range fields {
+		f = strings.TrimLeft(strings.TrimSpace(f), "-")
+		if f == "" || f[0] == '#' {
+			continue
+		}
+		name, value, _ := strings.Cut(f, "=")
+		opts[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return opts
+}
+
+// WithProfile returns the stream's options with profile p's over them if p
+// applies to the stream, p nil for none.
+func (st *Stream) WithProfile(p *Profile) (*Options, error) {
+	// profile options win over the stream's own
+	raw := make(map[string]string, len(st.Opts))
+	for k, v := range st.Opts {
+		raw[k] = v
+	}
+	if p != nil && (len(p.Ports) == 0 || p.Ports[st.Port]) {
+		for k, v := range p.Opts {
+			raw[k] = v
+		}
+	}
+	return ParseOptions(raw)
+}
+
+// ScheduledProfile returns the profile whose start time in sched was most
+// recently passed at t, wrapping around midnight, empty if sched is.
+func ScheduledProfile(sched []ScheduleEntry, t time.Time) string {
+	if len(sched) == 0 {
+		return ""
+	}
+	now := t.Hour()*60 + t.Minute()
+	name := sched[len(sched)-1].Profile
+	for _, s := range sched {
+		if s.At <= now {
+			name = s.Profile
+		}
+	}
+	return name
+}
+
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, errors.New("invalid time, expecting hh:mm: " + s)
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// addresses of the feeds built in
+const (
+	aisStreamURL   = "wss://stream.aisstream.io/v0/stream"
+	digitrafficURL = "wss://meri.digitraffic.fi:443/mqtt"
+	kystverketAddr = "153.44.253.27:5631"
+)
+
+// Feed is a network feed recorded instead of listening on a stream's UDP port,
+// the aisstream, tcp, feed or ingest option; package input runs it.
+type Feed struct {
+	Kind  string          // TCP, kystverket, aisstream, digitraffic or ingest, the record source with the port
+	Addr  string          // host:port of a TCP feed, the URL of a WebSocket one
+	TLS   *TLSFiles       // tcp=tls://, nil for plain TCP
+	Key   string          // aisstream API key
+	Boxes [][2][2]float64 // aisstream bounding boxes, [corner][lat,lon]
+	Token string          // ingest bearer token, empty for none
+}
+
+// Address is where the feed comes from, as logged.
+func (f *Feed) Address() string {
+	switch f.Kind {
+	case "TCP", "kystverket":
+		if f.TLS != nil {
+			return "tls://" + f.Addr
+		}
+		return "tcp://" + f.Addr
+	case "ingest":
+		return "agents posting to /api/ingest/"
+	}
+	return f.Addr
+}
+
+func parseFeed(name string, raw map[string]string) (*Feed, error) {
+	switch name {
+	case "aisstream":
+		return parseAISStream(raw)
+	case "ingest":
+		return &Feed{Kind: "ingest", Token: raw[name]}, nil
+	case "tcp":
+		addr, secure := strings.CutPrefix(raw[name], "tls://")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, errors.New("tcp needs the feed's host:port or tls://host:port: " + raw[name])
+		}
+		f := &Feed{Kind: "TCP", Addr: addr}
+		if secure {
+			var err error
+			if f.TLS, err = parseTLSFiles(raw, "tcp"); err != nil {
+				return nil, err
+			}
+		}
+		return f, nil
+	}
+	switch raw[name] {
+	case "kystverket":
+		return &Feed{Kind: "kystverket", Addr: kystverketAddr}, nil
+	case "digitraffic":
+		return &Feed{Kind: "digitraffic", Addr: digitrafficURL}, nil
+	}
+	return nil, errors.New("feed must be kystverket or digitraffic: " + raw[name])
+}
+
+func parseAISStream(raw map[string]string) (*Feed, error) {
+	s := &Feed{Kind: "aisstream", Key: raw["aisstream"], Addr: aisStreamURL}
+	if s.Key == "" {
+		return nil, errors.New("aisstream needs the feed's API key, eg aisstream=0123abcd")
+	}
+	if u, ok := raw["aisstream-url"]; ok {
+		if !strings.HasPrefix(u, "ws://") && !strings.HasPrefix(u, "wss://") {
+			return nil, errors.New("aisstream-url must be a ws:// or wss:// address: " + u)
+		}
+		s.Addr = u
+	}
+	if b, ok := raw["bbox"]; ok {
+		for _, box := range strings.Split(b, "|") {
+			corners := strings.Split(box, ";")
+			if len(corners) != 2 {
+				return nil, errors.New("bbox needs two opposite corners, lat,lon;lat,lon: " + box)
+			}
+			var bb [2][2]float64
+			for i, c := range corners {
+				lat, lon, err := ParseLatLon(c)
+				if err != nil {
+					return nil, fmt.Errorf("bbox: %v", err)
+				}
+				bb[i] = [2]float64{lat, lon}
+			}
+			s.Boxes = append(s.Boxes, bb)
+		}
+	} else {
+		s.Boxes = [][2][2]float64{{{-90, -180}, {90, 180}}}
+	}
+	return s, nil
+}
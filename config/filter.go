@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// MMSIFilter is an allow-mmsi or deny-mmsi list, see filter.go.
+type MMSIFilter struct {
+	Exact    map[uint32]bool // whole MMSIs
+	Prefixes []string        // MIDs and other leading digits
+}
+
+// ParseMMSIList reads a comma separated list of MMSIs and MMSI prefixes, name is
+// the option for errors.
+func ParseMMSIList(name string, value string) (*MMSIFilter, error) {
+	f := &MMSIFilter{Exact: make(map[uint32]bool)}
+	for _, m := range strings.Split(value, ",") {
+		m = strings.TrimSuffix(strings.TrimSpace(m), "*")
+		if _, err := strconv.ParseUint(m, 10, 32); err != nil || len(m) > 9 {
+			return nil, errors.New(name + " needs a list of MMSIs or MMSI prefixes: " + value)
+		}
+		if len(m) == 9 {
+			n, _ := strconv.ParseUint(m, 10, 32)
+			f.Exact[uint32(n)] = true
+		} else {
+			f.Prefixes = append(f.Prefixes, m)
+		}
+	}
+	return f, nil
+}
+
+// Match is whether the MMSI is in the list.
+func (f *MMSIFilter) Match(mmsi uint32) bool {
+	if f.Exact[mmsi] {
+		return true
+	}
+	s := strconv.FormatUint(uint64(mmsi), 10)
+	s = strings.Repeat("0", max(0, 9-len(s))) + s
+	for _, p := range f.Prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTypeList reads the types option, message types 1 to 27.
+func ParseTypeList(value string) (map[int]bool, error) {
+	// comma separated message types or ranges, eg 1-3,18
+	bad := errors.New("types needs a list of message types 1 to 27, eg 1-3,18: " + value)
+	types := make(map[int]bool)
+	for _, t := range strings.Split(value, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(t), "-")
+		a, err1 := strconv.Atoi(from)
+		b, err2 := a, error(nil)
+		if isRange {
+			b, err2 = strconv.Atoi(to)
+		}
+		if err1 != nil || err2 != nil || a < 1 || b > 27 || a > b {
+			return nil, bad
+		}
+		for n := a; n <= b; n++ {
+			types[n] = true
+		}
+	}
+	return types, nil
+}
+
+// Geofence is the geofence option, a box or polygon.
+type Geofence struct {
+	Points [][2]float64 // lat, lon; two points are opposite corners of a box
+}
+
+func parseGeofence(value string) (*Geofence, error) {
+	bad := errors.New("geofence needs two corners or three or more polygon points, eg geofence=-36.80,174.70;-36.90,174.90: " + value)
+	g := &Geofence{}
+	for _, p := range strings.Split(value, ";") {
+		lat, lon, err := ParseLatLon(p)
+		if err != nil {
+			return nil, bad
+		}
+		g.Points = append(g.Points, [2]float64{lat, lon})
+	}
+	if len(g.Points) < 2 {
+		return nil, bad
+	}
+	return g, nil
+}
+
+// Contains is whether a position is inside the geofence.
+func (g *Geofence) Contains(lat float64, lon float64) bool {
+	if len(g.Points) == 2 {
+		a, b := g.Points[0], g.Points[1]
+		return lat >= min(a[0], b[0]) && lat <= max(a[0], b[0]) && lon >= min(a[1], b[1]) && lon <= max(a[1], b[1])
+	}
+	// ray casting, fine for areas much smaller than a hemisphere
+	in := false
+	for i, j := 0, len(g.Points)-1; i < len(g.Points); j, i = i, i+1 {
+		a, b := g.Points[i], g.Points[j]
+		if (a[0] > lat) != (b[0] > lat) && lon < (b[1]-a[1])*(lat-a[0])/(b[0]-a[0])+a[1] {
+			in = !in
+		}
+	}
+	return in
+}
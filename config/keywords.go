@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LogSize        = 102400                 // LogAIS.log rotated past this size without a log-rotate line giving one, (100KB)
+	LogKeep        = 4                      // old logfiles kept likewise
+	clockMaxOffset = 500 * time.Millisecond // ntp default
+)
+
+// ColdStore is the coldstore line, see coldstore.go.
+type ColdStore struct {
+	Path string
+	Days int
+}
+
+// Node is a node line, a cluster member, see cluster.go.
+type Node struct {
+	Name string
+	URL  string
+}
+
+// RestartSpec is the restart line, see restart.go.
+type RestartSpec struct {
+	At  int // minutes after midnight UTC
+	Day int // time.Weekday, -1 for every day
+}
+
+// LowDisk is the low-disk line, see diskspace.go.
+type LowDisk struct {
+	Free    uint64  // bytes, or
+	Percent float64 // of the volume
+	Policy  string  // warn, pause or delete
+}
+
+// NTPCheck is the ntp line, see clock.go.
+type NTPCheck struct {
+	Servers   []string
+	MaxOffset time.Duration
+}
+
+// SyslogTarget is the syslog line, see syslog.go.
+type SyslogTarget struct {
+	Network string // "" for the local syslog, else udp or tcp
+	Addr    string // host:port
+	Only    bool   // no LogAIS.log
+}
+
+// LogRotate is the log-rotate line, see logrotate.go.
+type LogRotate struct {
+	Every time.Duration // rotation period, 0 for by size only
+	Size  int64         // bytes, 0 for by time only
+	Keep  int           // old logfiles kept
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseLatLon reads a position in decimal degrees, lat,lon.
+func ParseLatLon(s string) (float64, float64, error) {
+	la, lo, ok := strings.Cut(s, ",")
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(la), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(lo), 64)
+	if !ok || err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, errors.New("invalid position, expecting decimal degrees lat,lon: " + s)
+	}
+	return lat, lon, nil
+}
+
+func parseRestart(value string) (*RestartSpec, error) {
+	r := &RestartSpec{Day: -1}
+	fields := strings.Fields(value)
+	if len(fields) == 2 {
+		r.Day = -1
+		for i, d := range weekdays {
+			if strings.HasPrefix(strings.ToLower(fields[0]), d) {
+				r.Day = i
+			}
+		}
+		if r.Day < 0 {
+			return nil, errors.New("restart day must be mon, tue, ... sun: " + fields[0])
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return nil, errors.New("restart needs hh:mm UTC, with a day in front for once a week, eg sun 03:00: " + value)
+	}
+	at, err := parseClock(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	r.At = at
+	return r, nil
+}
+
+func parseVesselLost(value string) (time.Duration, error) {
+	min, err := strconv.Atoi(value)
+	if err != nil || min < 1 {
+		return 0, errors.New("vessel-lost needs a number of minutes: " + value)
+	}
+	return time.Duration(min) * time.Minute, nil
+}
+
+func parseLowDisk(value string) (*LowDisk, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.New("low-disk needs a free space, eg 2GB or 5%, and warn, pause or delete")
+	}
+	l := &LowDisk{Policy: "warn"}
+	if p, ok := strings.CutSuffix(fields[0], "%"); ok {
+		pc, err := strconv.ParseFloat(p, 64)
+		if err != nil || pc <= 0 || pc >= 100 {
+			return nil, errors.New("low-disk percentage must be between 0 and 100: " + fields[0])
+		}
+		l.Percent = pc
+	} else {
+		free, ok := parseSize(fields[0])
+		if !ok {
+			return nil, errors.New("low-disk free space must be a size, eg 500MB or 2GB, or a percentage: " + fields[0])
+		}
+		l.Free = free
+	}
+	if len(fields) == 2 {
+		l.Policy = strings.ToLower(fields[1])
+		if l.Policy != "warn" && l.Policy != "pause" && l.Policy != "delete" {
+			return nil, errors.New("low-disk policy must be warn, pause or delete: " + fields[1])
+		}
+	}
+	return l, nil
+}
+
+func parseNTP(value string) (*NTPCheck, error) {
+	fields := strings.Fields(value)
+	n := &NTPCheck{MaxOffset: clockMaxOffset}
+	if len(fields) > 1 {
+		if f, err := strconv.ParseFloat(fields[len(fields)-1], 64); err == nil {
+			if f <= 0 {
+				return nil, errors.New("ntp offset must be a number of seconds: " + fields[len(fields)-1])
+			}
+			n.MaxOffset = time.Duration(f * float64(time.Second))
+			fields = fields[:len(fields)-1]
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("ntp needs a server, eg pool.ntp.org, and optionally the seconds off allowed")
+	}
+	n.Servers = fields
+	return n, nil
+}
+
+func parseSyslog(value string) (*SyslogTarget, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 || len(fields) == 2 && !strings.EqualFold(fields[1], "only") {
+		return nil, errors.New("syslog needs local or a host:port, and only to stop writing LogAIS.log")
+	}
+	t := &SyslogTarget{Only: len(fields) == 2}
+	if strings.EqualFold(fields[0], "local") {
+		return t, nil
+	}
+	t.Network, t.Addr = "udp", fields[0]
+	if network, addr, ok := strings.Cut(fields[0], "://"); ok {
+		t.Network, t.Addr = strings.ToLower(network), addr
+	}
+	if _, port, err := net.SplitHostPort(t.Addr); err != nil || port == "" || t.Network != "udp" && t.Network != "tcp" {
+		return nil, errors.New("syslog collector must be [udp://|tcp://]host:port, eg logs.example.org:514: " + fields[0])
+	}
+	return t, nil
+}
+
+func (t *SyslogTarget) String() string {
+	if t.Network == "" {
+		return "local"
+	}
+	return t.Network + "://" + t.Addr
+}
+
+func parseLogRotate(value string) (*LogRotate, error) {
+	r := &LogRotate{Keep: LogKeep}
+	sized := false
+	for _, f := range strings.Fields(value) {
+		name, v, _ := strings.Cut(strings.ToLower(f), "=")
+		switch name {
+		case "daily":
+			r.Every = 24 * time.Hour
+		case "hourly":
+			r.Every = time.Hour
+		case "weekly":
+			r.Every = 7 * 24 * time.Hour
+		case "size":
+			n, ok := parseSize(v)
+			if !ok {
+				return nil, errors.New("log-rotate size must be a size, eg 10MB: " + v)
+			}
+			r.Size, sized = int64(n), true
+		case "keep":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, errors.New("log-rotate keep must be a number of files of at least 1: " + v)
+			}
+			r.Keep = n
+		default:
+			d, err := time.ParseDuration(f)
+			day := 24 * time.Hour
+			if err != nil || d < time.Minute || d < day && day%d != 0 || d > day && d%day != 0 {
+				return nil, errors.New("log-rotate needs daily, hourly, weekly or an interval dividing a day, eg 6h, and size= or keep=: " + f)
+			}
+			r.Every = d
+		}
+	}
+	if r.Every == 0 && !sized {
+		r.Size = LogSize
+	}
+	return r, nil
+}
+
+// ParseHTTPUsers reads an http-user line's name:password pairs, space separated.
+func ParseHTTPUsers(value string) (map[string]string, error) {
+	users := make(map[string]string)
+	for _, u := range strings.Fields(value) {
+		name, password, ok := strings.Cut(u, ":")
+		if !ok || name == "" || password == "" {
+			return nil, errors.New("http-user needs name:password: " + name)
+		}
+		users[name] = password
+	}
+	if len(users) == 0 {
+		return nil, errors.New("http-user needs name:password")
+	}
+	return users, nil
+}
+
+func parseHTTPTLS(fields []string) (*TLSFiles, error) {
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, errors.New("http-tls needs a certificate and key file, and optionally a file of CAs for client certificates")
+	}
+	ca := ""
+	if len(fields) == 3 {
+		ca = fields[2]
+	}
+	t, err := NewTLSFiles(fields[0], fields[1], ca)
+	if err != nil {
+		return nil, errors.New("http-tls: " + err.Error())
+	}
+	return t, nil
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config lint: setups that are valid but lose or double data quietly, so the
+// mistake shows up weeks later as a hole in the archive. Each finding has a rule
+// ID; a rule is switched off for the whole file with
+//
+//	lint-ignore <tab> rule[,rule...]
+//
+// or for one stream with its lint-ignore=rule,... option. Streams are checked
+// with their own options and under every profile. Findings are logged as
+// warnings at startup and on reload and listed by logais check.
+//
+//	geofence-split	two streams record inside and outside of geofences that overlap
+//		but differ: vessels in part of the area are recorded by both or by neither
+//	dedup-window	dedup shorter than an AIS repeater or echoing multiplexer takes to
+//		send a message again (dedupRepeater), or on a merged stream shorter than the
+//		spread of its streams' time-offset: the copies are recorded
+//	allow-deny	an MMSI or prefix both allowed and denied, deny wins and the
+//		vessel is never recorded
+//	diff-no-reference	diff without a reference stream, nothing is ever left out
+//	smooth-long	smooth longer than smoothRisk, that much is lost on a power cut
+//	push-plain	push-token sent over http://, anyone on the way can read it
+//	retain-coldstore	retain no longer than coldstore's days, the files are deleted
+//		before they would be moved to cold storage
+//	compress-retain	compress no sooner than retain, files are deleted before they
+//		would be compressed
+
+const (
+	dedupRepeater = 3 * time.Second
+	smoothRisk    = time.Minute
+)
+
+var lintRules = []string{"geofence-split", "dedup-window", "allow-deny", "diff-no-reference", "smooth-long", "push-plain", "retain-coldstore", "compress-retain"}
+
+// Finding is a setup that lint warns about.
+type Finding struct {
+	Rule   string
+	Stream string // port, empty for the whole file
+	Text   string
+}
+
+func (f Finding) String() string {
+	if f.Stream == "" {
+		return "[" + f.Rule + "] " + f.Text
+	}
+	return "[" + f.Rule + "] stream " + f.Stream + ": " + f.Text
+}
+
+// Log logs the finding as a warning.
+func (f Finding) Log(lg *slog.Logger) {
+	args := []any{"rule", f.Rule}
+	if f.Stream != "" {
+		args = append(args, "port", f.Stream)
+	}
+	lg.Warn("config lint: "+f.Text, args...)
+}
+
+func parseLintIgnore(value string) ([]string, error) {
+	var rules []string
+	for _, r := range strings.Split(value, ",") {
+		r = strings.ToLower(strings.TrimSpace(r))
+		if !slices.Contains(lintRules, r) {
+			return nil, fmt.Errorf("lint-ignore: unknown rule %s, rules are %s", r, strings.Join(lintRules, ", "))
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Lint checks the streams under their own options and then every profile,
+// each finding once, less those lint-ignore switches off.
+func Lint(conf *Config) []Finding {
+	contexts := []*Profile{nil}
+	names := make([]string, 0, len(conf.Profiles))
+	for name := range conf.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		contexts = append(contexts, conf.Profiles[name])
+	}
+	seen := make(map[Finding]bool)
+	var findings []Finding
+	for _, p := range contexts {
+		for _, f := range lintStreams(conf.Streams, p, conf.Cold) {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			if p != nil {
+				f.Text += " (profile " + p.Name + ")"
+			}
+			findings = append(findings, f)
+		}
+	}
+	// suppressions
+	keep := findings[:0]
+	for _, f := range findings {
+		if slices.Contains(conf.LintIgnore, f.Rule) {
+			continue
+		}
+		if st := streamByPort(conf.Streams, f.Stream); st != nil {
+			if ignore, err := parseLintIgnore(st.Opts["lint-ignore"]); err == nil && slices.Contains(ignore, f.Rule) {
+				continue
+			}
+		}
+		keep = append(keep, f)
+	}
+	return keep
+}
+
+func streamByPort(streams []*Stream, port string) *Stream {
+	for _, st := range streams {
+		if st.Port == port {
+			return st
+		}
+	}
+	return nil
+}
+
+func lintStreams(streams []*Stream, p *Profile, cold *ColdStore) []Finding {
+	var findings []Finding
+	add := func(rule string, port string, format string, args ...any) {
+		findings = append(findings, Finding{Rule: rule, Stream: port, Text: fmt.Sprintf(format, args...)})
+	}
+	opts := make(map[string]*Options)
+	reference := false
+	for _, st := range streams {
+		raw := make(map[string]string, len(st.Opts))
+		for k, v := range st.Opts {
+			raw[k] = v
+		}
+		if p != nil && (len(p.Ports) == 0 || p.Ports[st.Port]) {
+			for k, v := range p.Opts {
+				raw[k] = v
+			}
+		}
+		o, err := ParseOptions(raw)
+		if err != nil {
+			continue
+		}
+		opts[st.Port] = o
+		reference = reference || o.Reference
+	}
+
+	for i, st := range streams {
+		o := opts[st.Port]
+		if o == nil {
+			continue
+		}
+		if o.Dedup > 0 && o.Dedup < dedupRepeater {
+			add("dedup-window", st.Port, "dedup=%v is shorter than a repeater or multiplexer takes to echo a message (about %v), echoes will be recorded", o.Dedup.Seconds(), dedupRepeater)
+		}
+		if o.Merge != nil && o.Dedup > 0 {
+			var lo, hi time.Duration
+			for j, port := range o.Merge {
+				if src := opts[port]; src != nil {
+					if j == 0 || src.Offset < lo {
+						lo = src.Offset
+					}
+					if j == 0 || src.Offset > hi {
+						hi = src.Offset
+					}
+				}
+			}
+			if hi-lo >= o.Dedup {
+				add("dedup-window", st.Port, "the merged streams' time-offset differ by %v, more than dedup=%v, the same message from each is recorded", (hi - lo).Seconds(), o.Dedup.Seconds())
+			}
+		}
+		if o.AllowMMSI != nil && o.DenyMMSI != nil {
+			if both := o.AllowMMSI.overlap(o.DenyMMSI); len(both) > 0 {
+				add("allow-deny", st.Port, "%s both allowed and denied, never recorded", strings.Join(both, ","))
+			}
+		}
+		if o.Diff > 0 && !reference {
+			add("diff-no-reference", st.Port, "diff needs a stream with the reference option, everything is recorded")
+		}
+		if o.Smooth > smoothRisk {
+			add("smooth-long", st.Port, "smooth=%v, up to that much data is lost on a power cut", o.Smooth.Seconds())
+		}
+		if o.Retain > 0 && cold != nil && o.Retain <= cold.Days {
+			add("retain-coldstore", st.Port, "retain=%d deletes files before coldstore moves them at %d days", o.Retain, cold.Days)
+		}
+		if o.Retain > 0 && o.Compress >= o.Retain {
+			add("compress-retain", st.Port, "compress=%d is no sooner than retain=%d, nothing is compressed", o.Compress, o.Retain)
+		}
+		if o.PushToken != "" && strings.HasPrefix(o.Push, "http://") {
+			add("push-plain", st.Port, "push-token is sent unencrypted to %s, use https", o.Push)
+		}
+		for _, other := range streams[i+1:] {
+			oo := opts[other.Port]
+			if o.Geofence == nil || oo == nil || oo.Geofence == nil || o.Outside == oo.Outside {
+				continue
+			}
+			if !o.Geofence.same(oo.Geofence) && o.Geofence.overlaps(oo.Geofence) {
+				add("geofence-split", st.Port, "geofence overlaps stream %s's opposite geofence without matching it, vessels in part of the area are recorded by both or by neither", other.Port)
+			}
+		}
+	}
+	return findings
+}
+
+func (f *MMSIFilter) overlap(g *MMSIFilter) []string {
+	// entries of f that g also matches, and prefixes of g within f's
+	var both []string
+	for mmsi := range f.Exact {
+		if g.Match(mmsi) {
+			both = append(both, fmt.Sprintf("%09d", mmsi))
+		}
+	}
+	for _, p := range f.Prefixes {
+		for _, q := range g.Prefixes {
+			if strings.HasPrefix(p, q) || strings.HasPrefix(q, p) {
+				both = append(both, max(p, q)+"*")
+			}
+		}
+		for mmsi := range g.Exact {
+			if s := fmt.Sprintf("%09d", mmsi); strings.HasPrefix(s, p) {
+				both = append(both, s)
+			}
+		}
+	}
+	sort.Strings(both)
+	return slices.Compact(both)
+}
+
+func (g *Geofence) corners() [][2]float64 {
+	// polygon points, a box's four corners
+	if len(g.Points) != 2 {
+		return g.Points
+	}
+	a, b := g.Points[0], g.Points[1]
+	return [][2]float64{a, {a[0], b[1]}, b, {b[0], a[1]}}
+}
+
+func (g *Geofence) same(h *Geofence) bool {
+	return slices.Equal(g.Points, h.Points)
+}
+
+func (g *Geofence) overlaps(h *Geofence) bool {
+	// a corner of one inside the other or edges crossing
+	gc, hc := g.corners(), h.corners()
+	for _, p := range gc {
+		if h.Contains(p[0], p[1]) {
+			return true
+		}
+	}
+	for _, p := range hc {
+		if g.Contains(p[0], p[1]) {
+			return true
+		}
+	}
+	for i := range gc {
+		a, b := gc[i], gc[(i+1)%len(gc)]
+		for j := range hc {
+			if segmentsCross(a, b, hc[j], hc[(j+1)%len(hc)]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func segmentsCross(a, b, c, d [2]float64) bool {
+	side := func(p, q, r [2]float64) float64 {
+		return (q[0]-p[0])*(r[1]-p[1]) - (q[1]-p[1])*(r[0]-p[0])
+	}
+	return side(a, b, c)*side(a, b, d) < 0 && side(c, d, a)*side(c, d, b) < 0
+}
@@ -0,0 +1,656 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/sink"
+)
+
+// DiffMax is the longest diff matching window.
+const DiffMax = 10 * time.Minute
+
+// option defaults
+const (
+	diffDefault  = 30 * time.Second // diff matching window
+	dedupDefault = 5 * time.Second
+	gnssHoldover = 10 * time.Minute // without GNSS time before the system clock is used again, unless gnsstime= says
+	chainEvery   = time.Minute      // chain lines while records are written, unless chain= says
+	pcapSize     = 10 << 20         // bytes in a capture file before it's rotated, unless pcap= says
+)
+
+// Options are the parsed per-stream settings, rebuilt whenever the active profile changes
+type Options struct {
+	Raw        map[string]string
+	VdrStrict  bool            // write exactly the documented OpenCPN VDR columns
+	Output     string          // output preset, see output.go, empty for the LogAIS format
+	Receiver   string          // receiver ID for the record source, with the VHF channel appended
+	Quality    *QualitySpec    // write signal quality log if not nil
+	GeoJSON    string          // "ndjson" or "collection" to write positions as GeoJSON
+	GPS        bool            // this stream carries the station's own position
+	Checksum   string          // off, drop, file, flag or repair: what to do with bad checksums
+	Reference  bool            // reference stream for differential recording
+	Diff       time.Duration   // if not 0 only record sentences the reference stream didn't get within this window
+	Incomplete string          // keep or drop multipart messages with parts missing
+	Talkers    map[string]bool // AIS talker IDs to record, nil for all
+	OwnShip    string          // log, split or drop AIVDO own ship sentences
+	Tags       string          // keep, fields or drop NMEA 4.10 TAG blocks
+	TagTime    bool            // timestamp from the TAG block instead of the receive time
+	GNSSTime   time.Duration   // timestamps from RMC/ZDA times, for this long after the last, see gnsstime.go
+	TimeFmt    *TimeFormat     // how timestamps are written, nil for the default in UTC, see timefmt.go
+	Offset     time.Duration   // added to timestamps, to correct a gateway's clock or delay
+	NMEA       map[string]bool // non-AIS $ sentences to record too, eg GGA or GPGGA, "*" for all, nil for none
+	DSC        bool            // record DSC and DSE sentences
+	AllowMMSI  *MMSIFilter     // only record these vessels if not nil
+	DenyMMSI   *MMSIFilter     // don't record these vessels
+	Types      map[int]bool    // only record these AIS message types if not nil
+	Geofence   *Geofence       // only record vessels inside this area if not nil
+	Outside    bool            // record vessels outside the geofence instead
+	Dedup      time.Duration   // if not 0 don't write messages identical to one written this recently
+	Feed       *Feed           // network feed recorded instead of listening on the port
+	Rate       time.Duration   // if not 0 record at most one position report per vessel this often
+	Merge      []string        // ports of the streams merged into this one instead of listening on the port
+	Aggregate  bool            // Merge keeps every message in time order, tagged with the stream it came from
+	Reorder    time.Duration   // merged stream's reordering window, 0 for the default
+	Relay      []string        // UDP host:port addresses to send everything received to
+	Serve      string          // TCP address to serve everything received on, empty for none
+	ServeTLS   *TLSFiles       // Serve's certificate if it's TLS, see tls.go
+	Seq        bool            // number sentences in their TAG blocks
+	Smooth     time.Duration   // if not 0 write the stream's files this often rather than every second, see smooth.go
+	SmoothSize int             // buffer size for them, 0 for 64KB
+	Batch      int             // records held before they're written early, 0 for no limit
+	Unbuffered bool            // write every message as it comes, see smooth.go
+	Push       string          // collector URL to post everything received to, see ingest.go
+	PushToken  string          // bearer token for Push
+	PushTLS    *TLSFiles       // client certificate or CAs for Push if configured
+	Quiet      time.Duration   // unhealthy after this long without data, 0 for the default, see health.go
+	Compress   int             // gzip daily files this many days old, 0 for never, see retention.go
+	Retain     int             // delete daily files this many days old, 0 for never
+	LogFile    bool            // also log the stream's entries to its own file, see streamlog.go
+	Pcap       int64           // capture datagrams to a pcap file rotated at this size, 0 for none, see pcap.go
+	RecvBuf    int             // largest datagram read, 0 for 6144 bytes, see pipeline.go
+	SockBuf    int             // socket receive buffer (SO_RCVBUF) asked for, 0 for the system's
+	Sockets    int             // SO_REUSEPORT sockets reading the port, 0 for one
+	Pressure   string          // block, drop-oldest or drop-newest when the writer is behind
+	AllowFrom  []netip.Prefix  // only take datagrams from these senders if not nil, see pipeline.go
+	Index      bool            // keep a seek index next to the daily file, see index.go
+	Sink       string          // name[:param] of a sink the records also go to, see sink.go
+	Chain      time.Duration   // between hash chain lines in the daily file, 0 for none, see chain.go
+	ChainKey   string          // Ed25519 private key file signing them, empty for unsigned
+}
+
+// ParseOptions checks and converts a stream's options, name to value as the
+// config file gives them; unknown options are an error so typos get noticed.
+func ParseOptions(raw map[string]string) (*Options, error) {
+	o := &Options{Raw: raw, Checksum: "off", Incomplete: "keep", OwnShip: "log", Tags: "keep", Pressure: "drop-newest"}
+	for name := range raw {
+		switch name {
+		case "vdr-strict":
+			o.VdrStrict = true
+		case "opencpn-vdr", "aishub-uplink", "pyais-raw", "elk-jsonl":
+			if o.Output != "" {
+				return nil, errors.New("only one output preset: " + o.Output + " and " + name)
+			}
+			o.Output = name
+			o.VdrStrict = o.VdrStrict || name == "opencpn-vdr"
+		case "receiver":
+			if raw[name] == "" || strings.ContainsAny(raw[name], "\",") {
+				return nil, errors.New("receiver needs an ID without commas or quotes")
+			}
+			o.Receiver = raw[name]
+		case "quality":
+			q, err := parseQualitySpec(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Quality = q
+		case "geojson":
+			g, err := parseGeoJSON(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.GeoJSON = g
+		case "gps":
+			o.GPS = true
+		case "checksum":
+			switch raw[name] {
+			case "off", "drop", "file", "flag", "repair":
+				o.Checksum = raw[name]
+			default:
+				return nil, errors.New("checksum must be off, drop, file, flag or repair: " + raw[name])
+			}
+		case "reference":
+			o.Reference = true
+		case "diff":
+			d, err := parseSeconds(name, raw[name], diffDefault)
+			if err != nil {
+				return nil, err
+			}
+			if d > DiffMax {
+				return nil, fmt.Errorf("diff can wait at most %g seconds for the reference stream: %s", DiffMax.Seconds(), raw[name])
+			}
+			o.Diff = d
+		case "incomplete":
+			if raw[name] != "keep" && raw[name] != "drop" {
+				return nil, errors.New("incomplete must be keep or drop: " + raw[name])
+			}
+			o.Incomplete = raw[name]
+		case "ownship":
+			switch raw[name] {
+			case "log", "split", "drop":
+				o.OwnShip = raw[name]
+			default:
+				return nil, errors.New("ownship must be log, split or drop: " + raw[name])
+			}
+		case "tags":
+			t, err := parseTagOption(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Tags = t
+		case "tagtime":
+			o.TagTime = true
+		case "time-format", "timezone":
+			f, err := parseTimeFormat(raw)
+			if err != nil {
+				return nil, err
+			}
+			o.TimeFmt = f
+		case "gnsstime":
+			d, err := parseSeconds(name, raw[name], gnssHoldover)
+			if err != nil {
+				return nil, err
+			}
+			o.GNSSTime = d
+		case "time-offset":
+			f, err := strconv.ParseFloat(raw[name], 64)
+			if err != nil || f == 0 {
+				return nil, errors.New("time-offset needs a number of seconds to add, eg time-offset=-2 for a relay that delays data 2 s: " + raw[name])
+			}
+			o.Offset = time.Duration(f * float64(time.Second))
+		case "allow-mmsi", "deny-mmsi":
+			f, err := ParseMMSIList(name, raw[name])
+			if err != nil {
+				return nil, err
+			}
+			if name == "allow-mmsi" {
+				o.AllowMMSI = f
+			} else {
+				o.DenyMMSI = f
+			}
+		case "types":
+			t, err := ParseTypeList(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Types = t
+		case "geofence":
+			g, err := parseGeofence(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Geofence = g
+		case "geofence-outside":
+			o.Outside = true
+		case "dedup":
+			d, err := parseSeconds(name, raw[name], dedupDefault)
+			if err != nil {
+				return nil, err
+			}
+			o.Dedup = d
+		case "aisstream", "tcp", "feed", "ingest":
+			if o.Feed != nil {
+				return nil, errors.New("only one of aisstream, tcp, feed and ingest")
+			}
+			f, err := parseFeed(name, raw)
+			if err != nil {
+				return nil, err
+			}
+			o.Feed = f
+		case "bbox", "aisstream-url":
+			if _, ok := raw["aisstream"]; !ok {
+				return nil, errors.New(name + " needs the aisstream option")
+			}
+		case "rate":
+			if raw[name] == "" {
+				return nil, errors.New("rate needs a number of seconds, eg rate=30")
+			}
+			d, err := parseSeconds(name, raw[name], 0)
+			if err != nil {
+				return nil, err
+			}
+			o.Rate = d
+		case "merge", "aggregate":
+			if _, ok := raw["merge"]; ok && name == "aggregate" {
+				return nil, errors.New("a stream can merge or aggregate other streams, not both")
+			}
+			m, err := parseMergeList(name, raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Merge, o.Aggregate = m, name == "aggregate"
+		case "reorder":
+			if _, merged := raw["merge"]; !merged {
+				if _, merged = raw["aggregate"]; !merged {
+					return nil, errors.New("reorder is for merged and aggregated streams")
+				}
+			}
+			d, err := parseSeconds(name, raw[name], 0)
+			if err != nil || d == 0 {
+				return nil, errors.New("reorder needs a number of seconds, eg reorder=5")
+			}
+			o.Reorder = d
+		case "relay":
+			r, err := parseRelay(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Relay = r
+		case "tcp-serve":
+			a, t, err := parseServeAddr(raw)
+			if err != nil {
+				return nil, err
+			}
+			o.Serve, o.ServeTLS = a, t
+		case "push":
+			u, err := parsePush(raw)
+			if err == nil && raw["push-cert"]+raw["push-key"]+raw["push-ca"] != "" {
+				o.PushTLS, err = parseTLSFiles(raw, "push")
+			}
+			if err != nil {
+				return nil, err
+			}
+			o.Push = u
+		case "push-token":
+			if _, ok := raw["push"]; !ok || raw[name] == "" {
+				return nil, errors.New("push-token needs the push option and a token")
+			}
+			o.PushToken = raw[name]
+		case "tcp-cert", "tcp-key", "tcp-ca", "serve-cert", "serve-key", "serve-ca", "push-cert", "push-key", "push-ca":
+			// read with the option they're for, see tls.go
+			if err := checkTLSOption(name, raw); err != nil {
+				return nil, err
+			}
+		case "seq":
+			o.Seq = true
+		case "smooth":
+			if raw[name] == "" {
+				return nil, errors.New("smooth needs a number of seconds, eg smooth=10")
+			}
+			d, err := parseSeconds(name, raw[name], 0)
+			if err != nil {
+				return nil, err
+			}
+			o.Smooth = d
+		case "smooth-size":
+			n, ok := parseSize(raw[name])
+			if !ok || n > 64<<20 {
+				return nil, errors.New("smooth-size needs a buffer size up to 64MB, eg smooth-size=16KB")
+			}
+			o.SmoothSize = int(n)
+		case "recv-buffer":
+			n, ok := parseSize(raw[name])
+			if !ok || n < 512 || n > 65535 {
+				return nil, errors.New("recv-buffer needs a size from 512 to 65535 bytes, eg recv-buffer=9000")
+			}
+			o.RecvBuf = int(n)
+		case "socket-buffer":
+			n, ok := parseSize(raw[name])
+			if !ok || n > 256<<20 {
+				return nil, errors.New("socket-buffer needs a size up to 256MB, eg socket-buffer=4MB")
+			}
+			o.SockBuf = int(n)
+		case "sockets":
+			n, err := strconv.Atoi(raw[name])
+			if err != nil || n < 2 || n > 64 {
+				return nil, errors.New("sockets needs a number of sockets from 2 to 64, eg sockets=4")
+			}
+			o.Sockets = n
+		case "backpressure":
+			p, err := parseBackpressure(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Pressure = p
+		case "allow-from":
+			a, err := parseAllowFrom(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.AllowFrom = a
+		case "batch":
+			n, d, err := parseBatch(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := raw["smooth"]; ok && d > 0 {
+				return nil, errors.New("batch with seconds and smooth can't go together")
+			}
+			o.Batch = n
+			if d > 0 {
+				o.Smooth = d
+			}
+		case "write-through":
+			if _, ok := raw["smooth"]; ok {
+				return nil, errors.New("write-through and smooth can't go together")
+			}
+			if _, ok := raw["batch"]; ok {
+				return nil, errors.New("write-through and batch can't go together")
+			}
+			o.Unbuffered = true
+		case "sink":
+			s, err := parseSink(raw[name])
+			if err != nil {
+				return nil, err
+			}
+			o.Sink = s
+		case "chain":
+			d, err := parseSeconds(name, raw[name], chainEvery)
+			if err != nil {
+				return nil, err
+			}
+			o.Chain = d
+		case "chain-key":
+			if _, ok := raw["chain"]; !ok {
+				return nil, errors.New("chain-key needs the chain option")
+			}
+			if _, err := ReadChainKey(raw[name]); err != nil {
+				return nil, err
+			}
+			o.ChainKey = raw[name]
+		case "index":
+			if _, ok := raw["elk-jsonl"]; ok {
+				return nil, errors.New("index and elk-jsonl can't go together, only CSV and .nmea files are indexed")
+			}
+			o.Index = true
+		case "lint-ignore":
+			// only read by the lint, see lint.go
+			if _, err := parseLintIgnore(raw[name]); err != nil {
+				return nil, err
+			}
+		case "quiet":
+			if raw[name] == "" {
+				return nil, errors.New("quiet needs a number of seconds, eg quiet=600")
+			}
+			d, err := parseSeconds(name, raw[name], 0)
+			if err != nil {
+				return nil, err
+			}
+			o.Quiet = d
+		case "compress", "retain":
+			days, err := parseDays(name, raw[name])
+			if err != nil {
+				return nil, err
+			}
+			if name == "compress" {
+				o.Compress = days
+			} else {
+				o.Retain = days
+			}
+		case "log-file":
+			o.LogFile = true
+		case "pcap":
+			o.Pcap = pcapSize
+			if raw[name] != "" {
+				n, ok := parseSize(raw[name])
+				if !ok || n < 64<<10 || n > 2<<30 {
+					return nil, errors.New("pcap needs a file size from 64KB to 2GB, eg pcap=50MB")
+				}
+				o.Pcap = int64(n)
+			}
+		case "dsc":
+			o.DSC = true
+		case "nmea":
+			o.NMEA = map[string]bool{"*": true}
+			if raw[name] != "" {
+				o.NMEA = make(map[string]bool)
+				for _, t := range strings.Split(raw[name], ",") {
+					t = strings.ToUpper(strings.TrimSpace(t))
+					if len(t) < 3 {
+						return nil, errors.New("nmea needs a list of sentence types, eg GGA,RMC,ZDA or GPGGA: " + raw[name])
+					}
+					o.NMEA[t] = true
+				}
+			}
+		case "talkers":
+			o.Talkers = make(map[string]bool)
+			for _, t := range strings.Split(raw[name], ",") {
+				t = strings.ToUpper(strings.TrimSpace(t))
+				if len(t) != 2 {
+					return nil, errors.New("talkers needs a list of two letter talker IDs, eg AI,AB,BS: " + raw[name])
+				}
+				o.Talkers[t] = true
+			}
+		default:
+			return nil, errors.New("unknown option: " + name)
+		}
+	}
+	if _, ok := raw["tags"]; !ok && o.Output == "opencpn-vdr" {
+		// the plugin expects bare sentences
+		o.Tags = "drop"
+	}
+	if o.TimeFmt != nil && (o.VdrStrict || o.Output != "") {
+		return nil, errors.New("time-format and timezone are for the LogAIS format, vdr-strict and the output presets have their own")
+	}
+	if o.Chain > 0 && (o.VdrStrict || o.Output != "") {
+		return nil, errors.New("chain writes comment lines into the daily file, vdr-strict and the output presets can't have them")
+	}
+	if o.AllowFrom != nil && (o.Feed != nil || o.Merge != nil) {
+		return nil, errors.New("allow-from is for streams listening on their UDP port")
+	}
+	if o.Pcap > 0 && o.Merge != nil {
+		return nil, errors.New("pcap captures datagrams as they're received, capture the streams merged instead")
+	}
+	if o.Merge != nil {
+		if o.Feed != nil {
+			return nil, errors.New("a merged stream can't have a network feed too")
+		}
+		if _, ok := raw["dedup"]; !ok && !o.Aggregate {
+			o.Dedup = dedupDefault
+		}
+	}
+	return o, nil
+}
+
+// QualitySpec is the quality option, see quality.go.
+type QualitySpec struct {
+	Sentence string // proprietary sentence id without the $, empty for trailing fields only
+	RSSI     int    // field numbers in the proprietary sentence
+	SNR      int
+}
+
+func parseQualitySpec(value string) (*QualitySpec, error) {
+	q := &QualitySpec{}
+	if value == "" {
+		return q, nil
+	}
+	f := strings.Split(value, ",")
+	if len(f) != 3 || !strings.HasPrefix(strings.ToUpper(f[0]), "P") {
+		return nil, errors.New("quality needs a proprietary sentence and two field numbers, eg quality=PAIS,2,3")
+	}
+	q.Sentence = strings.ToUpper(f[0])
+	var err1, err2 error
+	q.RSSI, err1 = strconv.Atoi(f[1])
+	q.SNR, err2 = strconv.Atoi(f[2])
+	if err1 != nil || err2 != nil || q.RSSI < 0 || q.SNR < 0 {
+		return nil, errors.New("quality field numbers must be whole numbers")
+	}
+	return q, nil
+}
+
+func parseGeoJSON(value string) (string, error) {
+	switch value {
+	case "", "ndjson":
+		return "ndjson", nil
+	case "collection":
+		return value, nil
+	}
+	return "", errors.New("geojson must be ndjson or collection: " + value)
+}
+
+func parseTagOption(value string) (string, error) {
+	switch value {
+	case "keep", "fields", "drop":
+		return value, nil
+	}
+	return "", errors.New("tags must be keep, fields or drop: " + value)
+}
+
+func parseSeconds(name string, value string, def time.Duration) (time.Duration, error) {
+	// option value in seconds, def if not given
+	if value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("%s needs a number of seconds: %s", name, value)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func parseSize(value string) (uint64, bool) {
+	// bytes, or with KB, MB, GB or TB
+	size := strings.ToUpper(value)
+	mult := uint64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if s, ok := strings.CutSuffix(size, unit); ok {
+			size, mult = s, 1<<(10*(i+1))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(size, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return uint64(n * float64(mult)), true
+}
+
+func parseDays(name string, value string) (int, error) {
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return 0, fmt.Errorf("%s needs a whole number of days of at least 1: %s", name, value)
+	}
+	return days, nil
+}
+
+func parseMergeList(name string, value string) ([]string, error) {
+	var ports []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, errors.New(name + " needs the ports of the streams to take from, eg " + name + "=10110,10111")
+	}
+	return ports, nil
+}
+
+func parseRelay(value string) ([]string, error) {
+	var hosts []string
+	for _, h := range strings.Split(value, ",") {
+		h = strings.TrimSpace(h)
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			return nil, errors.New("relay needs UDP host:port addresses: " + h)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func parseServeAddr(raw map[string]string) (string, *TLSFiles, error) {
+	addr, secure := strings.CutPrefix(raw["tcp-serve"], "tls://")
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		return "", nil, errors.New("tcp-serve needs an address to listen on, [host]:port eg :10111, or tls://[host]:port")
+	}
+	if !secure {
+		return addr, nil, nil
+	}
+	if raw["serve-cert"] == "" {
+		return "", nil, errors.New("tcp-serve=tls:// needs serve-cert and serve-key")
+	}
+	t, err := parseTLSFiles(raw, "serve")
+	return addr, t, err
+}
+
+func parsePush(raw map[string]string) (string, error) {
+	u, err := url.Parse(raw["push"])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("push needs the collector's URL, eg https://central:8080/api/ingest/10110: " + raw["push"])
+	}
+	return u.String(), nil
+}
+
+func parseBackpressure(value string) (string, error) {
+	switch value {
+	case "block", "drop-oldest", "drop-newest":
+		return value, nil
+	}
+	return "", errors.New("backpressure needs block, drop-oldest or drop-newest: " + value)
+}
+
+func parseAllowFrom(value string) ([]netip.Prefix, error) {
+	var allow []netip.Prefix
+	for _, a := range strings.Split(value, ",") {
+		a = strings.TrimSpace(a)
+		p, err := netip.ParsePrefix(a)
+		if err != nil {
+			ip, ierr := netip.ParseAddr(a)
+			if ierr != nil {
+				return nil, errors.New("allow-from needs IP addresses or CIDR ranges, eg 10.1.2.3,192.168.40.0/24: " + a)
+			}
+			p = netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen())
+		}
+		allow = append(allow, p.Masked())
+	}
+	return allow, nil
+}
+
+func parseBatch(value string) (int, time.Duration, error) {
+	// records[,seconds]
+	count, secs, _ := strings.Cut(value, ",")
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return 0, 0, errors.New("batch needs a number of records and optionally seconds, eg batch=100,0.25")
+	}
+	d, err := parseSeconds("batch", secs, 0)
+	return n, d, err
+}
+
+func parseSink(value string) (string, error) {
+	if !sink.Known(value) {
+		return "", errors.New("sink must be one of " + strings.Join(sink.Names(), ", ") + ", eg sink=exec:command: " + value)
+	}
+	return value, nil
+}
+
+// ReadChainKey reads the chain-key option's Ed25519 private key, see chain.go.
+func ReadChainKey(name string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("chain-key: no PEM key in " + name)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("chain-key: " + err.Error())
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("chain-key must be an Ed25519 key: " + name)
+	}
+	return key, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// TimeFormat is a stream's time-format and timezone options, nil for the
+// default UTC ISO 8601 with milliseconds, see timefmt.go.
+type TimeFormat struct {
+	epoch time.Duration  // unit of epoch times, 0 for ISO
+	micro bool           // ISO to the microsecond
+	loc   *time.Location // timezone of ISO times
+}
+
+func parseTimeFormat(raw map[string]string) (*TimeFormat, error) {
+	f := &TimeFormat{loc: time.UTC}
+	switch raw["time-format"] {
+	case "", "iso":
+	case "iso-us":
+		f.micro = true
+	case "epoch":
+		f.epoch = time.Second
+	case "epoch-ms":
+		f.epoch = time.Millisecond
+	case "epoch-us":
+		f.epoch = time.Microsecond
+	default:
+		return nil, errors.New("time-format must be iso, iso-us, epoch, epoch-ms or epoch-us: " + raw["time-format"])
+	}
+	if name, ok := raw["timezone"]; ok {
+		if f.epoch != 0 {
+			return nil, errors.New("timezone is for iso times, epoch times have none")
+		}
+		loc, err := parseTimezone(name)
+		if err != nil {
+			return nil, err
+		}
+		f.loc = loc
+	}
+	if f.epoch == 0 && !f.micro && f.loc == time.UTC {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func parseTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, errors.New("timezone needs a name, eg Pacific/Auckland, or an offset, eg +05:30")
+	}
+	if name[0] == '+' || name[0] == '-' {
+		t, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, errors.New("timezone offset must be +hh:mm or -hh:mm: " + name)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(name, offset), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.New("unknown timezone, eg Pacific/Auckland or +05:30: " + name)
+	}
+	return loc, nil
+}
+
+// Format writes a time in the format, f must not be nil.
+func (f *TimeFormat) Format(t time.Time) string {
+	switch {
+	case f.epoch == time.Microsecond:
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	case f.epoch == time.Millisecond:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case f.epoch == time.Second:
+		ms := t.UnixMilli()
+		return strconv.FormatInt(ms/1000, 10) + "." + strconv.FormatInt(1000+ms%1000, 10)[1:]
+	}
+	if f.micro {
+		return t.In(f.loc).Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+	return t.In(f.loc).Format("2006-01-02T15:04:05.000Z07:00")
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TLS for the TCP feed, the TCP server and push, for data crossing the internet:
+//
+//	tcp=tls://host:port	TLS to the feed, its certificate checked against the system's CAs
+//		tcp-ca=file	or these instead (PEM)
+//		tcp-cert=file tcp-key=file	client certificate and key to present (PEM)
+//	tcp-serve=tls://[host]:port	TLS to clients, needs
+//		serve-cert=file serve-key=file	the server's certificate and key
+//		serve-ca=file	clients must present a certificate from these CAs
+//	push=https://...
+//		push-ca=file push-cert=file push-key=file	as for tcp, also -push-ca etc for logais-edge
+//
+// The files are checked for changes whenever they're used, when the feed
+// connects, a client connects or a batch is pushed, so renewed certificates are
+// picked up without a restart. Connections already open carry on with the old
+// ones. Files that changed but can't be read, eg while being written, are logged
+// and the old ones used until they change again.
+
+// TLSFiles are the certificate, key and CA files of a TLS option, empty for none.
+type TLSFiles struct {
+	Cert, Key, CA string
+}
+
+// TLSLoaded is what TLSFiles held when they were read.
+type TLSLoaded struct {
+	cert *tls.Certificate // nil for none
+	pool *x509.CertPool   // nil for the system's CAs, or no client certificates asked for
+}
+
+type tlsState struct {
+	stamp  string // modification times and sizes of the files read
+	loaded *TLSLoaded
+	err    error
+}
+
+var (
+	tlsMu    sync.Mutex
+	tlsCache = make(map[TLSFiles]*tlsState)
+)
+
+// NewTLSFiles checks and reads the files, so mistakes show when the config is read.
+func NewTLSFiles(cert, key, ca string) (*TLSFiles, error) {
+	if (cert == "") != (key == "") {
+		return nil, errors.New("a certificate needs its key and a key its certificate")
+	}
+	t := &TLSFiles{Cert: cert, Key: key, CA: ca}
+	if _, err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseTLSFiles(raw map[string]string, prefix string) (*TLSFiles, error) {
+	// the prefix-cert, -key and -ca options
+	t, err := NewTLSFiles(raw[prefix+"-cert"], raw[prefix+"-key"], raw[prefix+"-ca"])
+	if err != nil {
+		return nil, errors.New(prefix + "-cert, " + prefix + "-key, " + prefix + "-ca: " + err.Error())
+	}
+	return t, nil
+}
+
+func checkTLSOption(name string, raw map[string]string) error {
+	// a file option has the option it's for, with TLS
+	prefix, _, _ := strings.Cut(name, "-")
+	owner, scheme := prefix, "tls://"
+	switch prefix {
+	case "serve":
+		owner = "tcp-serve"
+	case "push":
+		scheme = "https://"
+	}
+	if raw[name] == "" || !strings.HasPrefix(raw[owner], scheme) {
+		return errors.New(name + " needs a file and " + owner + "=" + scheme + "...")
+	}
+	return nil
+}
+
+// Same is whether both are the same files, or both nil.
+func (t *TLSFiles) Same(u *TLSFiles) bool {
+	return t == nil && u == nil || t != nil && u != nil && *t == *u
+}
+
+func (t *TLSFiles) stamp() (string, error) {
+	var b strings.Builder
+	for _, name := range []string{t.Cert, t.Key, t.CA} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.FormatInt(fi.ModTime().UnixNano(), 10) + "," + strconv.FormatInt(fi.Size(), 10) + ";")
+	}
+	return b.String(), nil
+}
+
+func (t *TLSFiles) read() (*TLSLoaded, error) {
+	ld := &TLSLoaded{}
+	if t.Cert != "" {
+		c, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		ld.cert = &c
+	}
+	if t.CA != "" {
+		b, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		ld.pool = x509.NewCertPool()
+		if !ld.pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no PEM certificates in " + t.CA)
+		}
+	}
+	return ld, nil
+}
+
+func (t *TLSFiles) load() (*TLSLoaded, error) {
+	// the files as last read, read again if they changed; what was read
+	// before and the error if they can't be
+	stamp, err := t.stamp()
+	tlsMu.Lock()
+	defer tlsMu.Unlock()
+	s := tlsCache[*t]
+	if s == nil {
+		s = &tlsState{}
+		tlsCache[*t] = s
+	} else if err == nil && stamp == s.stamp {
+		if s.loaded == nil {
+			return nil, s.err
+		}
+		return s.loaded, nil
+	}
+	var ld *TLSLoaded
+	if err == nil {
+		ld, err = t.read()
+	}
+	s.stamp, s.err = stamp, err
+	if err != nil {
+		return s.loaded, err
+	}
+	s.loaded = ld
+	return ld, nil
+}
+
+// Current is the files as last read, read again if they changed. It's nil and
+// the error only if they were never read; files that changed but can't be read
+// are logged and the old ones kept.
+func (t *TLSFiles) Current(logit *slog.Logger) (*TLSLoaded, error) {
+	ld, err := t.load()
+	if ld == nil {
+		return nil, err
+	}
+	if err != nil {
+		logit.Warn("TLS files changed but can't be read, carrying on with the old ones", "cert", t.Cert, "ca", t.CA, "err", err)
+	}
+	return ld, nil
+}
+
+// Client is the config to connect to host with.
+func (ld *TLSLoaded) Client(host string) *tls.Config {
+	c := &tls.Config{ServerName: host, RootCAs: ld.pool, MinVersion: tls.VersionTLS12}
+	if ld.cert != nil {
+		c.Certificates = []tls.Certificate{*ld.cert}
+	}
+	return c
+}
+
+// Server is the config to serve with, asking for client certificates if there are CAs.
+func (ld *TLSLoaded) Server() *tls.Config {
+	c := &tls.Config{ClientCAs: ld.pool, MinVersion: tls.VersionTLS12}
+	if ld.cert != nil {
+		c.Certificates = []tls.Certificate{*ld.cert}
+	}
+	if ld.pool != nil {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return c
+}
+
+// ServerConfig is for a listener, the files are checked at each handshake.
+func (t *TLSFiles) ServerConfig(logit *slog.Logger) *tls.Config {
+	return &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		ld, err := t.Current(logit)
+		if ld == nil {
+			return nil, err
+		}
+		return ld.Server(), nil
+	}}
+}
@@ -0,0 +1,392 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TOML config file, LogAIS.toml, read instead of LogAIS.txt if it exists. It says
+// the same things as the tab separated file with room for long option lists:
+//
+//	station = "-36.84,174.77"
+//	station-id = "AKL-01"
+//	peer = "http://standby:8080"
+//	restart = "sun 03:00"
+//	vessel-lost = 30
+//	http-tls = "/etc/logais/cert.pem /etc/logais/key.pem"  # fields of a line, space separated
+//
+//	[coldstore]
+//	path = "/mnt/archive"
+//	days = 90
+//
+//	[[stream]]
+//	port = 10110
+//	name = "Harbour receiver"
+//	dedup = 5                  # any stream option, name = value
+//	nmea = ["GGA", "RMC"]      # lists are comma separated options
+//	seq = true                 # options without a value, false leaves them out
+//
+//	[[profile]]
+//	name = "storm"
+//	ports = [10110]
+//	rate = 10
+//
+//	[[schedule]]
+//	at = "18:00"
+//	profile = "storm"
+//
+//	[[node]]
+//	name = "shore1"
+//	url = "http://shore1:8080"
+//
+// Only the part of TOML a config file needs is read: comments, [table] and
+// [[table]] headers without dots, and keys set to strings, numbers, booleans or
+// arrays of those. Errors give the line of the offending key, or of the table
+// header when options only clash together.
+
+type tomlValue struct {
+	text  string      // string contents, or a number or boolean as written
+	kind  byte        // 's'tring, 'n'umber, 'b'oolean or 'a'rray
+	items []tomlValue // array elements
+}
+
+func (v tomlValue) String() string {
+	// option value, arrays comma separated
+	if v.kind != 'a' {
+		return v.text
+	}
+	parts := make([]string, len(v.items))
+	for i, item := range v.items {
+		parts[i] = item.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+type tomlTable struct {
+	name  string // "" for the keys before the first header
+	line  int
+	keys  []string // in file order
+	vals  map[string]tomlValue
+	lines map[string]int
+}
+
+type tomlParser struct {
+	src []byte
+	pos int
+}
+
+func (p *tomlParser) line() int {
+	return 1 + strings.Count(string(p.src[:p.pos]), "\n")
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: "+format, append([]any{p.line()}, args...)...)
+}
+
+func (p *tomlParser) skip(newlines bool) {
+	// spaces, and comments and newlines if asked
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skip(false)
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		return p.errorf("unexpected %q after value", p.src[p.pos])
+	}
+	return nil
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) key() (string, error) {
+	if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		v, err := p.value()
+		return v.text, err
+	}
+	start := p.pos
+	for p.pos < len(p.src) && isBareKey(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a key or [table]")
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+func (p *tomlParser) value() (tomlValue, error) {
+	if p.pos >= len(p.src) {
+		return tomlValue{}, p.errorf("missing value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '"':
+		var b strings.Builder
+		for p.pos++; p.pos < len(p.src); p.pos++ {
+			switch c := p.src[p.pos]; c {
+			case '"':
+				p.pos++
+				return tomlValue{text: b.String(), kind: 's'}, nil
+			case '\n':
+				return tomlValue{}, p.errorf("string not closed")
+			case '\\':
+				if p.pos++; p.pos >= len(p.src) {
+					return tomlValue{}, p.errorf("string not closed")
+				}
+				e, ok := map[byte]byte{'"': '"', '\\': '\\', 't': '\t', 'n': '\n', 'r': '\r'}[p.src[p.pos]]
+				if !ok {
+					return tomlValue{}, p.errorf("unsupported escape \\%c", p.src[p.pos])
+				}
+				b.WriteByte(e)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return tomlValue{}, p.errorf("string not closed")
+	case c == '\'':
+		end := strings.IndexAny(string(p.src[p.pos+1:]), "'\n")
+		if end < 0 || p.src[p.pos+1+end] != '\'' {
+			return tomlValue{}, p.errorf("string not closed")
+		}
+		v := tomlValue{text: string(p.src[p.pos+1 : p.pos+1+end]), kind: 's'}
+		p.pos += end + 2
+		return v, nil
+	case c == '[':
+		v := tomlValue{kind: 'a'}
+		p.pos++
+		for {
+			p.skip(true)
+			if p.pos < len(p.src) && p.src[p.pos] == ']' {
+				p.pos++
+				return v, nil
+			}
+			item, err := p.value()
+			if err != nil {
+				return v, err
+			}
+			if item.kind == 'a' {
+				return v, p.errorf("arrays of arrays aren't used by any setting")
+			}
+			v.items = append(v.items, item)
+			p.skip(true)
+			if p.pos < len(p.src) && p.src[p.pos] == ',' {
+				p.pos++
+			} else if p.pos >= len(p.src) || p.src[p.pos] != ']' {
+				return v, p.errorf("expected , or ] in array")
+			}
+		}
+	case c == '{':
+		return tomlValue{}, p.errorf("inline tables aren't supported, use a [table]")
+	default:
+		start := p.pos
+		for p.pos < len(p.src) && strings.IndexByte("+-._:0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		word := string(p.src[start:p.pos])
+		switch {
+		case word == "true" || word == "false":
+			return tomlValue{text: word, kind: 'b'}, nil
+		case word != "" && strings.Trim(word, "+-._0123456789eE") == "" && !strings.Contains(word, ":"):
+			return tomlValue{text: strings.ReplaceAll(word, "_", ""), kind: 'n'}, nil
+		case word != "":
+			return tomlValue{}, p.errorf("%s isn't a value, strings and times need quotes", word)
+		}
+		return tomlValue{}, p.errorf("missing value")
+	}
+}
+
+func parseTOML(src []byte) ([]*tomlTable, error) {
+	p := &tomlParser{src: src}
+	tables := []*tomlTable{{line: 1, vals: make(map[string]tomlValue), lines: make(map[string]int)}}
+	seen := make(map[string]bool) // [table] names, which can only appear once
+	for {
+		p.skip(true)
+		if p.pos >= len(p.src) {
+			return tables, nil
+		}
+		line := p.line()
+		if p.src[p.pos] == '[' {
+			array := strings.HasPrefix(string(p.src[p.pos:]), "[[")
+			opener, closer := "[", "]"
+			if array {
+				opener, closer = "[[", "]]"
+			}
+			end := strings.Index(string(p.src[p.pos:]), closer)
+			if end < 0 || strings.Contains(string(p.src[p.pos:p.pos+end]), "\n") {
+				return nil, p.errorf("table header not closed with %s", closer)
+			}
+			name := strings.TrimSpace(string(p.src[p.pos+len(opener) : p.pos+end]))
+			p.pos += end + len(closer)
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			if !array {
+				if seen[name] {
+					return nil, fmt.Errorf("line %d: [%s] appears twice", line, name)
+				}
+				seen[name] = true
+			}
+			if kind, ok := tomlTables[name]; !ok || kind != array {
+				return nil, fmt.Errorf("line %d: unknown table %s%s%s, expected [[stream]], [[profile]], [[schedule]], [[node]] or [coldstore]", line, opener, name, closer)
+			}
+			tables = append(tables, &tomlTable{name: name, line: line, vals: make(map[string]tomlValue), lines: make(map[string]int)})
+			continue
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		p.skip(false)
+		if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+			return nil, p.errorf("expected = after %s", key)
+		}
+		p.pos++
+		p.skip(false)
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.endOfLine(); err != nil {
+			return nil, err
+		}
+		t := tables[len(tables)-1]
+		key = strings.ToLower(key)
+		if _, dup := t.vals[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", line, key)
+		}
+		t.keys = append(t.keys, key)
+		t.vals[key] = v
+		t.lines[key] = line
+	}
+}
+
+// table names, true for [[arrays]]
+var tomlTables = map[string]bool{"stream": true, "profile": true, "schedule": true, "node": true, "coldstore": false}
+
+func (t *tomlTable) header() string {
+	if tomlTables[t.name] {
+		return "[[" + t.name + "]]"
+	}
+	return "[" + t.name + "]"
+}
+
+func (t *tomlTable) need(keys ...string) ([]string, error) {
+	// the values of keys the table must have
+	var vals []string
+	for _, k := range keys {
+		v, ok := t.vals[k]
+		if !ok || v.String() == "" {
+			return nil, fmt.Errorf("line %d: %s needs %s", t.line, t.header(), k)
+		}
+		vals = append(vals, v.String())
+	}
+	return vals, nil
+}
+
+func (t *tomlTable) options(skip ...string) ([]string, error) {
+	// the rest of the keys as name=value options, checked one at a time first
+	// so an error can name the key's line
+	var fields []string
+	raw := make(map[string]string)
+	for _, k := range t.keys {
+		v := t.vals[k]
+		if slices.Contains(skip, k) || v.kind == 'b' && v.text == "false" {
+			continue
+		}
+		if v.kind == 'b' {
+			fields = append(fields, k)
+			raw[k] = ""
+		} else {
+			fields = append(fields, k+"="+v.String())
+			raw[k] = v.String()
+		}
+	}
+	if _, err := ParseOptions(raw); err != nil {
+		for _, k := range t.keys {
+			if _, ok := raw[k]; !ok {
+				continue
+			}
+			if _, kerr := ParseOptions(map[string]string{k: raw[k]}); kerr != nil && kerr.Error() == err.Error() {
+				return nil, fmt.Errorf("line %d: %v", t.lines[k], err)
+			}
+		}
+		return nil, fmt.Errorf("line %d: %s: %v", t.line, t.header(), err)
+	}
+	return fields, nil
+}
+
+func tomlLines(src []byte) ([]configLine, error) {
+	// the TOML file as the lines of a tab separated one
+	tables, err := parseTOML(src)
+	if err != nil {
+		return nil, err
+	}
+	var lines []configLine
+	for _, t := range tables {
+		var fields []string
+		switch t.name {
+		case "":
+			for _, k := range t.keys {
+				switch k {
+				case "station", "station-id", "peer", "restart", "vessel-lost", "lint-ignore", "api-token", "http-user", "http-token", "http-tls", "low-disk", "ntp", "syslog", "log-rotate":
+					lines = append(lines, configLine{num: t.lines[k], fields: []string{k, t.vals[k].String()}})
+				default:
+					return nil, fmt.Errorf("line %d: unknown setting %s, expected station, station-id, peer, restart, vessel-lost, lint-ignore, api-token, http-user, http-token, http-tls, low-disk, ntp, syslog or log-rotate", t.lines[k], k)
+				}
+			}
+			continue
+		case "stream":
+			if fields, err = t.need("port", "name"); err != nil {
+				return nil, err
+			}
+			opts, err := t.options("port", "name")
+			if err != nil {
+				return nil, err
+			}
+			if slices.Contains([]string{"profile", "schedule", "station", "station-id", "coldstore", "peer", "node", "restart", "vessel-lost", "lint-ignore", "api-token", "http-user", "http-token", "http-tls", "low-disk", "ntp", "syslog", "log-rotate"}, strings.ToLower(fields[0])) {
+				return nil, fmt.Errorf("line %d: %s isn't a port", t.lines["port"], fields[0])
+			}
+			fields = append(fields, opts...)
+		case "profile":
+			if fields, err = t.need("name"); err != nil {
+				return nil, err
+			}
+			opts, err := t.options("name", "ports")
+			if err != nil {
+				return nil, err
+			}
+			fields = append([]string{"profile"}, fields...)
+			if ports, ok := t.vals["ports"]; ok {
+				fields = append(fields, "ports="+ports.String())
+			}
+			fields = append(fields, opts...)
+		case "schedule", "node", "coldstore":
+			keys := map[string][]string{"schedule": {"at", "profile"}, "node": {"name", "url"}, "coldstore": {"path", "days"}}[t.name]
+			if fields, err = t.need(keys...); err != nil {
+				return nil, err
+			}
+			for _, k := range t.keys {
+				if !slices.Contains(keys, k) {
+					return nil, fmt.Errorf("line %d: unknown setting %s in %s", t.lines[k], k, t.name)
+				}
+			}
+			fields = append([]string{t.name}, fields...)
+		}
+		lines = append(lines, configLine{num: t.line, fields: fields})
+	}
+	return lines, nil
+}
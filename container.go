@@ -0,0 +1,52 @@
+//go:build !edge
+
+package logais
+
+/*
+Container mode, -container or LOGAIS_CONTAINER=1, for Docker, Kubernetes and the like:
+ - the application log goes to stdout without rotation, for docker logs or the
+   cluster's log collector; fatal errors go to stderr
+ - the data folder defaults to /data, to mount a volume on (or LOGAIS_DATA_DIR)
+ - the whole config can be given in LOGAIS_CONFIG_TOML, or LOGAIS_CONFIG_TEXT
+   for the tab separated format, instead of a file, eg mounted at $LOGAIS_CONFIG
+ - -http defaults to $LOGAIS_HTTP, which needs users or tokens unless it's a
+   loopback address (see apiauth.go), eg in LOGAIS_HTTP_USER
+The config variables work in any mode, when no -config or LOGAIS_CONFIG names a
+file. A config given that way can't change without a restart, SIGHUP reads the
+same variable again; mount a file to reload it.
+*/
+
+import (
+	"os"
+	"slices"
+)
+
+var Container bool
+
+// config variables, as configPath gives them
+var configVars = []string{"$LOGAIS_CONFIG_TOML", "$LOGAIS_CONFIG_TEXT"}
+
+func containerMode() bool {
+	// needed before the flags are parsed, to set the default paths
+	if v := os.Getenv("LOGAIS_CONTAINER"); v != "" && v != "0" && v != "false" {
+		return true
+	}
+	return slices.Contains(os.Args[1:], "-container") || slices.Contains(os.Args[1:], "--container")
+}
+
+func envConfig() string {
+	// config variable to read, empty if none set
+	for _, v := range configVars {
+		if os.Getenv(v[1:]) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func closeLog() {
+	// stdout stays open, restartNow's exec carries on writing to it
+	if Logfile != os.Stdout {
+		Logfile.Close()
+	}
+}
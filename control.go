@@ -0,0 +1,183 @@
+//go:build !edge
+
+package logais
+
+/*
+Control API on the -http address, for managing remote recorders centrally.
+Every call needs the token from the config line
+ api-token <tab> token
+(or LOGAIS_API_TOKEN) as "Authorization: Bearer token"; without one the
+control API is off.
+ GET /api/streams	every stream with its state and counters
+ GET /api/streams/{port}	one stream, with its stats summary as logged hourly
+ POST /api/streams/{port}/stop	stop the stream, closing its files, until start or a restart
+ POST /api/streams/{port}/start	start a stopped stream again
+ POST /api/streams/{port}/pause	keep listening but record nothing until resume
+ POST /api/streams/{port}/resume
+ POST /api/streams/{port}/rollover	close the stream's files, writing what smooth holds,
+	and open them again with a "# Restarted" line; daily files keep their names
+ POST /api/profile/{name}	switch every stream to a profile, default for none, until
+	the next change the schedule makes, as -profile does
+Streams stopped or paused this way are shown as such by /healthz and the status
+page but don't make /healthz fail. A config reload starts stopped streams again.
+Every change is logged and written to audit.log.
+*/
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+type streamControl struct {
+	Port    string           `json:"port"`
+	Name    string           `json:"name"`
+	State   string           `json:"state"` // recording, paused, stopped
+	Stats   map[string]int64 `json:"stats"`
+	Summary string           `json:"summary,omitempty"`
+}
+
+func apiToken() string {
+	if t := os.Getenv("LOGAIS_API_TOKEN"); t != "" {
+		return t
+	}
+	return currentConfig().APIToken
+}
+
+func controlAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := apiToken()
+		if token == "" {
+			http.Error(w, "control API is off, set an api-token in the config", http.StatusForbidden)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "wrong or missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (st *Stream) state() string {
+	switch {
+	case st.done() || st.stopping():
+		return "stopped"
+	case st.paused.Load():
+		return "paused"
+	}
+	return "recording"
+}
+
+func (st *Stream) control() streamControl {
+	return streamControl{Port: st.Port, Name: st.Name, State: st.state(), Stats: st.stats.counts()}
+}
+
+func streamsHandler(w http.ResponseWriter, r *http.Request) {
+	list := []streamControl{}
+	for _, st := range currentConfig().Streams {
+		list = append(list, st.control())
+	}
+	writeJSON(w, list)
+}
+
+func controlStream(w http.ResponseWriter, r *http.Request) *Stream {
+	var st *Stream
+	for _, s := range currentConfig().Streams {
+		if s.Port == r.PathValue("port") {
+			st = s
+			break
+		}
+	}
+	if st == nil {
+		http.Error(w, "no stream on port "+r.PathValue("port"), http.StatusNotFound)
+	}
+	return st
+}
+
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	if st := controlStream(w, r); st != nil {
+		c := st.control()
+		c.Summary = st.stats.summary()
+		writeJSON(w, c)
+	}
+}
+
+func streamActionHandler(w http.ResponseWriter, r *http.Request) {
+	action := r.PathValue("action")
+	if !slices.Contains([]string{"stop", "start", "pause", "resume", "rollover"}, action) {
+		http.Error(w, "action must be stop, start, pause, resume or rollover", http.StatusNotFound)
+		return
+	}
+	// one change at a time, and not during a reload
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	st := controlStream(w, r)
+	if st == nil {
+		return
+	}
+	stopped := st.state() == "stopped"
+	switch {
+	case action == "start" && !stopped, action != "start" && stopped:
+		http.Error(w, "stream "+st.Port+" is "+st.state(), http.StatusConflict)
+		return
+	case action == "stop":
+		st.halted.Store(true)
+		st.stop()
+	case action == "start":
+		st = restartStream(st)
+	case action == "pause":
+		st.paused.Store(true)
+	case action == "resume":
+		st.paused.Store(false)
+	case action == "rollover":
+		select {
+		case st.roll <- struct{}{}:
+		default:
+			// one is waiting already
+		}
+	}
+	text := "control API: " + action + " stream " + st.Port
+	Logit.Info(text, "port", st.Port, "from", r.RemoteAddr)
+	if err := auditLog(text + " from " + r.RemoteAddr); err != nil {
+		Logit.Error("audit log", "err", err)
+	}
+	Events.publish(EventControl, st.Port, action)
+	writeJSON(w, st.control())
+}
+
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if err := setProfile(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	text := "control API: profile " + name
+	Logit.Info(text, "from", r.RemoteAddr)
+	if err := auditLog(text + " from " + r.RemoteAddr); err != nil {
+		Logit.Error("audit log", "err", err)
+	}
+	writeJSON(w, map[string]string{"profile": name})
+}
+
+func restartStream(old *Stream) *Stream {
+	// a stopped stream can't run again, a new one takes its place
+	st := newStream(old.Stream)
+	st.seq = old.seq
+	profMutex.Lock()
+	streams := slices.Clone(Conf.Streams)
+	streams[slices.Index(streams, old)] = st
+	Conf.Streams = streams
+	profile := ActiveProf
+	profMutex.Unlock()
+	setProfile(profile)
+	linkMerges(streams)
+	runStream(st)
+	return st
+}
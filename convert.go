@@ -0,0 +1,196 @@
+//go:build !edge
+
+package logais
+
+/*
+logais convert: rewrite recordings in another of the formats LogAIS writes.
+ logais convert -to csv|vdr|nmea [-o folder] [-ms] [-f] file ...
+ csv	the LogAIS format, timestamp,type,id,message (.csv)
+ vdr	the strict OpenCPN VDR format, the documented columns only (-vdr.csv)
+ nmea	raw sentences, each with a TAG block giving its time (.nmea, CRLF)
+Any of them, and the older dialects play reads, can be converted from. Going to
+nmea the time goes in the TAG block's c: field, added to a TAG block the
+sentence was recorded with unless that has a time of its own (as the pyais-raw
+preset does); it's in seconds, as other programs expect, or in milliseconds
+with -ms. Going from nmea the time comes from the TAG block and
+lines without one are left out. A TAG block stays in front of the sentence,
+except in vdr where the plugin doesn't expect one.
+Each file is written next to it, or in the -o folder, named for the format;
+-o - writes one file to stdout. Existing files are only replaced with -f.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// converted file name endings
+var convertExt = map[string]string{"csv": ".csv", "vdr": "-vdr.csv", "nmea": ".nmea"}
+
+func recordingBase(name string) string {
+	// file name without its folder and endings, eg 20261016-10110
+	base := strings.TrimSuffix(filepath.Base(name), ".gz")
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return strings.TrimSuffix(base, "-vdr")
+}
+
+func convertName(name string, format string, dir string) string {
+	// name with the format's ending instead of its own
+	if dir == "" {
+		dir = filepath.Dir(name)
+	}
+	return filepath.Join(dir, recordingBase(name)+convertExt[format])
+}
+
+func nmeaLine(rec *recRecord, ms bool) string {
+	// the sentence with its time added to its TAG block, one with a time of its own is kept as it is
+	raw, sentence := splitTag(rec.Sentence)
+	body, _, _ := strings.Cut(raw, "*")
+	var fields []string
+	for _, f := range strings.Split(body, ",") {
+		if strings.HasPrefix(f, "c:") {
+			return rec.Sentence + "\r\n"
+		}
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	c := strconv.FormatInt(rec.Time.Unix(), 10)
+	if ms {
+		c = strconv.FormatInt(rec.Time.UnixMilli(), 10)
+	}
+	fields = append(fields, "c:"+c)
+	return withChecksum("\\"+strings.Join(fields, ",")) + "\\" + sentence + "\r\n"
+}
+
+func convertLine(rec *recRecord, format string, ms bool) string {
+	switch format {
+	case "nmea":
+		return nmeaLine(rec, ms)
+	case "vdr":
+		_, sentence := splitTag(rec.Sentence)
+		return formatRecord(true, rec.Time.Format(timeLayout), rec.Source, sentence, "")
+	}
+	return formatRecord(false, rec.Time.Format(timeLayout), rec.Source, rec.Sentence, "")
+}
+
+func convertHeader(format string, made string) string {
+	// made says where the records came from
+	switch format {
+	case "nmea":
+		return ""
+	case "vdr":
+		return vdrHeader
+	}
+	return "# VDR Log File refer:\r\n" +
+		"# https://opencpn-manuals.github.io/main/vdr/log_format.html\r\n" +
+		"# " + made + " by LogAIS v" + Version + "\r\n" +
+		"# actual format in use differs from documented format:\r\n" +
+		"timestamp,type,id,message\r\n"
+}
+
+func convertFile(name string, out io.Writer, format string, ms bool) (int, int, error) {
+	// records written and .nmea lines left out
+	rr, err := openRecording(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rr.Close()
+	w := bufio.NewWriterSize(out, 65536)
+	if _, err := w.WriteString(convertHeader(format, "Converted from "+filepath.Base(name))); err != nil {
+		return 0, 0, err
+	}
+	n := 0
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, rr.untimed, err
+		}
+		if _, err := w.WriteString(convertLine(rec, format, ms)); err != nil {
+			return n, rr.untimed, err
+		}
+		n++
+	}
+	return n, rr.untimed, w.Flush()
+}
+
+func convertTo(name string, path string, format string, ms bool, force bool) (int, int, error) {
+	// into path, made complete before it replaces anything there
+	if _, err := os.Stat(path); err == nil && !force {
+		return 0, 0, errors.New(path + " exists, -f to replace it")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".convert-*")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, skipped, err := convertFile(name, tmp, format, ms)
+	tmp.Chmod(0664)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, skipped, err
+	}
+	return n, skipped, os.Rename(tmp.Name(), path)
+}
+
+func convertCmd(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("to", "", "format to convert to: csv, vdr or nmea")
+	dir := fs.String("o", "", "folder for the converted files, - for stdout (default next to each file)")
+	ms := fs.Bool("ms", false, "nmea: TAG block time in milliseconds rather than seconds")
+	force := fs.Bool("f", false, "replace converted files that exist")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais convert -to csv|vdr|nmea [options] file ...\n")
+		fs.PrintDefaults()
+	}
+	files := parseInterleaved(fs, args)
+	if _, ok := convertExt[*format]; !ok || len(files) == 0 || *dir == "-" && len(files) > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, name := range files {
+		name = findRecording(name)
+		if *dir == "-" {
+			if _, skipped, err := convertFile(name, os.Stdout, *format, *ms); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				status = 1
+			} else if skipped > 0 {
+				fmt.Fprintf(os.Stderr, "%s: %d lines without a TAG block time left out\n", name, skipped)
+			}
+			continue
+		}
+		path := convertName(name, *format, *dir)
+		in, _ := filepath.Abs(name)
+		if abs, _ := filepath.Abs(path); abs == in {
+			fmt.Fprintf(os.Stderr, "%s: already %s, -o another folder to rewrite it\n", name, *format)
+			status = 1
+			continue
+		}
+		n, skipped, err := convertTo(name, path, *format, *ms, *force)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+			continue
+		}
+		fmt.Printf("%s: %d records written to %s", name, n, path)
+		if skipped > 0 {
+			fmt.Printf(", %d lines without a TAG block time left out", skipped)
+		}
+		fmt.Println()
+	}
+	return status
+}
@@ -0,0 +1,89 @@
+//go:build !edge
+
+package logais
+
+/*
+Status page on the -http address, for field technicians checking a station is
+recording: open http://logger:8080/ in a browser, which asks for an http-user
+if there are any (see apiauth.go). It shows each stream's health, message rate,
+last message, current data file and size, and its recent errors (alerts and
+write errors), refreshed every few seconds from GET /api/dashboard. The page is dashboard.html, built into the program.
+*/
+
+import (
+	_ "embed"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const streamErrors = 5 // recent errors kept for each stream
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// recent alerts by stream, newest last
+var recentErrors struct {
+	mu sync.Mutex
+	m  map[string][]Event
+}
+
+type dashStream struct {
+	streamHealth
+	Sentences int64      `json:"sentences"`
+	LastTime  *time.Time `json:"last_message,omitempty"`
+	File      string     `json:"file,omitempty"`
+	Size      int64      `json:"size"`
+	Errors    []Event    `json:"errors"`
+}
+
+func keepErrors(s *subscription) {
+	for e := range s.C {
+		recentErrors.mu.Lock()
+		if recentErrors.m == nil {
+			recentErrors.m = make(map[string][]Event)
+		}
+		list := append(recentErrors.m[e.Stream], e)
+		if len(list) > streamErrors {
+			list = list[len(list)-streamErrors:]
+		}
+		recentErrors.m[e.Stream] = list
+		recentErrors.mu.Unlock()
+	}
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func dashboardData(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	conf := currentConfig()
+	streams := []dashStream{}
+	for _, st := range conf.Streams {
+		d := dashStream{streamHealth: st.health(now), Sentences: st.stats.Sentences.Load(), Errors: []Event{}}
+		if t := st.heard.Load(); t != 0 {
+			last := time.Unix(0, t).UTC()
+			d.LastTime = &last
+		}
+		if p := st.file.Load(); p != nil {
+			d.File = *p
+			d.Size, _ = Store.Size(*p)
+		}
+		recentErrors.mu.Lock()
+		d.Errors = append(d.Errors, recentErrors.m[st.Port]...)
+		recentErrors.mu.Unlock()
+		if e := d.WriteError; e != nil && (len(d.Errors) == 0 || e.Time.After(d.Errors[len(d.Errors)-1].Time)) {
+			d.Errors = append(d.Errors, Event{Time: e.Time, Kind: "write_error", Stream: st.Port, Text: e.Text})
+		}
+		streams = append(streams, d)
+	}
+	profMutex.Lock()
+	profile := ActiveProf
+	profMutex.Unlock()
+	host, _ := os.Hostname()
+	writeJSON(w, map[string]any{"time": now.UTC(), "host": host, "station_id": conf.StationID,
+		"version": Version, "started": started, "profile": profile, "streams": streams})
+}
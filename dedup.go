@@ -0,0 +1,77 @@
+//go:build !edge
+
+package logais
+
+/*
+Duplicate suppression, for feeds where a multiplexer echoes traffic or the same
+sentences arrive twice.
+ dedup[=seconds]	don't write a message identical to one written within seconds (default 5)
+Whole messages are compared, so the parts of different multipart messages that
+happen to be the same aren't lost, but the leftover parts of a message whose repeat
+was put together with its original are dropped. Suppressed messages are counted in
+the stream's stats.
+*/
+
+import (
+	"strings"
+	"time"
+)
+
+func groupKey(group []*record) string {
+	keys := make([]string, len(group))
+	for i, rec := range group {
+		keys[i] = sentenceKey(rec.Sentence)
+	}
+	return strings.Join(keys, "\n")
+}
+
+func (c *seenCache) repeat(key string, when time.Time) bool {
+	// true if key was seen within maxAge, otherwise remembered
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.m[key]; ok && when.Sub(t) <= c.maxAge {
+		return true
+	}
+	c.m[key] = when
+	if when.Sub(c.purged) > c.maxAge {
+		for k, t := range c.m {
+			if when.Sub(t) > c.maxAge {
+				delete(c.m, k)
+			}
+		}
+		c.purged = when
+	}
+	return false
+}
+
+func (st *Stream) duplicate(group []*record, complete bool) bool {
+	// called from the stream's goroutine only, the parts of incomplete messages
+	// are duplicates if they were all written as part of a complete one
+	o := st.opts()
+	if o.Dedup == 0 {
+		return false
+	}
+	if st.dupes == nil || st.dupes.maxAge != o.Dedup {
+		st.dupes = &seenCache{m: make(map[string]time.Time), maxAge: o.Dedup}
+	}
+	when := group[0].rx
+	if !complete {
+		for _, rec := range group {
+			if !st.dupes.seen(rec.Sentence, when, o.Dedup) {
+				return false
+			}
+		}
+		st.stats.Duplicates.Add(1)
+		return true
+	}
+	if st.dupes.repeat(groupKey(group), when) {
+		st.stats.Duplicates.Add(1)
+		return true
+	}
+	if len(group) > 1 {
+		for _, rec := range group {
+			st.dupes.add(rec.Sentence, when)
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+//go:build !edge
+
+package logais
+
+/*
+Differential recording, for evaluating a new receiver against an existing one.
+ reference	on the existing receiver's stream
+ diff[=seconds]	on the stream being evaluated, only sentences the reference did not
+		receive within seconds either side (default 30, at most diffMax) are written
+Each sentence is held for seconds before it is compared, so a reference copy
+arriving up to seconds later still matches; the stream's records are written
+that much later. Suppressed sentences are counted in the stream's stats.
+*/
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/logais/config"
+)
+
+// recently received sentences, keyed by payload so channel and sequence id differences don't matter
+type seenCache struct {
+	mu     sync.Mutex
+	m      map[string]time.Time
+	maxAge time.Duration
+	purged time.Time
+}
+
+// kept for two windows: a sentence is compared a window after it arrived, with copies up to a window before it
+var Reference = &seenCache{m: make(map[string]time.Time), maxAge: 2 * config.DiffMax}
+
+func sentenceKey(sentence string) string {
+	if v, ok := parseVDM(sentence); ok {
+		return strconv.Itoa(v.Part) + "/" + strconv.Itoa(v.Total) + "," + v.Payload
+	}
+	return sentence
+}
+
+func (c *seenCache) add(sentence string, when time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[sentenceKey(sentence)] = when
+	if when.Sub(c.purged) > time.Minute {
+		for k, t := range c.m {
+			if when.Sub(t) > c.maxAge {
+				delete(c.m, k)
+			}
+		}
+		c.purged = when
+	}
+}
+
+func (c *seenCache) seen(sentence string, when time.Time, window time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.m[sentenceKey(sentence)]
+	if !ok {
+		return false
+	}
+	d := when.Sub(t)
+	return d <= window && d >= -window
+}
@@ -0,0 +1,136 @@
+//go:build !edge
+
+package logais
+
+/*
+Low disk space: the free space on the data folder's volume is checked every
+diskInterval, and below a threshold, as a size or a share of the volume, the
+config line
+ low-disk <tab> 2GB|5% [<tab> warn|pause|delete]
+says what to do:
+ warn	log it and raise an alert, the default, below 5% without a low-disk line
+ pause	also stop writing until there is space again, so streams don't fail
+	on write errors; they keep listening, relays and other outputs carry on
+ delete	also delete the oldest day folders in the data folder until there is
+	space again, never today's, days under a legal hold or days whose files
+	hold a vessel under one (see holds.go), nor days in cold storage; each is
+	logged and written to audit.log. With nothing left to delete, pause.
+Recording resumes and the alert clears once free space is a fifth over the
+threshold, so it doesn't flap. Where the free space can't be read (see
+host_other.go) nothing is checked.
+*/
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"example.com/logais/rotation"
+)
+
+const diskInterval = time.Minute
+
+var (
+	defaultLowDisk = LowDisk{Percent: 5, Policy: "warn"}
+	DiskPaused     atomic.Bool // recording paused for lack of space
+)
+
+func diskLimit(l LowDisk, total uint64) uint64 {
+	if l.Free > 0 {
+		return l.Free
+	}
+	return uint64(float64(total) * l.Percent / 100)
+}
+
+func keepDiskSpace() {
+	low := false
+	for {
+		l := defaultLowDisk
+		if c := currentConfig(); c.LowDisk != nil {
+			l = *c.LowDisk
+		}
+		if total, free := hostDisk(Datapath); total > 0 {
+			low = checkDisk(l, total, free, low)
+		}
+		time.Sleep(diskInterval)
+	}
+}
+
+func checkDisk(l LowDisk, total uint64, free uint64, low bool) bool {
+	// returns whether space is still low
+	limit := diskLimit(l, total)
+	enough := limit + limit/5
+	switch {
+	case !low && free >= limit:
+		return false
+	case low && free >= enough:
+		Logit.Info("disk space recovered", "free_mb", free>>20)
+		if DiskPaused.Swap(false) {
+			Logit.Info("recording resumed")
+		}
+		return false
+	case !low:
+		text := "low disk space, " + strconv.FormatUint(free>>20, 10) + " MB free of " + strconv.FormatUint(total>>20, 10) + " MB"
+		Logit.Warn("low disk space", "free_mb", free>>20, "total_mb", total>>20, "limit_mb", limit>>20)
+		Events.publish(EventAlert, "", text)
+	}
+	switch l.Policy {
+	case "pause":
+		pauseRecording(limit)
+	case "delete":
+		n, err := deleteOldest(enough)
+		if err != nil {
+			Logit.Error("low disk space: deleting old days", "err", err)
+		}
+		if _, free = hostDisk(Datapath); n == 0 && free < limit {
+			Logit.Error("low disk space: no day folder can be deleted")
+			pauseRecording(limit)
+		} else if free >= limit && DiskPaused.Swap(false) {
+			Logit.Info("recording resumed")
+		}
+	}
+	return true
+}
+
+func pauseRecording(limit uint64) {
+	if !DiskPaused.Swap(true) {
+		Logit.Error("recording paused until there is space", "needed_mb", (limit+limit/5)>>20)
+		Events.publish(EventAlert, "", "recording paused, disk full")
+	}
+}
+
+func deleteOldest(enough uint64) (int, error) {
+	// oldest day folders first until enough is free, returns the number deleted
+	dirs, _ := filepath.Glob(Datapath + "[0-9][0-9][0-9][0-9]" + Sep + "[0-9][0-9]" + Sep + "[0-9][0-9]")
+	today := rotation.Folder(time.Now().UTC())
+	held := heldMMSIs()
+	deleted := 0
+	for _, dir := range dirs {
+		if _, free := hostDisk(Datapath); free >= enough {
+			break
+		}
+		name := strings.TrimPrefix(dir, Datapath)
+		day, err := time.Parse("2006"+Sep+"01"+Sep+"02", name)
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil || name >= today || dayHeld(day, "") || holdsVessel(files, held) {
+			continue
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return deleted, err
+		}
+		deleted++
+		Logit.Info("low disk space, deleted day folder", "day", name)
+		if err = auditLog("low disk space: deleted day folder " + name); err != nil {
+			Logit.Error("audit log", "err", err)
+		}
+		if Catalog != nil {
+			if err = Catalog.remove(dir); err != nil {
+				Logit.Error("updating catalog", "day", name, "err", err)
+			}
+		}
+	}
+	return deleted, nil
+}
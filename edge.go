@@ -0,0 +1,143 @@
+//go:build edge
+
+package logais
+
+/*
+Edge agent build, for gateways too small for the whole recorder: no files, API,
+feeds or tools, only UDP and serial input pushed to a collector's ingest stream
+(see ingest.go and push.go). Built with
+ go build -tags edge -ldflags "-s -w" -o logais-edge ./cmd/logais
+and run as
+ logais-edge -udp 10110 [-udp port ...] [-serial /dev/ttyUSB0 ...] -push https://central:8080/api/ingest/10110 [-push-token token]
+	[-push-ca file] [-push-cert file -push-key file]
+Serial devices are read as they are, set the speed first, eg stty -F /dev/ttyUSB0 38400 raw.
+Log lines go to stderr, -log-level and -log-format as for logais. Ctrl-C or SIGTERM posts what is held and exits
+(the command closes Edge's quit).
+*/
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"example.com/logais/config"
+)
+
+const edgeRetry = 5 * time.Second // wait before re-opening a failed input
+
+// EdgeSettings are what the logais-edge command's flags set.
+type EdgeSettings struct {
+	UDP       []string // UDP ports to listen on, as -udp
+	Serial    []string // serial devices to read NMEA lines from, as -serial
+	Push      string   // collector URL, as -push
+	PushToken string   // bearer token for the collector, as -push-token
+	PushCA    string   // CAs to check the collector's certificate against, as -push-ca
+	PushCert  string   // client certificate, as -push-cert
+	PushKey   string   // client certificate's key, as -push-key
+	LogLevel  string   // debug, info, warning or error, as -log-level
+	LogFormat string   // text or json, as -log-format
+}
+
+// Edge runs the edge agent until quit is closed, eg on Ctrl-C or SIGTERM,
+// then posts what is held and returns. An error is returned for settings
+// that aren't right, before anything starts.
+func Edge(s EdgeSettings, quit <-chan struct{}) error {
+	if s.Push == "" || len(s.UDP)+len(s.Serial) == 0 {
+		return errors.New("logais-edge needs -push and at least one -udp or -serial input")
+	}
+	level, err := parseLogLevel(s.LogLevel)
+	if err != nil {
+		return err
+	}
+	LogLevel.Set(level)
+	handler, err := newLogHandler(os.Stderr, s.LogFormat, LogLevel)
+	if err != nil {
+		return err
+	}
+	logit := slog.New(handler)
+	var secure *config.TLSFiles
+	if s.PushCA+s.PushCert+s.PushKey != "" {
+		if secure, err = config.NewTLSFiles(s.PushCert, s.PushKey, s.PushCA); err != nil {
+			return err
+		}
+	}
+
+	var pushed, dropped atomic.Int64
+	p := newPusher(s.Push, s.PushToken, secure, &pushed, &dropped)
+	done := make(chan struct{})
+	go func() {
+		p.run(logit, quit, nil)
+		close(done)
+	}()
+	for _, port := range s.UDP {
+		go edgeUDP(port, p, logit.With("port", port))
+	}
+	for _, dev := range s.Serial {
+		go edgeSerial(dev, p, logit.With("device", dev))
+	}
+	logit.Info("pushing", "url", s.Push)
+
+	<-quit
+	logit.Info("pushing what is held")
+	select {
+	case <-done:
+	case <-time.After(pushTimeout):
+	}
+	logit.Info("stopped", "pushed", pushed.Load(), "dropped", dropped.Load())
+	return nil
+}
+
+func edgeUDP(port string, p *pusher, logit *slog.Logger) {
+	n, _ := strconv.Atoi(port)
+	buff := make([]byte, 6144)
+	for {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: n})
+		if err != nil {
+			logit.Error("can't listen", "err", err)
+			time.Sleep(edgeRetry)
+			continue
+		}
+		logit.Info("connected for input")
+		for {
+			leng, err := conn.Read(buff)
+			if err != nil {
+				logit.Info("UDP read error, re-opening", "err", err)
+				break
+			}
+			p.add(buff[:leng], time.Now())
+		}
+		conn.Close()
+		time.Sleep(edgeRetry)
+	}
+}
+
+func edgeSerial(dev string, p *pusher, logit *slog.Logger) {
+	for {
+		f, err := os.Open(dev)
+		if err != nil {
+			logit.Error("can't open", "err", err)
+			time.Sleep(edgeRetry)
+			continue
+		}
+		logit.Info("open for input")
+		rd := bufio.NewReaderSize(f, 65536)
+		for {
+			line, err := rd.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil {
+				logit.Info("read error, re-opening", "err", err)
+				break
+			}
+			p.add(line, time.Now())
+		}
+		f.Close()
+		time.Sleep(edgeRetry)
+	}
+}
@@ -0,0 +1,149 @@
+//go:build !edge
+
+package logais
+
+/*
+Internal event bus: streams and background jobs publish lifecycle events and
+integrations subscribe to the kinds they care about, so adding one doesn't
+mean touching the code that raises them.
+ stream_started	a stream is listening or its feed has started
+ reconnected	a stream's UDP input was re-opened after an error
+ rollover	a stream started a new daily file
+ alert	something an operator should hear about, eg a DSC distress call or a failed write
+ upload_completed	files copied off the recorder, eg a day moved to cold storage
+ profile_changed	the active profile changed
+ config_reloaded	the config file was read again, see reload.go
+ handover	cluster streams gained or handed over
+ annotation	an operator's note, see annotate.go
+ vessel_acquired, vessel_lost	a vessel heard again, or not heard for a while, see sightings.go
+ control	a stream stopped, started, paused, resumed or rolled over through the control API, see control.go
+Publishing never blocks: a subscriber that falls behind loses events, counted
+in its Dropped. The last eventHistory events are kept for /api/events by a
+subscriber like any other.
+*/
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventStarted     = "stream_started"
+	EventReconnected = "reconnected"
+	EventRollover    = "rollover"
+	EventAlert       = "alert"
+	EventUploaded    = "upload_completed"
+	EventProfile     = "profile_changed"
+	EventReloaded    = "config_reloaded"
+	EventHandover    = "handover"
+	EventAnnotation  = "annotation"
+	EventAcquired    = "vessel_acquired"
+	EventLost        = "vessel_lost"
+	EventControl     = "control"
+
+	eventHistory = 200 // events kept for the API
+)
+
+type Event struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Stream string    `json:"stream,omitempty"` // port, empty for the whole logger
+	Text   string    `json:"text"`
+}
+
+type subscription struct {
+	C       chan Event
+	kinds   map[string]bool // nil for all
+	Dropped atomic.Int64
+}
+
+type eventBus struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs []*subscription
+}
+
+var Events = &eventBus{}
+
+// recent events for the API
+var history struct {
+	mu     sync.RWMutex
+	events []Event // oldest first
+}
+
+func (b *eventBus) subscribe(buffer int, kinds ...string) *subscription {
+	// events of these kinds, or all, until the program ends
+	s := &subscription{C: make(chan Event, buffer)}
+	if len(kinds) > 0 {
+		s.kinds = make(map[string]bool)
+		for _, k := range kinds {
+			s.kinds[k] = true
+		}
+	}
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+	return s
+}
+
+func (b *eventBus) publish(kind string, stream string, text string) {
+	b.mu.Lock()
+	b.seq++
+	e := Event{Seq: b.seq, Time: time.Now().UTC(), Kind: kind, Stream: stream, Text: text}
+	subs := b.subs
+	b.mu.Unlock()
+	Logit.Debug(text, "event", kind, "port", stream)
+
+	for _, s := range subs {
+		if s.kinds != nil && !s.kinds[kind] {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			s.Dropped.Add(1)
+		}
+	}
+}
+
+func keepHistory(s *subscription) {
+	for e := range s.C {
+		history.mu.Lock()
+		if len(history.events) == eventHistory {
+			history.events = history.events[1:]
+		}
+		history.events = append(history.events, e)
+		history.mu.Unlock()
+	}
+}
+
+func eventsSince(seq uint64) []Event {
+	// kept events after seq, oldest first
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+	out := []Event{}
+	for _, e := range history.events {
+		if e.Seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	// GET /api/events[?since=seq]
+	var seq uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "since needs an event number", http.StatusBadRequest)
+			return
+		}
+		seq = n
+	}
+	writeJSON(w, eventsSince(seq))
+}
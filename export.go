@@ -0,0 +1,108 @@
+//go:build !edge
+
+package logais
+
+/*
+logais export: package recordings into one self-verifying bundle (see bundle.go).
+ logais export -o bundle.zip [-log] [-sign key] file ...
+ logais export -verify bundle.zip [-pub key.pub]
+ logais export -keygen key
+With -log the application log entries covering the recordings' time range go
+in as logs/LogAIS-context.log, so recipients can see reconnects and gaps.
+*/
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func exportCmd(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "", "output zip file")
+	withLog := fs.Bool("log", false, "include application log entries from the same time")
+	sign := fs.String("sign", "", "sign the manifest with this private key")
+	verify := fs.String("verify", "", "check this bundle instead of making one")
+	pub := fs.String("pub", "", "public key the bundle must be signed with, for -verify")
+	gen := fs.String("keygen", "", "make a signing key pair with this file name")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais export -o bundle.zip [options] file ...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	switch {
+	case *gen != "":
+		if err := keygen(*gen); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Key pair written to %s and %s.pub\n", *gen, *gen)
+		return 0
+	case *verify != "":
+		if err := verifyBundle(*verify, *pub); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: FAILED: %v\n", *verify, err)
+			return 1
+		}
+		fmt.Printf("%s: OK\n", *verify)
+		return 0
+	}
+
+	files := fs.Args()
+	if *out == "" || len(files) == 0 {
+		fs.Usage()
+		return 2
+	}
+	for i, name := range files {
+		files[i] = findRecording(name)
+	}
+	var key ed25519.PrivateKey
+	if *sign != "" {
+		k, err := readKey(*sign, false)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		key = k
+	}
+	if err := writeExport(*out, files, *withLog, key, "export "+strings.Join(args, " ")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Remove(*out)
+		return 1
+	}
+	fmt.Printf("%d files exported to %s\n", len(files), *out)
+	return 0
+}
+
+func writeExport(out string, files []string, withLog bool, key ed25519.PrivateKey, command string) error {
+	b, err := newBundle(out, command)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if err = b.addFile(name, "data/"+filepath.Base(name)); err != nil {
+			return err
+		}
+	}
+	if withLog {
+		first, last, err := recordingSpan(files)
+		if err != nil {
+			return err
+		}
+		lines, err := logWindow(first, last)
+		if err != nil {
+			return err
+		}
+		var text strings.Builder
+		for _, l := range lines {
+			text.WriteString(l.Text + "\r\n")
+		}
+		if err = b.addBytes("logs/LogAIS-context.log", []byte(text.String())); err != nil {
+			return err
+		}
+	}
+	return b.close(key)
+}
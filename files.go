@@ -0,0 +1,59 @@
+//go:build !edge
+
+package logais
+
+/*
+Extra per-stream daily files kept next to the main data file
+*/
+
+import (
+	"time"
+)
+
+type sideFile struct {
+	suffix string // added to the daily file name, eg 20250101-10110-quality.csv
+	ext    string // file extension, .csv if empty
+	header string // written when the file is created
+	path   string
+	f      *smoothFile
+	every  time.Duration // buffering for the next file opened, see smooth.go
+	size   int
+	batch  int
+}
+
+func (sf *sideFile) write(dir string, base string, text string) error {
+	// append text, the file follows the main file into a new day folder
+	ext := sf.ext
+	if ext == "" {
+		ext = ".csv"
+	}
+	path := dir + base + sf.suffix + ext
+	if path != sf.path {
+		sf.Close()
+		f, created, err := Store.Append(path)
+		if err != nil {
+			return err
+		}
+		if created {
+			if _, err = f.WriteString(sf.header); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		sf.f = newSmoothFile(f, sf.every, sf.size, sf.batch)
+		sf.path = path
+	}
+	return sf.f.writeRecord(text)
+}
+
+func (sf *sideFile) flush(now time.Time) error {
+	return sf.f.flush(now, false)
+}
+
+func (sf *sideFile) Close() {
+	if sf.f != nil {
+		sf.f.Close()
+		sf.f = nil
+		sf.path = ""
+	}
+}
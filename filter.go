@@ -0,0 +1,68 @@
+//go:build !edge
+
+package logais
+
+/*
+Per-stream filters on whole AIS messages, applied after multipart messages are
+put together so every part of a message goes the same way.
+ allow-mmsi=list	only record these vessels
+ deny-mmsi=list	don't record these vessels
+ types=list	only record these message types, eg types=1-3,18,19 for position reports
+ geofence=lat,lon;lat,lon[;...]	only record vessels inside a box (two corners) or polygon (three or more points)
+ geofence-outside	record vessels outside the geofence instead
+Messages without a position follow the vessel's last reported position, vessels
+not yet seen with a position count as outside.
+Lists are comma separated MMSIs, entries shorter than 9 digits (or ending in *)
+are prefixes, eg allow-mmsi=512,235098765 for a country's MID and one vessel.
+The lists and geofence are read by package config.
+*/
+
+import (
+	"example.com/logais/ais"
+)
+
+func filtered(o *Options) bool {
+	return o.AllowMMSI != nil || o.DenyMMSI != nil || o.Types != nil || o.Geofence != nil
+}
+
+func (st *Stream) wanted(group []*record) bool {
+	// whether an AIS message passes the stream's filters, messages that can't be read only pass deny lists
+	// and an outside geofence, called from the stream's goroutine only
+	o := st.opts()
+	if !filtered(o) {
+		return true
+	}
+	v, ok := parseVDM(group[0].Sentence)
+	var mmsi uint32
+	if ok && v.Part == 1 {
+		// the type and MMSI are in the first part
+		mmsi, ok = ais.MMSI(v.Payload)
+	} else {
+		ok = false
+	}
+	if !ok {
+		return o.AllowMMSI == nil && o.Types == nil && (o.Geofence == nil || o.Outside)
+	}
+	if o.Types != nil && !o.Types[ais.MessageType(v.Payload)] {
+		return false
+	}
+	if o.AllowMMSI != nil && !o.AllowMMSI.Match(mmsi) {
+		return false
+	}
+	if o.DenyMMSI != nil && o.DenyMMSI.Match(mmsi) {
+		return false
+	}
+	if o.Geofence == nil {
+		return true
+	}
+	if msg, err := decodeGroup(group); err == nil {
+		if l, ok := msg.(ais.Located); ok && l.Location().HasPosition() {
+			c := l.Location()
+			if st.inside == nil {
+				st.inside = make(map[uint32]bool)
+			}
+			st.inside[mmsi] = o.Geofence.Contains(c.Lat, c.Lon)
+		}
+	}
+	return st.inside[mmsi] != o.Outside
+}
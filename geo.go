@@ -0,0 +1,33 @@
+//go:build !edge
+
+package logais
+
+/*
+Great circle range and bearing
+*/
+
+import (
+	"math"
+)
+
+const earthRadiusNM = 3440.065
+
+func rangeBearing(lat1 float64, lon1 float64, lat2 float64, lon2 float64) (float64, float64) {
+	// nautical miles and initial true bearing from point 1 to point 2
+	p1, p2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dl := (lon2 - lon1) * math.Pi / 180
+	a := math.Pow(math.Sin((p2-p1)/2), 2) + math.Cos(p1)*math.Cos(p2)*math.Pow(math.Sin(dl/2), 2)
+	dist := 2 * earthRadiusNM * math.Asin(math.Min(1, math.Sqrt(a)))
+	y := math.Sin(dl) * math.Cos(p2)
+	x := math.Cos(p1)*math.Sin(p2) - math.Sin(p1)*math.Cos(p2)*math.Cos(dl)
+	return dist, normBearing(math.Atan2(y, x) * 180 / math.Pi)
+}
+
+func normBearing(b float64) float64 {
+	// 0 to 360
+	b = math.Mod(b, 360)
+	if b < 0 {
+		b += 360
+	}
+	return b
+}
@@ -0,0 +1,138 @@
+//go:build !edge
+
+package logais
+
+/*
+GeoJSON output of decoded position reports for GIS tools.
+ geojson	one Feature per line, daily .geojsonl file (NDJSON)
+ geojson=collection	daily .geojson FeatureCollection, kept valid after every write
+*/
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+
+	"example.com/logais/ais"
+)
+
+const (
+	collectionHead = "{\"type\":\"FeatureCollection\",\"features\":[\n"
+	collectionTail = "\n]}\n"
+)
+
+type geoFeature struct {
+	Type     string      `json:"type"`
+	Geometry geoPoint    `json:"geometry"`
+	Props    geoProperty `json:"properties"`
+}
+
+type geoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoProperty struct {
+	MMSI      uint32   `json:"mmsi"`
+	MsgType   int      `json:"msg_type"`
+	SOG       *float64 `json:"sog"`
+	COG       *float64 `json:"cog"`
+	Heading   *int     `json:"heading"`
+	Timestamp string   `json:"timestamp"`
+	Range     *float64 `json:"range_nm,omitempty"`    // from the station
+	Bearing   *float64 `json:"bearing,omitempty"`     // true, from the station
+	RelBrg    *float64 `json:"rel_bearing,omitempty"` // relative to own heading, moving station only
+}
+
+func geoJSONFeature(msg ais.Message, rfctime string) ([]byte, bool) {
+	// position reports only, nil if no position
+	var p *ais.Position
+	switch m := msg.(type) {
+	case *ais.Position:
+		p = m
+	case *ais.ExtendedB:
+		p = &m.Position
+	default:
+		return nil, false
+	}
+	if !p.HasPosition() {
+		return nil, false
+	}
+	f := geoFeature{
+		Type:     "Feature",
+		Geometry: geoPoint{Type: "Point", Coordinates: [2]float64{p.Lon, p.Lat}},
+		Props:    geoProperty{MMSI: p.MMSI, MsgType: p.Type, Timestamp: rfctime},
+	}
+	if p.HasSOG() {
+		f.Props.SOG = &p.SOG
+	}
+	if p.HasCOG() {
+		f.Props.COG = &p.COG
+	}
+	if p.HasHeading() {
+		f.Props.Heading = &p.Heading
+	}
+	if rp, ok := Station.relative(p.Lat, p.Lon); ok {
+		rng, brg := math.Round(rp.Range*100)/100, math.Round(rp.Bearing*10)/10
+		f.Props.Range, f.Props.Bearing = &rng, &brg
+		if rp.HasRel {
+			rel := math.Round(rp.RelBrg*10) / 10
+			f.Props.RelBrg = &rel
+		}
+	}
+	b, err := json.Marshal(f)
+	return b, err == nil
+}
+
+type geoFile struct {
+	ndjson sideFile
+	path   string // collection file
+	f      storageFile
+}
+
+func newGeoFile() *geoFile {
+	return &geoFile{ndjson: sideFile{ext: ".geojsonl"}}
+}
+
+func (g *geoFile) write(mode string, dir string, base string, feature []byte) error {
+	if mode == "ndjson" {
+		return g.ndjson.write(dir, base, string(feature)+"\n")
+	}
+	path := dir + base + ".geojson"
+	if path != g.path {
+		g.closeCollection()
+		f, err := Store.Update(path)
+		if err != nil {
+			return err
+		}
+		g.f = f
+		g.path = path
+	}
+	// overwrite the closing brackets so the file is always a complete collection
+	end, err := g.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	text := collectionHead + string(feature) + collectionTail
+	if end >= int64(len(collectionHead)+len(collectionTail)) {
+		if _, err = g.f.Seek(end-int64(len(collectionTail)), io.SeekStart); err != nil {
+			return err
+		}
+		text = ",\n" + string(feature) + collectionTail
+	}
+	_, err = g.f.WriteString(text)
+	return err
+}
+
+func (g *geoFile) closeCollection() {
+	if g.f != nil {
+		g.f.Close()
+		g.f = nil
+		g.path = ""
+	}
+}
+
+func (g *geoFile) Close() {
+	g.ndjson.Close()
+	g.closeCollection()
+}
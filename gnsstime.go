@@ -0,0 +1,111 @@
+//go:build !edge
+
+package logais
+
+/*
+GNSS time for streams on offline vessels, whose PC clock wanders. With the
+stream option
+ gnsstime[=seconds]
+the timestamps come from the times in $..RMC (with a fix) and $..ZDA sentences
+the stream receives among its AIS, carried on between them by the monotonic
+clock: each one gives the offset from the monotonic clock to GNSS time, which
+is smoothed (a 16th of each change) so the jitter of when sentences arrive
+doesn't show, and taken as it is after a jump of more than gnssStep, eg the
+receiver starting again. Until the first one, and once none has been heard for
+seconds (default 600), timestamps are the system clock's again.
+Which is in use is in a "# Time reference:" header line and a comment line
+whenever it changes, and the log. The GNSS sentences needn't be recorded (see
+nmea), only received. Times are when the fix was, a sentence arrives some
+tenths of a second later: time-offset corrects for it. The daily file is
+still chosen by the system clock. tagtime takes precedence for sentences with
+a TAG block time.
+*/
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const (
+	gnssStep      = 2 * time.Second // a GNSS time this far out is taken as it is, not smoothed
+	gnssSmoothing = 16
+)
+
+var monoBase = time.Now() // monotonic clock readings are since this
+
+// a stream's time from its GNSS sentences
+type gnssClock struct {
+	est   time.Time     // GNSS time at monoBase
+	last  time.Duration // monotonic time of the last GNSS time
+	using bool          // timestamps are from GNSS time now
+	st    *Stream
+	logit *slog.Logger
+}
+
+func (g *gnssClock) update(sentence string, rx time.Time) {
+	t, ok := gpsTime(sentence)
+	if !ok {
+		return
+	}
+	mono := rx.Sub(monoBase)
+	sample := t.Add(-mono)
+	jump := sample.Sub(g.est)
+	switch {
+	case !g.using:
+		g.est = sample
+		g.logit.Info("timestamps from GNSS time", "sentence", sentenceType(sentence), "system_clock_ahead", rx.Sub(t).Seconds())
+		ahead := "ahead"
+		if rx.Before(t) {
+			ahead = "behind"
+		}
+		g.note("# Time reference: GNSS time from " + sentenceType(sentence) + " " + t.Format(timeLayout) + ", the system clock was " + strconv.FormatFloat(rx.Sub(t).Abs().Seconds(), 'f', 3, 64) + " s " + ahead + "\r\n")
+	case jump.Abs() > gnssStep:
+		g.est = sample
+		g.logit.Warn("GNSS time jumped, taken as it is", "sentence", sentenceType(sentence), "jump", jump.Seconds())
+		g.note("# Time reference: GNSS time jumped " + strconv.FormatFloat(jump.Seconds(), 'f', 3, 64) + " s\r\n")
+	default:
+		g.est = g.est.Add(jump / gnssSmoothing)
+	}
+	g.last, g.using = mono, true
+}
+
+func (g *gnssClock) at(rx time.Time) (time.Time, bool) {
+	// the timestamp for something received at rx, false if there's no GNSS time
+	mono := rx.Sub(monoBase)
+	if holdover := g.st.opts().GNSSTime; g.using && mono-g.last > holdover {
+		g.using = false
+		g.logit.Warn("no GNSS time, timestamps from the system clock again", "for", holdover.String())
+		g.note("# Time reference: system clock, no GNSS time for " + holdover.String() + "\r\n")
+	}
+	if !g.using {
+		return time.Time{}, false
+	}
+	return g.est.Add(mono), true
+}
+
+func (g *gnssClock) note(line string) {
+	select {
+	case g.st.notes <- line:
+	default:
+		g.logit.Warn("time reference note not written, the stream is behind")
+	}
+}
+
+func timeReference(o *Options, g *gnssClock) string {
+	// the header line saying where the file's timestamps come from
+	ref := "system clock"
+	switch {
+	case o.GNSSTime > 0 && g.using:
+		ref = "GNSS time from RMC/ZDA, carried on by the monotonic clock"
+	case o.GNSSTime > 0:
+		ref = "system clock until GNSS time (RMC/ZDA) is heard"
+	}
+	if o.TagTime {
+		ref = "TAG block time, or " + ref + " without one"
+	}
+	if o.Offset != 0 {
+		ref += ", " + strconv.FormatFloat(o.Offset.Seconds(), 'f', -1, 64) + " s added"
+	}
+	return "# Time reference: " + ref + "\r\n"
+}
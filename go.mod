@@ -2,4 +2,7 @@ module example.com/logais
 
 go 1.25.5
 
-require golang.org/x/sys v0.33.0 // indirect
+require (
+	github.com/mattn/go-sqlite3 v1.14.32
+	golang.org/x/sys v0.33.0
+)
@@ -0,0 +1,195 @@
+//go:build !edge
+
+package logais
+
+/*
+logais grep: one vessel's (or a few vessels') records out of the archive.
+ logais grep -mmsi list [-from time] [-to time] [-types list] [-stream port] [-format csv|vdr|nmea] [file|folder|yyyy-mm-dd|yyyy-mm ...]
+The MMSI is decoded from each AIS payload, a multipart message's other parts
+are written with the first. -mmsi takes MMSIs or prefixes as the allow-mmsi
+option does, eg 512000123,503*. -from and -to are RFC3339 times, yyyy-mm-ddThh:mm
+or yyyy-mm-dd (UTC); -to is where it stops, a day given alone is included.
+Without files the daily files of the days from -from to -to are read, of every
+stream or the -stream one. Records are written in timestamp order to stdout,
+LogAIS CSV unless -format says otherwise (see convert.go). Files with an index
+(see index.go) are skipped if it says the vessels aren't in them, and read
+from near -from.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"example.com/logais/ais"
+	"example.com/logais/config"
+)
+
+type grepFilter struct {
+	mmsi     *config.MMSIFilter
+	types    map[int]bool // nil for all
+	from, to time.Time    // zero for no limit
+}
+
+func grepTime(value string, end bool) (time.Time, error) {
+	// a -from or -to time, a day alone for -to is up to the end of it
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02T15:04", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.New("invalid time, expecting RFC3339, yyyy-mm-ddThh:mm or yyyy-mm-dd: " + value)
+}
+
+func grepDays(from, to time.Time) []string {
+	// yyyy-mm-dd of every day in the range, for statsFiles
+	var days []string
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(time.DateOnly))
+	}
+	return days
+}
+
+func (g *grepFilter) match(rec *recRecord) (*vdm, bool) {
+	// the first or only part of a message, and whether it's wanted
+	_, bare := splitTag(rec.Sentence)
+	v, ok := parseVDM(bare)
+	if !ok || v.Part != 1 {
+		return v, false
+	}
+	if !g.from.IsZero() && rec.Time.Before(g.from) || !g.to.IsZero() && !rec.Time.Before(g.to) {
+		return v, false
+	}
+	if g.types != nil && !g.types[ais.MessageType(v.Payload)] {
+		return v, false
+	}
+	mmsi, ok := ais.MMSI(v.Payload)
+	return v, ok && g.mmsi.Match(mmsi)
+}
+
+func (g *grepFilter) absent(name string) bool {
+	// the file's index says none of the vessels are in it, never for prefixes
+	if len(g.mmsi.Prefixes) > 0 {
+		return false
+	}
+	ix := loadIndex(name)
+	if ix == nil || !ix.whole {
+		return false
+	}
+	for mmsi := range g.mmsi.Exact {
+		if ix.mayHave(mmsi) {
+			return false
+		}
+	}
+	return true
+}
+
+func grepRecordings(files []string, g *grepFilter, format string, ms bool) (int, error) {
+	w := bufio.NewWriterSize(os.Stdout, 65536)
+	if _, err := w.WriteString(convertHeader(format, "Extracted")); err != nil {
+		return 0, err
+	}
+	n := 0
+	parts := make(map[string]bool) // file and sequence ID of multipart messages being written
+	_, err := timeOrdered(files, g.from, func(rr *recReader, rec *recRecord) error {
+		v, ok := g.match(rec)
+		if v != nil && v.Total > 1 {
+			key := rr.name + "," + v.Channel + "," + v.SeqID
+			switch {
+			case v.Part == 1:
+				parts[key] = ok
+			case parts[key]:
+				ok = true
+				if v.Part == v.Total {
+					delete(parts, key)
+				}
+			}
+		}
+		if !ok {
+			return nil
+		}
+		n++
+		_, err := w.WriteString(convertLine(rec, format, ms))
+		return err
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+func grepCmd(args []string) int {
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	mmsi := fs.String("mmsi", "", "MMSIs or prefixes to extract, eg 512000123,503*")
+	from := fs.String("from", "", "from this time, RFC3339, yyyy-mm-ddThh:mm or yyyy-mm-dd")
+	to := fs.String("to", "", "until this time, a day alone is included")
+	types := fs.String("types", "", "only these message types, eg 1-3,18")
+	stream := fs.String("stream", "", "only this stream's files, by port, for days and folders")
+	format := fs.String("format", "csv", "format to write: csv, vdr or nmea")
+	ms := fs.Bool("ms", false, "nmea: TAG block time in milliseconds rather than seconds")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais grep -mmsi list [options] [file|folder|yyyy-mm-dd|yyyy-mm ...]\n")
+		fs.PrintDefaults()
+	}
+	args = parseInterleaved(fs, args)
+	if _, ok := convertExt[*format]; !ok || *mmsi == "" {
+		fs.Usage()
+		return 2
+	}
+	g := &grepFilter{}
+	var err error
+	if g.mmsi, err = config.ParseMMSIList("-mmsi", *mmsi); err == nil && *types != "" {
+		g.types, err = config.ParseTypeList(*types)
+	}
+	if err == nil {
+		g.from, err = grepTime(*from, false)
+	}
+	if err == nil {
+		g.to, err = grepTime(*to, true)
+	}
+	if err == nil && len(args) == 0 {
+		if g.from.IsZero() || g.to.IsZero() {
+			err = errors.New("-from and -to are needed to find the days without files")
+		} else {
+			args = grepDays(g.from, g.to)
+		}
+	}
+	var files []string
+	if err == nil {
+		files, err = statsFiles(args, *stream)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var read []string
+	for _, name := range files {
+		if !g.absent(name) {
+			read = append(read, name)
+		}
+	}
+	n, err := grepRecordings(read, g, *format, *ms)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d records from %d files", n, len(read))
+	if skipped := len(files) - len(read); skipped > 0 {
+		fmt.Fprintf(os.Stderr, ", %d files without the vessels skipped by their index", skipped)
+	}
+	fmt.Fprintln(os.Stderr)
+	return 0
+}
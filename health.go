@@ -0,0 +1,91 @@
+//go:build !edge
+
+package logais
+
+/*
+GET /healthz on the -http address, for uptime monitors that need to see a
+stream gone quiet, not just a dead process. Each stream reports
+ bound	listening on its port, or its feed or merge started
+ receiving	something arrived within its quiet time, quiet=seconds (default healthQuiet)
+ last_message_age	seconds since anything arrived, absent if nothing has
+ last_write_error	the last error writing its files, with its time
+ restarts	times it failed and was started again, see supervise.go
+ disk_full	recording paused for lack of disk space, see diskspace.go
+The answer is 200 when every stream is running, bound and receiving and hasn't
+had a write error within the quiet time, 503 otherwise, with the same JSON.
+Streams stopped or paused through the control API say so in control and don't
+count.
+*/
+
+import (
+	"net/http"
+	"time"
+)
+
+const healthQuiet = 5 * time.Minute
+
+type writeError struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"error"`
+}
+
+type streamHealth struct {
+	Port       string      `json:"port"`
+	Name       string      `json:"name"`
+	Running    bool        `json:"running"`
+	Bound      bool        `json:"bound"`
+	Receiving  bool        `json:"receiving"`
+	LastAge    *float64    `json:"last_message_age,omitempty"` // seconds
+	WriteError *writeError `json:"last_write_error,omitempty"`
+	Restarts   int64       `json:"restarts"`
+	DiskFull   bool        `json:"disk_full,omitempty"`
+	Healthy    bool        `json:"healthy"`
+	Control    string      `json:"control,omitempty"` // stopped or paused through the control API
+}
+
+func (st *Stream) writeFailed(err error) {
+	st.writeErr.Store(&writeError{Time: time.Now().UTC(), Text: err.Error()})
+}
+
+func (st *Stream) health(now time.Time) streamHealth {
+	h := streamHealth{Port: st.Port, Name: st.Name, Running: !st.done(), Bound: st.bound.Load()}
+	quiet := st.opts().Quiet
+	if quiet == 0 {
+		quiet = healthQuiet
+	}
+	if t := st.heard.Load(); t != 0 {
+		age := now.Sub(time.Unix(0, t))
+		secs := age.Round(time.Millisecond).Seconds()
+		h.LastAge, h.Receiving = &secs, age <= quiet
+	}
+	h.WriteError = st.writeErr.Load()
+	h.Restarts = st.stats.Restarts.Load()
+	recent := h.WriteError != nil && now.Sub(h.WriteError.Time) <= quiet
+	h.DiskFull = DiskPaused.Load()
+	h.Healthy = h.Running && h.Bound && h.Receiving && !recent && !h.DiskFull
+	switch {
+	case st.halted.Load():
+		h.Control = "stopped"
+	case st.paused.Load():
+		h.Control = "paused"
+	}
+	return h
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	status := "ok"
+	streams := []streamHealth{}
+	for _, st := range currentConfig().Streams {
+		h := st.health(now)
+		if !h.Healthy && h.Control == "" {
+			status = "failing"
+		}
+		streams = append(streams, h)
+	}
+	if status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, map[string]any{"status": status, "streams": streams})
+}
@@ -0,0 +1,209 @@
+//go:build !edge
+
+package logais
+
+/*
+Legal holds: days (optionally one stream) or vessels that must never be deleted
+by retention, low disk space cleanup or purges, eg recordings that are evidence.
+Kept in holds.json in the data folder. A held vessel is looked for in every
+kind of file purge reads: CSV, the .nmea and .jsonl output presets and GeoJSON.
+ logais hold add -from 2025-01-01 [-until 2025-01-31] [-port 10110] [-mmsi 512000123] -reason text
+ logais hold list
+ logais hold release id
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Hold struct {
+	ID      int       `json:"id"`
+	From    string    `json:"from,omitempty"`  // yyyy-mm-dd
+	Until   string    `json:"until,omitempty"` // yyyy-mm-dd inclusive
+	Port    string    `json:"port,omitempty"`  // all streams if empty
+	MMSI    uint32    `json:"mmsi,omitempty"`  // every recording of this vessel
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+}
+
+var holdMu sync.Mutex // serialises changes to the holds file
+
+func holdsPath() string {
+	return Datapath + "holds.json"
+}
+
+func loadHolds() ([]Hold, error) {
+	b, err := os.ReadFile(holdsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var holds []Hold
+	err = json.Unmarshal(b, &holds)
+	return holds, err
+}
+
+func saveHolds(holds []Hold) error {
+	b, err := json.MarshalIndent(holds, "", " ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(holdsPath()+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(holdsPath()+".tmp", holdsPath())
+}
+
+func addHold(h Hold) (Hold, error) {
+	if h.From == "" && h.MMSI == 0 {
+		return h, errors.New("a hold needs a date range or an MMSI")
+	}
+	if h.Until == "" {
+		h.Until = h.From
+	}
+	for _, d := range []string{h.From, h.Until} {
+		if _, err := time.Parse(time.DateOnly, d); d != "" && err != nil {
+			return h, errors.New("dates must be yyyy-mm-dd: " + d)
+		}
+	}
+	if h.Reason == "" {
+		return h, errors.New("a hold needs a reason")
+	}
+	holdMu.Lock()
+	defer holdMu.Unlock()
+	holds, err := loadHolds()
+	if err != nil {
+		return h, err
+	}
+	for _, old := range holds {
+		h.ID = max(h.ID, old.ID)
+	}
+	h.ID++
+	h.Created = time.Now().UTC()
+	return h, saveHolds(append(holds, h))
+}
+
+func releaseHold(id int) error {
+	holdMu.Lock()
+	defer holdMu.Unlock()
+	holds, err := loadHolds()
+	if err != nil {
+		return err
+	}
+	for i, h := range holds {
+		if h.ID == id {
+			return saveHolds(append(holds[:i], holds[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no hold with id %d", id)
+}
+
+func dayHeld(day time.Time, port string) bool {
+	// true if recordings of port on day must be kept, errors reading holds count as held
+	holds, err := loadHolds()
+	if err != nil {
+		return true
+	}
+	d := day.Format(time.DateOnly)
+	for _, h := range holds {
+		if h.From != "" && d >= h.From && d <= h.Until && (h.Port == "" || port == "" || h.Port == port) {
+			return true
+		}
+	}
+	return false
+}
+
+func mmsiHeld(mmsi uint32) bool {
+	holds, err := loadHolds()
+	if err != nil {
+		return true
+	}
+	for _, h := range holds {
+		if h.MMSI == mmsi {
+			return true
+		}
+	}
+	return false
+}
+
+func heldMMSIs() map[uint32]bool {
+	// vessels under hold, for checking file contents before deleting
+	holds, _ := loadHolds()
+	m := make(map[uint32]bool)
+	for _, h := range holds {
+		if h.MMSI != 0 {
+			m[h.MMSI] = true
+		}
+	}
+	return m
+}
+
+func holdCmd(args []string) int {
+	usage := "Usage: logais hold add|list|release ..."
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("hold add", flag.ExitOnError)
+		var h Hold
+		var mmsi uint
+		fs.StringVar(&h.From, "from", "", "first day held, yyyy-mm-dd")
+		fs.StringVar(&h.Until, "until", "", "last day held, yyyy-mm-dd, default same as -from")
+		fs.StringVar(&h.Port, "port", "", "only this stream's recordings")
+		fs.UintVar(&mmsi, "mmsi", 0, "every recording containing this vessel")
+		fs.StringVar(&h.Reason, "reason", "", "why, eg case number")
+		fs.Parse(args[1:])
+		h.MMSI = uint32(mmsi)
+		h, err := addHold(h)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Hold %d added\n", h.ID)
+	case "list":
+		holds, err := loadHolds()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, h := range holds {
+			what := h.From + " to " + h.Until
+			if h.MMSI != 0 {
+				what = "MMSI " + strconv.FormatUint(uint64(h.MMSI), 10)
+			}
+			if h.Port != "" {
+				what += " port " + h.Port
+			}
+			fmt.Printf("%d\t%s\t%s\t(%s)\n", h.ID, what, h.Reason, h.Created.Format(time.DateTime))
+		}
+	case "release":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		id, err := strconv.Atoi(args[1])
+		if err == nil {
+			err = releaseHold(id)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Hold %d released\n", id)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
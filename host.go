@@ -0,0 +1,55 @@
+//go:build !edge
+
+package logais
+
+/*
+Host resources, logged with the hourly stats and served in /api/status, as a
+stream going quiet is often a full disk, a hot Pi or a machine out of memory.
+What can be read depends on the platform (see host_linux.go), anything not
+available is left out.
+*/
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+type hostStatus struct {
+	Load1       *float64 `json:"load1,omitempty"`         // one minute load average
+	CPUs        int      `json:"cpus"`                    // for making sense of the load
+	MemTotal    uint64   `json:"mem_total,omitempty"`     // bytes
+	MemAvail    uint64   `json:"mem_available,omitempty"` // bytes available without swapping
+	DiskTotal   uint64   `json:"disk_total,omitempty"`    // data folder's file system, bytes
+	DiskFree    uint64   `json:"disk_free,omitempty"`     // bytes
+	Temperature *float64 `json:"temperature,omitempty"`   // hottest thermal sensor, Celsius
+}
+
+func readHost() hostStatus {
+	h := hostStatus{CPUs: runtime.NumCPU()}
+	h.Load1 = hostLoad()
+	h.MemTotal, h.MemAvail = hostMemory()
+	h.DiskTotal, h.DiskFree = hostDisk(Datapath)
+	h.Temperature = hostTemperature()
+	return h
+}
+
+func (h hostStatus) summary() string {
+	var parts []string
+	if h.Load1 != nil {
+		parts = append(parts, fmt.Sprintf("load %.2f on %d CPUs", *h.Load1, h.CPUs))
+	}
+	if h.MemTotal > 0 {
+		parts = append(parts, fmt.Sprintf("memory available %d of %d MB", h.MemAvail>>20, h.MemTotal>>20))
+	}
+	if h.DiskTotal > 0 {
+		parts = append(parts, fmt.Sprintf("disk free %d of %d MB", h.DiskFree>>20, h.DiskTotal>>20))
+	}
+	if h.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("temperature %.1fC", *h.Temperature))
+	}
+	if len(parts) == 0 {
+		return "not available on this platform"
+	}
+	return strings.Join(parts, ", ")
+}
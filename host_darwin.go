@@ -0,0 +1,30 @@
+//go:build !edge
+
+package logais
+
+// disk space from statfs, the rest needs sysctl and host_statistics, not read yet
+
+import (
+	"syscall"
+)
+
+func hostLoad() *float64 {
+	return nil
+}
+
+func hostMemory() (uint64, uint64) {
+	return 0, 0
+}
+
+func hostDisk(path string) (uint64, uint64) {
+	// total and free to unprivileged users, bytes
+	var fs syscall.Statfs_t
+	if syscall.Statfs(path, &fs) != nil {
+		return 0, 0
+	}
+	return fs.Blocks * uint64(fs.Bsize), fs.Bavail * uint64(fs.Bsize)
+}
+
+func hostTemperature() *float64 {
+	return nil
+}
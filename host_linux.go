@@ -0,0 +1,81 @@
+//go:build !edge
+
+package logais
+
+// host resources from /proc and /sys
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func hostLoad() *float64 {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return nil
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil
+	}
+	return &load
+}
+
+func hostMemory() (uint64, uint64) {
+	// total and available, bytes
+	b, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, 0
+	}
+	var total, avail uint64
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kb, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb << 10
+		case "MemAvailable:":
+			avail = kb << 10
+		}
+	}
+	return total, avail
+}
+
+func hostDisk(path string) (uint64, uint64) {
+	// total and free to unprivileged users, bytes
+	var fs syscall.Statfs_t
+	if syscall.Statfs(path, &fs) != nil {
+		return 0, 0
+	}
+	return fs.Blocks * uint64(fs.Bsize), fs.Bavail * uint64(fs.Bsize)
+}
+
+func hostTemperature() *float64 {
+	// hottest thermal zone, the SoC on a Raspberry Pi, none on most VMs
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+	var hottest *float64
+	for _, z := range zones {
+		b, err := os.ReadFile(z)
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+		if err != nil {
+			continue
+		}
+		if c := milli / 1000; hottest == nil || c > *hottest {
+			hottest = &c
+		}
+	}
+	return hottest
+}
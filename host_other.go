@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !edge
+
+package logais
+
+// only the CPU count elsewhere, for now
+
+func hostLoad() *float64 {
+	return nil
+}
+
+func hostMemory() (uint64, uint64) {
+	return 0, 0
+}
+
+func hostDisk(path string) (uint64, uint64) {
+	return 0, 0
+}
+
+func hostTemperature() *float64 {
+	return nil
+}
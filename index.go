@@ -0,0 +1,304 @@
+//go:build !edge
+
+package logais
+
+/*
+Index sidecars, so the tools can seek in a daily file instead of reading
+gigabytes. With the index option a stream keeps yyyymmdd-port.idx next to its
+main daily file, a small JSON document:
+ size	bytes of the file it covers, records written since are read as usual
+ minutes	each minute (Unix time) records start in, with the byte offset of its first record
+ bloom	Bloom filter of the MMSIs in the AIS payloads, which can say a vessel
+	certainly isn't in the file (under 1% wrong for 5000 vessels)
+It is saved every indexEvery and when the file closes, replacing the old one
+whole, about 11KB each time. A stream starting again during the day carries on
+with the index if it fits the file, otherwise reads the file to make it again;
+purge and the warm standby fill make the indexes of files they rewrite again.
+ logais index [-f] [-stream port] file|folder|yyyy-mm-dd|yyyy-mm ...
+makes them for files recorded without the option, leaving indexes that fit
+their files alone unless -f. Compressed files are read whole, so get none.
+grep skips files without the vessels asked for and seeks to -from, play seeks
+to -from or -offset. A seek goes indexMargin before the time asked for, so
+only records written more out of order than that could be missed.
+*/
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+const (
+	indexEvery  = 5 * time.Minute // how often a stream saves its index
+	indexMargin = time.Minute     // seeks go this far before the time asked for
+	bloomBytes  = 8192
+	bloomHashes = 4
+)
+
+type recIndex struct {
+	File    string     `json:"file"` // daily file name, yyyymmdd-port.csv
+	Size    int64      `json:"size"`
+	Records int        `json:"records"`
+	Minutes [][2]int64 `json:"minutes"` // minute start and byte offset, both rising
+	Hashes  int        `json:"hashes"`
+	Bloom   []byte     `json:"bloom"`
+
+	path    string // where it's saved
+	whole   bool   // covered the whole file when it was read
+	saved   int    // records when last saved
+	savedAt time.Time
+}
+
+func indexPath(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".idx"
+}
+
+func newRecIndex(name string) *recIndex {
+	return &recIndex{File: filepath.Base(name), Hashes: bloomHashes, Bloom: make([]byte, bloomBytes),
+		path: indexPath(name), savedAt: time.Now()}
+}
+
+func (ix *recIndex) bloomBits(mmsi uint32) []uint32 {
+	// double hashing of FNV-1a
+	h := fnv.New64a()
+	h.Write(binary.BigEndian.AppendUint32(nil, mmsi))
+	sum := h.Sum64()
+	bits := make([]uint32, ix.Hashes)
+	for i := range bits {
+		bits[i] = (uint32(sum) + uint32(i)*(uint32(sum>>32)|1)) % uint32(len(ix.Bloom)*8)
+	}
+	return bits
+}
+
+func (ix *recIndex) mayHave(mmsi uint32) bool {
+	for _, b := range ix.bloomBits(mmsi) {
+		if ix.Bloom[b/8]&(1<<(b%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (ix *recIndex) add(stamp string, offset int64, sentence string) {
+	// a record written at offset, nil safe for streams without an index
+	if ix == nil {
+		return
+	}
+	ix.Records++
+	if t, ok := parseStamp(stamp); ok {
+		m := t.Truncate(time.Minute).Unix()
+		if n := len(ix.Minutes); n == 0 || m > ix.Minutes[n-1][0] {
+			ix.Minutes = append(ix.Minutes, [2]int64{m, offset})
+		}
+	}
+	_, bare := splitTag(sentence)
+	if v, ok := parseVDM(bare); ok && v.Part == 1 {
+		if mmsi, ok := ais.MMSI(v.Payload); ok {
+			for _, b := range ix.bloomBits(mmsi) {
+				ix.Bloom[b/8] |= 1 << (b % 8)
+			}
+		}
+	}
+}
+
+func (ix *recIndex) seekOffset(t time.Time) int64 {
+	// first record of the last minute starting indexMargin or more before t, 0 for the start
+	m := t.Add(-indexMargin).Unix()
+	i := sort.Search(len(ix.Minutes), func(i int) bool { return ix.Minutes[i][0] > m })
+	if i == 0 {
+		return 0
+	}
+	return ix.Minutes[i-1][1]
+}
+
+func (ix *recIndex) due(now time.Time) bool {
+	return ix != nil && ix.Records > ix.saved && now.Sub(ix.savedAt) >= indexEvery
+}
+
+func (ix *recIndex) save(size int64) error {
+	// as the index of the file's first size bytes, replacing the old one
+	ix.Size, ix.savedAt = size, time.Now()
+	b, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(ix.path+".tmp", b, 0664); err != nil {
+		return err
+	}
+	ix.saved = ix.Records
+	return os.Rename(ix.path+".tmp", ix.path)
+}
+
+func readIndex(name string) (*recIndex, error) {
+	// name's index as saved, whatever file it's for
+	b, err := os.ReadFile(indexPath(name))
+	if err != nil {
+		return nil, err
+	}
+	ix := &recIndex{path: indexPath(name), savedAt: time.Now()}
+	if err = json.Unmarshal(b, ix); err != nil {
+		return nil, err
+	}
+	ix.saved = ix.Records
+	return ix, nil
+}
+
+func loadIndex(name string) *recIndex {
+	// the index of an uncompressed file if it has one that fits, else nil
+	if strings.HasSuffix(name, ".gz") {
+		return nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil
+	}
+	ix, err := readIndex(name)
+	if err != nil || ix.File != filepath.Base(name) || ix.Size > fi.Size() || ix.Hashes < 1 || len(ix.Bloom) == 0 {
+		return nil
+	}
+	ix.whole = ix.Size == fi.Size()
+	return ix
+}
+
+func buildIndex(name string) (*recIndex, error) {
+	// read the file through for its index
+	rr, err := openRecording(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Close()
+	fi, err := rr.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ix := newRecIndex(name)
+	// what's written while it's read is indexed too, but not counted in Size
+	ix.Size, ix.whole = fi.Size(), true
+	for {
+		at := rr.offset()
+		rec, err := rr.Next()
+		if err == io.EOF {
+			return ix, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ix.add(rec.Stamp, at, rec.Sentence)
+	}
+}
+
+func streamIndex(name string, size int64) (*recIndex, error) {
+	// the index for a stream to carry on with, its daily file being size bytes
+	if size == 0 {
+		return newRecIndex(name), nil
+	}
+	if ix := loadIndex(name); ix != nil && ix.whole {
+		return ix, nil
+	}
+	return buildIndex(name)
+}
+
+func reindex(name string) error {
+	// make the index of a file that was rewritten again, if it has one
+	if ix, err := readIndex(name); err != nil || ix.File != filepath.Base(name) {
+		return nil
+	}
+	ix, err := buildIndex(name)
+	if err != nil {
+		return err
+	}
+	return ix.save(ix.Size)
+}
+
+func (rr *recReader) skipTo(t time.Time) (bool, error) {
+	// seek to near t if the file has an index and that's further on
+	ix := loadIndex(rr.name)
+	if ix == nil {
+		return false, nil
+	}
+	if at := ix.seekOffset(t); at > rr.offset() {
+		return true, rr.seek(at)
+	}
+	return false, nil
+}
+
+func (h *playHeap) skipTo(t time.Time) error {
+	// move the files with an index on to near t, dropping any with nothing from then
+	kept := (*h)[:0]
+	for _, src := range *h {
+		var err error
+		if src.next.Time.Before(t) {
+			var moved bool
+			if moved, err = src.rr.skipTo(t); moved && err == nil {
+				src.next, err = src.rr.Next()
+			}
+		}
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", src.rr.name, err)
+		}
+		kept = append(kept, src)
+	}
+	*h = kept
+	heap.Init(h)
+	return nil
+}
+
+func indexCmd(args []string) int {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	stream := fs.String("stream", "", "only this stream's files, by port, for days and folders")
+	force := fs.Bool("f", false, "make indexes again even if they fit their files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais index [options] file|folder|yyyy-mm-dd|yyyy-mm ...\n")
+		fs.PrintDefaults()
+	}
+	args = parseInterleaved(fs, args)
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	files, err := statsFiles(args, *stream)
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("no recordings found for %s", strings.Join(args, " "))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, name := range files {
+		if strings.HasSuffix(name, ".gz") {
+			fmt.Printf("%s: compressed, read whole\n", name)
+			continue
+		}
+		if ix := loadIndex(name); ix != nil && ix.whole && !*force {
+			fmt.Printf("%s: index up to date\n", name)
+			continue
+		}
+		ix, err := buildIndex(name)
+		if err == nil {
+			err = ix.save(ix.Size)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+			continue
+		}
+		fmt.Printf("%s: %d records in %d minutes, %s\n", name, ix.Records, len(ix.Minutes), ix.path)
+	}
+	return status
+}
@@ -0,0 +1,54 @@
+//go:build !edge
+
+package logais
+
+/*
+LogAIS as a central collector: remote agents, eg other LogAIS instances on
+small boxes at the receivers, push batches of sentences over HTTP(S) and the
+central instance does the archiving.
+
+On the collector, a stream with
+ ingest[=token]	record what agents post to /api/ingest/{port} on the -http API instead of listening on the port
+takes POST bodies of NMEA lines, TAG blocks allowed, with an
+Authorization: Bearer token header if a token is set. The answer is JSON
+{"accepted": n}; if the stream falls behind it is 503 after the lines it did
+take, so the agent sends the rest again. Use tagtime to keep the agents'
+receive times (see below) rather than the time the batch arrived.
+
+On an agent, any stream with
+ push=url	also post everything received to a collector, eg https://central:8080/api/ingest/10110
+ push-token=token	with this bearer token
+ push-ca=file push-cert=file push-key=file	CAs to check an https collector against, client certificate, see config/tls.go
+batches what the stream receives and posts it, see push.go; lines dropped
+because the collector was away too long are counted in the stream's stats.
+The edge build (edge.go) is an agent and nothing else.
+
+The collector serves HTTPS with the http-tls config line (see config/tls.go), agents
+then post to an https:// URL, with push-ca if its certificate isn't from a
+public CA.
+*/
+
+import (
+	"log/slog"
+	"time"
+)
+
+func (st *Stream) push(packet []byte, rx time.Time, logit *slog.Logger) {
+	// called from the stream's goroutine only
+	o := st.opts()
+	if o.Push == "" {
+		return
+	}
+	p := st.pusher
+	if p == nil || p.url != o.Push || p.token != o.PushToken || !p.tls.Same(o.PushTLS) {
+		if p != nil {
+			close(p.done)
+		}
+		p = newPusher(o.Push, o.PushToken, o.PushTLS, &st.stats.Pushed, &st.stats.PushDropped)
+		st.pusher = p
+		go p.run(logit, st.quit, func(text string) {
+			Events.publish(EventAlert, st.Port, text)
+		})
+	}
+	p.add(packet, rx)
+}
@@ -0,0 +1,226 @@
+package input
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+	"example.com/logais/config"
+)
+
+// aisstream.io and similar WebSocket feeds of decoded AIS messages as JSON, eg
+//
+//	20001	aisstream.io Hauraki Gulf	aisstream=APIKEY	bbox=-36.9,174.6;-36.1,175.6
+//
+// The port only names the stream's files, nothing listens on it.
+//
+//	aisstream=key	subscribe with this API key instead of listening on the port
+//	bbox=lat,lon;lat,lon[|...]	bounding boxes to subscribe to, two opposite corners each, default the whole world
+//	aisstream-url=wss://...	feed address, default wss://stream.aisstream.io/v0/stream
+//
+// Messages are encoded back into !AIVDM sentences so they're recorded like a
+// local receiver's, with a TAG block giving the feed as source and the time the
+// feed received them, see tags and tagtime. The feed doesn't say which VHF channel
+// a message came in on so that's left empty. Binary and other message types the
+// feed only partly decodes are not recorded; the first of each type is logged.
+
+// one field of a message as the feed names it, in transmitted order
+type aisField struct {
+	name  string  // JSON field, Parent.Child if nested
+	bits  int     // 0 for text of any length
+	scale float64 // numbers are multiplied by this, 0 for 1
+}
+
+var (
+	aisHeader = []aisField{{name: "MessageID", bits: 6}, {name: "RepeatIndicator", bits: 2}, {name: "UserID", bits: 30}}
+	aisLatLon = []aisField{{name: "Longitude", bits: 28, scale: 600000}, {name: "Latitude", bits: 27, scale: 600000}}
+	aisDims   = []aisField{{name: "Dimension.A", bits: 9}, {name: "Dimension.B", bits: 9}, {name: "Dimension.C", bits: 6}, {name: "Dimension.D", bits: 6}}
+)
+
+func joinFields(parts ...[]aisField) []aisField {
+	var all []aisField
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return all
+}
+
+// layouts of the message types recorded, by the feed's MessageType
+var aisLayouts = map[string][]aisField{
+	"PositionReport": joinFields(aisHeader, []aisField{{name: "NavigationalStatus", bits: 4}, {name: "RateOfTurn", bits: 8},
+		{name: "Sog", bits: 10, scale: 10}, {name: "PositionAccuracy", bits: 1}}, aisLatLon,
+		[]aisField{{name: "Cog", bits: 12, scale: 10}, {name: "TrueHeading", bits: 9}, {name: "Timestamp", bits: 6},
+			{name: "SpecialManoeuvreIndicator", bits: 2}, {name: "Spare", bits: 3}, {name: "Raim", bits: 1}, {name: "CommunicationState", bits: 19}}),
+	"BaseStationReport": joinFields(aisHeader, []aisField{{name: "UtcYear", bits: 14}, {name: "UtcMonth", bits: 4}, {name: "UtcDay", bits: 5},
+		{name: "UtcHour", bits: 5}, {name: "UtcMinute", bits: 6}, {name: "UtcSecond", bits: 6}, {name: "PositionAccuracy", bits: 1}}, aisLatLon,
+		[]aisField{{name: "FixType", bits: 4}, {name: "LongRangeEnable", bits: 1}, {name: "Spare", bits: 9}, {name: "Raim", bits: 1}, {name: "CommunicationState", bits: 19}}),
+	"ShipStaticData": joinFields(aisHeader, []aisField{{name: "AisVersion", bits: 2}, {name: "ImoNumber", bits: 30},
+		{name: "CallSign", bits: 42}, {name: "Name", bits: 120}, {name: "Type", bits: 8}}, aisDims,
+		[]aisField{{name: "FixType", bits: 4}, {name: "Eta.Month", bits: 4}, {name: "Eta.Day", bits: 5}, {name: "Eta.Hour", bits: 5}, {name: "Eta.Minute", bits: 6},
+			{name: "MaximumStaticDraught", bits: 8, scale: 10}, {name: "Destination", bits: 120}, {name: "Dte", bits: 1}, {name: "Spare", bits: 1}}),
+	"StandardSearchAndRescueAircraftReport": joinFields(aisHeader, []aisField{{name: "Altitude", bits: 12}, {name: "Sog", bits: 10},
+		{name: "PositionAccuracy", bits: 1}}, aisLatLon, []aisField{{name: "Cog", bits: 12, scale: 10}, {name: "Timestamp", bits: 6},
+		{name: "AltFromBaro", bits: 1}, {name: "Spare1", bits: 7}, {name: "Dte", bits: 1}, {name: "Spare2", bits: 3}, {name: "AssignedMode", bits: 1},
+		{name: "Raim", bits: 1}, {name: "CommunicationStateIsItdma", bits: 1}, {name: "CommunicationState", bits: 19}}),
+	"AddressedSafetyMessage": joinFields(aisHeader, []aisField{{name: "SequenceNumber", bits: 2}, {name: "DestinationID", bits: 30},
+		{name: "Retransmission", bits: 1}, {name: "Spare", bits: 1}, {name: "Text"}}),
+	"SafetyBroadcastMessage": joinFields(aisHeader, []aisField{{name: "Spare", bits: 2}, {name: "Text"}}),
+	"StandardClassBPositionReport": joinFields(aisHeader, []aisField{{name: "Spare1", bits: 8}, {name: "Sog", bits: 10, scale: 10},
+		{name: "PositionAccuracy", bits: 1}}, aisLatLon, []aisField{{name: "Cog", bits: 12, scale: 10}, {name: "TrueHeading", bits: 9},
+		{name: "Timestamp", bits: 6}, {name: "Spare2", bits: 2}, {name: "ClassBUnit", bits: 1}, {name: "ClassBDisplay", bits: 1},
+		{name: "ClassBDsc", bits: 1}, {name: "ClassBBand", bits: 1}, {name: "ClassBMsg22", bits: 1}, {name: "AssignedMode", bits: 1},
+		{name: "Raim", bits: 1}, {name: "CommunicationStateIsItdma", bits: 1}, {name: "CommunicationState", bits: 19}}),
+	"ExtendedClassBPositionReport": joinFields(aisHeader, []aisField{{name: "Spare1", bits: 8}, {name: "Sog", bits: 10, scale: 10},
+		{name: "PositionAccuracy", bits: 1}}, aisLatLon, []aisField{{name: "Cog", bits: 12, scale: 10}, {name: "TrueHeading", bits: 9},
+		{name: "Timestamp", bits: 6}, {name: "Spare2", bits: 4}, {name: "Name", bits: 120}, {name: "Type", bits: 8}}, aisDims,
+		[]aisField{{name: "FixType", bits: 4}, {name: "Raim", bits: 1}, {name: "Dte", bits: 1}, {name: "AssignedMode", bits: 1}, {name: "Spare3", bits: 4}}),
+	"AidsToNavigationReport": joinFields(aisHeader, []aisField{{name: "Type", bits: 5}, {name: "Name", bits: 120},
+		{name: "PositionAccuracy", bits: 1}}, aisLatLon, aisDims, []aisField{{name: "Fixtype", bits: 4}, {name: "Timestamp", bits: 6},
+		{name: "OffPosition", bits: 1}, {name: "AtoN", bits: 8}, {name: "Raim", bits: 1}, {name: "VirtualAtoN", bits: 1},
+		{name: "AssignedMode", bits: 1}, {name: "Spare", bits: 1}, {name: "NameExtension"}}),
+	// type 24 is two messages, chosen by PartNumber
+	"StaticDataReport/A": joinFields(aisHeader, []aisField{{name: "PartNumber", bits: 2}, {name: "ReportA.Name", bits: 120},
+		{name: "ReportA.Spare", bits: 8}}),
+	"StaticDataReport/B": joinFields(aisHeader, []aisField{{name: "PartNumber", bits: 2}, {name: "ReportB.ShipType", bits: 8},
+		{name: "ReportB.VendorIDName", bits: 18}, {name: "ReportB.VenderIDModel", bits: 4}, {name: "ReportB.VenderIDSerial", bits: 20},
+		{name: "ReportB.CallSign", bits: 42}, {name: "ReportB.Dimension.A", bits: 9}, {name: "ReportB.Dimension.B", bits: 9},
+		{name: "ReportB.Dimension.C", bits: 6}, {name: "ReportB.Dimension.D", bits: 6}, {name: "ReportB.FixType", bits: 4}, {name: "ReportB.Spare", bits: 2}}),
+	"LongRangeAisBroadcastMessage": joinFields(aisHeader, []aisField{{name: "PositionAccuracy", bits: 1}, {name: "Raim", bits: 1},
+		{name: "NavigationalStatus", bits: 4}, {name: "Longitude", bits: 18, scale: 600}, {name: "Latitude", bits: 17, scale: 600},
+		{name: "Sog", bits: 6}, {name: "Cog", bits: 9}, {name: "PositionLatency", bits: 1}, {name: "Spare", bits: 1}}),
+}
+
+// one message from the feed
+type aisStreamMessage struct {
+	MessageType string
+	Message     map[string]map[string]any
+	MetaData    struct {
+		TimeUTC string `json:"time_utc"`
+	}
+}
+
+var errAISStreamType = errors.New("message type not recorded")
+
+func lookup(m map[string]any, name string) any {
+	// nested field by dotted name, case insensitive as the feed isn't consistent
+	first, rest, nested := strings.Cut(name, ".")
+	for k, v := range m {
+		if !strings.EqualFold(k, first) {
+			continue
+		}
+		if !nested {
+			return v
+		}
+		if sub, ok := v.(map[string]any); ok {
+			return lookup(sub, rest)
+		}
+	}
+	return nil
+}
+
+func encodeAISStream(typ string, m map[string]any) (string, int, error) {
+	// payload and fill bits of a decoded message
+	if typ == "StaticDataReport" {
+		typ += "/A"
+		if p, _ := lookup(m, "PartNumber").(bool); p {
+			typ = "StaticDataReport/B"
+		}
+	}
+	layout, ok := aisLayouts[typ]
+	if !ok {
+		return "", 0, errAISStreamType
+	}
+	w := &ais.Writer{}
+	for _, f := range layout {
+		switch v := lookup(m, f.name).(type) {
+		case string:
+			size := f.bits
+			if size == 0 {
+				size = len(v) * 6
+			}
+			w.Text(v, size)
+		case float64:
+			if f.scale != 0 {
+				v *= f.scale
+			}
+			w.Int(int64(math.Round(v)), f.bits)
+		case bool:
+			if v {
+				w.Uint(1, f.bits)
+			} else {
+				w.Uint(0, f.bits)
+			}
+		default:
+			// missing, zero or spaces
+			w.Uint(0, f.bits)
+		}
+	}
+	payload, fill := w.Payload()
+	return payload, fill, nil
+}
+
+// aisstream.io and the like
+type aisStreamFeed struct {
+	*config.Feed
+}
+
+// a running subscription
+type aisStream struct {
+	spec    *config.Feed
+	logit   *slog.Logger
+	vdm     *vdmFeed
+	skipped map[string]bool // message types logged as not recorded
+}
+
+func (s *aisStreamFeed) Start(port string, logit *slog.Logger, quit <-chan struct{}, failed func(err error)) <-chan Datagram {
+	out := newFeedOut(quit)
+	a := &aisStream{spec: s.Feed, logit: logit, vdm: newVDMFeed(s.Addr), skipped: make(map[string]bool)}
+	go runFeed(s.Addr, logit, quit, failed, func() (int, error) { return a.session(out) })
+	return out.C
+}
+
+func (a *aisStream) session(out feedOut) (int, error) {
+	// one connection, returns the number of messages received before it failed
+	c, err := dialWebSocket(a.spec.Addr, "", 30*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	sub, _ := json.Marshal(map[string]any{"APIKey": a.spec.Key, "BoundingBoxes": a.spec.Boxes})
+	if err = c.writeText(sub); err != nil {
+		return 0, err
+	}
+	a.logit.Info("feed subscribed", "feed", a.spec.Addr)
+	n := 0
+	for {
+		b, err := c.read(feedQuiet)
+		if err != nil {
+			return n, err
+		}
+		n++
+		var msg aisStreamMessage
+		if err = json.Unmarshal(b, &msg); err != nil {
+			if n == 1 {
+				// the feed sends an error instead of messages, eg for a bad API key
+				return n, errors.New(strings.TrimSpace(string(b)))
+			}
+			continue
+		}
+		payload, fill, err := encodeAISStream(msg.MessageType, msg.Message[msg.MessageType])
+		if err != nil {
+			if !a.skipped[msg.MessageType] {
+				a.skipped[msg.MessageType] = true
+				a.logit.Info("feed message type not recorded", "feed", a.spec.Addr, "type", msg.MessageType)
+			}
+			continue
+		}
+		t, _ := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", msg.MetaData.TimeUTC)
+		if err = out.send(a.vdm.packet(payload, fill, t)); err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package input
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Finnish Digitraffic marine AIS feed, MQTT over WebSocket, for feed=digitraffic.
+// Vessel positions and metadata arrive decoded as JSON on topics
+//
+//	vessels-v2/{mmsi}/location
+//	vessels-v2/{mmsi}/metadata
+//
+// and are recorded as AIS type 1 and type 5 sentences, whatever type the vessel
+// sent (the feed doesn't say), with a TAG block giving the feed's time as for aisstream.
+// Only as much MQTT 3.1.1 as a QoS 0 subscription needs is implemented here.
+
+const mqttKeepAlive = 60 // seconds
+
+var digitrafficTopics = []string{"vessels-v2/+/location", "vessels-v2/+/metadata"}
+
+type digitraffic struct {
+	URL string
+}
+
+func (d *digitraffic) Start(port string, logit *slog.Logger, quit <-chan struct{}, failed func(err error)) <-chan Datagram {
+	out := newFeedOut(quit)
+	vdm := newVDMFeed(d.URL)
+	go runFeed(d.URL, logit, quit, failed, func() (int, error) {
+		return d.session(logit, vdm, out)
+	})
+	return out.C
+}
+
+// MQTT control packets over a WebSocket, which may split or join them
+type mqttConn struct {
+	ws  *wsConn
+	buf []byte
+}
+
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func (m *mqttConn) send(header byte, body []byte) error {
+	p := []byte{header}
+	n := len(body)
+	for {
+		// remaining length, 7 bits at a time
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		p = append(p, b)
+		if n == 0 {
+			break
+		}
+	}
+	return m.ws.writeBinary(append(p, body...))
+}
+
+func (m *mqttConn) receive(timeout time.Duration) (byte, []byte, error) {
+	// next packet's first byte and the rest of it
+	for {
+		if len(m.buf) >= 2 {
+			n, shift, i := 0, 0, 1
+			for ; i < len(m.buf) && i < 5; i++ {
+				n |= int(m.buf[i]&0x7f) << shift
+				shift += 7
+				if m.buf[i]&0x80 == 0 {
+					break
+				}
+			}
+			if i == 5 {
+				return 0, nil, errors.New("mqtt: bad packet length")
+			}
+			if i < len(m.buf) && len(m.buf) >= i+1+n {
+				header, body := m.buf[0], m.buf[i+1:i+1+n]
+				m.buf = m.buf[i+1+n:]
+				return header, body, nil
+			}
+		}
+		b, err := m.ws.read(timeout)
+		if err != nil {
+			return 0, nil, err
+		}
+		m.buf = append(m.buf, b...)
+	}
+}
+
+func (d *digitraffic) session(logit *slog.Logger, vdm *vdmFeed, out feedOut) (int, error) {
+	ws, err := dialWebSocket(d.URL, "mqtt", 30*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer ws.Close()
+	m := &mqttConn{ws: ws}
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	connect := append(mqttString("MQTT"), 4, 0x02, 0, mqttKeepAlive) // 3.1.1, clean session
+	if err = m.send(0x10, append(connect, mqttString("logais-"+hex.EncodeToString(id))...)); err != nil {
+		return 0, err
+	}
+	header, body, err := m.receive(30 * time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if header>>4 != 2 || len(body) < 2 || body[1] != 0 {
+		return 0, fmt.Errorf("mqtt: connection refused (%x %x)", header, body)
+	}
+	sub := []byte{0, 1}
+	for _, t := range digitrafficTopics {
+		sub = append(append(sub, mqttString(t)...), 0)
+	}
+	if err = m.send(0x82, sub); err != nil {
+		return 0, err
+	}
+	logit.Info("feed subscribed", "feed", d.URL)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		tick := time.NewTicker(mqttKeepAlive / 2 * time.Second)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				m.send(0xc0, nil)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	n := 0
+	for {
+		header, body, err := m.receive(feedQuiet)
+		if err != nil {
+			return n, err
+		}
+		if header>>4 != 3 || len(body) < 2 {
+			// only publishes matter, acks and ping responses are ignored
+			continue
+		}
+		tl := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+tl {
+			continue
+		}
+		topic, payload := string(body[2:2+tl]), body[2+tl:]
+		if header&0x06 != 0 {
+			// QoS 1 or 2 has a packet id, not asked for but skip it anyway
+			if len(payload) < 2 {
+				continue
+			}
+			payload = payload[2:]
+		}
+		n++
+		if packet, ok := vdm.digitraffic(topic, payload); ok {
+			if err = out.send(packet); err != nil {
+				return n, err
+			}
+		}
+	}
+}
+
+// message fields as the feed sends them
+type digitrafficMessage struct {
+	Time        int64   `json:"time"`      // location, UNIX seconds
+	Timestamp   int64   `json:"timestamp"` // metadata, UNIX milliseconds
+	SOG         float64 `json:"sog"`
+	COG         float64 `json:"cog"`
+	NavStat     float64 `json:"navStat"`
+	ROT         float64 `json:"rot"`
+	PosAcc      bool    `json:"posAcc"`
+	RAIM        bool    `json:"raim"`
+	Heading     float64 `json:"heading"`
+	Lon         float64 `json:"lon"`
+	Lat         float64 `json:"lat"`
+	Destination string  `json:"destination"`
+	Name        string  `json:"name"`
+	Draught     float64 `json:"draught"` // 1/10 metre
+	ETA         int     `json:"eta"`     // packed as in type 5
+	PosType     float64 `json:"posType"`
+	RefA        float64 `json:"refA"`
+	RefB        float64 `json:"refB"`
+	RefC        float64 `json:"refC"`
+	RefD        float64 `json:"refD"`
+	CallSign    string  `json:"callSign"`
+	IMO         float64 `json:"imo"`
+	Type        float64 `json:"type"`
+}
+
+func (f *vdmFeed) digitraffic(topic string, payload []byte) ([]byte, bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	mmsi, err := strconv.ParseUint(parts[1], 10, 32)
+	var d digitrafficMessage
+	if err != nil || json.Unmarshal(payload, &d) != nil {
+		return nil, false
+	}
+	var (
+		typ  string
+		m    map[string]any
+		when time.Time
+	)
+	switch parts[2] {
+	case "location":
+		typ, when = "PositionReport", time.Unix(d.Time, 0)
+		m = map[string]any{"MessageID": 1.0, "UserID": float64(mmsi), "NavigationalStatus": d.NavStat, "RateOfTurn": d.ROT,
+			"Sog": d.SOG, "PositionAccuracy": d.PosAcc, "Longitude": d.Lon, "Latitude": d.Lat, "Cog": d.COG,
+			"TrueHeading": d.Heading, "Timestamp": float64(d.Time % 60), "Raim": d.RAIM}
+	case "metadata":
+		typ, when = "ShipStaticData", time.UnixMilli(d.Timestamp)
+		m = map[string]any{"MessageID": 5.0, "UserID": float64(mmsi), "ImoNumber": d.IMO, "CallSign": d.CallSign, "Name": d.Name,
+			"Type": d.Type, "Dimension": map[string]any{"A": d.RefA, "B": d.RefB, "C": d.RefC, "D": d.RefD}, "FixType": d.PosType,
+			"Eta": map[string]any{"Month": float64(d.ETA >> 16 & 0xf), "Day": float64(d.ETA >> 11 & 0x1f),
+				"Hour": float64(d.ETA >> 6 & 0x1f), "Minute": float64(d.ETA & 0x3f)},
+			"MaximumStaticDraught": d.Draught / 10, "Destination": d.Destination}
+	default:
+		return nil, false
+	}
+	p, fill, err := encodeAISStream(typ, m)
+	if err != nil {
+		return nil, false
+	}
+	if d.Time == 0 && d.Timestamp == 0 {
+		when = time.Time{}
+	}
+	return f.packet(p, fill, when), true
+}
@@ -0,0 +1,211 @@
+// Package input runs the network feeds a stream can record instead of
+// listening on its UDP port, and opens the UDP sockets of the streams that do
+// listen. Feeds are
+//
+//	aisstream=key	aisstream.io WebSocket JSON, see aisstream.go
+//	tcp=host:port	NMEA sentences over TCP, one per line, eg a receiver's or a provider's TCP server
+//	tcp=tls://host:port	the same over TLS, see package config
+//	feed=name	a public national feed with its address and quirks built in:
+//		kystverket	Norwegian Coastal Administration, TCP 153.44.253.27:5631, sentences from
+//			their base stations (talker BS) with a TAG block giving the station and time
+//		digitraffic	Finnish Digitraffic marine, MQTT over WebSocket, see digitraffic.go
+//	ingest[=token]	batches other instances post to the API, see IngestHandler
+//
+// Feeds reconnect by themselves, waiting longer after each failure up to five
+// minutes. They stop with their stream, eg when a config reload removes it, as
+// soon as they next receive something or time out.
+package input
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/config"
+	"example.com/logais/sentence"
+)
+
+const (
+	feedBuffer = 256             // packets waiting for the stream
+	feedQuiet  = 2 * time.Minute // reconnect if a feed is quiet this long
+	feedRetry  = 5 * time.Minute // longest wait between connection attempts
+)
+
+// Datagram is a packet of sentences and the time it was read.
+type Datagram struct {
+	Data []byte
+	Rx   time.Time
+}
+
+// Feed is a network feed recorded instead of a UDP port.
+type Feed interface {
+	// Start connects and returns packets of sentences as if from a datagram,
+	// timed as they're read; port is the stream's. The feed reconnects until
+	// quit is closed, calling failed with the error each time it drops.
+	Start(port string, log *slog.Logger, quit <-chan struct{}, failed func(err error)) <-chan Datagram
+}
+
+// New returns the feed f configures.
+func New(f *config.Feed) Feed {
+	switch f.Kind {
+	case "aisstream":
+		return &aisStreamFeed{f}
+	case "digitraffic":
+		return &digitraffic{URL: f.Addr}
+	case "ingest":
+		return &ingestFeed{token: f.Token}
+	}
+	return &tcpFeed{f}
+}
+
+var errFeedStopped = errors.New("feed stopped")
+
+// where a feed's sessions send packets, until the stream stops
+type feedOut struct {
+	C    chan Datagram
+	quit <-chan struct{}
+}
+
+func newFeedOut(quit <-chan struct{}) feedOut {
+	return feedOut{C: make(chan Datagram, feedBuffer), quit: quit}
+}
+
+func (f feedOut) send(packet []byte) error {
+	select {
+	case f.C <- Datagram{Data: packet, Rx: time.Now()}:
+		return nil
+	case <-f.quit:
+		return errFeedStopped
+	}
+}
+
+func runFeed(address string, logit *slog.Logger, quit <-chan struct{}, failed func(err error), session func() (int, error)) {
+	// run sessions until quit, session returns how much it received before failing
+	wait := 5 * time.Second
+	for {
+		n, err := session()
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		logit.Error("feed failed", "feed", address, "err", err)
+		failed(err)
+		if n > 0 {
+			wait = 5 * time.Second
+		}
+		select {
+		case <-time.After(wait):
+		case <-quit:
+			return
+		}
+		wait = min(2*wait, feedRetry)
+	}
+}
+
+// NMEA sentences over TCP, kystverket too
+type tcpFeed struct {
+	*config.Feed
+}
+
+func (f *tcpFeed) dial(logit *slog.Logger) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	if f.TLS == nil {
+		return d.Dial("tcp", f.Addr)
+	}
+	ld, err := f.TLS.Current(logit)
+	if ld == nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(f.Addr)
+	return tls.DialWithDialer(d, "tcp", f.Addr, ld.Client(host))
+}
+
+func (f *tcpFeed) Start(port string, logit *slog.Logger, quit <-chan struct{}, failed func(err error)) <-chan Datagram {
+	out := newFeedOut(quit)
+	go runFeed(f.Address(), logit, quit, failed, func() (int, error) {
+		conn, err := f.dial(logit)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		logit.Info("feed connected", "feed", f.Address())
+		// reads come in whatever pieces TCP delivers, so sentences are put back together by line
+		rd := bufio.NewReaderSize(conn, 65536)
+		n := 0
+		for {
+			conn.SetReadDeadline(time.Now().Add(feedQuiet))
+			line, err := rd.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+			n++
+			if err = out.send(append([]byte(nil), line...)); err != nil {
+				return n, err
+			}
+		}
+	})
+	return out.C
+}
+
+// sentences made from decoded messages, with a TAG block giving the feed and the time it received them
+type vdmFeed struct {
+	source string // TAG block source, the feed's host
+	seq    int    // multipart sequence id
+}
+
+func newVDMFeed(address string) *vdmFeed {
+	f := &vdmFeed{source: address}
+	if u, err := url.Parse(address); err == nil && u.Hostname() != "" {
+		f.source = u.Hostname()
+	}
+	return f
+}
+
+func (f *vdmFeed) packet(payload string, fill int, when time.Time) []byte {
+	// when is left out of the TAG block if zero
+	tag := "s:" + f.source
+	if !when.IsZero() {
+		tag += ",c:" + strconv.FormatInt(when.UnixMilli(), 10)
+	}
+	tag = sentence.WithChecksum("\\" + tag)
+	var packet strings.Builder
+	for _, s := range vdmSentences(payload, fill, f.seq) {
+		packet.WriteString(tag + "\\" + s + "\r\n")
+	}
+	f.seq++
+	return []byte(packet.String())
+}
+
+func vdmSentences(payload string, fill int, seq int) []string {
+	// split into sentences of at most 60 payload characters, seq is the multipart sequence id
+	var parts []string
+	for len(payload) > 60 {
+		parts = append(parts, payload[:60])
+		payload = payload[60:]
+	}
+	parts = append(parts, payload)
+	id := ""
+	if len(parts) > 1 {
+		id = strconv.Itoa(seq % 10)
+	}
+	sentences := make([]string, len(parts))
+	for i, p := range parts {
+		f := 0
+		if i == len(parts)-1 {
+			f = fill
+		}
+		sentences[i] = sentence.WithChecksum(fmt.Sprintf("!AIVDM,%d,%d,%s,,%s,%d", len(parts), i+1, id, p, f))
+	}
+	return sentences
+}
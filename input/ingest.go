@@ -0,0 +1,100 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ingestMax  = 4 << 20          // largest batch a collector takes, bytes
+	ingestWait = 10 * time.Second // how long a batch waits for a stream that's behind
+)
+
+// ingest streams by port while they run
+var ingests sync.Map // port -> *ingestFeed
+
+// posted batches recorded by a collector stream
+type ingestFeed struct {
+	token string
+	out   feedOut
+}
+
+func (f *ingestFeed) Start(port string, logit *slog.Logger, quit <-chan struct{}, failed func(err error)) <-chan Datagram {
+	// a stream gets its own copy, the parsed options are shared with profiles
+	g := &ingestFeed{token: f.token, out: newFeedOut(quit)}
+	ingests.Store(port, g)
+	go func() {
+		<-quit
+		// a restarted stream may already have its new feed in place
+		ingests.CompareAndDelete(port, g)
+	}()
+	return g.out.C
+}
+
+// IngestHandler takes the batches agents post to /api/ingest/{port} for a
+// running ingest stream, answering {"accepted": n}; if the stream falls behind
+// it's 503 after the lines it did take, so the agent sends the rest again.
+func IngestHandler(w http.ResponseWriter, r *http.Request) {
+	v, ok := ingests.Load(r.PathValue("port"))
+	if !ok {
+		http.Error(w, "no ingest stream on that port", http.StatusNotFound)
+		return
+	}
+	f := v.(*ingestFeed)
+	if f.token != "" {
+		given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(f.token)) != 1 {
+			http.Error(w, "wrong or missing token", http.StatusUnauthorized)
+			return
+		}
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, ingestMax))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	// one packet per line as from a TCP feed, so nothing is cut at the stream's buffer size
+	accepted := 0
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(nil, ingestMax)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			accepted++
+			continue
+		}
+		select {
+		case f.out.C <- Datagram{Data: append(append([]byte(nil), line...), '\r', '\n'), Rx: time.Now()}:
+			accepted++
+			continue
+		case <-f.out.quit:
+		case <-time.After(ingestWait):
+		}
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		writeJSON(w, map[string]int{"accepted": accepted})
+		return
+	}
+	writeJSON(w, map[string]int{"accepted": accepted})
+}
+
+// IngestToken reports whether the ingest stream on port checks its agents' token itself.
+func IngestToken(port string) bool {
+	v, ok := ingests.Load(port)
+	return ok && v.(*ingestFeed).token != ""
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	enc.Encode(v)
+}
@@ -0,0 +1,9 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package input
+
+import "syscall"
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return setReusePort(c, syscall.SO_REUSEPORT)
+}
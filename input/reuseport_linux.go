@@ -0,0 +1,14 @@
+//go:build linux
+
+package input
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	// SO_REUSEPORT isn't in package syscall for Linux
+	return setReusePort(c, unix.SO_REUSEPORT)
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package input
+
+import "net"
+
+// SocketBuffer is the receive buffer (SO_RCVBUF) the system gave conn, 0 if it can't say.
+func SocketBuffer(conn *net.UDPConn) int {
+	// not read back here, the log shows the size asked for
+	return 0
+}
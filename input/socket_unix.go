@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package input
+
+import (
+	"net"
+	"syscall"
+)
+
+// SocketBuffer is the receive buffer (SO_RCVBUF) the system gave conn, 0 if it can't say.
+func SocketBuffer(conn *net.UDPConn) int {
+	// SO_RCVBUF as the system set it, 0 if it can't be read
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	n := 0
+	rc.Control(func(fd uintptr) {
+		n, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	})
+	return n
+}
+
+func setReusePort(c syscall.RawConn, opt int) error {
+	// before the socket is bound, see reusePort
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, 1)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,29 @@
+package input
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// ListenUDP opens a stream's UDP port with a receive buffer of sockBuf bytes,
+// 0 for the system's. Shared sockets (SO_REUSEPORT) let several read the
+// same port, the system sharing the datagrams out between them by sender.
+func ListenUDP(port int, shared bool, sockBuf int) (*net.UDPConn, error) {
+	var lc net.ListenConfig
+	if shared {
+		lc.Control = reusePort
+	}
+	pc, err := lc.ListenPacket(context.Background(), "udp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.UDPConn)
+	if sockBuf > 0 {
+		if err := conn.SetReadBuffer(sockBuf); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,205 @@
+package input
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Minimal WebSocket client (RFC 6455) for feeds that stream over ws:// or wss://,
+// enough to send a subscription and read messages. No extensions or compression.
+
+const (
+	wsGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxMessage = 1 << 20 // longer messages are an error, a feed's are a few hundred bytes
+
+	wsText   = 1
+	wsBinary = 2
+	wsClose  = 8
+	wsPing   = 9
+	wsPong   = 10
+)
+
+// UserAgent is what WebSocket feeds are told is connecting.
+var UserAgent = "LogAIS"
+
+var errWSClosed = errors.New("websocket closed by server")
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	wmu  sync.Mutex // writes from the reader answering pings and from the feed
+}
+
+func dialWebSocket(rawURL string, protocol string, timeout time.Duration) (*wsConn, error) {
+	// protocol is the subprotocol to ask for, eg mqtt, or empty
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host += map[string]string{"ws": ":80", "wss": ":443"}[u.Scheme]
+	}
+	d := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = d.Dial("tcp", host)
+	case "wss":
+		conn, err = tls.DialWithDialer(d, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, errors.New("not a ws:// or wss:// address: " + rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	nonce := base64.StdEncoding.EncodeToString(key)
+	conn.SetDeadline(time.Now().Add(timeout))
+	extra := ""
+	if protocol != "" {
+		extra = "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\nUser-Agent: %s\r\n%s\r\n",
+		u.RequestURI(), u.Host, nonce, UserAgent, extra)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: "GET"})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	sum := sha1.Sum([]byte(nonce + wsGUID))
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, errors.New("websocket upgrade refused: " + resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, errors.New("websocket upgrade: bad Sec-WebSocket-Accept")
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, br: br}, nil
+}
+
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	// client frames are always masked
+	head := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, 0x80|byte(n))
+	case n < 65536:
+		head = append(head, 0x80|126)
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head = append(head, 0x80|127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	head = append(head, mask...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(append(head, masked...))
+	return err
+}
+
+func (c *wsConn) writeText(payload []byte) error {
+	return c.write(wsText, payload)
+}
+
+func (c *wsConn) writeBinary(payload []byte) error {
+	return c.write(wsBinary, payload)
+}
+
+func (c *wsConn) read(timeout time.Duration) ([]byte, error) {
+	// next text or binary message, answering pings on the way
+	var message []byte
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(timeout))
+		var head [2]byte
+		if _, err := io.ReadFull(c.br, head[:]); err != nil {
+			return nil, err
+		}
+		fin, opcode := head[0]&0x80 != 0, head[0]&0x0f
+		n := uint64(head[1] & 0x7f)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return nil, err
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		var mask [4]byte
+		if head[1]&0x80 != 0 {
+			if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+				return nil, err
+			}
+		}
+		if n+uint64(len(message)) > wsMaxMessage {
+			return nil, fmt.Errorf("websocket message longer than %d bytes", wsMaxMessage)
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return nil, err
+		}
+		if head[1]&0x80 != 0 {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.write(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.write(wsClose, nil)
+			if len(payload) > 2 {
+				return nil, fmt.Errorf("%w: %s", errWSClosed, payload[2:])
+			}
+			return nil, errWSClosed
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
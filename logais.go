@@ -1,4 +1,6 @@
-package main
+//go:build !edge
+
+package logais
 
 /*
 Write AIS data received by UDP to file in OpenCPN VDR format:
@@ -17,11 +19,10 @@ Logfile rotated when size exceeds limit below, size checked at ticker interval b
 */
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"log"
-	"net"
+	"log/slog"
+	"net/netip"
 	"os"
 	"runtime"
 	"strconv"
@@ -29,150 +30,382 @@ import (
 	"sync"
 	"time"
 
+	"example.com/logais/config"
+	"example.com/logais/input"
+	"example.com/logais/sink"
 )
 
 const (
 	ConfName  = "LogAIS"    // config file name
-	Lfsize    = 102400      // max size of Logfile before rotating it, (100KB)
+	Lfsize    = config.LogSize // max size of Logfile before rotating it, (100KB)
 	Logcheck  = 10          // minutes between checking Logfile size
 	LogfName  = "LogAIS"
-	Maxlogs   = 4           // number of old logfiles to keep
+	Maxlogs   = config.LogKeep // number of old logfiles to keep
 	Version   = "1.02"
 )
 
 var (
 	Logfile       *os.File
-	Logit         *log.Logger
+	Logit         = slog.New(&textHandler{w: os.Stderr, mu: new(sync.Mutex), level: LogLevel}) // see logging.go
+	logMu         sync.Mutex // held while the log file is swapped
 	Logpath       = ""
 	Datapath      = "" // output data path
 	Sep           = ""
 )
 
-func abort(text string) {
-	// called if unable to cd to datadir, don't know what will happen to call to log.
-	//  tries to log event, ignore errors
-	lname := LogfName + ".log"
-	os.Chdir(Logpath) // home dir on Linux, no action on Windows
-	lhandle, _ := os.OpenFile(lname, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
-	defer lhandle.Close()
-	logx := log.New(lhandle, "UTC ", log.LUTC|log.LstdFlags|log.Lmsgprefix)
-	logx.Fatal(text)
-	fmt.Printf("Exiting program, error: %s\n", text)
-	os.Exit(1)
-}
+// column header of the documented OpenCPN VDR format
+const vdrHeader = "received_at,protocol,msg_type,source,raw_data\r\n"
 
-func main() {
-	var wg sync.WaitGroup
+// LogOpened, if set, is called with each log file Start opens, and again
+// when the log is rotated, eg for the logais command to send stderr there.
+var LogOpened func(f *os.File)
 
-	// os specific variables
-	switch runtime.GOOS {
-	case "windows":
-		Sep = "\\" // actual single backslash
-		Datapath = "C:\\" + ConfName + Sep
-		Logpath, _ = os.LookupEnv("APPDATA")
-		Logpath += Sep + LogfName + Sep
-	case "linux":
-		Sep = "/"
-		Datapath = "/var/local/" + ConfName + Sep
-		Logpath = "/var/log/" + LogfName + Sep
-	default:
-		abort("Unknown OS: " + runtime.GOOS)
-	}
+func init() {
+	setPaths()
+}
 
-	// find the dirs for config & log files
-	if err := os.MkdirAll(Logpath, 0775); err != nil {
-		// won't return
-		abort("Fatal: unable to open logfile folder for logging: " + Logpath + " please rerun installer")
+// Tool is the logais command's tool called name, one that works on
+// recordings rather than recording, eg convert: run with the arguments after
+// the name it returns the exit status. nil if there's no such tool.
+func Tool(name string) func(args []string) int {
+	var cmd func([]string) int
+	switch name {
+	case "play", "replay":
+		cmd = playCmd
+	case "convert":
+		cmd = convertCmd
+	case "merge":
+		cmd = mergeCmd
+	case "stats":
+		cmd = statsCmd
+	case "grep":
+		cmd = grepCmd
+	case "index":
+		cmd = indexCmd
+	case "vessels":
+		cmd = vesselsCmd
+	case "export":
+		cmd = exportCmd
+	case "hold":
+		cmd = holdCmd
+	case "purge":
+		cmd = purgeCmd
+	case "du":
+		cmd = duCmd
+	case "retention":
+		cmd = retentionCmd
+	case "catalog":
+		cmd = catalogCmd
+	case "check":
+		cmd = checkCmd
+	case "setup":
+		cmd = setupCmd
+	case "annotate":
+		cmd = annotateCmd
+	case "verify":
+		cmd = verifyCmd
+	default:
+		return nil
 	}
-	if err := os.Chdir(Datapath); err != nil {
-		abort("Fatal: unable to set data directory to " + Datapath + " please rerun installer")
-		return
+	return func(args []string) int {
+		args, err := pathFlags(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return cmd(args)
 	}
+}
 
-	// rotate Logfile now to start new file for each program launch
-	rotateLog()
-	// Logfile handle will change when Logfile is rotated, so will repeat this on exit (probably not necessary)
-	defer Logfile.Close()
-	Logit = log.New(Logfile, "UTC ", log.LUTC|log.LstdFlags|log.Lmsgprefix)
-	Logit.Printf("LogAIS v%s started. CompAIS NZ", Version)
+// Settings are what the logais command's flags set, for it or another
+// program running the recorder with Start. Empty fields are the defaults.
+type Settings struct {
+	Profile   string // config file profile to start with, as -profile
+	HTTP      string // address to serve the monitoring API on, none if empty, as -http
+	Node      string // this logger's name in the config's cluster nodes, default the host name
+	Watch     bool   // reload the config file when it changes, as -watch
+	Config    string // config file, as -config
+	DataDir   string // folder for recordings, as -data-dir
+	LogDir    string // folder for the log file, as -log-dir
+	Storage   string // local or memory, as -storage
+	LogLevel  string // debug, info, warning or error, as -log-level
+	LogFormat string // text or json, as -log-format
+}
 
-	conffile := Datapath + ConfName
+// Start starts recording every stream in the config as logais does, and
+// returns once they're started; Wait then waits for them to stop. An error is
+// returned for settings, folders or a config that aren't right, nothing has
+// been started then. Streams' records reach the rest of the program through
+// a sink registered with package sink. Signals are left to the caller: Stop
+// for Ctrl-C or SIGTERM, Reload for SIGHUP. It can only be called once.
+func Start(s Settings) error {
+	for name, value := range map[string]string{"config": s.Config, "data-dir": s.DataDir, "log-dir": s.LogDir} {
+		if value != "" {
+			setPath(name, value)
+		}
+	}
+	if s.Profile == "" {
+		s.Profile = DefaultProfile
+	}
+	if s.Node == "" {
+		s.Node, _ = os.Hostname()
+	}
+	if err := setStorage(s.Storage); err != nil {
+		return err
+	}
+	level, err := parseLogLevel(s.LogLevel)
+	if err != nil {
+		return err
+	}
+	LogLevel.Set(level)
+	handler, err := newLogHandler(logOutput{}, s.LogFormat, LogLevel)
+	if err != nil {
+		return err
+	}
+	LogFormat = s.LogFormat
 
-	go logCheck()  // periodic check on logfile size
+	// find the dirs for config & log files
+	if Container {
+		// a fresh volume is empty
+		if err := os.MkdirAll(Datapath, 0775); err != nil {
+			return fmt.Errorf("unable to make data folder %s: %w", Datapath, err)
+		}
+	} else if err := os.MkdirAll(Logpath, 0775); err != nil {
+		return fmt.Errorf("unable to open logfile folder for logging: %s, please rerun installer", Logpath)
+	}
+	if fi, err := os.Stat(Datapath); err != nil || !fi.IsDir() {
+		return fmt.Errorf("no data folder %s, please rerun installer", Datapath)
+	}
 
-	// read file into memory
-	content, err := os.ReadFile(conffile + ".txt")
+	// read first, it says how the log is rotated
+	conffile := configPath()
+	conf, err := readConfig(conffile)
 	if err != nil {
-		// file error, bail out
-		abort("Fatal error reading " + conffile + ".txt : " + err.Error())
-		return
+		return fmt.Errorf("error reading %s: %w", conffile, err)
 	}
 
-	// Break up content into lines
-	afoArray := bytes.Split(content, []byte("\n"))
-	for _, buf := range afoArray {
-		// byte slice for each line
-		// trim leading & trailing spaces, double spaces
-		line := strings.TrimSpace(string(buf))
-		line = strings.ReplaceAll(line, "  ", " ")
-		if line == "" {
-			continue
+	// nothing started yet, settings the config doesn't allow are an error
+	if s.Profile != DefaultProfile {
+		if _, ok := conf.Profiles[s.Profile]; !ok {
+			return fmt.Errorf("no profile %q in %s", s.Profile, conffile)
 		}
-		fields := strings.Split(line, "\t")
-		if fields[0][0] == '#' {
-			// ignore # comments
-			continue
+	}
+	if s.HTTP != "" {
+		if err = checkHTTPAuth(s.HTTP, conf); err != nil {
+			return err
 		}
-		if len(fields) < 2 {
-			// must have a description
-			continue
+	}
+	var members *cluster
+	if len(conf.Nodes) > 0 {
+		if s.HTTP == "" {
+			return errors.New("cluster members need -http so they can see each other")
+		}
+		if members, err = newCluster(s.Node, conf.Nodes); err != nil {
+			return err
 		}
+	}
+	if err = linkMerges(conf.Streams); err != nil {
+		return err
+	}
 
-		// strip spaces except for description
-		// any fields beyond 2 ignored
-		text := make([]string, 2)
-		for i := 0; i < 2; i++ {
-			if i < 1 {
-				fields[i] = strings.ReplaceAll(fields[i], " ", "")
-			}
-			text[i] = string(fields[i])
+	if Container {
+		// the container runtime keeps the log
+		Logfile = os.Stdout
+	} else if err = openLog(logRotation(conf)); err != nil {
+		// a new Logfile for each program launch, or this period's, see logrotate.go
+		return err
+	}
+	input.UserAgent = "LogAIS/" + Version
+	Logit = slog.New(handler)
+	Logit.Info("LogAIS started. CompAIS NZ", "version", Version)
+	if s.Storage == "memory" {
+		Logit.Warn("-storage memory, stream files are kept in memory and lost when LogAIS stops")
+	}
+
+
+	if conf.Syslog != nil {
+		if Logit, err = withSyslog(handler, conf.Syslog); err != nil {
+			Logit.Error("can't reach syslog, logging to the file only", "syslog", conf.Syslog.String(), "err", err)
+		} else {
+			Logit.Info("logging to syslog", "syslog", conf.Syslog.String(), "only", conf.Syslog.Only)
 		}
+	}
+	// streams with log-file get their entries in their own file too
+	Logit = slog.New(&streamRouter{next: Logit.Handler()})
+	Logit.Info("config read", "path", conffile)
+	for _, p := range checkConfig(conffile, conf) {
+		Logit.Warn("config: " + p)
+	}
+	for _, f := range config.Lint(conf.Config) {
+		f.Log(Logit)
+	}
+	Conf = conf
+	if Conf.Station != nil {
+		Station.set(Conf.Station[0], Conf.Station[1], "config")
+	}
 
-		wg.Go(func() {
-			startAIS(text, &Logit)
-		})
+	// after the config and Logit are set, these use both
+	if !Container {
+		go logCheck()  // periodic check on logfile size and age
+	}
+	go keepHistory(Events.subscribe(eventHistory))
+	go keepErrors(Events.subscribe(streamErrors*4, EventAlert))
+	go reportStats()
 
-//		go startAIS(text, &Logit)
+	// a scheduled restart carries on with the profile and seq numbers it had
+	if state := loadRestartState(); state != nil {
+		Logit.Info("restarted as scheduled", "profile", state.Profile)
+		if _, ok := Conf.Profiles[state.Profile]; ok && s.Profile == DefaultProfile {
+			s.Profile = state.Profile
+		}
+		for _, st := range Conf.Streams {
+			st.seq = state.Seq[st.Port]
+		}
+	}
+	// starting profile from the command line, otherwise whatever the schedule says
+	if s.Profile != DefaultProfile {
+		setProfile(s.Profile) // checked above
+	}
+	if len(Conf.Schedule) > 0 {
+		scheduling = true
+		go runSchedule(s.Profile != DefaultProfile)
+	}
 
+	Vessels.path = Datapath + "vessels.json"
+	if err = Vessels.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		Logit.Error("reading vessel registry", "err", err)
+	}
+	go Vessels.keep()
+	Sightings.lost.Store(int64(Conf.VesselLost))
+	go Sightings.keep()
+	if cat, err := openCatalog(); err == nil {
+		Catalog = cat
+		go keepCatalog()
+	} else if !errors.Is(err, errNoCatalog) {
+		Logit.Error("opening catalog", "err", err)
+	}
+	if Conf.Cold != nil {
+		go keepTiering(*Conf.Cold)
+	}
+	go keepDiskSpace()
+	go keepRetention()
+	startClock()
+	if s.HTTP != "" {
+		apiAddr = s.HTTP
+		go serveAPI(s.HTTP)
+	}
+	if members != nil {
+		Cluster = members
+		go Cluster.run()
+	}
+	if Conf.Peer != "" {
+		if s.HTTP == "" {
+			Logit.Warn("peer can't fill gaps from this instance without -http", "peer", redactURL(Conf.Peer))
+		}
+		go keepSync(Conf.Peer)
+	}
+	for _, st := range Conf.Streams {
+		if f := st.opts().Feed; f != nil && f.Kind == "ingest" && s.HTTP == "" {
+			Logit.Warn("ingest stream gets nothing without -http", "port", st.Port)
+		}
 	}
 
-	Logit.Printf("Info: all channels started")
+	for _, st := range Conf.Streams {
+		runStream(st)
+	}
+	confPath = conffile
+	go watchConfig(conffile, s.Watch)
+	go keepRestarting()
+	go notifySystemd()
+	go keepManifest()
 
-	fmt.Printf("%s Z\n", time.Now().UTC().Format(time.DateTime))
-	fmt.Printf("\t\tAll processes started\n")
-	fmt.Printf("\t\t****** DO NOT CLOSE THIS WINDOW! ******\n")
-	fmt.Printf("\t\tunless the command prompt has returned!\n\n")
+	Logit.Info("all channels started")
+	return nil
+}
 
-	wg.Wait()
+// Wait waits for the recorder Start started to stop, with Stop or through the
+// control API, and finishes up as logais does on exit.
+func Wait() {
+	<-stopAll
+	Running.Wait()
+	if restarting.Load() {
+		// restart.go carries on from here
+		select {}
+	}
+	closeManifest("stopped")
+	Vessels.save()
+	if Catalog != nil {
+		Catalog.Close()
+	}
 
-	Logit.Printf("Exiting application.  Thank you for flying Coconut Airways.")
-	defer Logfile.Close()
-	return
+	Logit.Info("Exiting application.  Thank you for flying Coconut Airways.")
+	Logfile.Close()
 }
 
+func setPaths() {
+	// os specific variables
+	switch runtime.GOOS {
+	case "windows":
+		Sep = "\\" // actual single backslash
+		Datapath = "C:\\" + ConfName + Sep
+		Logpath, _ = os.LookupEnv("APPDATA")
+		Logpath += Sep + LogfName + Sep
+	case "linux":
+		Sep = "/"
+		Datapath = "/var/local/" + ConfName + Sep
+		Logpath = "/var/log/" + LogfName + Sep
+	case "freebsd", "openbsd", "netbsd", "dragonfly":
+		// /var/local isn't a BSD convention, program state goes in /var/db
+		Sep = "/"
+		Datapath = "/var/db/" + ConfName + Sep
+		Logpath = "/var/log/" + LogfName + Sep
+	case "darwin":
+		// per user, a Mac is usually someone's nav laptop rather than a server
+		Sep = "/"
+		home, _ := os.UserHomeDir()
+		Datapath = home + "/Library/Application Support/" + ConfName + Sep
+		Logpath = home + "/Library/Logs/" + LogfName + Sep
+	default:
+		// laid out as on Linux
+		Sep = "/"
+		Datapath = "/var/local/" + ConfName + Sep
+		Logpath = "/var/log/" + LogfName + Sep
+	}
+	if Container = containerMode(); Container {
+		Datapath = "/data/"
+	}
+	envPaths()
+}
 
 func logCheck() {
-	// repeat every 10 minutes
+	// repeat every 10 minutes, and at the end of each rotation period
 	for {
-		time.Sleep(Logcheck * time.Minute)
+		r := logRotation(currentConfig())
+		time.Sleep(logUntilCheck(r, time.Now()))
+		r = logRotation(currentConfig())
+		logRules.Store(&r)
+		checkStreamLogs(r)
 		fstat, _ := Logfile.Stat()
-		if fstat.Size() > Lfsize {
-			rotateLog()
-			Logit = log.New(Logfile, "UTC ", log.LUTC|log.LstdFlags|log.Lmsgprefix)
+		if r.Size > 0 && fstat.Size() > r.Size || logDue(r, time.Now()) {
+			logMu.Lock()
+			err := rotateLog(r)
+			logMu.Unlock()
+			if err != nil {
+				Logit.Error("rotating the log", "err", err)
+			}
 		}
 	}
 }
 
+// log entries go to whichever Logfile is open
+type logOutput struct{}
+
+func (logOutput) Write(p []byte) (int, error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	return Logfile.Write(p)
+}
+
 func checkPort(port string) (int, error) {
 	num, err := strconv.Atoi(port)
 	if err != nil {
@@ -184,227 +417,829 @@ func checkPort(port string) (int, error) {
 	return num, nil
 }
 
-func rotateLog() {
+func rotateLog(r LogRotate) error {
 	// rotates logfile up to the number specified in global variable
 	// called at program startup and when the logfile gets to a size set in the main program
 	// only checks for file permission errors, opens new logfile
-	wd, err := os.Getwd()
-	if err != nil {
-		abort("Fatal: Can't get current folder\n")
-		os.Exit(1)
-	}
-	if err = os.Chdir(Logpath); err != nil {
-		abort("Fatal: Can't change folder for logging " + Logpath)
-		os.Exit(1)
+	// with time rotation old logfiles are named by date instead, see logrotate.go
+	base := Logpath + LogfName
+	if r.Every > 0 {
+		Logfile.Close()
+		if err := os.Rename(base + ".log", datedLogName(base, logPeriod, r.Every)); errors.Is(err, os.ErrPermission) {
+			// carry on with it
+			return errors.Join(errors.New("unable to rename old logfile: " + err.Error()), openLogfile(base + ".log"))
+		}
+		pruneLogs(datedLogs, r.Keep)
+		logPeriod = time.Now().UTC().Truncate(r.Every)
+		return openLogfile(base + ".log")
 	}
-	if err = os.Remove(LogfName + strconv.Itoa(Maxlogs) + ".log"); err != nil {
+	if err := os.Remove(base + strconv.Itoa(r.Keep) + ".log"); err != nil {
 		// either file does not exist, or no permission to delete
 		if errors.Is(err, os.ErrPermission) {
-			abort("Fatal: Unable to delete old logfile: " + err.Error())
-			os.Exit(1)
+			return errors.New("unable to delete old logfile: " + err.Error())
 		}
 	}
 
-	for i := Maxlogs; i > 1; i-- {
+	for i := r.Keep; i > 1; i-- {
 		ai := strconv.Itoa(i)
 		aj := strconv.Itoa(i - 1)
-		if err = os.Rename(LogfName + aj + ".log", LogfName + ai + ".log"); err != nil {
+		if err := os.Rename(base + aj + ".log", base + ai + ".log"); err != nil {
 			// only going to worry about file permision errors
 			if errors.Is(err, os.ErrPermission) {
-				abort("Fatal: Unable to rename old logfile: " + err.Error())
-				os.Exit(1)
+				return errors.New("unable to rename old logfile: " + err.Error())
 			}
 		}
 	}
 
 	// close current logfile to rename it, then open new one
 	Logfile.Close() // if there's an error it's either already closed or doesn't exist
-	if err = os.Rename(LogfName + ".log", LogfName + "1.log"); err != nil {
+	if err := os.Rename(base + ".log", base + "1.log"); err != nil {
 		// only going to worry about file permision errors
 		if errors.Is(err, os.ErrPermission) {
-			abort("Fatal: Unable to rename old logfile: " + err.Error())
-			os.Exit(1)
+			return errors.Join(errors.New("unable to rename old logfile: " + err.Error()), openLogfile(base + ".log"))
 		}
 	}
+	return openLogfile(base + ".log")
+}
 
-	// init new logfile
-	Logfile, err = os.OpenFile(LogfName + ".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+func openLogfile(name string) error {
+	// init new logfile, or carry on with it
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
 	if err != nil {
-		abort("Fatal: Could not open log file!")
-		os.Exit(1)
+		return errors.New("could not open log file: " + err.Error())
 	}
-	// trap panics etc
-	os.Stderr = Logfile
-
-	os.Chdir(wd)
-	return
+	Logfile = f
+	if LogOpened != nil {
+		// eg to trap panics
+		LogOpened(f)
+	}
+	return nil
 }
 
-func startAIS(line []string, logit **log.Logger) {
+func startAIS(st *Stream, logit *slog.Logger) {
 /*
 	record data from one input port to file
 	assume packets are clean enough...
 */
 
 	var (
-		bufsize                = 6144              // size of receive buffer
+		bufsize                = recvBufDefault    // size of receive buffer, see pipeline.go
 		filename               = " "
 		loopwait time.Duration = (1 * time.Second) // seconds to wait for data before looping
-		sockin                 *net.UDPConn
+		udp                    *receiver     // datagrams from the UDP port, see pipeline.go
+		feed                   <-chan input.Datagram // packets from a network feed instead of the UDP port
+		server                 *tcpServer    // tcp-serve clients
 		spath                  = " "
-		outfile                *os.File
+		outfile                *smoothFile
+		ix                     *recIndex // outfile's index, nil without the index option, see index.go
+		records                *streamSink // nil without the sink option, see sink.go
+		strict                 bool // strict OpenCPN VDR format for current file
+		preset                 *outputPreset // non-CSV output preset for current file, nil for CSV
+		ext                    = ".csv"
+		flagcol                bool // checksum column in current file
+		ifile                  = &sideFile{suffix: "-invalid", header: "timestamp,message\r\n"}
+		rfile                  = &sideFile{suffix: "-repaired", header: repairedHeader}
+		ofile                  = &sideFile{suffix: "-ownship"}
+		qfile                  = &sideFile{suffix: "-quality", header: qualityHeader}
+		gfile                  = newGeoFile()
+		confHash               string // config the current file's header names
+		gclock                 = &gnssClock{st: st, logit: logit} // time from GNSS sentences with gnsstime, see gnsstime.go
+		rxc                    = &rxClock{notes: st.notes, logit: logit} // receive times, see rxclock.go
+		pcap                   *capture // nil without the pcap option, see pcap.go
 	)
+	defer qfile.Close()
+	defer ifile.Close()
+	defer rfile.Close()
+	defer ofile.Close()
+	defer gfile.Close()
+	defer func() { pcap.Close() }()
+	defer func() {
+		// after the data file's deferred Close, so the index covers all of it
+		if ix != nil {
+			if err := ix.save(outfile.offset); err != nil {
+				logit.Error("writing index", "file", ix.path, "err", err)
+			}
+		}
+	}()
 
-	fmt.Printf("Starting channel %s\n", line)
+	line := []string{st.Port, st.Name}
+	logit.Info("starting channel", "name", line[1])
 
-	input, err := checkPort(line[0])
+	inport, err := checkPort(line[0])
 	if err != nil {
-		(*logit).Printf("Error: not a valid input port, skipping entry: %s", line[:])
-		fmt.Printf("%s is not a valid port, skipping channel %s\n", line[0], line[1])
+		logit.Error("not a valid input port, skipping entry", "name", line[1])
 		return
 	}
 
-	// Connect to UDP source
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: input})
-	if err != nil {
-		(*logit).Printf("Error: %d can't connect to UDP input, error: %v", input, err)
-		fmt.Printf("Can't connect to port %s, probably already in use, skipping channel\n", line)
-		// Remote chance input port is already in use
-		(*logit).Printf("Error: %d probably already in use, check input file", input)
-		return
+	defer func() {
+		if !st.stopping() {
+			Events.publish(EventAlert, line[0], "stream failed, see the log")
+		}
+	}()
+
+	inputDesc := "NMEA0183 on UDP port " + line[0]
+	defer st.bound.Store(false)
+	if f := st.opts().Feed; f != nil {
+		if st.feed == nil {
+			st.feed = input.New(f).Start(line[0], logit, st.quit, func(err error) {
+				Events.publish(EventAlert, line[0], "feed "+f.Address()+": "+err.Error())
+			})
+		}
+		feed = st.feed
+		inputDesc = "AIS from " + f.Address() + " as stream " + line[0]
+	} else if st.mergeIn != nil {
+		inputDesc = "merged from UDP ports " + strings.Join(st.opts().Merge, ",") + " as stream " + line[0]
+		if st.opts().Aggregate {
+			inputDesc = "aggregated from streams " + strings.Join(st.opts().Merge, ",") + " as stream " + line[0]
+		}
+	} else {
+		// Connect to UDP source
+		if n := st.opts().RecvBuf; n > 0 {
+			bufsize = n
+		}
+		conns, err := listenSockets(st, inport)
+		if err != nil {
+			// Remote chance input port is already in use
+			logit.Error("can't connect to UDP input, probably already in use, skipping channel", "err", err)
+			return
+		}
+
+		// UDP source connected, read in a goroutine of its own
+		sockbuf := input.SocketBuffer(conns[0])
+		logit.Info("connected for input", "recv_buffer", bufsize, "socket_buffer", sockbuf, "sockets", len(conns))
+		if n := st.opts().SockBuf; sockbuf > 0 && sockbuf < n {
+			logit.Warn("socket buffer smaller than asked, the system limits it", "socket_buffer", sockbuf, "asked", n)
+		}
+		udp = receiveUDP(st, conns, bufsize, logit)
+		defer udp.stop()
 	}
+	st.bound.Store(true)
 
-	// UDP source connected
-	(*logit).Printf("Info: %d connected for input", input)
-	sockin = conn
-	defer sockin.Close()
+	Events.publish(EventStarted, line[0], inputDesc)
+
+	if addr := st.opts().Serve; addr != "" && st.server == nil {
+		if st.server, err = startTCPServer(addr, st.opts().ServeTLS, logit); err != nil {
+			logit.Error("can't serve on TCP", "addr", addr, "err", err)
+		}
+	}
+	server = st.server
+
+	if s := st.opts().Sink; s != "" {
+		if records, err = newStreamSink(s, logit); err != nil {
+			logit.Error("sink: can't make it", "sink", s, "err", err)
+		}
+		defer records.close(logit)
+	}
 
 	buff := make([]byte, bufsize)
 	npath := ""
-	// loop forever listening for packets
-	for {
+	var qual *quality // signal report from a proprietary sentence, applies to the next AIS sentence
+	var pending [][]*record // differential recording, waiting to compare with the reference stream
+	frags := newAssembler()  // multipart messages waiting for the rest of their parts
+	fixer := newRepairer()   // vessel tracks for checksum=repair
+	var held reorder         // merged messages waiting to be written in order
+	var lastHeld string      // timestamp of the last one written
+
+	// one AIS message to the data file and any extra outputs, error is fatal
+	// complete is false for multipart messages with parts missing
+	writeGroup := func(group []*record, complete bool) error {
+		base := filename[:len(filename)-len(ext)]
+		allValid := complete
+		own := isAIS(group[0].Sentence, nil) && group[0].Sentence[3:6] == "VDO"
+		for _, rec := range group {
+			extra := ""
+			if flagcol {
+				extra = "ok"
+				if !rec.Valid {
+					extra = "invalid"
+				}
+			}
+			o := st.opts()
+			message, tag := rec.Sentence, ""
+			if rec.Tag != nil && o.Tags == "keep" {
+				tag = rec.Tag.Raw
+			} else if rec.Tag != nil && rec.Tag.Seq > 0 && o.Seq {
+				tag = numberTag("", rec.Tag.Seq)
+			}
+			if tag != "" {
+				message = "\\" + tag + "\\" + message
+			}
+			stamp := timeStamp(o.TimeFmt, rec)
+			content := formatRecord(strict, stamp, source(o, line[0], rec), message, extra)
+			if preset != nil {
+				content = preset.format(line[0], rec, source(o, line[0], rec), tag)
+			}
+			st.stats.Sentences.Add(1)
+			if own && st.opts().OwnShip == "split" {
+				if err := ofile.write(spath, base, content); err != nil {
+					logit.Error("writing own ship file", "err", err)
+					st.writeFailed(err)
+				}
+			} else {
+				ix.add(stamp, outfile.offset, message)
+				if err := outfile.writeRecord(content); err != nil {
+					fatal(logit, "error writing to output file", "file", filename, "content", content, "err", err)
+					st.writeFailed(err)
+					outfile.Close()
+					return err
+				}
+				records.write(line[0], sink.Record{Time: stamp, Source: source(o, line[0], rec), Sentence: message, Valid: rec.Valid, Line: content}, logit)
+			}
+			if rec.Qual != nil {
+				if err := qfile.write(spath, base, rec.Qual.record(stamp, rec.Sentence)); err != nil {
+					logit.Error("writing quality log", "err", err)
+					st.writeFailed(err)
+				}
+			}
+			allValid = allValid && rec.Valid
+		}
+		if !allValid {
+			return nil
+		}
+		msg, err := decodeGroup(group)
+		if err != nil {
+			return nil
+		}
+		Vessels.learn(msg)
+		Sightings.heard(msg.Base().MMSI, st.Port, time.Now())
+
+		if o := st.opts(); o.GeoJSON != "" {
+			if feature, ok := geoJSONFeature(msg, timeStamp(o.TimeFmt, group[0])); ok {
+				if err = gfile.write(o.GeoJSON, spath, base, feature); err != nil {
+					logit.Error("writing GeoJSON", "err", err)
+					st.writeFailed(err)
+				}
+			}
+		}
+		return nil
+	}
+
+	// a whole message, or a multipart message's parts after the timeout (complete false),
+	// through the stream's filters to the file
+	accept := func(group []*record, complete bool) error {
+		if !isAIS(group[0].Sentence, nil) {
+			// other instruments on the same feed, recorded as received
+			if st.mergeIn != nil && !wantNMEA(st.opts(), group[0].Sentence) || st.duplicate(group, true) {
+				return nil
+			}
+			return writeGroup(group, true)
+		}
+		if !complete {
+			st.stats.Incomplete.Add(1)
+		}
+		if !st.wanted(group) {
+			st.stats.Filtered.Add(1)
+			return nil
+		}
+		if !complete {
+			if st.opts().Incomplete == "drop" || st.duplicate(group, false) {
+				return nil
+			}
+			return writeGroup(group, false)
+		}
+		if st.duplicate(group, true) || st.limited(group) {
+			return nil
+		}
+		if st.opts().Diff > 0 {
+			// wait in case the reference stream gets it a little later
+			pending = append(pending, group)
+			return nil
+		}
+		return writeGroup(group, true)
+	}
+
+	// merged messages received by cutoff, in order
+	writeHeld := func(cutoff time.Time) error {
+		for _, m := range held.due(cutoff) {
+			if m.group[0].Time < lastHeld {
+				st.stats.Late.Add(1)
+			} else {
+				lastHeld = m.group[0].Time
+			}
+			if o := st.opts(); o.Seq || o.Aggregate {
+				// the records are shared with the stream they came from
+				group := make([]*record, len(m.group))
+				for i, rec := range m.group {
+					r := *rec
+					if o.Seq {
+						st.seq++
+						r.Tag = parseTag(numberTag(tagRaw(rec.Tag), st.seq))
+					}
+					if o.Aggregate {
+						r.origin = source(m.from.opts(), m.from.Port, rec)
+					}
+					group[i] = &r
+				}
+				m.group = group
+			}
+			st.relay(recordLines(m.group), logit)
+			st.push(recordLines(m.group), m.group[0].rx, logit)
+			server.broadcast(recordLines(m.group))
+			if err := accept(m.group, m.complete); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// whichever daily file is open when the stream stops, closed at rollover before that
+	defer func() { outfile.Close() }()
+
+	// loop listening for packets until the stream is stopped
+	for !st.stopping() {
+		st.beat.Store(time.Now().UnixNano())
+		select {
+		case <-st.roll:
+			// rollover through the control API, the files are opened again below
+			qfile.Close()
+			ifile.Close()
+			rfile.Close()
+			ofile.Close()
+			gfile.Close()
+			spath = ""
+		default:
+		}
 		// get year, month, day, compare with previous
 		year, mnth, day, rfctime := gettime()
 		npath = Datapath + year + Sep + mnth + Sep + day + Sep
 		if npath != spath {
 			// date has changed or program restarted, close old file, ignore error if it doesn't exist
 			outfile.Close()
+			if ix != nil {
+				if err = ix.save(outfile.offset); err != nil {
+					logit.Error("writing index", "file", ix.path, "err", err)
+				}
+				ix = nil
+			}
+			if spath != " " {
+				logit.Info("stats", st.stats.attrs()...)
+				Events.publish(EventRollover, line[0], npath)
+			}
 			// new folder - no error if folder already exists
-			if err = os.MkdirAll(npath, 0775); err != nil {
-				(*logit).Printf("Fatal: unable to make output directory: %s, please rerun installer: %v", npath, err)
+			if err = Store.MkdirAll(npath); err != nil {
+				fatal(logit, "unable to make output directory, please rerun installer", "dir", npath, "err", err)
+				st.writeFailed(err)
 				return
 			}
-			// change folder
-			if err = os.Chdir(npath); err != nil {
-				(*logit).Printf("Fatal: unable to change dir to %s: %v", spath, err)
-				return
+			confHash = currentConfig().Hash
+			rxc.anchor(time.Now())
+			header := "# Restarted: " + rfctime + "\r\n" + fileBanner() + timeReference(st.opts(), gclock)
+			// format is fixed for the life of the file so a profile change can't mix formats
+			strict = st.opts().VdrStrict
+			preset, ext = outputPresets[st.opts().Output], ".csv"
+			if preset != nil {
+				ext = preset.ext
+			}
+			filename = year + mnth + day + "-" + line[0] + ext
+			// strict format can't have an extra column, flagged sentences go to the invalid file instead
+			flagcol = st.opts().Checksum == "flag" && !strict && preset == nil
+			ofile.header = vdrHeader
+			if !strict {
+				ofile.header = "timestamp,type,id,message\r\n"
+				if flagcol {
+					ofile.header = "timestamp,type,id,message,checksum\r\n"
+				}
+			}
+			if strict {
+				// plugin only expects the column header
+				header = ""
+			}
+			if preset != nil {
+				ofile.header, header = "", ""
 			}
-
-			filename = year + mnth + day + "-" + line[0] + ".csv"
-			header := "# Restarted: " + rfctime + "\r\n"
 			// check if file exists, might be restarting a recording.
-			outfile, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0664)
+			f, created, err := Store.Append(npath + filename)
 			if err != nil {
-				(*logit).Printf("Info: Creating new file: %s", filename)
-				// file does not exist, create new
-				outfile, err = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
-				if err != nil {
-					(*logit).Printf("Fatal: Could not open output file: %s: %v", filename, err)
-					return
+				fatal(logit, "Could not open output file", "file", filename, "err", err)
+				st.writeFailed(err)
+				return
+			}
+			path := npath + filename
+			st.file.Store(&path)
+			if created {
+				logit.Info("Creating new file", "file", filename)
+				header = vdrHeader
+				if preset != nil {
+					header = ""
+				} else if !strict {
+					header = "# VDR Log File refer:\r\n" +
+						"# https://opencpn-manuals.github.io/main/vdr/log_format.html\r\n" +
+						"# Created: " + rfctime + "\r\n" +
+						"# LogAIS.exe " + "\u00A9" + " CompAIS NZ Ltd\r\n" +
+						fileBanner() +
+						timeReference(st.opts(), gclock) +
+						"# " + inputDesc + " \"" + line[1] + "\"\r\n" +
+						"# Station position: " + Station.String() + "\r\n" +
+						"# received_at,protocol,msg_type,source,raw_data\r\n" +
+						"# actual format in use differs from documented format:\r\n" +
+						"timestamp,type,id,message"
+					if flagcol {
+						header += ",checksum"
+					}
+					header += "\r\n"
 				}
-				header = "# VDR Log File refer:\r\n" +
-					"# https://opencpn-manuals.github.io/main/vdr/log_format.html\r\n" +
-					"# Created: " + rfctime + "\r\n" +
-					"# LogAIS.exe " + "\u00A9" + " CompAIS NZ Ltd\r\n" +
-					"# NMEA0183 on UDP port " + line[0] + " \"" + line[1] + "\"\r\n" +
-					"# received_at,protocol,msg_type,source,raw_data\r\n" +
-					"# actual format in use differs from documented format:\r\n" +
-					"timestamp,type,id,message\r\n"
 			} else {
-				(*logit).Printf("Info: Appending to file: %s", filename)
+				logit.Info("Appending to file", "file", filename)
+			}
+			// buffering is also fixed for the life of the file, side files follow it
+			every, size, batch := smoothing(st.opts())
+			outfile = newSmoothFile(f, every, size, batch)
+			outfile.offset, _ = Store.Size(path)
+			records.rotate(line[0], path, logit)
+			// the index follows the file, carried on or made again if the stream restarted
+			if st.opts().Index {
+				if _, ok := Store.(localStore); !ok {
+					logit.Warn("index needs files on disk, none kept with this storage")
+				} else if ix, err = streamIndex(path, outfile.offset); err != nil {
+					logit.Error("reading file for its index", "file", filename, "err", err)
+				}
+			}
+			// and the hash chain, carried on from what the file has
+			if st.opts().Chain > 0 {
+				if _, ok := Store.(localStore); !ok {
+					logit.Warn("chain needs files on disk, none kept with this storage")
+				} else if chain, check, err := openChain(path, st.opts(), outfile.offset); err != nil {
+					logit.Error("reading file for its hash chain, not chained", "file", filename, "err", err)
+				} else {
+					if check != nil && check.broken != "" {
+						logit.Warn("file doesn't verify, its chain carries on from what it has now", "file", filename, "at", check.broken)
+						Events.publish(EventAlert, line[0], "daily file "+filename+" doesn't verify: "+check.broken)
+					}
+					outfile.chain = chain
+				}
+			}
+			for _, sf := range []*sideFile{qfile, ifile, rfile, ofile, &gfile.ndjson} {
+				sf.every, sf.size, sf.batch = every, size, batch
+			}
+			// wake often enough to write on time when it's quiet
+			loopwait = time.Second
+			if every > 0 {
+				loopwait = min(loopwait, every)
 			}
-			defer outfile.Close()
 
 			if _, err = outfile.WriteString(header); err != nil {
-				(*logit).Printf("Fatal: error writing to output file %s: %v", filename, err)
+				fatal(logit, "error writing to output file", "file", filename, "err", err)
+				st.writeFailed(err)
 				outfile.Close()
 				return
 			}
 			spath = npath
 		}
+		if c := currentConfig(); c.Hash != confHash && !strict && preset == nil {
+			// a reload changed the config the rest of the file is written with
+			confHash = c.Hash
+			if _, err = outfile.WriteString("# Config reloaded: " + rfctime + " sha256:" + c.Hash + "\r\n"); err != nil {
+				fatal(logit, "error writing to output file", "file", filename, "err", err)
+				st.writeFailed(err)
+				outfile.Close()
+				return
+			}
+		}
+		select {
+		case note := <-st.notes:
+			if !strict && preset == nil {
+				if _, err = outfile.WriteString(note); err != nil {
+					fatal(logit, "error writing to output file", "file", filename, "err", err)
+					st.writeFailed(err)
+					outfile.Close()
+					return
+				}
+			}
+		default:
+		}
+		if err = outfile.seal(time.Now(), false); err != nil {
+			fatal(logit, "error writing to output file", "file", filename, "err", err)
+			st.writeFailed(err)
+			outfile.Close()
+			return
+		}
+		if err = outfile.flush(time.Now(), false); err != nil {
+			fatal(logit, "error writing to output file", "file", filename, "err", err)
+			st.writeFailed(err)
+			outfile.Close()
+			return
+		}
+		if ix.due(time.Now()) && outfile.buffered() == 0 {
+			if err = ix.save(outfile.offset); err != nil {
+				logit.Error("writing index", "file", ix.path, "err", err)
+			}
+		}
+		for _, sf := range []*sideFile{qfile, ifile, rfile, ofile, &gfile.ndjson} {
+			if err = sf.flush(time.Now()); err != nil {
+				logit.Error("writing side file", "file", sf.path, "err", err)
+			}
+		}
 
-		sockin.SetDeadline(time.Now().Add(loopwait))
-		leng, err := sockin.Read(buff)
-		if err != nil {
-			// error reading from port
-			if errors.Is(err, os.ErrDeadlineExceeded) {
-				// loop on timeout
-				continue
+		for _, group := range frags.expire(time.Now()) {
+			st.forward(group, false)
+			if err = accept(group, false); err != nil {
+				return
 			}
-			(*logit).Printf("Info: %d UDP read error: %+v", input, err)
-			(*logit).Printf("Info: %d will re-open port", input)
-			sockin.Close()
-			conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: input})
-			if err != nil {
-				(*logit).Printf("Error: %d can't connect to UDP input, error: %v", input, err)
+		}
+
+		if len(pending) > 0 {
+			keep := pending[:0]
+			for _, group := range pending {
+				switch {
+				case time.Since(group[0].rx) < st.opts().Diff:
+					// the reference stream may still get it
+					keep = append(keep, group)
+				case Reference.seen(group[0].Sentence, group[0].rx, st.opts().Diff):
+					st.stats.DiffCommon.Add(1)
+				default:
+					if err = writeGroup(group, true); err != nil {
+						return
+					}
+				}
+			}
+			pending = keep
+		}
+
+		var data []byte
+		var from netip.AddrPort
+		rx := time.Now()
+		if st.mergeIn != nil {
+			select {
+			case m := <-st.mergeIn:
+				st.heard.Store(time.Now().UnixNano())
+				if !st.paused.Load() && !DiskPaused.Load() {
+					held.add(m)
+				}
+			case <-time.After(loopwait):
+			}
+			window := st.opts().Reorder
+			if window == 0 && st.opts().Aggregate {
+				window = aggregateDelay
+			}
+			if err = writeHeld(time.Now().Add(-window)); err != nil {
 				return
 			}
-			// UDP source re-connected
-			sockin = conn
-			defer sockin.Close()
-			(*logit).Printf("Info: %d input reconnected", input)
 			continue
+		} else if feed != nil {
+			select {
+			case d := <-feed:
+				data, rx = buff[:copy(buff, d.Data)], d.Rx
+				st.heard.Store(rx.UnixNano())
+			case <-time.After(loopwait):
+				continue
+			}
 		} else {
-			// no error, log big packets (input UDP)
-			if leng > 1460 {
-				(*logit).Printf("Info: %d large packet received %d bytes", input, leng)
+			select {
+			case d, ok := <-udp.C:
+				if !ok {
+					// the port couldn't be opened again
+					return
+				}
+				data, rx, from = buff[:copy(buff, d.data)], d.rx, d.from
+				udp.release(d)
+			case <-time.After(loopwait):
+				continue
+			}
+		}
+		if st.paused.Load() || DiskPaused.Load() {
+			continue
+		}
+		rxAt := rxc.at(rx)
+		if limit := st.opts().Pcap; limit > 0 {
+			if pcap == nil {
+				pcap = newCapture(line[0])
+				if _, ok := Store.(localStore); !ok {
+					logit.Warn("pcap needs files on disk, nothing captured with this storage")
+					pcap.broken = true
+				} else {
+					logit.Info("capturing datagrams", "file", pcap.path(), "size", limit)
+				}
+			}
+			if err := pcap.write(data, from, rxAt, limit); err != nil {
+				logit.Error("capture stopped, can't write it", "file", pcap.path(), "err", err)
+			}
+		} else if pcap != nil {
+			pcap.Close()
+			pcap = nil
+			logit.Info("capture stopped")
+		}
+
+		sentences := scanSentences(data)
+		packet := data
+		if st.opts().Seq {
+			for i := range sentences {
+				st.seq++
+				sentences[i].Tag = numberTag(sentences[i].Tag, st.seq)
 			}
+			packet = sentenceLines(sentences)
 		}
+		st.relay(packet, logit)
+		st.push(packet, rx, logit)
+		server.broadcast(packet)
 
-		for i := 0; i+3 < leng; i++ {
-			// need more than 3 bytes for a sentence, that's just to prevent out of range indeces
-			if string(buff[i:(i+2)]) == "!A" {
-				// start of a sentence, maybe
-				// starting ! is at [i]
-				j := i+1
-				for ; j < leng && buff[j] != '*' && buff[j] != '!'; j++ {
-//					could calculate checksum here
+		for _, rs := range sentences {
+			sentence := rs.Text
+			check := st.opts().Checksum
+			valid := check == "off" || checksumOK(sentence)
+			if !valid {
+				st.stats.BadChecksum.Add(1)
+				if !isAIS(sentence, st.opts().Talkers) && !wantNMEA(st.opts(), sentence) || check == "drop" {
+					continue
 				}
-				if j+3 > leng {
-					// no ending checksum
-					break
+				fixed, repaired := "", false
+				if check == "repair" {
+					fixed, repaired = fixer.repair(sentence, rx)
 				}
-				// if checksum '*' is missing, could be start of a new sentence
-				// very unlikely though
-				if buff[j] == '!' {
-					// start of a new sentence
-					i = j-1
+				if repaired {
+					if err = rfile.write(spath, year+mnth+day+"-"+line[0], formatTime(st.opts().TimeFmt, rxAt)+",\""+sentence+"\",\""+fixed+"\"\r\n"); err != nil {
+						logit.Error("writing repaired sentence file", "err", err)
+						st.writeFailed(err)
+					}
+					st.stats.Repaired.Add(1)
+					sentence, valid = fixed, true
+				} else if check == "file" || check == "repair" || check == "flag" && !flagcol {
+					if err = ifile.write(spath, year+mnth+day+"-"+line[0], formatTime(st.opts().TimeFmt, rxAt)+",\""+sentence+"\"\r\n"); err != nil {
+						logit.Error("writing invalid sentence file", "err", err)
+						st.writeFailed(err)
+					}
 					continue
 				}
-				// must be checksum marker '*'
+			}
+			if check == "repair" && valid {
+				fixer.seen(sentence, rx)
+			}
+			if st.opts().GPS && valid {
+				updateStation(line[0], sentence)
+			}
+			if st.opts().GNSSTime > 0 && valid {
+				gclock.update(sentence, rx)
+			}
+			if o := st.opts(); o.Quality != nil && strings.HasPrefix(sentence, "$"+o.Quality.Sentence+",") {
+				qual = parseQuality(o.Quality, sentence)
+				continue
+			}
+			nmea := !isAIS(sentence, st.opts().Talkers)
+			if nmea && !wantNMEA(st.opts(), sentence) {
+				continue
+			}
+			if !nmea && st.opts().OwnShip == "drop" && sentence[3:6] == "VDO" {
+				continue
+			}
 
-				_, _, _, rfctime = gettime()
-//				"timestamp,type,id,message"
-				content := rfctime + ",AIS,\"UDP port:" + line[0] + "\",\"" + string(buff[i:(j+3)]) + "\"\r\n"
-				if _, err = outfile.WriteString(content); err != nil {
-					(*logit).Printf("Fatal: error writing to output file: %s - %s: %v", filename, content, err)
-					outfile.Close()
+			rec := &record{Sentence: sentence, Valid: valid, Tag: parseTag(rs.Tag), rx: rxAt}
+			if st.opts().GNSSTime > 0 {
+				if t, ok := gclock.at(rx); ok {
+					rec.rx = t
+				}
+			}
+			if o := st.opts(); o.Offset != 0 {
+				// corrected receive time, also used to line the stream up with others
+				rec.rx = rec.rx.Add(o.Offset)
+			}
+			rec.at = rec.rx
+			if o := st.opts(); o.TagTime && rec.Tag != nil && !rec.Tag.Time.IsZero() {
+				rec.at = rec.Tag.Time.Add(o.Offset)
+			}
+			rec.Time = rec.at.UTC().Format(timeLayout)
+			if nmea {
+				if isDSC(sentence) && dscDistress(sentence) {
+					logit.Warn("DSC distress call", "sentence", sentence)
+					Events.publish(EventAlert, line[0], "DSC distress call: "+sentence)
+				}
+				st.forward([]*record{rec}, true)
+				if err = accept([]*record{rec}, true); err != nil {
 					return
 				}
-				i = j+2
-				// i also gets incremented at the end of the loop
-			} // end found AIS sentence
+				continue
+			}
+			if o := st.opts(); o.Quality != nil {
+				if qual == nil {
+					qual = trailerQuality(rs.Trailer)
+				}
+				rec.Qual = qual
+				qual = nil
+			}
+			if st.opts().Reference {
+				Reference.add(sentence, rec.rx)
+			}
+			group := []*record{rec}
+			if v, ok := parseVDM(sentence); ok && v.Total > 1 {
+				if group = frags.add(v, rec); group == nil {
+					// wait for the rest of the message
+					continue
+				}
+			}
+			st.forward(group, true)
+			if err = accept(group, true); err != nil {
+				return
+			}
 		} // end loop through buffer
 	} // end loop forever
 
-	(*logit).Printf("Info: %d ending process for input port", input)
-	return
+	// stopped: write what's waiting, then say so in the file so it doesn't look cut off
+	if spath == " " {
+		return
+	}
+	if err = writeHeld(time.Now().Add(time.Hour)); err != nil {
+		return
+	}
+	for _, group := range pending {
+		if Reference.seen(group[0].Sentence, group[0].rx, st.opts().Diff) {
+			st.stats.DiffCommon.Add(1)
+		} else if err = writeGroup(group, true); err != nil {
+			return
+		}
+	}
+	if !strict && preset == nil {
+		_, _, _, rfctime := gettime()
+		if _, err = outfile.WriteString("# Stopped: " + rfctime + "\r\n"); err != nil {
+			logit.Error("writing to output file", "file", filename, "err", err)
+			st.writeFailed(err)
+		}
+	}
+}
+
+func currentConfig() *Config {
+	profMutex.Lock()
+	defer profMutex.Unlock()
+	return Conf
+}
+
+func fileBanner() string {
+	// header lines tracing a file to the software, host, config and station that wrote it
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	c := currentConfig()
+	id := c.StationID
+	if id == "" {
+		id = "not set"
+	}
+	return "# LogAIS v" + Version + " " + runtime.GOOS + "/" + runtime.GOARCH + " on host " + host + "\r\n" +
+		"# Config: " + c.Path + " sha256:" + c.Hash + "\r\n" +
+		"# Station ID: " + id + "\r\n" +
+		Clock.Load().header()
+}
+
+// a sentence ready to write, AIS or with the nmea option any other
+type record struct {
+	Time     string // receive time, or TAG block time with tagtime, as timeLayout
+	at       time.Time // the same to the nanosecond, see rxclock.go
+	Sentence string
+	Valid    bool      // checksum ok or not checked
+	Qual     *quality  // signal quality if reported
+	Tag      *tagBlock // NMEA 4.10 TAG block if there was one
+	rx       time.Time
+	origin   string // source of the stream it came from, in an aggregated stream
+}
+
+func formatRecord(strict bool, rfctime string, source string, sentence string, extra string) string {
+	// one output line, extra is added as another column if not empty
+	// sentence may have a TAG block in front
+	if extra != "" {
+		extra = "," + extra
+	}
+	_, bare := splitTag(sentence)
+	if strict {
+		// "received_at,protocol,msg_type,source,raw_data"
+		return rfctime + ",NMEA0183," + sentenceType(bare) + ",\"" + source + "\",\"" + sentence + "\"" + extra + "\r\n"
+	}
+	// "timestamp,type,id,message"
+	kind := "AIS"
+	switch {
+	case isDSC(bare):
+		kind = "DSC"
+	case strings.HasPrefix(bare, "$"):
+		kind = "NMEA"
+	}
+	return rfctime + "," + kind + ",\"" + source + "\",\"" + sentence + "\"" + extra + "\r\n"
+}
+
+func source(o *Options, port string, rec *record) string {
+	// record source, receiver ID and VHF channel if a receiver is configured,
+	// or the TAG block source with tags=fields
+	if rec.origin != "" {
+		return rec.origin
+	}
+	if o.Receiver == "" {
+		if o.Tags == "fields" && rec.Tag != nil && rec.Tag.Source != "" {
+			return rec.Tag.Source
+		}
+		if o.Feed != nil {
+			return o.Feed.Kind + ":" + port
+		}
+		return "UDP port:" + port
+	}
+	if ch := aisChannel(rec.Sentence); ch != "" {
+		return o.Receiver + ":" + ch
+	}
+	return o.Receiver
 }
 
 func gettime() (string, string, string, string) {
-	thetime := time.Now().UTC()
+	return timeAt(time.Now())
+}
+
+func timeAt(t time.Time) (string, string, string, string) {
+	thetime := t.UTC()
 //	rfctime := thetime.Format(time.RFC3339) - doesn't do mS
-	rfctime := thetime.Format("2006-01-02T15:04:05.000Z")
+	rfctime := thetime.Format(timeLayout)
 	texttime := strings.Split(thetime.Format("2006 01 02"), " ")
 	return texttime[0], texttime[1], texttime[2], rfctime
 }
@@ -0,0 +1,203 @@
+package logais
+
+/*
+Application log through log/slog. Every entry has a level and fields, eg port
+and stream for a stream's entries, err for the error, event for events (see
+events.go), so a log pipeline doesn't have to pick them out of the text.
+Levels are debug, info, warning, error and fatal (a stream or the program
+can't carry on). Written as text lines, as the log has always looked, with the
+fields after the message:
+ 2026/10/16 09:17:59 UTC Info: connected for input port=10110 stream="Harbour receiver"
+or as one JSON object a line:
+ {"time":"2026-10-16T09:17:59.123Z","level":"INFO","msg":"connected for input","port":"10110","stream":"Harbour receiver"}
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const LevelFatal = slog.LevelError + 4
+
+var LogLevel = new(slog.LevelVar) // least important level written, -log-level
+
+var levelNames = map[slog.Level]string{slog.LevelDebug: "Debug", slog.LevelInfo: "Info", slog.LevelWarn: "Warning",
+	slog.LevelError: "Error", LevelFatal: "Fatal"}
+
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warning", "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, errors.New("log level must be debug, info, warning or error: " + s)
+}
+
+func newLogHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	switch format {
+	case "", "text":
+		return &textHandler{w: w, mu: new(sync.Mutex), level: level}, nil
+	case "json":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch {
+			case len(groups) > 0:
+			case a.Key == slog.TimeKey:
+				a.Value = slog.StringValue(a.Value.Time().UTC().Format("2006-01-02T15:04:05.000Z"))
+			case a.Key == slog.LevelKey && a.Value.Any() == LevelFatal:
+				a.Value = slog.StringValue("FATAL")
+			}
+			return a
+		}}), nil
+	}
+	return nil, errors.New("log format must be text or json: " + format)
+}
+
+func fatal(lg *slog.Logger, msg string, args ...any) {
+	// logged only, it's for the caller to stop
+	lg.Log(context.Background(), LevelFatal, msg, args...)
+}
+
+// every entry to each handler, eg the log file and syslog
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	t2 := make(teeHandler, len(t))
+	for i, h := range t {
+		t2[i] = h.WithAttrs(attrs)
+	}
+	return t2
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	t2 := make(teeHandler, len(t))
+	for i, h := range t {
+		t2[i] = h.WithGroup(name)
+	}
+	return t2
+}
+
+// text lines, "2006/01/02 15:04:05 UTC Level: message key=value ..."
+type textHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Leveler
+	attrs []byte // from With, formatted
+	group string // from WithGroup, prefixed to keys
+}
+
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := append(h.format(r, true), '\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *textHandler) format(r slog.Record, stamp bool) []byte {
+	// stamp adds the time and level in front, syslog has its own
+	var buf []byte
+	if stamp {
+		t := r.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		buf = t.UTC().AppendFormat(nil, "2006/01/02 15:04:05 UTC ")
+		name, ok := levelNames[r.Level]
+		if !ok {
+			name = r.Level.String()
+		}
+		buf = append(buf, name+": "...)
+	}
+	buf = append(buf, r.Message...)
+	buf = append(buf, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf = appendAttr(buf, h.group, a)
+		return true
+	})
+	return buf
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]byte(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, h.group, a)
+	}
+	return &h2
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = attrKey(h.group, name)
+	return &h2
+}
+
+func attrKey(group string, key string) string {
+	if group == "" {
+		return key
+	}
+	return group + "." + key
+}
+
+func appendAttr(buf []byte, group string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		g := group
+		if a.Key != "" {
+			g = attrKey(group, a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			buf = appendAttr(buf, g, ga)
+		}
+		return buf
+	}
+	s := a.Value.String()
+	if a.Value.Kind() == slog.KindTime {
+		s = a.Value.Time().UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	if s == "" || strings.ContainsAny(s, " \"=\t\r\n") {
+		s = strconv.Quote(s)
+	}
+	return fmt.Appendf(buf, " %s=%s", attrKey(group, a.Key), s)
+}
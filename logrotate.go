@@ -0,0 +1,105 @@
+//go:build !edge
+
+package logais
+
+/*
+Application log rotation. Without a config line LogAIS.log is renamed
+LogAIS1.log (and LogAIS1.log LogAIS2.log and so on, Maxlogs kept) at each
+start and whenever it grows past Lfsize. The config line
+ log-rotate <tab> [daily|hourly|weekly|interval] [<tab> size=size] [<tab> keep=n]
+changes that: with a period, eg daily or 6h, LogAIS.log is carried on at a start
+in the same period and renamed for its period when one ends, eg
+ LogAIS-20261016.log	daily, weekly
+ LogAIS-20261016-1800.log	hourly, 6h (UTC)
+with .2.log and so on added if it also grew past size in the period. A period
+shorter than a day must divide it evenly. size rotates by size as well,
+eg size=10MB (only by time when a period is given without it); keep is how
+many old files are kept, the oldest are deleted. A reload applies a change.
+*/
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	logPeriod time.Time                 // start of the period LogAIS.log is for, with time rotation
+	logRules  atomic.Pointer[LogRotate] // as last read from the config, for stream logs
+)
+
+// LogAIS.log renamed by date, not LogAIS-10110.log of a stream (see streamlog.go)
+const datedLogs = LogfName + "-[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]*.log"
+
+func logRotation(c *Config) LogRotate {
+	if c == nil || c.LogRotate == nil {
+		return LogRotate{Size: Lfsize, Keep: Maxlogs}
+	}
+	return *c.LogRotate
+}
+
+func logDue(r LogRotate, now time.Time) bool {
+	return r.Every > 0 && now.UTC().Truncate(r.Every).After(logPeriod)
+}
+
+func logUntilCheck(r LogRotate, now time.Time) time.Duration {
+	// Logcheck minutes, or to just after the period ends
+	wait := Logcheck * time.Minute
+	if r.Every > 0 {
+		wait = min(wait, now.UTC().Truncate(r.Every).Add(r.Every).Sub(now)+time.Second)
+	}
+	return wait
+}
+
+func openLog(r LogRotate) error {
+	// at startup: carry on with this period's LogAIS.log, or start a new one
+	logRules.Store(&r)
+	if r.Every > 0 {
+		if info, err := os.Stat(Logpath + LogfName + ".log"); err == nil {
+			logPeriod = info.ModTime().UTC().Truncate(r.Every)
+			if !logDue(r, time.Now()) {
+				return openLogfile(Logpath + LogfName + ".log")
+			}
+		}
+	}
+	return rotateLog(r)
+}
+
+func datedLogName(base string, period time.Time, every time.Duration) string {
+	// base with the period's date, a name not yet taken
+	layout := "20060102"
+	if every%(24*time.Hour) != 0 {
+		layout += "-1504"
+	}
+	name := base + "-" + period.UTC().Format(layout)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(name + ".log"); os.IsNotExist(err) {
+			return name + ".log"
+		}
+		name = strings.TrimSuffix(name, "."+strconv.Itoa(i-1)) + "." + strconv.Itoa(i)
+	}
+}
+
+func oldLogs(pattern string) []string {
+	// rotated logfiles matching pattern in the log folder, oldest first
+	names, _ := filepath.Glob(filepath.Join(Logpath, pattern))
+	mod := make(map[string]time.Time)
+	for _, n := range names {
+		if info, err := os.Stat(n); err == nil {
+			mod[n] = info.ModTime()
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool { return mod[names[i]].Before(mod[names[j]]) })
+	return names
+}
+
+func pruneLogs(pattern string, keep int) {
+	old := oldLogs(pattern)
+	for _, n := range old[:max(len(old)-keep, 0)] {
+		os.Remove(n)
+	}
+}
@@ -0,0 +1,248 @@
+//go:build !edge
+
+package logais
+
+/*
+Run manifest, run-manifest.json in each day folder: one document describing
+how the day was recorded, for auditors.
+ sessions	each run of LogAIS that recorded part of the day: start, end, version,
+	host, config hash and how it ended: running, stopped, restart (scheduled),
+	midnight (carried on into the next day) or unknown (crashed or lost power,
+	end is the last time it was known to be running)
+ restarts	sessions started during the day, not counting a run carried over from the day before
+ version_changes	sessions running another version than the one before
+ files	every file in the folder with its size, and its records and time range once the day is over
+ gaps	quiet spells of more than two minutes in each main daily file, once the day is over
+ final	the day is over and files and gaps are complete
+It is written every manifestInterval while recording, when LogAIS stops, and
+after midnight for the day that ended. Days of the last week left unfinished,
+eg LogAIS wasn't running at midnight, are finished at the next start.
+*/
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/logais/rotation"
+)
+
+const (
+	manifestName     = "run-manifest.json"
+	manifestInterval = time.Minute
+)
+
+type runSession struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Ended     string    `json:"ended"`
+	Continued bool      `json:"continued,omitempty"` // carried over from the day before
+	Version   string    `json:"version"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Config    string    `json:"config_sha256"`
+}
+
+type versionChange struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+type runFile struct {
+	Name    string     `json:"name"`
+	Size    int64      `json:"size"`
+	Records int        `json:"records,omitempty"`
+	First   *time.Time `json:"first,omitempty"`
+	Last    *time.Time `json:"last,omitempty"`
+}
+
+type runGap struct {
+	File    string    `json:"file"`
+	From    time.Time `json:"from"`
+	Until   time.Time `json:"until"`
+	Seconds int       `json:"seconds"`
+}
+
+type runManifest struct {
+	Day            string          `json:"day"`
+	Sessions       []runSession    `json:"sessions"`
+	Restarts       int             `json:"restarts"`
+	VersionChanges []versionChange `json:"version_changes"`
+	Files          []runFile       `json:"files"`
+	Gaps           []runGap        `json:"gaps"`
+	Final          bool            `json:"final"`
+}
+
+// this run's manifest for today
+var run struct {
+	mu  sync.Mutex
+	day time.Time
+	m   *runManifest
+}
+
+func dayFolder(day time.Time) string {
+	// where a day's files are, the data folder if it isn't anywhere yet
+	dir := rotation.Folder(day)
+	for _, root := range archiveRoots() {
+		if fi, err := os.Stat(filepath.Join(root, dir)); err == nil && fi.IsDir() {
+			return filepath.Join(root, dir)
+		}
+	}
+	return filepath.Join(Datapath, dir)
+}
+
+func loadManifest(day time.Time) *runManifest {
+	m := &runManifest{Day: day.Format(time.DateOnly)}
+	if b, err := os.ReadFile(filepath.Join(dayFolder(day), manifestName)); err == nil {
+		json.Unmarshal(b, m)
+	}
+	return m
+}
+
+func (m *runManifest) save(day time.Time) error {
+	dir := dayFolder(day)
+	m.Restarts, m.VersionChanges = 0, []versionChange{}
+	for i, s := range m.Sessions {
+		if !s.Continued && i > 0 {
+			m.Restarts++
+		}
+		if i > 0 && s.Version != m.Sessions[i-1].Version {
+			m.VersionChanges = append(m.VersionChanges, versionChange{Time: s.Start, From: m.Sessions[i-1].Version, To: s.Version})
+		}
+	}
+	m.Files = listRunFiles(dir, m.Final)
+	if m.Gaps == nil {
+		m.Gaps = []runGap{}
+	}
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+	// written whole then renamed, so a reader never sees half of it
+	tmp := filepath.Join(dir, manifestName+".tmp")
+	if err = os.WriteFile(tmp, b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestName))
+}
+
+func listRunFiles(dir string, final bool) []runFile {
+	files := []runFile{}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || strings.HasPrefix(e.Name(), manifestName) {
+			continue
+		}
+		f := runFile{Name: e.Name(), Size: info.Size()}
+		if final && filepath.Ext(f.Name) == ".csv" {
+			if first, last, n := recordingCount(filepath.Join(dir, f.Name)); n > 0 {
+				f.Records, f.First, f.Last = n, &first, &last
+			}
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func (m *runManifest) finish(day time.Time) error {
+	// the day is over: sessions left running didn't say how they ended, gaps and records counted
+	for i := range m.Sessions {
+		if m.Sessions[i].Ended == "running" {
+			m.Sessions[i].Ended = "unknown"
+		}
+	}
+	m.Gaps = []runGap{}
+	dir := dayFolder(day)
+	for _, name := range syncDayFiles(day) {
+		lines, err := readLines(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		for _, g := range findGaps(lines, day) {
+			m.Gaps = append(m.Gaps, runGap{File: name, From: g.from, Until: g.until, Seconds: int(g.until.Sub(g.from).Seconds())})
+		}
+	}
+	m.Final = true
+	return m.save(day)
+}
+
+func newSession(start time.Time, continued bool) runSession {
+	host, _ := os.Hostname()
+	return runSession{Start: start, End: start, Ended: "running", Continued: continued,
+		Version: Version, Host: host, PID: os.Getpid(), Config: currentConfig().Hash}
+}
+
+func keepManifest() {
+	// finish days missed, then keep today's manifest up to date
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for d := 1; d <= syncDays; d++ {
+		day := today.AddDate(0, 0, -d)
+		if _, err := os.Stat(filepath.Join(dayFolder(day), manifestName)); err != nil {
+			continue
+		}
+		if m := loadManifest(day); !m.Final {
+			if err := m.finish(day); err != nil {
+				Logit.Error("run manifest", "day", m.Day, "err", err)
+			}
+		}
+	}
+
+	run.mu.Lock()
+	run.day, run.m = today, loadManifest(today)
+	for i := range run.m.Sessions {
+		// a run that was still writing this day's manifest, and then wasn't
+		if run.m.Sessions[i].Ended == "running" {
+			run.m.Sessions[i].Ended = "unknown"
+		}
+	}
+	run.m.Sessions = append(run.m.Sessions, newSession(time.Now().UTC(), false))
+	run.mu.Unlock()
+	for {
+		run.mu.Lock()
+		if run.m == nil {
+			// closed, the program is ending
+			run.mu.Unlock()
+			return
+		}
+		now := time.Now().UTC()
+		if day := now.Truncate(24 * time.Hour); day.After(run.day) {
+			// carried over midnight: close yesterday and carry on in a new day
+			last := &run.m.Sessions[len(run.m.Sessions)-1]
+			last.End, last.Ended = day, "midnight"
+			if err := run.m.finish(run.day); err != nil {
+				Logit.Error("run manifest", "day", run.m.Day, "err", err)
+			}
+			run.day, run.m = day, loadManifest(day)
+			run.m.Sessions = append(run.m.Sessions, newSession(day, true))
+		}
+		run.m.Sessions[len(run.m.Sessions)-1].End = now
+		if err := run.m.save(run.day); err != nil {
+			Logit.Error("run manifest", "err", err)
+		}
+		run.mu.Unlock()
+		time.Sleep(manifestInterval)
+	}
+}
+
+func closeManifest(how string) {
+	// this run is ending, how is stopped or restart
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.m == nil || len(run.m.Sessions) == 0 {
+		return
+	}
+	last := &run.m.Sessions[len(run.m.Sessions)-1]
+	last.End, last.Ended = time.Now().UTC(), how
+	if err := run.m.save(run.day); err != nil {
+		Logit.Error("run manifest", "err", err)
+	}
+	run.m = nil
+}
@@ -0,0 +1,133 @@
+//go:build !edge
+
+package logais
+
+/*
+Merged streams, for one antenna feeding two receivers on different ports, eg
+ 10100	Harbour merged	merge=10110,10111
+writes every message either receiver got once, to a daily file named by the
+merged stream's port (nothing listens on it). The receivers' own streams still
+write their files as usual.
+Messages are passed on as each receiver's stream got them, before its filters,
+and go through the merged stream's own options. dedup is on by default, the
+first copy of a message is written; dedup=seconds changes the window.
+Multipart messages are put together by each receiver's stream, so parts from
+different receivers are never mixed. If the merged stream falls behind,
+messages are lost from it rather than holding up the receivers, and counted in its stats.
+
+Aggregated streams take from several streams the same way, eg
+ 10000	All ports	aggregate=10110,10111,10112
+but keep every message, each with the id column of the stream it came from, for
+one daily file of everything.
+
+Both write messages in timestamp order (the time written, so the TAG block time
+with tagtime), after holding each one for a reordering window in case another
+stream has an earlier one still on its way: reorder=seconds, aggregateDelay by
+default for aggregated streams and none for merged ones. A message arriving
+after later ones were written, eg a multipart message with parts missing that
+comes out when it times out, is written anyway and counted as late in the stats.
+*/
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	mergeBuffer    = 1024            // messages waiting for a merged stream
+	aggregateDelay = 2 * time.Second // how long an aggregated stream waits for other streams' earlier messages
+)
+
+type mergedGroup struct {
+	group    []*record
+	complete bool    // false for the parts of a multipart message that never completed
+	from     *Stream // stream it came from
+}
+
+func checkMerges(streams []*Stream) error {
+	// merged streams' sources are streams that aren't merged themselves
+	byPort := make(map[string]*Stream)
+	for _, st := range streams {
+		byPort[st.Port] = st
+	}
+	for _, m := range streams {
+		for _, port := range m.opts().Merge {
+			src, ok := byPort[port]
+			if !ok || src == m {
+				return errors.New("merged stream " + m.Port + ": no stream on port " + port)
+			}
+			if src.opts().Merge != nil {
+				return errors.New("merged stream " + m.Port + ": " + port + " is a merged stream too")
+			}
+		}
+	}
+	return nil
+}
+
+func linkMerges(streams []*Stream) error {
+	// connect merged streams to their sources, before any stream starts and
+	// again after a config reload, when some of them are running
+	if err := checkMerges(streams); err != nil {
+		return err
+	}
+	byPort := make(map[string]*Stream)
+	to := make(map[*Stream][]*Stream)
+	for _, st := range streams {
+		byPort[st.Port] = st
+	}
+	for _, m := range streams {
+		ports := m.opts().Merge
+		if ports == nil {
+			continue
+		}
+		if m.mergeIn == nil {
+			m.mergeIn = make(chan mergedGroup, mergeBuffer)
+		}
+		for _, port := range ports {
+			to[byPort[port]] = append(to[byPort[port]], m)
+		}
+	}
+	for _, st := range streams {
+		list := to[st]
+		st.mergeTo.Store(&list)
+	}
+	return nil
+}
+
+func (st *Stream) forward(group []*record, complete bool) {
+	// pass a message on to the merged streams taking from this one
+	to := st.mergeTo.Load()
+	if to == nil {
+		return
+	}
+	for _, m := range *to {
+		select {
+		case m.mergeIn <- mergedGroup{group: group, complete: complete, from: st}:
+		default:
+			m.stats.Lost.Add(1)
+		}
+	}
+}
+
+// messages waiting for the reordering window, in timestamp order
+type reorder []mergedGroup
+
+func (r *reorder) add(m mergedGroup) {
+	// streams hand messages over in the order they got them, so most go at the end
+	i := sort.Search(len(*r), func(i int) bool { return (*r)[i].group[0].Time > m.group[0].Time })
+	*r = append(*r, mergedGroup{})
+	copy((*r)[i+1:], (*r)[i:])
+	(*r)[i] = m
+}
+
+func (r *reorder) due(cutoff time.Time) []mergedGroup {
+	// messages from the front received by cutoff
+	n := 0
+	for n < len(*r) && !(*r)[n].group[0].rx.After(cutoff) {
+		n++
+	}
+	out := append([]mergedGroup(nil), (*r)[:n]...)
+	*r = (*r)[n:]
+	return out
+}
@@ -0,0 +1,184 @@
+//go:build !edge
+
+package logais
+
+/*
+logais merge: several recordings (different ports or stations) into one file in
+timestamp order, for putting an incident back together.
+ logais merge [-o file] [-to csv|vdr|nmea] [-dedup seconds] [-id source|file] file ...
+Written as LogAIS CSV unless -to says otherwise (see convert.go), to stdout
+without -o. -dedup leaves out a sentence identical to one written within that
+many seconds before it, eg the same vessel heard by two stations; TAG blocks
+aren't compared. -id file puts the name of the file each record came from in
+the id column instead of its recorded source, to tell stations apart.
+Files are read as play reads them, .gz and .nmea with TAG block times too.
+*/
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type mergeOptions struct {
+	format string
+	ms     bool
+	dedup  time.Duration
+	byFile bool // id column from the file name
+}
+
+type mergeCount struct {
+	written int
+	dupes   int
+	untimed int
+}
+
+func timeOrdered(files []string, from time.Time, each func(rr *recReader, rec *recRecord) error) (untimed int, err error) {
+	// every record of the files in timestamp order, as play sends them; untimed
+	// counts .nmea lines left out. Files with an index start near from if it's
+	// not zero, the records before it are still to be skipped
+	h := &playHeap{}
+	var readers []*recReader
+	defer func() {
+		for _, rr := range readers {
+			untimed += rr.untimed
+			rr.Close()
+		}
+	}()
+	for _, name := range files {
+		rr, err := openRecording(name)
+		if err != nil {
+			return 0, err
+		}
+		readers = append(readers, rr)
+		src := &playSource{rr: rr}
+		if src.next, err = rr.Next(); err == nil {
+			heap.Push(h, src)
+		} else if err != io.EOF {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if !from.IsZero() {
+		if err := h.skipTo(from); err != nil {
+			return 0, err
+		}
+	}
+	for h.Len() > 0 {
+		src := (*h)[0]
+		if err := each(src.rr, src.next); err != nil {
+			return 0, err
+		}
+		if src.next, err = src.rr.Next(); err != nil {
+			if err != io.EOF {
+				return 0, fmt.Errorf("%s: %w", src.rr.name, err)
+			}
+			heap.Pop(h)
+			continue
+		}
+		heap.Fix(h, 0)
+	}
+	return 0, nil
+}
+
+func mergeRecordings(files []string, out io.Writer, o mergeOptions) (mergeCount, error) {
+	var c mergeCount
+	seen := &seenCache{m: make(map[string]time.Time), maxAge: o.dedup}
+	w := bufio.NewWriterSize(out, 65536)
+	if _, err := w.WriteString(convertHeader(o.format, "Merged from "+strconv.Itoa(len(files))+" files")); err != nil {
+		return c, err
+	}
+	untimed, err := timeOrdered(files, time.Time{}, func(rr *recReader, rec *recRecord) error {
+		_, bare := splitTag(rec.Sentence)
+		if o.dedup > 0 && seen.repeat(sentenceKey(bare), rec.Time) {
+			c.dupes++
+			return nil
+		}
+		if o.byFile {
+			rec.Source = recordingBase(rr.name)
+		}
+		if _, err := w.WriteString(convertLine(rec, o.format, o.ms)); err != nil {
+			return err
+		}
+		c.written++
+		return nil
+	})
+	c.untimed = untimed
+	if err != nil {
+		return c, err
+	}
+	return c, w.Flush()
+}
+
+func mergeCmd(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	var o mergeOptions
+	outName := fs.String("o", "", "file to write, stdout if not given")
+	fs.StringVar(&o.format, "to", "csv", "format to write: csv, vdr or nmea")
+	fs.BoolVar(&o.ms, "ms", false, "nmea: TAG block time in milliseconds rather than seconds")
+	dedup := fs.Float64("dedup", 0, "leave out sentences identical to one this many seconds before")
+	id := fs.String("id", "source", "id column: source as recorded, or file it came from")
+	force := fs.Bool("f", false, "replace the -o file if it exists")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais merge [options] file ...\n")
+		fs.PrintDefaults()
+	}
+	files := parseInterleaved(fs, args)
+	if _, ok := convertExt[o.format]; !ok || len(files) == 0 || *dedup < 0 || *id != "source" && *id != "file" {
+		fs.Usage()
+		return 2
+	}
+	o.dedup = time.Duration(*dedup * float64(time.Second))
+	o.byFile = *id == "file"
+	for i, name := range files {
+		files[i] = findRecording(name)
+	}
+
+	var c mergeCount
+	var err error
+	if *outName == "" {
+		c, err = mergeRecordings(files, os.Stdout, o)
+	} else {
+		c, err = mergeTo(files, *outName, o, *force)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d records from %d files", c.written, len(files))
+	if c.dupes > 0 {
+		fmt.Fprintf(os.Stderr, ", %d duplicates left out", c.dupes)
+	}
+	if c.untimed > 0 {
+		fmt.Fprintf(os.Stderr, ", %d lines without a TAG block time left out", c.untimed)
+	}
+	fmt.Fprintln(os.Stderr)
+	return 0
+}
+
+func mergeTo(files []string, path string, o mergeOptions, force bool) (mergeCount, error) {
+	// as convertTo, the file only appears once it's complete
+	if _, err := os.Stat(path); err == nil && !force {
+		return mergeCount{}, errors.New(path + " exists, -f to replace it")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".merge-*")
+	if err != nil {
+		return mergeCount{}, err
+	}
+	defer os.Remove(tmp.Name())
+	c, err := mergeRecordings(files, tmp, o)
+	tmp.Chmod(0664)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return c, err
+	}
+	return c, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,96 @@
+//go:build !edge
+
+package logais
+
+/*
+Multipart AIVDM reassembly. Parts are grouped by sequence id and channel and
+released together once complete, so decoding and filtering see whole messages.
+Groups still incomplete after fragTimeout are counted and, unless the stream has
+incomplete=drop, written as received.
+*/
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+const fragTimeout = 5 * time.Second
+
+type fragGroup struct {
+	recs  []*record // by part number, nil until received
+	got   int
+	first time.Time
+}
+
+type assembler struct {
+	groups map[string]*fragGroup
+}
+
+func newAssembler() *assembler {
+	return &assembler{groups: make(map[string]*fragGroup)}
+}
+
+func (a *assembler) add(v *vdm, rec *record) []*record {
+	// returns the whole group when the last part arrives
+	key := v.SeqID + "," + v.Channel + "," + strconv.Itoa(v.Total)
+	g, ok := a.groups[key]
+	if ok && g.recs[v.Part-1] != nil {
+		// repeated part, the previous group will never complete
+		a.groups[key+",stale"+strconv.FormatInt(g.first.UnixNano(), 10)] = g
+		ok = false
+	}
+	if !ok {
+		g = &fragGroup{recs: make([]*record, v.Total), first: rec.rx}
+		a.groups[key] = g
+	}
+	g.recs[v.Part-1] = rec
+	g.got++
+	if g.got < v.Total {
+		return nil
+	}
+	delete(a.groups, key)
+	return g.recs
+}
+
+func (a *assembler) expire(now time.Time) [][]*record {
+	// incomplete groups that have timed out, parts received only
+	var old [][]*record
+	for key, g := range a.groups {
+		if now.Sub(g.first) < fragTimeout {
+			continue
+		}
+		delete(a.groups, key)
+		var recs []*record
+		for _, rec := range g.recs {
+			if rec != nil {
+				recs = append(recs, rec)
+			}
+		}
+		old = append(old, recs)
+	}
+	return old
+}
+
+func decodeGroup(recs []*record) (ais.Message, error) {
+	// decode a complete message from all its parts
+	if len(recs) == 1 {
+		return decodeSentence(recs[0].Sentence)
+	}
+	var payload strings.Builder
+	fill := 0
+	for i, rec := range recs {
+		v, ok := parseVDM(rec.Sentence)
+		if !ok {
+			return nil, errNotVDM
+		}
+		if v.Part != i+1 || v.Total != len(recs) {
+			return nil, errMultipart
+		}
+		payload.WriteString(v.Payload)
+		fill = v.Fill
+	}
+	return ais.Decode(payload.String(), fill)
+}
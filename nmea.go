@@ -0,0 +1,38 @@
+package logais
+
+/*
+NMEA 0183 sentence helpers, in package sentence so other programs can read
+feeds and recordings the way LogAIS does; these are the names used here.
+*/
+
+import (
+	"example.com/logais/sentence"
+)
+
+var (
+	errNotVDM    = sentence.ErrNotVDM
+	errMultipart = sentence.ErrMultipart
+)
+
+// fields of a VDM/VDO sentence, and one sentence found in a datagram
+type (
+	vdm         = sentence.VDM
+	rawSentence = sentence.Raw
+)
+
+var (
+	sentenceType   = sentence.Type
+	isAIS          = sentence.IsAIS
+	isDSC          = sentence.IsDSC
+	dscDistress    = sentence.DSCDistress
+	checksumOK     = sentence.ChecksumOK
+	withChecksum   = sentence.WithChecksum
+	sentenceFields = sentence.Fields
+	parseVDM       = sentence.ParseVDM
+	aisChannel     = sentence.Channel
+	decodeSentence = sentence.Decode
+	scanSentences  = sentence.Scan
+	gpsPosition    = sentence.Position
+	gpsHeading     = sentence.Heading
+	gpsTime        = sentence.Time
+)
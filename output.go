@@ -0,0 +1,95 @@
+//go:build !edge
+
+package logais
+
+/*
+Output presets, one keyword for the file format a consumer needs instead of a
+combination of format options:
+ opencpn-vdr	OpenCPN VDR plugin, the documented columns only as vdr-strict, TAG blocks dropped unless tags is given (.csv, CRLF)
+ aishub-uplink	bare sentences as sent to AIShub and other aggregators, no timestamps or TAG blocks (.nmea, CRLF)
+ pyais-raw	sentences with a TAG block giving the receive time, for the file readers of pyais and libais (.nmea, LF);
+	the received TAG block as the tags option keeps it, with a c: field of the
+	record's timestamp in seconds added if the source gave no time (a source's
+	c: is kept, it's when the station received the sentence)
+ elk-jsonl	one JSON object per sentence with @timestamp, for Filebeat, Logstash or Elasticsearch (.jsonl, LF)
+Files in the .nmea and .jsonl presets have no header or comment lines. The
+play and other tools read .nmea files with TAG block times (pyais-raw) as well
+as the CSV formats, logais convert turns one into another (see convert.go).
+*/
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+// preset output format other than CSV
+type outputPreset struct {
+	ext string // file extension including the dot
+	// tag is the TAG block the tags option keeps, empty for none
+	format func(port string, rec *record, source string, tag string) string
+}
+
+var outputPresets = map[string]*outputPreset{
+	"aishub-uplink": {".nmea", func(port string, rec *record, source string, tag string) string {
+		return rec.Sentence + "\r\n"
+	}},
+	"pyais-raw": {".nmea", func(port string, rec *record, source string, tag string) string {
+		return "\\" + receiveTag(tag, rec.at) + "\\" + rec.Sentence + "\n"
+	}},
+	"elk-jsonl": {".jsonl", elkRecord},
+}
+
+// field names as the Elastic Common Schema would have them where there is one
+type elkLine struct {
+	Timestamp string `json:"@timestamp"`
+	Stream    string `json:"stream"`
+	Source    string `json:"source"`
+	Type      string `json:"type"` // AIS, NMEA or DSC as in the CSV type column
+	Sentence  string `json:"sentence"`
+	Tag       string `json:"tag,omitempty"`
+	Checksum  string `json:"checksum"`
+	MsgType   int    `json:"msg_type,omitempty"`
+	MMSI      uint32 `json:"mmsi,omitempty"`
+}
+
+func receiveTag(raw string, t time.Time) string {
+	// TAG block contents with the source's time kept, or c: of t in seconds first if it has none
+	if raw != "" && !parseTag(raw).Time.IsZero() {
+		return raw
+	}
+	body, _, _ := strings.Cut(raw, "*")
+	fields := []string{"c:" + strconv.FormatInt(t.Unix(), 10)}
+	for _, f := range strings.Split(body, ",") {
+		if f != "" && !strings.HasPrefix(f, "c:") {
+			fields = append(fields, f)
+		}
+	}
+	return withChecksum("\\" + strings.Join(fields, ","))[1:]
+}
+
+func elkRecord(port string, rec *record, source string, tag string) string {
+	l := elkLine{Timestamp: rec.Time, Stream: port, Source: source, Type: "AIS", Sentence: rec.Sentence, Checksum: "ok"}
+	switch {
+	case isDSC(rec.Sentence):
+		l.Type = "DSC"
+	case !isAIS(rec.Sentence, nil):
+		l.Type = "NMEA"
+	}
+	l.Tag = tag
+	if !rec.Valid {
+		l.Checksum = "invalid"
+	}
+	if v, ok := parseVDM(rec.Sentence); ok && v.Part == 1 {
+		l.MsgType = ais.MessageType(v.Payload)
+		l.MMSI, _ = ais.MMSI(v.Payload)
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(l)
+	return b.String()
+}
@@ -0,0 +1,27 @@
+//go:build !edge
+
+package logais
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReceiveTag(t *testing.T) {
+	at := time.Unix(1700000000, 500e6)
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"", withChecksum("\\c:1700000000")[1:]},
+		{withChecksum("\\s:r1")[1:], withChecksum("\\c:1700000000,s:r1")[1:]},
+		// the station's time is kept
+		{"s:r1,c:1000000000*7E", "s:r1,c:1000000000*7E"},
+		{withChecksum("\\c:1700000000123,s:r1")[1:], withChecksum("\\c:1700000000123,s:r1")[1:]},
+		// one that can't be read is replaced
+		{withChecksum("\\s:r1,c:x")[1:], withChecksum("\\c:1700000000,s:r1")[1:]},
+	} {
+		if got := receiveTag(c.in, at); got != c.want {
+			t.Errorf("receiveTag(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+//go:build !edge
+
+package logais
+
+/*
+Where the config file, recordings and log files are, for running from a
+non-standard place, in a container, or several instances side by side.
+The defaults for the OS (see setPaths) are overridden by the environment
+ LOGAIS_CONFIG	config file, default LogAIS.toml or LogAIS.txt in the data folder
+ LOGAIS_DATA_DIR	folder for recordings and the files kept with them
+ LOGAIS_LOG_DIR	folder for LogAIS.log
+and those by the -config, -data-dir and -log-dir flags, which the tools
+(play, export, purge...) take too, anywhere among their own arguments.
+*/
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var Confpath = "" // config file, empty for the default in Datapath
+
+func dirPath(dir string) string {
+	// absolute with a trailing separator, as the data folder is left for day folders
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return strings.TrimSuffix(dir, Sep) + Sep
+}
+
+func envPaths() {
+	if v := os.Getenv("LOGAIS_CONFIG"); v != "" {
+		Confpath, _ = filepath.Abs(v)
+	}
+	if v := os.Getenv("LOGAIS_DATA_DIR"); v != "" {
+		Datapath = dirPath(v)
+	}
+	if v := os.Getenv("LOGAIS_LOG_DIR"); v != "" {
+		Logpath = dirPath(v)
+	}
+}
+
+func setPath(name string, value string) {
+	switch name {
+	case "config":
+		Confpath, _ = filepath.Abs(value)
+	case "data-dir":
+		Datapath = dirPath(value)
+	case "log-dir":
+		Logpath = dirPath(value)
+	}
+}
+
+func configPath() string {
+	// TOML config if there is one, otherwise the tab separated file
+	if Confpath != "" {
+		return Confpath
+	}
+	if v := envConfig(); v != "" {
+		return v
+	}
+	if _, err := os.Stat(Datapath + ConfName + ".toml"); err == nil {
+		return Datapath + ConfName + ".toml"
+	}
+	return Datapath + ConfName + ".txt"
+}
+
+func pathFlags(args []string) ([]string, error) {
+	// take -config, -data-dir, -log-dir and -container out of a tool's arguments
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-container" || args[i] == "--container" {
+			// containerMode has seen it
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "config" && name != "data-dir" && name != "log-dir" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i++; i == len(args) {
+				return nil, errors.New("-" + name + " needs a path")
+			}
+			value = args[i]
+		}
+		setPath(name, value)
+	}
+	return rest, nil
+}
@@ -0,0 +1,246 @@
+//go:build !edge
+
+package logais
+
+/*
+Packet capture, for looking at a malformed feed in Wireshark or reproducing a
+parser bug with exactly what was received. With the stream option
+ pcap[=size]
+every datagram the stream takes is also written to LogAIS-port.pcap in the log
+folder (the data folder in a container) as the UDP packet it came in: from its
+sender to the stream's port on 127.0.0.1 (::1 for IPv6 senders), with IPv4 or
+IPv6 and UDP headers whose lengths and checksums are right, and its receive
+time to the nanosecond as the daily file has it (see rxclock.go). Wireshark
+and tcpdump read it as they would a live capture; tell Wireshark to Decode As
+NMEA 0183 on the port. Once a file reaches size (default 10MB) it's renamed
+LogAIS-port.1.pcap, the one before that LogAIS-port.2.pcap and so on, keeping
+pcapKeep of them; the stream starting starts a new file too, so none is ever
+carried on after a packet cut short. Network feeds' datagrams come from
+0.0.0.0 port 0. Datagrams dropped for a full queue (see pipeline.go) or while
+the stream is paused aren't captured. A reload starts or stops it. Not for
+merged streams, capture the streams merged instead. Captures are written
+straight to disk, so with -storage memory (see storage.go) a warning is logged
+and nothing is captured.
+The datagrams hold the MMSIs they came with: logais purge drops the packets
+with a purged vessel's sentences from the captures too, all but the one being
+written today, as it leaves today's daily files (see purge.go).
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pcapKeep    = 4          // rotated capture files kept
+	pcapMagic   = 0xa1b23c4d // little endian, nanosecond timestamps
+	pcapSnaplen = 65535
+	pcapRaw     = 101   // LINKTYPE_RAW, packets start with their IP header
+	udpMax      = 65507 // most a UDP datagram over IPv4 can carry
+)
+
+// a stream's packet capture
+type capture struct {
+	port   uint16
+	base   string // eg /var/log/LogAIS/LogAIS-10110, without .pcap
+	f      *os.File
+	size   int64 // bytes written to f
+	broken bool  // a write failed, nothing more is captured
+	buf    []byte
+}
+
+func captureDir() string {
+	if Container {
+		return Datapath
+	}
+	return Logpath
+}
+
+func newCapture(port string) *capture {
+	n, _ := strconv.Atoi(port)
+	return &capture{port: uint16(n), base: captureDir() + LogfName + "-" + port}
+}
+
+func captureFiles() []string {
+	// every stream's captures, rotated ones too
+	names, _ := filepath.Glob(captureDir() + LogfName + "-*.pcap")
+	return names
+}
+
+func (c *capture) path() string {
+	return c.base + ".pcap"
+}
+
+func (c *capture) rotate() error {
+	// the current file becomes .1, and a new one is started with the pcap header
+	if c.f != nil {
+		c.f.Close()
+		c.f = nil
+	}
+	os.Remove(c.base + "." + strconv.Itoa(pcapKeep) + ".pcap")
+	for i := pcapKeep; i > 1; i-- {
+		os.Rename(c.base+"."+strconv.Itoa(i-1)+".pcap", c.base+"."+strconv.Itoa(i)+".pcap")
+	}
+	os.Rename(c.path(), c.base+".1.pcap")
+	f, err := os.OpenFile(c.path(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnaplen)
+	binary.LittleEndian.PutUint32(hdr[20:], pcapRaw)
+	if _, err = f.Write(hdr); err != nil {
+		f.Close()
+		return err
+	}
+	c.f, c.size = f, int64(len(hdr))
+	return nil
+}
+
+func (c *capture) write(data []byte, from netip.AddrPort, rx time.Time, limit int64) error {
+	// one datagram received at rx, the file rotated first if it would pass limit
+	if c.broken {
+		return nil
+	}
+	data = data[:min(len(data), udpMax)]
+	pkt := c.packet(data, from, rx)
+	if c.f == nil || c.size+int64(len(pkt)) > limit {
+		if err := c.rotate(); err != nil {
+			c.broken = true
+			return err
+		}
+	}
+	n, err := c.f.Write(pkt)
+	c.size += int64(n)
+	if err != nil {
+		c.broken = true
+	}
+	return err
+}
+
+func (c *capture) packet(data []byte, from netip.AddrPort, rx time.Time) []byte {
+	// the pcap record: its header, then the IP and UDP headers and data
+	src := from.Addr().Unmap()
+	dst := netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	iphdr := 20
+	if !src.IsValid() {
+		src = netip.IPv4Unspecified()
+	} else if src.Is6() {
+		dst, iphdr = netip.IPv6Loopback(), 40
+	}
+	udpLen := 8 + len(data)
+	total := iphdr + udpLen
+	b := append(c.buf[:0], make([]byte, 16+total)...)
+	binary.LittleEndian.PutUint32(b[0:], uint32(rx.Unix()))
+	binary.LittleEndian.PutUint32(b[4:], uint32(rx.Nanosecond()))
+	binary.LittleEndian.PutUint32(b[8:], uint32(total))
+	binary.LittleEndian.PutUint32(b[12:], uint32(total))
+	ip := b[16:]
+	if iphdr == 20 {
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(total))
+		ip[6] = 0x40 // don't fragment
+		ip[8], ip[9] = 64, 17
+		s, d := src.As4(), dst.As4()
+		copy(ip[12:], s[:])
+		copy(ip[16:], d[:])
+		binary.BigEndian.PutUint16(ip[10:], fold(sum16(0, ip[:20])))
+	} else {
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(udpLen))
+		ip[6], ip[7] = 17, 64
+		s, d := src.As16(), dst.As16()
+		copy(ip[8:], s[:])
+		copy(ip[24:], d[:])
+	}
+	udp := ip[iphdr:]
+	binary.BigEndian.PutUint16(udp[0:], from.Port())
+	binary.BigEndian.PutUint16(udp[2:], c.port)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpLen))
+	copy(udp[8:], data)
+	// the pseudo header sums the same for both: addresses, protocol and UDP length
+	sum := sum16(0, src.AsSlice())
+	sum = sum16(sum, dst.AsSlice())
+	sum += 17 + uint32(udpLen)
+	check := fold(sum16(sum, udp))
+	if check == 0 {
+		check = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], check)
+	c.buf = b
+	return b
+}
+
+func purgeCapture(content []byte, m *purgeMatcher) ([]byte, int, error) {
+	// packets with a matching sentence go whole, the rest stay as captured
+	if len(content) < 24 || binary.LittleEndian.Uint32(content) != pcapMagic {
+		return nil, 0, errors.New("not a capture LogAIS wrote")
+	}
+	out := append([]byte(nil), content[:24]...)
+	n := 0
+	for p := 24; p+16 <= len(content); {
+		end := p + 16 + int(binary.LittleEndian.Uint32(content[p+8:]))
+		if end > len(content) {
+			// cut short by the logger stopping
+			break
+		}
+		if capturedMatch(content[p+16:end], m) {
+			n++
+		} else {
+			out = append(out, content[p:end]...)
+		}
+		p = end
+	}
+	return out, n, nil
+}
+
+func capturedMatch(pkt []byte, m *purgeMatcher) bool {
+	// any sentence in the UDP data of a packet as capture.packet makes them
+	iphdr := 40
+	if len(pkt) > 0 && pkt[0]>>4 == 4 {
+		iphdr = int(pkt[0]&15) * 4
+	}
+	if len(pkt) < iphdr+8 {
+		return false
+	}
+	for line := range strings.Lines(string(pkt[iphdr+8:])) {
+		if s := strings.TrimSpace(line); s != "" && (s[0] == '!' || s[0] == '\\') && m.match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func sum16(sum uint32, b []byte) uint32 {
+	// ones' complement sum of b as big endian 16 bit words, unfolded
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+func fold(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func (c *capture) Close() {
+	if c != nil && c.f != nil {
+		c.f.Close()
+		c.f = nil
+	}
+}
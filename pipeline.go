@@ -0,0 +1,288 @@
+//go:build !edge
+
+package logais
+
+/*
+Receive pipeline: a stream listening on a UDP port reads it in a goroutine of
+its own that only takes each datagram and its receive time and queues it for
+the stream's writer (startAIS), up to receiveQueue datagrams. A slow disk
+write then holds up the writer, not the reads, and a burst waits in the queue
+rather than overflowing the kernel's socket buffer. What happens should the
+queue still be full is up to the stream:
+ backpressure=drop-newest	drop the datagram just read (the default)
+ backpressure=drop-oldest	drop the longest waiting one to make room for it
+ backpressure=block	wait for the writer; the socket buffer takes the burst, and
+	past that the system drops datagrams, which LogAIS can't count
+Every datagram dropped is counted (overflow in the stream's stats) and so is
+every sentence in them (dropped), in the log and /api/status, so loss is
+measured rather than silent. A reload applies a change. Network feeds always
+wait, TCP holds the sender up, and ingest tells agents to send again later. Read errors re-open the port as before;
+if it can't be opened again the queue is closed and the stream fails.
+Records take the time the datagram was read, not when it was written, see
+rxclock.go.
+On a routed network anyone can send to the port, so a stream can take only
+some senders' datagrams:
+ allow-from=addr[,addr...]	IP addresses or CIDR ranges, eg 10.1.2.3,192.168.40.0/24
+Others are dropped before anything else sees them and counted (rejected in the
+stream's stats), with a warning giving the sender at most once a minute.
+Per stream options for bursty sources, eg a network aggregator:
+ recv-buffer=size	largest datagram read, 512 to 65535 bytes (default recvBufDefault)
+ socket-buffer=size	socket receive buffer asked of the system (SO_RCVBUF)
+The sizes in use are logged when the port is opened; the system may give a
+different socket buffer (Linux doubles it, and caps it at net.core.rmem_max).
+For ports too busy for one reader:
+ sockets=n	open the port n times with SO_REUSEPORT, 2 to 64, a reader on each
+The system shares the datagrams out between the sockets by sender address, so
+it helps with many senders, less with one. Each socket's datagrams received and
+dropped for a full queue are counted in the stream's stats; one that can't be
+opened again after a read error stops, the stream fails once all have.
+Linux and the BSDs only.
+Datagrams are read into buffers of recv-buffer bytes from a pool kept for each
+size, which the writer gives back once it has copied the datagram, so a busy
+port doesn't allocate for every datagram.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"example.com/logais/input"
+)
+
+const (
+	receiveQueue   = 4096        // datagrams waiting for the writer
+	receiveWait    = time.Second // read deadline, to notice the stream stopping
+	recvBufDefault = 6144        // largest datagram read unless recv-buffer is given
+	behindLogEvery = time.Minute // at most one writer behind warning this often, per socket
+	rejectLogEvery = time.Minute // and one sender not allowed warning
+	cutLogEvery    = time.Minute // and one datagram cut short warning
+)
+
+type datagram struct {
+	data []byte
+	rx   time.Time
+	from netip.AddrPort // sender, zero for network feeds
+	buf  *[]byte        // data is read into, from the receiver's pool
+}
+
+type receiver struct {
+	C      <-chan datagram // closed once no socket can be read
+	pool   *sync.Pool      // of buffers for the stream's recv-buffer size
+	done   chan struct{}
+	exited chan struct{}
+}
+
+var recvPools sync.Map // buffer size -> *sync.Pool
+
+func recvPool(size int) *sync.Pool {
+	if p, ok := recvPools.Load(size); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := recvPools.LoadOrStore(size, &sync.Pool{New: func() any {
+		b := make([]byte, size)
+		return &b
+	}})
+	return p.(*sync.Pool)
+}
+
+func listenUDP(st *Stream, port int) (*net.UDPConn, error) {
+	// the stream's port with its socket-buffer, shared with the stream's other sockets if it has them
+	return input.ListenUDP(port, st.opts().Sockets > 1, st.opts().SockBuf)
+}
+
+func listenSockets(st *Stream, port int) ([]*net.UDPConn, error) {
+	// one socket, or as many as the sockets option asks for
+	conns := make([]*net.UDPConn, 0, max(st.opts().Sockets, 1))
+	for range cap(conns) {
+		conn, err := listenUDP(st, port)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+func receiveUDP(st *Stream, conns []*net.UDPConn, bufsize int, logit *slog.Logger) *receiver {
+	out := make(chan datagram, receiveQueue)
+	r := &receiver{C: out, pool: recvPool(bufsize), done: make(chan struct{}), exited: make(chan struct{})}
+	var socks []*socketStats
+	if len(conns) > 1 {
+		socks = make([]*socketStats, len(conns))
+		for i := range socks {
+			socks[i] = new(socketStats)
+		}
+	}
+	st.stats.Sockets.Store(&socks)
+	var readers sync.WaitGroup
+	for i, conn := range conns {
+		lg, sock := logit, new(socketStats)
+		if socks != nil {
+			lg, sock = logit.With("socket", i+1), socks[i]
+		}
+		readers.Go(func() {
+			r.read(st, conn, bufsize, out, sock, lg)
+		})
+	}
+	go func() {
+		readers.Wait()
+		close(out)
+		close(r.exited)
+	}()
+	return r
+}
+
+func allowed(allow []netip.Prefix, from netip.Addr) bool {
+	// nil allows everyone
+	if allow == nil {
+		return true
+	}
+	from = from.Unmap()
+	for _, p := range allow {
+		if p.Contains(from) {
+			return true
+		}
+	}
+	return false
+}
+
+func countSentences(data []byte) int64 {
+	// lines with anything on them
+	var n int64
+	for line := range bytes.Lines(data) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *receiver) read(st *Stream, conn *net.UDPConn, bufsize int, out chan datagram, sock *socketStats, logit *slog.Logger) {
+	// one socket's reader, until the stream stops or the socket can't be opened again
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	var buf *[]byte         // from the pool, until it's queued
+	var behind, warned bool // the queue was full, until a datagram is queued again, and that was logged
+	var warnedAt, rejectedAt, cutAt time.Time
+	var dropped, lost int64 // datagrams and their sentences dropped since the last caught up entry
+	var rejected int64      // datagrams from senders not allowed since the last warning
+	var cut int64           // datagrams filling the buffer since the last warning
+	drop := func(d datagram) {
+		n := countSentences(d.data)
+		st.stats.Overflow.Add(1)
+		st.stats.Dropped.Add(n)
+		sock.Dropped.Add(1)
+		dropped++
+		lost += n
+		r.release(d)
+	}
+	for {
+		if buf == nil {
+			buf = r.pool.Get().(*[]byte)
+		}
+		conn.SetReadDeadline(time.Now().Add(receiveWait))
+		leng, from, err := conn.ReadFromUDPAddrPort(*buf)
+		select {
+		case <-r.done:
+			conn.Close()
+			return
+		default:
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			logit.Info("UDP read error, will re-open port", "err", err)
+			st.bound.Store(false)
+			conn.Close()
+			if conn, err = listenUDP(st, port); err != nil {
+				logit.Error("can't connect to UDP input", "err", err)
+				return
+			}
+			st.bound.Store(true)
+			logit.Info("input reconnected")
+			Events.publish(EventReconnected, st.Port, "UDP port re-opened after a read error")
+			continue
+		}
+		rx := time.Now()
+		if !allowed(st.opts().AllowFrom, from.Addr()) {
+			st.stats.Rejected.Add(1)
+			rejected++
+			if rx.Sub(rejectedAt) >= rejectLogEvery {
+				logit.Warn("datagrams from a sender allow-from doesn't list, dropped", "sender", from.Addr().Unmap(), "datagrams", rejected)
+				rejected, rejectedAt = 0, rx
+			}
+			continue
+		}
+		st.heard.Store(rx.UnixNano())
+		sock.Received.Add(1)
+		if leng == bufsize {
+			if cut++; rx.Sub(cutAt) >= cutLogEvery {
+				logit.Warn("datagrams may have been cut short, see recv-buffer", "bytes", leng, "datagrams", cut)
+				cut, cutAt = 0, rx
+			}
+		} else if leng > 1460 {
+			logit.Info("large packet received", "bytes", leng)
+		}
+		d := datagram{data: (*buf)[:leng], rx: rx, from: from, buf: buf}
+		buf = nil
+		select {
+		case out <- d:
+			if behind && warned {
+				logit.Info("writer caught up", "datagrams", dropped, "dropped", lost)
+				warned, dropped, lost = false, 0, 0
+			}
+			behind = false
+			continue
+		default:
+		}
+		policy := st.opts().Pressure
+		if !behind && rx.Sub(warnedAt) >= behindLogEvery {
+			logit.Warn("writer behind", "queue", receiveQueue, "backpressure", policy)
+			warned, warnedAt = true, rx
+		}
+		behind = true
+		switch policy {
+		case "block":
+			select {
+			case out <- d:
+			case <-r.done:
+				conn.Close()
+				return
+			}
+		case "drop-oldest":
+			select {
+			case old := <-out:
+				drop(old)
+			default:
+			}
+			select {
+			case out <- d:
+			default:
+				// another socket's reader took the room
+				drop(d)
+			}
+		default:
+			drop(d)
+		}
+	}
+}
+
+func (r *receiver) release(d datagram) {
+	// the writer is done with d.data
+	r.pool.Put(d.buf)
+}
+
+func (r *receiver) stop() {
+	// the sockets are closed once this returns, so the port can be opened again
+	close(r.done)
+	<-r.exited
+}
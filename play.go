@@ -0,0 +1,275 @@
+//go:build !edge
+
+package logais
+
+/*
+logais play: send recorded files to UDP destinations with their original timing.
+ logais play [options] -to udp://host:port [-to ...] file ...
+ logais play file ... --to udp://host:port [options]
+Several files are played together in timestamp order, recreating a station's
+traffic. With one -to everything goes there, otherwise each file goes to the
+-to in the same position.
+Options for demo feeds: -loop to repeat forever, -offset to skip the start of the
+recording, -from/-until to select a time range (hh:mm[:ss] on the recording's
+day or a full RFC3339 time), and -ramp to speed up gradually from 1x to -speed.
+With -log the application log entries from the recording's time are printed as
+playing reaches them, showing reconnects and gaps that affected the capture.
+Files with an index (see index.go) are sought to -from or -offset.
+*/
+
+import (
+	"container/heap"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+func parseInterleaved(fs *flag.FlagSet, args []string) []string {
+	// fs.Parse, allowing options after the file names too
+	var files []string
+	for {
+		fs.Parse(args)
+		if args = fs.Args(); len(args) == 0 {
+			return files
+		}
+		files, args = append(files, args[0]), args[1:]
+	}
+}
+
+// one input file with its next record
+type playSource struct {
+	rr   *recReader
+	next *recRecord
+	out  net.Conn
+}
+
+type playHeap []*playSource
+
+func (h playHeap) Len() int           { return len(h) }
+func (h playHeap) Less(i, j int) bool { return h[i].next.Time.Before(h[j].next.Time) }
+func (h playHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *playHeap) Push(x any)        { *h = append(*h, x.(*playSource)) }
+func (h *playHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func dialDest(dest string) (net.Conn, error) {
+	addr, ok := strings.CutPrefix(dest, "udp://")
+	if !ok {
+		return nil, errors.New("destination must be udp://host:port: " + dest)
+	}
+	return net.Dial("udp", addr)
+}
+
+type playOptions struct {
+	log    []logLine // application log entries to show while playing
+	speed  float64
+	ramp   time.Duration // wall time to go from 1x to speed
+	offset time.Duration
+	from   string
+	until  string
+}
+
+func playTime(s string, day time.Time) (time.Time, error) {
+	// RFC3339, or a time of day on the day of the first record
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			y, m, d := day.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time, expecting hh:mm[:ss] or RFC3339: " + s)
+}
+
+func openPlay(files []string, to []string, conns map[string]net.Conn) (*playHeap, func(), error) {
+	// one source per file, primed with its first record
+	h := &playHeap{}
+	var readers []*recReader
+	closeAll := func() {
+		for _, rr := range readers {
+			rr.Close()
+		}
+	}
+	for i, name := range files {
+		dest := to[0]
+		if len(to) > 1 {
+			dest = to[i]
+		}
+		rr, err := openRecording(name)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		readers = append(readers, rr)
+		src := &playSource{rr: rr, out: conns[dest]}
+		if src.next, err = rr.Next(); err == nil {
+			heap.Push(h, src)
+		}
+	}
+	return h, closeAll, nil
+}
+
+func playOnce(h *playHeap, o playOptions, ramp bool) (int, error) {
+	var (
+		first time.Time // recording time of the first record
+		from  time.Time
+		until time.Time
+		prev  time.Time // recording time of the last record sent
+		due   time.Time // wall time to send the next record
+		start time.Time // wall time playing started
+		sent  int
+		err   error
+	)
+	for h.Len() > 0 {
+		src := (*h)[0]
+		rec := src.next
+		if first.IsZero() {
+			first = rec.Time
+			if from, err = playTime(o.from, first); err != nil {
+				return 0, err
+			}
+			if until, err = playTime(o.until, first); err != nil {
+				return 0, err
+			}
+			if start := first.Add(o.offset); start.After(from) {
+				from = start
+			}
+			if from.After(first) {
+				// seek the files with an index, see index.go
+				if err = h.skipTo(from); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		if !rec.Time.Before(from) && (until.IsZero() || rec.Time.Before(until)) {
+			if due.IsZero() {
+				start, due, prev = time.Now(), time.Now(), rec.Time
+			}
+			// speed rises linearly from 1 over the ramp time
+			speed := o.speed
+			if elapsed := time.Since(start); ramp && o.ramp > 0 && elapsed < o.ramp {
+				speed = 1 + (o.speed-1)*float64(elapsed)/float64(o.ramp)
+			}
+			due = due.Add(time.Duration(float64(rec.Time.Sub(prev)) / speed))
+			prev = rec.Time
+			time.Sleep(time.Until(due))
+			for len(o.log) > 0 && !o.log[0].Time.After(rec.Time) {
+				fmt.Println(o.log[0].Text)
+				o.log = o.log[1:]
+			}
+			if _, err := src.out.Write([]byte(rec.Sentence + "\r\n")); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", src.rr.name, err)
+			}
+			sent++
+		} else if !until.IsZero() && !rec.Time.Before(until) {
+			// past the end of the range for this file
+			heap.Pop(h)
+			continue
+		}
+
+		if src.next, err = src.rr.Next(); err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", src.rr.name, err)
+			}
+			heap.Pop(h)
+			continue
+		}
+		heap.Fix(h, 0)
+	}
+	return sent, nil
+}
+
+func playCmd(args []string) int {
+	fs := flag.NewFlagSet("play", flag.ExitOnError)
+	var to stringList
+	var o playOptions
+	fs.Var(&to, "to", "destination udp://host:port, repeat for one per file")
+	fs.Float64Var(&o.speed, "speed", 1, "playback speed multiplier")
+	fs.DurationVar(&o.ramp, "ramp", 0, "time to ramp up from 1x to -speed, eg 5m")
+	fs.DurationVar(&o.offset, "offset", 0, "skip this much of the start of the recording, eg 6h")
+	fs.StringVar(&o.from, "from", "", "start at this time, hh:mm[:ss] or RFC3339")
+	fs.StringVar(&o.until, "until", "", "stop at this time, hh:mm[:ss] or RFC3339")
+	loop := fs.Bool("loop", false, "repeat forever")
+	withLog := fs.Bool("log", false, "show application log entries from the recording's time")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais play [options] file ... (options may also follow the files)\n")
+		fs.PrintDefaults()
+	}
+	files := parseInterleaved(fs, args)
+	if len(files) == 0 || len(to) == 0 || len(to) != 1 && len(to) != len(files) || o.speed <= 0 {
+		fs.Usage()
+		return 2
+	}
+	for i, name := range files {
+		files[i] = findRecording(name)
+	}
+
+	conns := make(map[string]net.Conn)
+	for _, dest := range to {
+		if conns[dest] == nil {
+			c, err := dialDest(dest)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer c.Close()
+			conns[dest] = c
+		}
+	}
+
+	var applog []logLine
+	if *withLog {
+		first, last, err := recordingSpan(files)
+		if err == nil {
+			applog, err = logWindow(first, last)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	total := 0
+	for pass := 0; pass == 0 || *loop; pass++ {
+		h, closeAll, err := openPlay(files, to, conns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		o.log = applog
+		sent, err := playOnce(h, o, pass == 0)
+		closeAll()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		total += sent
+		if sent == 0 {
+			// nothing in range, don't spin
+			break
+		}
+	}
+	fmt.Printf("%d sentences sent\n", total)
+	return 0
+}
@@ -0,0 +1,364 @@
+//go:build !edge
+
+package logais
+
+/*
+logais purge: remove a vessel's records from the whole archive, eg after a
+data removal request for a private vessel.
+ logais purge [-redact] [-n] -reason text mmsi ...
+Every daily file, in cold storage too, is checked (main, -ownship, -invalid, -quality and GeoJSON,
+and the .nmea and .jsonl files of the output presets), compressed ones too,
+and the pcap option's packet captures in the log folder (see pcap.go).
+Matching lines are removed, or with -redact replaced by a "# redacted" comment
+that keeps the timestamp so gaps stay explained; the presets' files can't have
+comments, so they're removed from those either way. Multipart messages go as a whole.
+The vessel is also removed from vessels.json.
+Each run is appended to purge-audit.log in the data folder with the files
+changed and their SHA-256 before and after.
+Packets with a matching sentence are dropped from captures whatever -redact says.
+Today's files are still being written and are left alone, as are days and
+vessels under a legal hold (see holds.go). Files recorded with the chain
+option no longer verify once purged, purge-audit.log says why (see chain.go).
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+	"example.com/logais/rotation"
+)
+
+// finds the sentences of the vessels being purged in one file
+type purgeMatcher struct {
+	mmsi  map[uint32]bool
+	parts map[string]bool // multipart messages whose first part matched
+}
+
+func (m *purgeMatcher) match(field string) bool {
+	_, sentence := splitTag(strings.TrimSpace(field))
+	v, ok := parseVDM(sentence)
+	if !ok {
+		return false
+	}
+	key := v.SeqID + "," + v.Channel + "," + strconv.Itoa(v.Total)
+	if v.Part > 1 {
+		// the MMSI is only in the first part
+		return m.parts[key]
+	}
+	mmsi, ok := ais.MMSI(v.Payload)
+	hit := ok && m.mmsi[mmsi]
+	if v.Total > 1 {
+		m.parts[key] = hit
+	}
+	return hit
+}
+
+func (m *purgeMatcher) line(text string) bool {
+	// any column holding a matching sentence, header and comment lines never match
+	if text == "" || text[0] == '#' {
+		return false
+	}
+	r := csv.NewReader(strings.NewReader(text))
+	r.LazyQuotes = true
+	fields, err := r.Read()
+	if err != nil {
+		return false
+	}
+	for _, f := range fields {
+		if f != "" && (f[0] == '!' || f[0] == '\\') && m.match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func purgeCSV(content []byte, m *purgeMatcher, redact bool) ([]byte, int) {
+	var out bytes.Buffer
+	n := 0
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	sc.Buffer(make([]byte, 65536), 1<<20)
+	for sc.Scan() {
+		text := strings.TrimRight(sc.Text(), "\r")
+		if !m.line(text) {
+			out.WriteString(text + "\r\n")
+			continue
+		}
+		n++
+		if redact {
+			stamp, _, _ := strings.Cut(text, ",")
+			out.WriteString("# redacted " + stamp + "\r\n")
+		}
+	}
+	return out.Bytes(), n
+}
+
+func purgeNMEA(content []byte, m *purgeMatcher) ([]byte, int) {
+	// a sentence a line, with a TAG block if it had one, line endings kept
+	var out bytes.Buffer
+	n := 0
+	for _, text := range strings.SplitAfter(string(content), "\n") {
+		if s := strings.TrimSpace(text); s != "" && m.match(s) {
+			n++
+			continue
+		}
+		out.WriteString(text)
+	}
+	return out.Bytes(), n
+}
+
+func purgeJSONL(content []byte, m *purgeMatcher) ([]byte, int) {
+	// elk-jsonl, matched by the sentence so later parts of a multipart message go too
+	var out bytes.Buffer
+	n := 0
+	for _, text := range strings.SplitAfter(string(content), "\n") {
+		var l elkLine
+		if json.Unmarshal([]byte(text), &l) == nil && l.Sentence != "" && m.match(l.Sentence) {
+			n++
+			continue
+		}
+		out.WriteString(text)
+	}
+	return out.Bytes(), n
+}
+
+func purgeNDJSON(content []byte, mmsi map[uint32]bool) ([]byte, int) {
+	var out bytes.Buffer
+	n := 0
+	for _, text := range strings.SplitAfter(string(content), "\n") {
+		var f geoFeature
+		if json.Unmarshal([]byte(text), &f) == nil && mmsi[f.Props.MMSI] {
+			n++
+			continue
+		}
+		out.WriteString(text)
+	}
+	return out.Bytes(), n
+}
+
+func purgeCollection(content []byte, mmsi map[uint32]bool) ([]byte, int, error) {
+	// rewritten in the layout geoFile.write uses
+	var c struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, 0, err
+	}
+	var keep []string
+	for _, raw := range c.Features {
+		var f geoFeature
+		if json.Unmarshal(raw, &f) == nil && mmsi[f.Props.MMSI] {
+			continue
+		}
+		keep = append(keep, string(raw))
+	}
+	return []byte(collectionHead + strings.Join(keep, ",\n") + collectionTail), len(c.Features) - len(keep), nil
+}
+
+type purgeResult struct {
+	path   string
+	n      int
+	before string
+	after  string
+}
+
+// the kinds of file purge takes a vessel's records out of, by extension without .gz
+var purgeKinds = map[string]bool{".csv": true, ".nmea": true, ".pcap": true, ".jsonl": true, ".geojsonl": true, ".geojson": true}
+
+func purgeContent(path string, content []byte, mmsi map[uint32]bool, redact bool) ([]byte, int, error) {
+	// a file's content without the vessels' records, and how many there were
+	m := &purgeMatcher{mmsi: mmsi, parts: make(map[string]bool)}
+	switch filepath.Ext(strings.TrimSuffix(path, ".gz")) {
+	case ".csv":
+		out, n := purgeCSV(content, m, redact)
+		return out, n, nil
+	case ".nmea":
+		out, n := purgeNMEA(content, m)
+		return out, n, nil
+	case ".pcap":
+		return purgeCapture(content, m)
+	case ".jsonl":
+		out, n := purgeJSONL(content, m)
+		return out, n, nil
+	case ".geojsonl":
+		out, n := purgeNDJSON(content, mmsi)
+		return out, n, nil
+	case ".geojson":
+		return purgeCollection(content, mmsi)
+	}
+	return nil, 0, nil
+}
+
+func purgeFile(path string, mmsi map[uint32]bool, redact bool, dryRun bool) (*purgeResult, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// compressed by retention, rewritten compressed
+	content, gz := raw, filepath.Ext(path) == ".gz"
+	if gz {
+		if content, err = gunzipBytes(raw); err != nil {
+			return nil, err
+		}
+	}
+	out, n, err := purgeContent(path, content, mmsi, redact)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	sum := func(b []byte) string {
+		s := sha256.Sum256(b)
+		return hex.EncodeToString(s[:])
+	}
+	if redact && !dryRun && filepath.Ext(strings.TrimSuffix(path, ".gz")) == ".csv" {
+		out = append(out, "# Purged "+time.Now().UTC().Format(timeLayout)+": "+strconv.Itoa(n)+" records redacted, see purge-audit.log\r\n"...)
+	}
+	if gz {
+		out = gzipBytes(out, filepath.Base(strings.TrimSuffix(path, ".gz")))
+	}
+	res := &purgeResult{path: path, n: n, before: sum(raw), after: sum(out)}
+	if dryRun {
+		return res, nil
+	}
+	if err = os.WriteFile(path+".tmp", out, 0664); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return nil, err
+	}
+	return res, reindex(path)
+}
+
+// day and port of a daily file, yyyymmdd-port[-suffix].ext[.gz]
+var dailyFileDay = rotation.Parse
+
+func purgeCmd(args []string) int {
+	fset := flag.NewFlagSet("purge", flag.ExitOnError)
+	redact := fset.Bool("redact", false, "replace matching lines with a comment instead of removing them")
+	dryRun := fset.Bool("n", false, "only report what would change")
+	reason := fset.String("reason", "", "why, eg request reference, for the audit log")
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "Usage: logais purge [options] -reason text mmsi ...\n")
+		fset.PrintDefaults()
+	}
+	fset.Parse(args)
+	if fset.NArg() == 0 || *reason == "" {
+		fset.Usage()
+		return 2
+	}
+	mmsi := make(map[uint32]bool)
+	var list []string
+	for _, a := range fset.Args() {
+		n, err := strconv.ParseUint(a, 10, 32)
+		if err != nil || n == 0 || n > 999999999 {
+			fmt.Fprintln(os.Stderr, "not an MMSI: "+a)
+			return 2
+		}
+		if mmsiHeld(uint32(n)) {
+			fmt.Fprintf(os.Stderr, "%d is under a legal hold, release it first\n", n)
+			return 1
+		}
+		mmsi[uint32(n)] = true
+		list = append(list, a)
+	}
+
+	today := time.Now().UTC().Format("20060102")
+	var results []*purgeResult
+	var skipped []string
+	purge := func(path string) error {
+		res, err := purgeFile(path, mmsi, *redact, *dryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if res != nil {
+			results = append(results, res)
+			fmt.Printf("%s\t%d\n", path, res.n)
+		}
+		return nil
+	}
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		day, port, ok := dailyFileDay(d.Name())
+		if !ok {
+			return nil
+		}
+		if day.Format("20060102") == today || dayHeld(day, port) {
+			skipped = append(skipped, path)
+			return nil
+		}
+		return purge(path)
+	}
+	var err error
+	for _, root := range archiveRoots() {
+		if err = filepath.WalkDir(root, walk); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			break
+		}
+	}
+	// and the packet captures, but the one being written
+	for _, path := range captureFiles() {
+		if err != nil {
+			break
+		}
+		if info, serr := os.Stat(path); serr == nil && info.ModTime().UTC().Format("20060102") == today {
+			skipped = append(skipped, path)
+			continue
+		}
+		if err = purge(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	for _, s := range skipped {
+		fmt.Printf("%s\tnot checked, written today or under a legal hold\n", s)
+	}
+	if *dryRun {
+		return 0
+	}
+
+	Vessels.path = Datapath + "vessels.json"
+	if lerr := Vessels.load(); lerr == nil {
+		for n := range mmsi {
+			Vessels.forget(n)
+		}
+		if serr := Vessels.save(); serr != nil {
+			fmt.Fprintln(os.Stderr, serr)
+		}
+	}
+
+	mode := "remove"
+	if *redact {
+		mode = "redact"
+	}
+	audit := fmt.Sprintf("%s purge %s mmsi %s reason %q\r\n", time.Now().UTC().Format(timeLayout), mode, strings.Join(list, ","), *reason)
+	for _, r := range results {
+		audit += fmt.Sprintf("\t%s\t%d\tsha256 %s -> %s\r\n", r.path, r.n, r.before, r.after)
+	}
+	for _, s := range skipped {
+		audit += "\t" + s + "\tskipped\r\n"
+	}
+	f, aerr := os.OpenFile(Datapath+"purge-audit.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	if aerr == nil {
+		_, aerr = f.WriteString(audit)
+		f.Close()
+	}
+	if aerr != nil {
+		fmt.Fprintln(os.Stderr, "audit log: "+aerr.Error())
+	}
+	if err != nil || aerr != nil {
+		return 1
+	}
+	return 0
+}
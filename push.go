@@ -0,0 +1,162 @@
+package logais
+
+/*
+Posting what a stream receives to a collector's ingest stream, for the push
+option and the edge agent (see ingest.go and edge.go). Lines are batched with
+a c: TAG block time of when they were received, unless they had one, and
+posted every pushInterval; what the collector doesn't take is kept for the next
+post, up to pushBacklog bytes, then the oldest lines are dropped.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/logais/config"
+)
+
+const (
+	pushInterval = 5 * time.Second // how often an agent posts what its stream received
+	pushBacklog  = 8 << 20         // unsent bytes an agent keeps while the collector is away
+	pushTimeout  = 30 * time.Second
+)
+
+// batches waiting to be posted to a collector, lines of sentences
+type pusher struct {
+	url     string
+	token   string
+	tls     *config.TLSFiles // nil for the system's CAs and no client certificate
+	done    chan struct{}    // closed when the stream moves to another collector
+	pushed  *atomic.Int64    // sentences the collector accepted
+	dropped *atomic.Int64    // sentences dropped unsent
+	mu      sync.Mutex
+	lines   [][]byte
+	size    int
+	lost    int // lines dropped from the front, so a post in progress knows where its batch now starts
+}
+
+func newPusher(url string, token string, secure *config.TLSFiles, pushed *atomic.Int64, dropped *atomic.Int64) *pusher {
+	return &pusher{url: url, token: token, tls: secure, done: make(chan struct{}), pushed: pushed, dropped: dropped}
+}
+
+func (p *pusher) add(packet []byte, rx time.Time) {
+	var lines [][]byte
+	for _, rs := range scanSentences(packet) {
+		lines = append(lines, []byte(stampLine(rs, rx)))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, l := range lines {
+		p.lines = append(p.lines, l)
+		p.size += len(l)
+	}
+	for p.size > pushBacklog {
+		p.size -= len(p.lines[0])
+		p.lines = p.lines[1:]
+		p.lost++
+		p.dropped.Add(1)
+	}
+}
+
+func stampLine(rs rawSentence, rx time.Time) string {
+	return "\\" + stampTag(rs.Tag, rx) + "\\" + rs.Text + rs.Trailer + "\r\n"
+}
+
+func (p *pusher) run(logit *slog.Logger, quit <-chan struct{}, alert func(string)) {
+	// post every pushInterval until quit or done, and once more then
+	tick := time.NewTicker(pushInterval)
+	defer tick.Stop()
+	client := &http.Client{Timeout: pushTimeout}
+	var loaded *config.TLSLoaded // what client has of p.tls
+	failing := false
+	for {
+		stopping := false
+		select {
+		case <-tick.C:
+		case <-quit:
+			stopping = true
+		case <-p.done:
+			stopping = true
+		}
+		p.mu.Lock()
+		batch, lost := p.lines, p.lost
+		p.mu.Unlock()
+		if len(batch) > 0 {
+			var n int
+			var err error
+			if p.tls != nil {
+				client, loaded, err = p.tlsClient(client, loaded, logit)
+			}
+			if err == nil {
+				n, err = p.post(client, batch)
+			}
+			p.mu.Lock()
+			for _, l := range batch[min(p.lost-lost, n):n] {
+				p.lines = p.lines[1:]
+				p.size -= len(l)
+			}
+			p.mu.Unlock()
+			p.pushed.Add(int64(n))
+			switch {
+			case err != nil && !failing:
+				logit.Error("push failed", "url", p.url, "err", err)
+				if alert != nil {
+					alert("push to " + p.url + " failing: " + err.Error())
+				}
+			case err == nil && failing:
+				logit.Info("push working again", "url", p.url)
+			}
+			failing = err != nil
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+func (p *pusher) tlsClient(client *http.Client, loaded *config.TLSLoaded, logit *slog.Logger) (*http.Client, *config.TLSLoaded, error) {
+	// client again, or a new one if the TLS files changed
+	ld, err := p.tls.Current(logit)
+	if ld == nil {
+		return client, loaded, err
+	}
+	if ld == loaded {
+		return client, loaded, nil
+	}
+	client.CloseIdleConnections()
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = ld.Client("")
+	return &http.Client{Timeout: pushTimeout, Transport: tr}, ld, nil
+}
+
+func (p *pusher) post(client *http.Client, batch [][]byte) (int, error) {
+	// lines the collector accepted, from the start of batch
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(bytes.Join(batch, nil)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		Accepted int `json:"accepted"`
+	}
+	json.NewDecoder(resp.Body).Decode(&answer)
+	n := min(max(answer.Accepted, 0), len(batch))
+	if resp.StatusCode != http.StatusOK {
+		return n, fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return len(batch), nil
+}
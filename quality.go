@@ -0,0 +1,51 @@
+//go:build !edge
+
+package logais
+
+/*
+Signal quality reported by receivers, written to a parallel daily log for antenna tuning.
+
+Two sources:
+ fields after the checksum, eg !AIVDM,...*hh,s22390,d-107,T41.27,x1664	d is signal level in dBm
+ a proprietary sentence ahead of the AIS sentence it describes, configured as
+ quality=PXXXX,r,s	sentence PXXXX with RSSI in field r and SNR in field s (0 if not reported)
+*/
+
+import (
+	"strconv"
+	"strings"
+)
+
+const qualityHeader = "timestamp,rssi,snr,message\r\n"
+
+type quality struct {
+	RSSI string
+	SNR  string
+}
+
+func parseQuality(q *QualitySpec, sentence string) *quality {
+	f := sentenceFields(sentence)
+	get := func(n int) string {
+		if n > 0 && n < len(f) {
+			return f[n]
+		}
+		return ""
+	}
+	return &quality{RSSI: get(q.RSSI), SNR: get(q.SNR)}
+}
+
+func trailerQuality(trailer string) *quality {
+	// ,d-107 is the signal level in dBm
+	for _, f := range strings.Split(trailer, ",") {
+		if len(f) > 1 && f[0] == 'd' {
+			if _, err := strconv.ParseFloat(f[1:], 64); err == nil {
+				return &quality{RSSI: f[1:]}
+			}
+		}
+	}
+	return nil
+}
+
+func (q *quality) record(rfctime string, sentence string) string {
+	return rfctime + "," + q.RSSI + "," + q.SNR + ",\"" + sentence + "\"\r\n"
+}
@@ -0,0 +1,61 @@
+//go:build !edge
+
+package logais
+
+/*
+Downsampling of position reports for vessels reporting more often than the archive needs.
+ rate=seconds	record at most one position report (types 1-3, 18, 19, 27) per vessel every seconds
+Static data, safety messages and every other type are always recorded.
+Dropped reports are counted in the stream's stats.
+*/
+
+import (
+	"time"
+
+	"example.com/logais/ais"
+)
+
+var positionTypes = map[int]bool{1: true, 2: true, 3: true, 18: true, 19: true, 27: true}
+
+// last recorded position report of each vessel, for one stream
+type rateLimit struct {
+	every  time.Duration
+	last   map[uint32]time.Time
+	purged time.Time
+}
+
+func (st *Stream) limited(group []*record) bool {
+	// true if the message is a position report from a vessel recorded too recently,
+	// called from the stream's goroutine only
+	o := st.opts()
+	if o.Rate == 0 {
+		return false
+	}
+	v, ok := parseVDM(group[0].Sentence)
+	if !ok || v.Part != 1 || !positionTypes[ais.MessageType(v.Payload)] {
+		return false
+	}
+	mmsi, ok := ais.MMSI(v.Payload)
+	if !ok {
+		return false
+	}
+	if st.rate == nil || st.rate.every != o.Rate {
+		st.rate = &rateLimit{every: o.Rate, last: make(map[uint32]time.Time)}
+	}
+	r, now := st.rate, group[0].rx
+	if t, ok := r.last[mmsi]; ok && now.Sub(t) < r.every {
+		st.stats.Downsampled.Add(1)
+		return true
+	}
+	r.last[mmsi] = now
+	if now.Sub(r.purged) > time.Hour {
+		// forget vessels long gone
+		for m, t := range r.last {
+			if now.Sub(t) > r.every {
+				delete(r.last, m)
+			}
+		}
+		r.purged = now
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+//go:build !edge
+
+package logais
+
+/*
+Reading recorded daily files back, for the play and other tools.
+Understands the LogAIS format, the strict VDR format, the checksum column and
+-invalid.csv files, compressed with .gz too; # comment lines are skipped.
+.nmea files are read too, taking the time from each line's TAG block (c:);
+lines without one are skipped and counted.
+*/
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// one line of a recording
+type recRecord struct {
+	Time     time.Time
+	Stamp    string // timestamp as written
+	Source   string
+	Sentence string // with its TAG block in front if it was recorded with one
+}
+
+type recReader struct {
+	name   string
+	f      *os.File
+	csv    *csv.Reader
+	column int // which column has the sentence
+	srcCol int // which column has the source, -1 if none
+
+	lines   *bufio.Scanner // .nmea file, instead of csv
+	untimed int            // .nmea lines skipped for having no TAG block time
+
+	base int64 // byte offset the csv reader started at, see seek
+	read int64 // .nmea bytes read
+}
+
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+func openRecording(name string) (*recReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	var in io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		// compressed by retention
+		if in, err = gzip.NewReader(bufio.NewReaderSize(f, 65536)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	rr := &recReader{name: name, f: f, column: 3, srcCol: 2}
+	if strings.HasSuffix(strings.TrimSuffix(name, ".gz"), ".nmea") {
+		rr.scanLines(in)
+	} else {
+		rr.csv = recordCSV(in)
+	}
+	return rr, nil
+}
+
+func recordCSV(in io.Reader) *csv.Reader {
+	r := csv.NewReader(bufio.NewReaderSize(in, 65536))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r
+}
+
+func (rr *recReader) scanLines(in io.Reader) {
+	// .nmea lines, counting the bytes for offset
+	rr.lines = bufio.NewScanner(bufio.NewReaderSize(in, 65536))
+	rr.lines.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		n, line, err := bufio.ScanLines(data, atEOF)
+		rr.read += int64(n)
+		return n, line, err
+	})
+}
+
+func (rr *recReader) offset() int64 {
+	// where the next record's line starts in the file, or a comment or header
+	// line before it; in the uncompressed data of a .gz file
+	if rr.lines != nil {
+		return rr.read
+	}
+	return rr.base + rr.csv.InputOffset()
+}
+
+func (rr *recReader) seek(offset int64) error {
+	// carry on reading from offset, the start of a line, in an uncompressed file
+	if _, err := rr.f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if rr.lines != nil {
+		rr.read = offset
+		rr.scanLines(rr.f)
+		return nil
+	}
+	rr.base, rr.csv = offset, recordCSV(rr.f)
+	return nil
+}
+
+func (rr *recReader) Close() error {
+	return rr.f.Close()
+}
+
+func (rr *recReader) Next() (*recRecord, error) {
+	// next record, io.EOF at the end, bad lines skipped
+	if rr.lines != nil {
+		return rr.nextLine()
+	}
+	for {
+		fields, err := rr.csv.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch fields[0] {
+		case "timestamp":
+			// LogAIS header, timestamp,message for -invalid files
+			rr.column, rr.srcCol = 3, 2
+			if len(fields) == 2 {
+				rr.column, rr.srcCol = 1, -1
+			}
+			continue
+		case "received_at":
+			rr.column, rr.srcCol = 4, 3
+			continue
+		}
+		if len(fields) <= rr.column {
+			continue
+		}
+		t, ok := parseStamp(fields[0])
+		if !ok {
+			continue
+		}
+		rec := &recRecord{Time: t, Stamp: fields[0], Sentence: strings.TrimSpace(fields[rr.column])}
+		if rr.srcCol >= 0 {
+			rec.Source = fields[rr.srcCol]
+		}
+		return rec, nil
+	}
+}
+
+func (rr *recReader) nextLine() (*recRecord, error) {
+	// next sentence of a .nmea file with its TAG block time
+	for rr.lines.Scan() {
+		line := strings.TrimSpace(rr.lines.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		raw, _ := splitTag(line)
+		tag := parseTag(raw)
+		if tag == nil || tag.Time.IsZero() {
+			rr.untimed++
+			continue
+		}
+		return &recRecord{Time: tag.Time, Stamp: tag.Time.Format(timeLayout), Source: tag.Source, Sentence: line}, nil
+	}
+	if err := rr.lines.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,107 @@
+//go:build !edge
+
+package logais
+
+/*
+Relaying received data to other programs, eg OpenCPN on the bridge and a shore
+aggregator, so a separate forwarder doesn't have to be kept in step with the config:
+ relay=host:port[,host:port...]	send every datagram received to these UDP addresses too
+Datagrams are sent as received, before checksum policy or filters, or with seq
+put back together with their numbered TAG blocks. Feeds and merged streams send
+what they pass to the stream, one line per sentence.
+Addresses are looked up when the stream starts and again every 10 minutes, send
+errors are counted in the stream's stats and the first after a quiet spell is logged.
+*/
+
+import (
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+const relayResolve = 10 * time.Minute
+
+type relay struct {
+	hosts    []string
+	addrs    []*net.UDPAddr
+	conn     *net.UDPConn
+	resolved time.Time
+	failing  bool // last send failed, so the next failure isn't logged
+}
+
+func (st *Stream) relay(packet []byte, logit *slog.Logger) {
+	// called from the stream's goroutine only
+	hosts := st.opts().Relay
+	if len(hosts) == 0 {
+		return
+	}
+	r := st.relays
+	if r == nil || !slices.Equal(r.hosts, hosts) {
+		if r != nil && r.conn != nil {
+			r.conn.Close()
+		}
+		conn, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			logit.Error("relay", "err", err)
+			return
+		}
+		r = &relay{hosts: hosts, conn: conn}
+		st.relays = r
+	}
+	if time.Since(r.resolved) > relayResolve {
+		r.addrs = r.addrs[:0]
+		for _, h := range r.hosts {
+			addr, err := net.ResolveUDPAddr("udp", h)
+			if err != nil {
+				logit.Error("relay", "err", err)
+				continue
+			}
+			r.addrs = append(r.addrs, addr)
+		}
+		r.resolved = time.Now()
+	}
+	failed := false
+	for _, addr := range r.addrs {
+		if _, err := r.conn.WriteToUDP(packet, addr); err != nil {
+			st.stats.RelayErrors.Add(1)
+			if !r.failing {
+				logit.Error("relay failed", "addr", addr, "err", err)
+			}
+			failed = true
+		}
+	}
+	r.failing = failed
+}
+
+func tagRaw(t *tagBlock) string {
+	if t == nil {
+		return ""
+	}
+	return t.Raw
+}
+
+func sentenceLines(sentences []rawSentence) []byte {
+	// a datagram put back together from its sentences, eg after numbering them
+	var b strings.Builder
+	for _, rs := range sentences {
+		if rs.Tag != "" {
+			b.WriteString("\\" + rs.Tag + "\\")
+		}
+		b.WriteString(rs.Text + rs.Trailer + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+func recordLines(group []*record) []byte {
+	// sentences as received, with their TAG blocks
+	var b strings.Builder
+	for _, rec := range group {
+		if rec.Tag != nil {
+			b.WriteString("\\" + rec.Tag.Raw + "\\")
+		}
+		b.WriteString(rec.Sentence + "\r\n")
+	}
+	return []byte(b.String())
+}
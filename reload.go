@@ -0,0 +1,231 @@
+//go:build !edge
+
+package logais
+
+/*
+Config reload without restarting, on SIGHUP (Reload) or, with -watch (for Windows, which
+has no SIGHUP), when the config file changes. The file is read again and
+ - new streams start and removed ones stop, closing their files,
+ - streams whose name, feed, merge, aggregate, relay or tcp-serve changed are
+   restarted, losing only what arrives on that port in between,
+ - other option changes, eg filters, apply to the running stream straight away,
+ - streams stopped through the control API start again,
+ - profiles, the schedule, the restart time, the station ID, vessel-lost, api-token, http-user, http-token, low-disk, ntp and log-rotate are replaced, the active profile stays if it still exists.
+Station, coldstore, peer, node, syslog and http-tls lines are only read at startup, a change to
+them is logged. A config file with errors is logged and the running config kept.
+*/
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/logais/config"
+)
+
+const (
+	streamStopWait = 10 * time.Second // how long a reload waits for a stream to stop
+	watchInterval  = 5 * time.Second  // how often -watch checks the config file
+)
+
+// options a running stream can't change, it is restarted instead
+var restartOptions = []string{"aisstream", "bbox", "aisstream-url", "tcp", "tcp-cert", "tcp-key", "tcp-ca", "feed", "ingest", "merge", "aggregate", "relay", "tcp-serve", "serve-cert", "serve-key", "serve-ca", "recv-buffer", "socket-buffer", "sockets", "sink"}
+
+var (
+	Running    sync.WaitGroup // stream goroutines
+	reloadMu   sync.Mutex
+	scheduling bool   // runSchedule has been started
+	confPath   string // the config file Start read, for Reload
+)
+
+func runStream(st *Stream) {
+	logStreams.Store(st.Port, st)
+	Running.Go(func() {
+		supervise(st)
+	})
+}
+
+func (st *Stream) stopping() bool {
+	select {
+	case <-st.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (st *Stream) stop() {
+	// ask the stream to stop and wait until its files are closed
+	if st.stopping() {
+		// already, eg through the control API
+		return
+	}
+	close(st.quit)
+	select {
+	case <-st.stopped:
+		Logit.Info("stream stopped", append([]any{"port", st.Port}, st.stats.attrs()...)...)
+	case <-time.After(streamStopWait):
+		Logit.Warn("stream hasn't stopped", "port", st.Port, "after", streamStopWait)
+	}
+}
+
+func needsRestart(old *Stream, next *Stream) bool {
+	if old.Name != next.Name {
+		return true
+	}
+	for _, k := range restartOptions {
+		ov, ook := old.Opts[k]
+		nv, nok := next.Opts[k]
+		if ook != nok || ov != nv {
+			return true
+		}
+	}
+	return false
+}
+
+func reloadConfig(path string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	next, err := readConfig(path)
+	if err == nil {
+		err = checkMerges(next.Streams)
+	}
+	if err == nil {
+		err = checkHTTPAuth(apiAddr, next)
+	}
+	if err != nil {
+		Logit.Error("config reload failed, keeping the running config", "path", path, "err", err)
+		Events.publish(EventAlert, "", "config reload failed: "+err.Error())
+		return
+	}
+
+	running := make(map[string]*Stream)
+	for _, st := range Conf.Streams {
+		running[st.Port] = st
+	}
+	var streams, start, stop []*Stream
+	var restarted, changed []string
+	newOpts := make(map[*Stream]map[string]string)
+	for _, ns := range next.Streams {
+		st, ok := running[ns.Port]
+		delete(running, ns.Port)
+		switch {
+		case !ok:
+			start = append(start, ns)
+			streams = append(streams, ns)
+		case needsRestart(st, ns) || st.halted.Load():
+			restarted = append(restarted, st.Port)
+			stop = append(stop, st)
+			start = append(start, ns)
+			streams = append(streams, ns)
+		default:
+			if !maps.Equal(st.Opts, ns.Opts) {
+				newOpts[st] = ns.Opts
+				changed = append(changed, st.Port)
+			}
+			streams = append(streams, st)
+		}
+	}
+	var removed, added []*Stream
+	for _, st := range Conf.Streams {
+		if running[st.Port] != nil {
+			removed = append(removed, st)
+		}
+	}
+	for _, st := range append(stop, removed...) {
+		st.stop()
+	}
+	for _, st := range start {
+		if !slices.Contains(restarted, st.Port) {
+			added = append(added, st)
+		}
+	}
+
+	if next.Peer != Conf.Peer || !slices.Equal(next.Nodes, Conf.Nodes) || !equalPtr(next.Station, Conf.Station) || !equalPtr(next.Cold, Conf.Cold) || !equalPtr(next.Syslog, Conf.Syslog) || !next.HTTPTLS.Same(Conf.HTTPTLS) {
+		Logit.Warn("config reload: station, coldstore, peer, node, syslog and http-tls changes need a restart")
+	}
+	profMutex.Lock()
+	for st, opts := range newOpts {
+		st.Opts = opts
+	}
+	c := *next.Config
+	c.Station, c.Cold, c.Peer, c.Nodes, c.Syslog, c.HTTPTLS = Conf.Station, Conf.Cold, Conf.Peer, Conf.Nodes, Conf.Syslog, Conf.HTTPTLS
+	Conf = &Config{Config: &c, Streams: streams}
+	profile := ActiveProf
+	profMutex.Unlock()
+	if _, ok := Conf.Profiles[profile]; !ok && profile != DefaultProfile {
+		Logit.Warn("config reload: active profile is gone, back to default", "profile", profile)
+		profile = DefaultProfile
+	}
+	setProfile(profile)
+	linkMerges(streams)
+	if len(Conf.Schedule) > 0 && !scheduling {
+		scheduling = true
+		go runSchedule(false)
+	}
+	for _, st := range start {
+		runStream(st)
+	}
+
+	var parts []string
+	for _, p := range [][2]string{{"started ", ports(added)}, {"stopped ", ports(removed)}, {"restarted ", strings.Join(restarted, ",")}, {"options changed ", strings.Join(changed, ",")}} {
+		if p[1] != "" {
+			parts = append(parts, p[0]+p[1])
+		}
+	}
+	text := strings.Join(parts, ", ")
+	if text == "" {
+		text = "no stream changes"
+	}
+	Logit.Info("config reloaded: "+text, "path", path)
+	for _, f := range config.Lint(next.Config) {
+		f.Log(Logit)
+	}
+	Events.publish(EventReloaded, "", text)
+}
+
+func ports(streams []*Stream) string {
+	var p []string
+	for _, st := range streams {
+		p = append(p, st.Port)
+	}
+	return strings.Join(p, ",")
+}
+
+func equalPtr[T comparable](a *T, b *T) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// Reload reads the config file again and applies it to the recorder Start
+// started, as SIGHUP does logais. A config with errors is logged and the
+// running one kept.
+func Reload() {
+	reloadConfig(confPath)
+}
+
+func watchConfig(path string, poll bool) {
+	// reload when the file changes, if poll
+	if !poll {
+		return
+	}
+	modTime := func() time.Time {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+	last := modTime()
+	for range time.Tick(watchInterval) {
+		t := modTime()
+		if t.Equal(last) || t.IsZero() {
+			continue
+		}
+		last = t
+		Logit.Info("config changed, reloading", "path", path)
+		reloadConfig(path)
+	}
+}
@@ -0,0 +1,167 @@
+//go:build !edge
+
+package logais
+
+/*
+checksum=repair, for studying marginal reception: a sentence with a bad
+checksum is tried with every single bit error that would explain it, in the
+checksum digits or in the sentence. Candidates must still make sense: the same
+fields, an AIS payload that decodes with its position in range, and when the
+vessel sent a position report in the last trackAge, the same vessel within reach
+of that position at maxKnots. If exactly one candidate is left it is recorded,
+and the received and repaired sentences go to -repaired.csv; otherwise the
+sentence is quarantined in -invalid.csv as with checksum=file. An XOR checksum
+can't say where a bit went wrong, so many errors stay unrepaired.
+*/
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+const (
+	repairedHeader = "timestamp,received,repaired\r\n"
+	trackAge       = 10 * time.Minute
+	maxKnots       = 60.0 // fastest a vessel is taken to move, HSC included
+)
+
+type trackPoint struct {
+	pos ais.Coord
+	at  time.Time
+}
+
+type repairer struct {
+	tracks map[uint32]trackPoint // last position of each vessel
+}
+
+func newRepairer() *repairer {
+	return &repairer{tracks: make(map[uint32]trackPoint)}
+}
+
+func (r *repairer) seen(sentence string, now time.Time) {
+	// good position reports keep the tracks
+	p, ok := decodeSingle(sentence)
+	if !ok {
+		return
+	}
+	if l, ok := p.(ais.Located); ok && l.Location().HasPosition() {
+		r.tracks[p.Base().MMSI] = trackPoint{pos: l.Location(), at: now}
+	}
+	if len(r.tracks) > 10000 {
+		for mmsi, t := range r.tracks {
+			if now.Sub(t.at) > trackAge {
+				delete(r.tracks, mmsi)
+			}
+		}
+	}
+}
+
+func (r *repairer) repair(sentence string, now time.Time) (string, bool) {
+	// the one sensible sentence a single bit error away, if there is one
+	body, sum, ok := strings.Cut(sentence, "*")
+	if !ok || len(body) < 2 || len(sum) < 2 {
+		return "", false
+	}
+	want, err := strconv.ParseUint(sum[:2], 16, 8)
+	if err != nil {
+		return "", false
+	}
+	var x byte
+	for i := 1; i < len(body); i++ {
+		x ^= body[i]
+	}
+	var found []string
+	// a bit wrong in one of the checksum digits
+	for i := range 2 {
+		for b := range 7 {
+			digits := []byte(sum[:2])
+			digits[i] ^= 1 << b
+			if v, err := strconv.ParseUint(string(digits), 16, 8); err == nil && byte(v) == x && r.sensible(body, body, now) {
+				found = append(found, withChecksum(body))
+			}
+		}
+	}
+	// a bit wrong in the sentence, flipping it back gives the checksum received
+	if diff := x ^ byte(want); bits.OnesCount8(diff) == 1 {
+		for i := 1; i < len(body); i++ {
+			fixed := body[:i] + string(body[i]^diff) + body[i+1:]
+			if r.sensible(body, fixed, now) {
+				found = append(found, fixed+"*"+sum)
+			}
+		}
+	}
+	if len(found) != 1 {
+		return "", false
+	}
+	return found[0], true
+}
+
+func (r *repairer) sensible(received string, body string, now time.Time) bool {
+	// printable, the same fields, and for AIS a payload that decodes and fits the vessel's track
+	for i := 1; i < len(body); i++ {
+		if c := body[i]; c < 0x20 || c > 0x7e || c == '*' || c == '!' || c == '$' || c == '\\' {
+			return false
+		}
+	}
+	if strings.Count(body, ",") != strings.Count(received, ",") {
+		return false
+	}
+	if !isAIS(body, nil) {
+		return true
+	}
+	v, ok := parseVDM(body + "*00")
+	if !ok || v.Fill < 0 || v.Fill > 5 {
+		return false
+	}
+	if v.Total > 1 {
+		// can't decode a part on its own, the payload characters at least
+		return armoured(v.Payload)
+	}
+	msg, err := ais.Decode(v.Payload, v.Fill)
+	if err != nil {
+		return false
+	}
+	l, ok := msg.(ais.Located)
+	if !ok {
+		return true
+	}
+	c := l.Location()
+	if !c.HasPosition() {
+		return c.Lon == ais.NoLon && c.Lat == ais.NoLat
+	}
+	if rm, ok := decodeSingle(received + "*00"); ok && rm.Base().MMSI != msg.Base().MMSI {
+		// a vessel being tracked is more likely than one that isn't
+		if _, tracked := r.tracks[rm.Base().MMSI]; tracked {
+			return false
+		}
+	}
+	t, ok := r.tracks[msg.Base().MMSI]
+	if !ok || now.Sub(t.at) > trackAge {
+		return true
+	}
+	dist, _ := rangeBearing(t.pos.Lat, t.pos.Lon, c.Lat, c.Lon)
+	return dist <= 0.1+maxKnots*now.Sub(t.at).Hours()
+}
+
+func decodeSingle(sentence string) (ais.Message, bool) {
+	// single part AIS sentence decoded
+	v, ok := parseVDM(sentence)
+	if !ok || v.Total != 1 {
+		return nil, false
+	}
+	msg, err := ais.Decode(v.Payload, v.Fill)
+	return msg, err == nil
+}
+
+func armoured(payload string) bool {
+	for i := 0; i < len(payload); i++ {
+		if c := payload[i]; c < '0' || c > 'w' || c > 'W' && c < '`' {
+			return false
+		}
+	}
+	return true
+}
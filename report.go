@@ -0,0 +1,260 @@
+//go:build !edge
+
+package logais
+
+/*
+logais stats: message counts from recordings, for coverage reports.
+ logais stats [-stream port] [-csv|-json] [-top n] file|folder|yyyy-mm-dd|yyyy-mm ...
+A day or month reads the main daily files of every stream (or the -stream one)
+from the data and cold storage folders, a folder every main daily file under it.
+Reported: messages (multipart ones counted once) and other sentences, unique
+vessels, messages per UTC hour, per message type and per MMSI, and the peak
+messages in a second and in a minute with when they were. The table lists the
+-top busiest vessels, -csv (section,key,count rows) and -json list them all.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+type ratePeak struct {
+	Count int       `json:"count"`
+	At    time.Time `json:"at"`
+}
+
+type recStats struct {
+	Files      int            `json:"files"`
+	First      time.Time      `json:"first"`
+	Last       time.Time      `json:"last"`
+	Sentences  int            `json:"sentences"`
+	Messages   int            `json:"messages"` // AIS messages, multipart ones once
+	Other      int            `json:"other"`    // non-AIS sentences
+	Vessels    int            `json:"vessels"`
+	PeakSecond ratePeak       `json:"peak_second"`
+	PeakMinute ratePeak       `json:"peak_minute"`
+	ByHour     map[string]int `json:"by_hour"` // yyyy-mm-ddThh UTC
+	ByType     map[int]int    `json:"by_type"`
+	ByMMSI     map[uint32]int `json:"by_mmsi"`
+
+	second, minute ratePeak // counting now
+	untimed        int
+}
+
+func (s *recStats) count(rec *recRecord) {
+	// records come in timestamp order
+	if s.First.IsZero() {
+		s.First = rec.Time
+	}
+	s.Last = rec.Time
+	s.Sentences++
+	_, bare := splitTag(rec.Sentence)
+	v, ok := parseVDM(bare)
+	if !ok {
+		s.Other++
+		return
+	}
+	if v.Part != 1 {
+		return
+	}
+	s.Messages++
+	s.ByHour[rec.Time.UTC().Format("2006-01-02T15")]++
+	s.ByType[ais.MessageType(v.Payload)]++
+	if mmsi, ok := ais.MMSI(v.Payload); ok {
+		s.ByMMSI[mmsi]++
+	}
+	s.second.add(rec.Time.Truncate(time.Second), &s.PeakSecond)
+	s.minute.add(rec.Time.Truncate(time.Minute), &s.PeakMinute)
+}
+
+func (p *ratePeak) add(at time.Time, peak *ratePeak) {
+	// one more message in the period starting at
+	if !at.Equal(p.At) {
+		*p = ratePeak{At: at}
+	}
+	if p.Count++; p.Count > peak.Count {
+		*peak = *p
+	}
+}
+
+func mainRecording(name string) bool {
+	// a main daily file, not a side file
+	_, _, ok := dailyFileDay(name)
+	f := strings.TrimSuffix(fileFormat(name), ".gz")
+	return ok && (f == "csv" || f == "nmea")
+}
+
+func statsFiles(args []string, stream string) ([]string, error) {
+	// the recordings the arguments name
+	var files []string
+	addDir := func(dir string) error {
+		return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !mainRecording(d.Name()) {
+				return err
+			}
+			if _, port, _ := dailyFileDay(d.Name()); stream == "" || port == stream {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	for _, arg := range args {
+		var days []time.Time
+		if day, err := time.Parse(time.DateOnly, arg); err == nil {
+			days = append(days, day)
+		} else if month, err := time.Parse("2006-01", arg); err == nil {
+			for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+				days = append(days, day)
+			}
+		} else if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+			if err := addDir(arg); err != nil {
+				return nil, err
+			}
+			continue
+		} else {
+			files = append(files, findRecording(arg))
+			continue
+		}
+		for _, day := range days {
+			if dir := dayFolder(day); dirExists(dir) {
+				if err := addDir(dir); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+func dirExists(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir()
+}
+
+func readStats(files []string) (*recStats, error) {
+	s := &recStats{Files: len(files), ByHour: make(map[string]int), ByType: make(map[int]int), ByMMSI: make(map[uint32]int)}
+	untimed, err := timeOrdered(files, time.Time{}, func(_ *recReader, rec *recRecord) error {
+		s.count(rec)
+		return nil
+	})
+	s.Vessels, s.untimed = len(s.ByMMSI), untimed
+	return s, err
+}
+
+func sortedKeys[K int | uint32 | string](m map[K]int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func (s *recStats) writeCSV() error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"section", "key", "count"})
+	for _, row := range [][]string{
+		{"total", "files", strconv.Itoa(s.Files)},
+		{"total", "sentences", strconv.Itoa(s.Sentences)},
+		{"total", "messages", strconv.Itoa(s.Messages)},
+		{"total", "other", strconv.Itoa(s.Other)},
+		{"total", "vessels", strconv.Itoa(s.Vessels)},
+		{"peak_second", s.PeakSecond.At.Format(time.RFC3339), strconv.Itoa(s.PeakSecond.Count)},
+		{"peak_minute", s.PeakMinute.At.Format(time.RFC3339), strconv.Itoa(s.PeakMinute.Count)},
+	} {
+		w.Write(row)
+	}
+	for _, h := range sortedKeys(s.ByHour) {
+		w.Write([]string{"hour", h, strconv.Itoa(s.ByHour[h])})
+	}
+	for _, t := range sortedKeys(s.ByType) {
+		w.Write([]string{"type", strconv.Itoa(t), strconv.Itoa(s.ByType[t])})
+	}
+	for _, m := range sortedKeys(s.ByMMSI) {
+		w.Write([]string{"mmsi", fmt.Sprintf("%09d", m), strconv.Itoa(s.ByMMSI[m])})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (s *recStats) print(top int) {
+	fmt.Printf("%d files, %s to %s\n", s.Files, s.First.Format(time.RFC3339), s.Last.Format(time.RFC3339))
+	fmt.Printf("%d sentences: %d AIS messages, %d other\n", s.Sentences, s.Messages, s.Other)
+	fmt.Printf("%d vessels\n", s.Vessels)
+	fmt.Printf("peak %d messages in a second at %s, %d in a minute at %s\n\n",
+		s.PeakSecond.Count, s.PeakSecond.At.Format(time.RFC3339), s.PeakMinute.Count, s.PeakMinute.At.Format(time.RFC3339))
+	fmt.Printf("%-14s %10s\n", "hour (UTC)", "messages")
+	for _, h := range sortedKeys(s.ByHour) {
+		fmt.Printf("%-14s %10d\n", h, s.ByHour[h])
+	}
+	fmt.Printf("\n%-14s %10s\n", "type", "messages")
+	for _, t := range sortedKeys(s.ByType) {
+		fmt.Printf("%-14d %10d\n", t, s.ByType[t])
+	}
+	mmsis := sortedKeys(s.ByMMSI)
+	sort.SliceStable(mmsis, func(i, j int) bool { return s.ByMMSI[mmsis[i]] > s.ByMMSI[mmsis[j]] })
+	if len(mmsis) > top {
+		mmsis = mmsis[:top]
+	}
+	fmt.Printf("\n%-14s %10s\n", "mmsi", "messages")
+	for _, m := range mmsis {
+		fmt.Printf("%09d      %10d\n", m, s.ByMMSI[m])
+	}
+}
+
+func statsCmd(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	stream := fs.String("stream", "", "only this stream's files, by port, for days and folders")
+	asCSV := fs.Bool("csv", false, "print section,key,count rows")
+	asJSON := fs.Bool("json", false, "print JSON")
+	top := fs.Int("top", 20, "busiest vessels listed in the table")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: logais stats [options] file|folder|yyyy-mm-dd|yyyy-mm ...\n")
+		fs.PrintDefaults()
+	}
+	args = parseInterleaved(fs, args)
+	if len(args) == 0 || *asCSV && *asJSON {
+		fs.Usage()
+		return 2
+	}
+	files, err := statsFiles(args, *stream)
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("no recordings found for %s", strings.Join(args, " "))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	s, err := readStats(files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if s.untimed > 0 {
+		fmt.Fprintf(os.Stderr, "%d lines without a TAG block time left out\n", s.untimed)
+	}
+	switch {
+	case *asJSON:
+		b, _ := json.MarshalIndent(s, "", " ")
+		fmt.Println(string(b))
+	case *asCSV:
+		if err := s.writeCSV(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		s.print(*top)
+	}
+	return 0
+}
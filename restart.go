@@ -0,0 +1,121 @@
+//go:build !edge
+
+package logais
+
+/*
+Scheduled self-restart, for recorders on platforms that misbehave after running
+for weeks, instead of a cron job killing the program mid-write:
+ restart <tab> hh:mm	every day at hh:mm UTC
+ restart <tab> sun 03:00	once a week
+At that time the streams stop as on Ctrl-C (files flushed, "# Stopped" lines),
+the active profile and the seq numbers are saved to restart.json in the data
+folder, and the program starts itself again with the same command line. On
+Linux, macOS and the BSDs it stays the same process (exec), so systemd, launchd
+and daemon(8) don't notice; on Windows a new process is started. If that fails
+the program exits with an error so a service manager can start it.
+The new process reads restart.json if it is at most restartStateAge old and
+removes it. The restart line can be changed by a config reload.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const restartStateAge = 10 * time.Minute
+
+var restarting atomic.Bool // Wait leaves the exit to restartNow
+
+// what a restart carries over
+type restartState struct {
+	Time    time.Time         `json:"time"`
+	Profile string            `json:"profile"`
+	Seq     map[string]uint64 `json:"seq,omitempty"` // last sentence number by port
+}
+
+func restartDue(r *RestartSpec, now time.Time) bool {
+	return now.Hour()*60+now.Minute() == r.At && (r.Day < 0 || int(now.Weekday()) == r.Day)
+}
+
+func keepRestarting() {
+	// check every minute, the restart line can come and go with reloads
+	for {
+		time.Sleep(time.Minute)
+		profMutex.Lock()
+		r := Conf.Restart
+		profMutex.Unlock()
+		// not again within the minute it started in
+		if r != nil && restartDue(r, time.Now().UTC()) && time.Since(started) > 2*time.Minute {
+			restartNow()
+		}
+	}
+}
+
+func restartNow() {
+	Logit.Info("scheduled restart, stopping all streams")
+	restarting.Store(true)
+	sdNotify("STATUS=scheduled restart")
+	if !stopStreams() {
+		Logit.Warn("streams still running, restarting anyway", "after", shutdownWait)
+	}
+	closeManifest("restart")
+	state := restartState{Time: time.Now().UTC(), Profile: ActiveProf, Seq: make(map[string]uint64)}
+	for _, st := range Conf.Streams {
+		if st.seq > 0 {
+			state.Seq[st.Port] = st.seq
+		}
+	}
+	if b, err := json.Marshal(state); err != nil || os.WriteFile(Datapath+"restart.json", b, 0664) != nil {
+		Logit.Error("saving restart.json, the profile and seq numbers start afresh")
+	}
+	if err := Vessels.save(); err != nil {
+		Logit.Error("saving vessel registry", "err", err)
+	}
+	if Catalog != nil {
+		Catalog.Close()
+	}
+	Logit.Info("restarting", "command", strings.Join(os.Args, " "))
+	closeLog()
+	err := reexec()
+	// still here, leave it to the service manager
+	fmt.Fprintf(os.Stderr, "LogAIS restart failed: %v\n", err)
+	os.Exit(1)
+}
+
+func reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		cmd := exec.Command(exe, os.Args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err = cmd.Start(); err != nil {
+			return err
+		}
+		os.Exit(0)
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+func loadRestartState() *restartState {
+	// left by a scheduled restart just now, nil if not
+	path := Datapath + "restart.json"
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	os.Remove(path)
+	var state restartState
+	if err = json.Unmarshal(b, &state); err != nil || time.Since(state.Time) > restartStateAge {
+		return nil
+	}
+	return &state
+}
@@ -0,0 +1,251 @@
+//go:build !edge
+
+package logais
+
+/*
+Retention, per stream options:
+ compress=days	gzip the stream's daily files once they are this many days old
+ retain=days	delete them once they are this many days old
+so eg compress=30 retain=365 keeps a month raw and a year in all. Run by the
+logger at startup and just after each UTC midnight over the data folder and
+cold storage. Compressed files keep their name with .gz added, and play,
+export, purge, du and the catalog read them as they are.
+Files of days under a legal hold, or with a vessel under one (see holds.go),
+are neither compressed nor deleted. Each file deleted is logged and written to
+audit.log; the run manifest of a day stays after its files have gone.
+ logais retention [-n]
+runs it now, -n lists what would be done without doing it.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type retentionStep struct {
+	Path   string
+	Delete bool // compress otherwise
+}
+
+func retentionPlan(streams []*Stream, now time.Time) []retentionStep {
+	// what each stream's compress and retain options ask for, oldest first
+	rules := make(map[string]*Options)
+	for _, st := range streams {
+		if o := st.opts(); o.Compress > 0 || o.Retain > 0 {
+			rules[st.Port] = o
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	held := heldMMSIs()
+	var steps []retentionStep
+	for _, root := range archiveRoots() {
+		dirs, _ := filepath.Glob(filepath.Join(root, "[0-9][0-9][0-9][0-9]", "[0-9][0-9]", "[0-9][0-9]"))
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			// the files of each stream, checked for holds together
+			files := make(map[string][]string)
+			var ports []string
+			for _, e := range entries {
+				_, port, ok := dailyFileDay(e.Name())
+				if !ok || e.IsDir() || rules[port] == nil {
+					continue
+				}
+				if files[port] == nil {
+					ports = append(ports, port)
+				}
+				files[port] = append(files[port], filepath.Join(dir, e.Name()))
+			}
+			for _, port := range ports {
+				day, _, _ := dailyFileDay(filepath.Base(files[port][0]))
+				o := rules[port]
+				remove := o.Retain > 0 && day.Before(today.AddDate(0, 0, -o.Retain))
+				compress := o.Compress > 0 && day.Before(today.AddDate(0, 0, -o.Compress))
+				if !remove && !compress || dayHeld(day, port) || holdsVessel(files[port], held) {
+					continue
+				}
+				for _, path := range files[port] {
+					if remove || !strings.HasSuffix(path, ".gz") {
+						steps = append(steps, retentionStep{Path: path, Delete: remove})
+					}
+				}
+			}
+		}
+	}
+	return steps
+}
+
+func runRetention(steps []retentionStep, cat catalogStore, logit *slog.Logger) (int, int, error) {
+	// returns the numbers of files compressed and deleted, each deletion is logged
+	compressed, deleted := 0, 0
+	for _, s := range steps {
+		if !s.Delete {
+			if err := compressFile(s.Path); err != nil {
+				return compressed, deleted, fmt.Errorf("compressing %s: %v", s.Path, err)
+			}
+			compressed++
+			if cat != nil {
+				if e, err := describeFile(s.Path + ".gz"); err == nil {
+					cat.remove(s.Path)
+					cat.put(e)
+				}
+			}
+			continue
+		}
+		if err := os.Remove(s.Path); err != nil {
+			return compressed, deleted, err
+		}
+		deleted++
+		logit.Info("retention: deleted", "file", s.Path)
+		if err := auditLog("retention: deleted " + s.Path); err != nil {
+			logit.Error("audit log", "err", err)
+		}
+		if cat != nil {
+			cat.remove(s.Path)
+		}
+		// the day folder too once nothing is left in it
+		os.Remove(filepath.Dir(s.Path))
+	}
+	return compressed, deleted, nil
+}
+
+func compressFile(path string) error {
+	// path.gz with the same modification time, then path goes
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz.tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	zw, _ := gzip.NewWriterLevel(out, gzip.BestCompression)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = info.ModTime()
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		os.Chtimes(path+".gz.tmp", info.ModTime(), info.ModTime())
+		err = os.Rename(path+".gz.tmp", path+".gz")
+	}
+	if err != nil {
+		os.Remove(path + ".gz.tmp")
+		return err
+	}
+	return os.Remove(path)
+}
+
+func gunzipBytes(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+func gzipBytes(b []byte, name string) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Name = name
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func holdsVessel(files []string, held map[uint32]bool) bool {
+	// files recording a vessel under hold, of any kind purge reads; unreadable ones count
+	if len(held) == 0 {
+		return false
+	}
+	for _, f := range files {
+		if !purgeKinds[filepath.Ext(strings.TrimSuffix(f, ".gz"))] {
+			continue
+		}
+		content, err := os.ReadFile(f)
+		if err == nil && strings.HasSuffix(f, ".gz") {
+			content, err = gunzipBytes(content)
+		}
+		if err != nil {
+			return true
+		}
+		if _, n, err := purgeContent(f, content, held, false); err != nil || n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func keepRetention() {
+	// at start, then just after each UTC midnight, when yesterday's files are finished
+	for {
+		n, d, err := runRetention(retentionPlan(currentConfig().Streams, time.Now()), Catalog, Logit)
+		if err != nil {
+			Logit.Error("retention", "err", err)
+		}
+		if n+d > 0 {
+			Logit.Info("retention", "compressed", n, "deleted", d)
+		}
+		now := time.Now().UTC()
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 10, 0, 0, time.UTC)
+		time.Sleep(next.Sub(now))
+	}
+}
+
+func retentionCmd(args []string) int {
+	fset := flag.NewFlagSet("retention", flag.ExitOnError)
+	dryRun := fset.Bool("n", false, "only list what would be compressed and deleted")
+	fset.Parse(args)
+	path := configPath()
+	conf, err := readConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	steps := retentionPlan(conf.Streams, time.Now())
+	if *dryRun {
+		for _, s := range steps {
+			action := "compress"
+			if s.Delete {
+				action = "delete"
+			}
+			fmt.Printf("%s\t%s\n", action, s.Path)
+		}
+		fmt.Printf("%d files, nothing changed (-n)\n", len(steps))
+		return 0
+	}
+	cat, err := openCatalog()
+	if err == nil {
+		defer cat.Close()
+	}
+	n, d, err := runRetention(steps, cat, slog.New(&textHandler{w: os.Stdout, mu: new(sync.Mutex), level: LogLevel}))
+	fmt.Printf("%d files compressed, %d deleted\n", n, d)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+//go:build !edge
+
+package logais
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/logais/config"
+)
+
+func TestRetentionHolds(t *testing.T) {
+	// files of the output presets with a held vessel are kept like CSV ones
+	old := Datapath
+	Datapath = t.TempDir() + string(os.PathSeparator)
+	t.Cleanup(func() { Datapath = old })
+	if err := saveHolds([]Hold{{ID: 1, MMSI: 366053209, Reason: "inquiry"}}); err != nil {
+		t.Fatal(err)
+	}
+	const (
+		held  = "!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*5F"
+		other = "!AIVDM,1,1,,A,13u?etPv2;0n:dDPwUM1U1Cb069D,0*24"
+	)
+	files := map[string]string{
+		"2026/01/10/20260110-10110.nmea":     withChecksum("\\s:r1,c:1768003200") + "\\" + held + "\n",
+		"2026/01/11/20260111-10110.nmea":     withChecksum("\\s:r1,c:1768089600") + "\\" + other + "\n",
+		"2026/01/12/20260112-10110.jsonl":    `{"@timestamp":"2026-01-12T00:00:00Z","sentence":"` + held + `"}` + "\n",
+		"2026/01/13/20260113-10110.nmea":     other + "\r\n" + held + "\r\n",
+		"2026/01/14/20260114-10110.geojsonl": `{"type":"Feature","properties":{"mmsi":366053209}}` + "\n",
+		"2026/01/15/20260115-10110.jsonl":    `{"@timestamp":"2026-01-15T00:00:00Z","sentence":"` + other + `"}` + "\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(Datapath, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0775)
+		if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := newStream(config.Stream{Port: "10110", Name: "A", Opts: map[string]string{"pyais-raw": "", "retain": "1"}})
+	steps := retentionPlan([]*Stream{st}, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	want := map[string]bool{
+		filepath.Join(Datapath, "2026", "01", "11", "20260111-10110.nmea"):  true,
+		filepath.Join(Datapath, "2026", "01", "15", "20260115-10110.jsonl"): true,
+	}
+	for _, s := range steps {
+		if !want[s.Path] || !s.Delete {
+			t.Errorf("retention would delete %v %s", s.Delete, s.Path)
+		}
+		delete(want, s.Path)
+	}
+	for path := range want {
+		t.Errorf("retention doesn't delete %s", path)
+	}
+}
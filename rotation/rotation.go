@@ -0,0 +1,53 @@
+// Package rotation names the daily files LogAIS writes. Each UTC day a stream
+// starts new files in the day's folder under the data folder,
+//
+//	yyyy/mm/dd/yyyymmdd-port[-suffix].ext
+//
+// eg 2026/10/16/20261016-10110.csv and 20261016-10110-quality.csv, with .gz
+// added once retention compresses them.
+package rotation
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Folder returns a day's folder, yyyy/mm/dd with the system's separators.
+func Folder(day time.Time) string {
+	return filepath.FromSlash(day.Format("2006/01/02"))
+}
+
+// Name returns a stream's file name for a day, suffix is empty for the main
+// file and ext includes its dot.
+func Name(day time.Time, port string, suffix string, ext string) string {
+	return day.Format("20060102") + "-" + port + suffix + ext
+}
+
+// Parse returns the day and port of a daily file name, ok is false if it isn't one.
+func Parse(name string) (day time.Time, port string, ok bool) {
+	name = strings.TrimSuffix(name, ".gz")
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	d, rest, ok := strings.Cut(base, "-")
+	t, err := time.Parse("20060102", d)
+	if !ok || err != nil {
+		return time.Time{}, "", false
+	}
+	port, _, _ = strings.Cut(rest, "-")
+	return t, port, true
+}
+
+// Format returns the kind of daily file from its name: the suffix without its
+// dash or else the extension without its dot, eg csv, quality, geojsonl, idx,
+// with .gz added if compressed.
+func Format(name string) string {
+	if s, ok := strings.CutSuffix(name, ".gz"); ok {
+		return Format(s) + ".gz"
+	}
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if parts := strings.SplitN(base, "-", 3); len(parts) == 3 {
+		return parts[2]
+	}
+	return ext
+}
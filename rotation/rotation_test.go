@@ -0,0 +1,44 @@
+package rotation
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNames(t *testing.T) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	if got := Folder(day); got != filepath.FromSlash("2026/10/16") {
+		t.Errorf("Folder = %q", got)
+	}
+	for _, c := range []struct {
+		suffix, ext, name, format string
+	}{
+		{"", ".csv", "20261016-10110.csv", "csv"},
+		{"-quality", ".csv", "20261016-10110-quality.csv", "quality"},
+		{"", ".geojsonl", "20261016-10110.geojsonl", "geojsonl"},
+		{"", ".nmea", "20261016-10110.nmea", "nmea"},
+	} {
+		name := Name(day, "10110", c.suffix, c.ext)
+		if name != c.name {
+			t.Errorf("Name(%q, %q) = %q, want %q", c.suffix, c.ext, name, c.name)
+		}
+		if f := Format(name); f != c.format {
+			t.Errorf("Format(%q) = %q, want %q", name, f, c.format)
+		}
+		if f := Format(name + ".gz"); f != c.format+".gz" {
+			t.Errorf("Format(%q.gz) = %q, want %q.gz", name, f, c.format)
+		}
+		for _, n := range []string{name, name + ".gz"} {
+			d, port, ok := Parse(n)
+			if !ok || !d.Equal(day) || port != "10110" {
+				t.Errorf("Parse(%q) = %v, %q, %v", n, d, port, ok)
+			}
+		}
+	}
+	for _, n := range []string{"LogAIS.log", "vessels.json", "2026-10110.csv", "20261340-10110.csv", "20261016.csv", ""} {
+		if _, _, ok := Parse(n); ok {
+			t.Errorf("Parse(%q) ok, not a daily file", n)
+		}
+	}
+}
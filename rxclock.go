@@ -0,0 +1,57 @@
+//go:build !edge
+
+package logais
+
+/*
+Receive times. Each datagram is timed as it is read, by the UDP reader (see
+pipeline.go) or the feed, not when the writer gets to it, so a busy writer
+doesn't skew the timestamps. They're carried on from the monotonic clock
+rather than read off the wall clock each time, so the system clock stepping
+back, eg NTP correcting it, can't make a stream's records go backwards: the
+wall clock is taken again whenever it's ahead, so steps forward show at once,
+while after a step back of more than rxStepWarn a warning is logged, a
+"# Clock stepped back" line written, and the stream carries on monotonically
+until its next daily file, which takes the wall clock as it is.
+Records are timed to the nanosecond inside; time-format=iso-us or epoch-us
+(see timefmt.go) write them to the microsecond.
+*/
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const rxStepWarn = time.Second // the wall clock this far behind is logged
+
+// a stream's receive times, from the wall clock when its daily file was opened
+type rxClock struct {
+	wall   time.Time // wall clock reading when anchored
+	mono   time.Time // the same reading, with the monotonic clock's
+	warned bool      // about a step back since then
+	notes  chan string
+	logit  *slog.Logger
+}
+
+func (c *rxClock) anchor(now time.Time) {
+	c.wall, c.mono, c.warned = now.Round(0), now, false
+}
+
+func (c *rxClock) at(rx time.Time) time.Time {
+	// the time of something read at rx, never before the last
+	wall := rx.Round(0)
+	t := c.wall.Add(rx.Sub(c.mono))
+	if c.mono.IsZero() || !wall.Before(t) {
+		c.anchor(rx)
+		return wall
+	}
+	if behind := t.Sub(wall); behind > rxStepWarn && !c.warned {
+		c.warned = true
+		c.logit.Warn("system clock stepped back, timestamps carry on from the monotonic clock until the next daily file", "behind", behind.Seconds())
+		select {
+		case c.notes <- "# Clock stepped back: " + strconv.FormatFloat(behind.Seconds(), 'f', 3, 64) + " s, timestamps carry on from " + t.UTC().Format(timeLayout) + "\r\n":
+		default:
+		}
+	}
+	return t
+}
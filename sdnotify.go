@@ -0,0 +1,116 @@
+//go:build !edge
+
+package logais
+
+/*
+systemd integration for Type=notify services, see the unit logais setup writes:
+ READY=1	once every stream is listening (or has given up), so systemctl start waits for it
+ WATCHDOG=1	every half WatchdogSec while every running stream still goes round its
+	loop, which it does at least every second even when nothing arrives; a stream
+	stuck, eg writing to a dead disk, stops the pings and systemd restarts LogAIS
+ STOPPING=1	on Ctrl-C or SIGTERM
+Nothing is sent when NOTIFY_SOCKET isn't set, eg not run by systemd.
+*/
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const readyWait = 30 * time.Second // longest wait for the streams before READY anyway
+
+func sdNotify(state string) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return
+	}
+	if path[0] == '@' {
+		// abstract socket
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		Logit.Error("systemd notify", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		Logit.Error("systemd notify", "err", err)
+	}
+}
+
+func watchdogInterval() time.Duration {
+	// WatchdogSec from the unit, 0 if none or meant for another process
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+func (st *Stream) done() bool {
+	select {
+	case <-st.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func liveStreams() []*Stream {
+	// streams that should be going round their loops
+	profMutex.Lock()
+	streams := Conf.Streams
+	profMutex.Unlock()
+	var live []*Stream
+	for _, st := range streams {
+		if !st.done() && !st.stopping() {
+			live = append(live, st)
+		}
+	}
+	return live
+}
+
+func notifySystemd() {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	for deadline := time.Now().Add(readyWait); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		up := true
+		for _, st := range liveStreams() {
+			up = up && st.beat.Load() != 0
+		}
+		if up {
+			break
+		}
+	}
+	sdNotify("READY=1\nSTATUS=recording " + strconv.Itoa(len(liveStreams())) + " streams")
+
+	every := watchdogInterval()
+	if every == 0 {
+		return
+	}
+	stuck := ""
+	// a loop can take a second or two when busy, don't call that stuck
+	late := max(every/2, 5*time.Second)
+	for {
+		time.Sleep(every / 2)
+		hung := ""
+		for _, st := range liveStreams() {
+			if b := st.beat.Load(); b != 0 && time.Since(time.Unix(0, b)) > late {
+				hung = st.Port
+			}
+		}
+		if hung != stuck && hung != "" {
+			Logit.Warn("stream is stuck, no systemd watchdog pings until it recovers", "port", hung)
+		}
+		if stuck = hung; hung == "" {
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
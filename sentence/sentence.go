@@ -0,0 +1,323 @@
+// Package sentence splits datagrams into NMEA 0183 sentences and reads the
+// parts of them LogAIS records by: checksums, AIVDM/AIVDO fields, NMEA 4.10
+// TAG blocks and GNSS positions, headings and times. Payloads are decoded by package ais.
+package sentence
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+var (
+	ErrNotVDM    = errors.New("not a VDM/VDO sentence")
+	ErrMultipart = errors.New("part of a multipart message")
+)
+
+// Type returns the talker and formatter, eg AIVDM.
+func Type(sentence string) string {
+	typ, _, _ := strings.Cut(sentence, ",")
+	return strings.TrimLeft(typ, "!$")
+}
+
+// IsAIS reports whether sentence is !xxVDM or !xxVDO from any talker, eg AI
+// mobile, AB/BS base station, SA satellite, or only from talkers if not nil.
+func IsAIS(sentence string, talkers map[string]bool) bool {
+	if len(sentence) < 7 || sentence[0] != '!' || sentence[6] != ',' {
+		return false
+	}
+	if f := sentence[3:6]; f != "VDM" && f != "VDO" {
+		return false
+	}
+	return talkers == nil || talkers[sentence[1:3]]
+}
+
+// IsDSC reports whether sentence is $xxDSC/$xxDSE VHF digital selective
+// calling, usually talker CD.
+func IsDSC(sentence string) bool {
+	typ := Type(sentence)
+	return strings.HasPrefix(sentence, "$") && len(typ) == 5 && (typ[2:] == "DSC" || typ[2:] == "DSE")
+}
+
+// DSCDistress reports whether a DSC sentence is a distress alert or relay,
+// format specifier or category 12.
+func DSCDistress(sentence string) bool {
+	f := Fields(sentence)
+	return len(f) > 3 && len(f[0]) >= 6 && f[0][3:6] == "DSC" && (f[1] == "12" || f[3] == "12")
+}
+
+// ChecksumOK checks the XOR of everything between the start character and the *.
+func ChecksumOK(sentence string) bool {
+	body, sum, ok := strings.Cut(sentence, "*")
+	if !ok || len(body) < 1 || len(sum) < 2 {
+		return false
+	}
+	want, err := strconv.ParseUint(sum[:2], 16, 8)
+	if err != nil {
+		return false
+	}
+	var x byte
+	for i := 1; i < len(body); i++ {
+		x ^= body[i]
+	}
+	return x == byte(want)
+}
+
+// WithChecksum returns body, from its start character, with *hh appended.
+func WithChecksum(body string) string {
+	var x byte
+	for i := 1; i < len(body); i++ {
+		x ^= body[i]
+	}
+	return fmt.Sprintf("%s*%02X", body, x)
+}
+
+// Fields returns the comma separated fields with the checksum removed, field
+// 0 is the talker and formatter.
+func Fields(sentence string) []string {
+	body, _, _ := strings.Cut(sentence, "*")
+	return strings.Split(body, ",")
+}
+
+// VDM holds the fields of a VDM/VDO sentence
+//
+//	!AIVDM,1,1,,A,payload,0*hh
+type VDM struct {
+	Own     bool   // VDO, own ship
+	Total   int    // number of parts
+	Part    int    // this part, from 1
+	SeqID   string // sequential message id of multipart messages
+	Channel string // A, B or empty
+	Payload string
+	Fill    int // fill bits at the end of the payload
+}
+
+// ParseVDM splits a VDM/VDO sentence into its fields, ok is false if it isn't one.
+func ParseVDM(sentence string) (*VDM, bool) {
+	f := Fields(sentence)
+	if len(f) < 7 || len(f[0]) < 6 || f[0][0] != '!' {
+		return nil, false
+	}
+	v := &VDM{SeqID: f[3], Payload: f[5]}
+	switch f[0][3:] {
+	case "VDM":
+	case "VDO":
+		v.Own = true
+	default:
+		return nil, false
+	}
+	var err1, err2, err3 error
+	v.Total, err1 = strconv.Atoi(f[1])
+	v.Part, err2 = strconv.Atoi(f[2])
+	v.Fill, err3 = strconv.Atoi(f[6])
+	if err1 != nil || err2 != nil || err3 != nil || v.Part < 1 || v.Part > v.Total {
+		return nil, false
+	}
+	// some receivers report 1/2 instead of A/B
+	switch f[4] {
+	case "A", "1":
+		v.Channel = "A"
+	case "B", "2":
+		v.Channel = "B"
+	}
+	return v, true
+}
+
+// Channel returns the VHF channel of a VDM/VDO sentence: A, B, or empty if not given.
+func Channel(sentence string) string {
+	if v, ok := ParseVDM(sentence); ok {
+		return v.Channel
+	}
+	return ""
+}
+
+// Decode decodes the payload of a single part sentence.
+func Decode(sentence string) (ais.Message, error) {
+	v, ok := ParseVDM(sentence)
+	if !ok {
+		return nil, ErrNotVDM
+	}
+	if v.Total != 1 {
+		return nil, ErrMultipart
+	}
+	return ais.Decode(v.Payload, v.Fill)
+}
+
+// Raw is one sentence found in a datagram.
+type Raw struct {
+	Text    string // from the leading ! or $ up to and including the checksum
+	Trailer string // anything after the checksum on the same line, some receivers put signal data here
+	Tag     string // NMEA 4.10 TAG block in front of the sentence, without the backslashes
+}
+
+func isStart(c byte) bool {
+	return c == '!' || c == '$'
+}
+
+// Scan splits a datagram into sentences, skipping anything that isn't one.
+func Scan(buff []byte) []Raw {
+	// assume packets are clean enough...
+	var found []Raw
+	tag := "" // TAG block waiting for its sentence
+	leng := len(buff)
+	for i := 0; i+3 < leng; i++ {
+		// need more than 3 bytes for a sentence, that's just to prevent out of range indeces
+		switch buff[i] {
+		case '\\':
+			// TAG block, up to the next backslash on the same line
+			j := i + 1
+			for ; j < leng && buff[j] != '\\' && buff[j] != '\r' && buff[j] != '\n'; j++ {
+			}
+			if j < leng && buff[j] == '\\' {
+				tag = string(buff[i+1 : j])
+				i = j
+			}
+			continue
+		case '\r', '\n':
+			tag = ""
+			continue
+		}
+		if !isStart(buff[i]) {
+			continue
+		}
+		// start of a sentence, maybe
+		j := i + 1
+		for ; j < leng && buff[j] != '*' && !isStart(buff[j]); j++ {
+		}
+		if j+3 > leng {
+			// no ending checksum
+			break
+		}
+		// if checksum '*' is missing, could be start of a new sentence
+		// very unlikely though
+		if isStart(buff[j]) {
+			i = j - 1
+			continue
+		}
+		// must be checksum marker '*'
+		k := j + 3
+		for ; k < leng && buff[k] != '\r' && buff[k] != '\n' && buff[k] != '\\' && !isStart(buff[k]); k++ {
+		}
+		found = append(found, Raw{Text: string(buff[i:(j + 3)]), Trailer: string(buff[(j + 3):k]), Tag: tag})
+		tag = ""
+		i = k - 1
+		// i also gets incremented at the end of the loop
+	}
+	return found
+}
+
+// LatLon converts ddmm.mmmm,N,dddmm.mmmm,E to degrees.
+func LatLon(lat string, ns string, lon string, ew string) (float64, float64, bool) {
+	la, err1 := strconv.ParseFloat(lat, 64)
+	lo, err2 := strconv.ParseFloat(lon, 64)
+	if err1 != nil || err2 != nil || ns != "N" && ns != "S" || ew != "E" && ew != "W" {
+		return 0, 0, false
+	}
+	la = float64(int(la/100)) + math.Mod(la, 100)/60
+	lo = float64(int(lo/100)) + math.Mod(lo, 100)/60
+	// before the sign, so 95S doesn't pass as -95; NaN fails too
+	if !(la >= 0 && la <= 90 && lo >= 0 && lo <= 180) {
+		return 0, 0, false
+	}
+	if ns == "S" {
+		la = -la
+	}
+	if ew == "W" {
+		lo = -lo
+	}
+	return la, lo, true
+}
+
+// Position returns the position of a valid RMC, GGA or GLL fix.
+func Position(sentence string) (float64, float64, bool) {
+	f := Fields(sentence)
+	if len(f[0]) < 6 || f[0][0] != '$' {
+		return 0, 0, false
+	}
+	switch f[0][3:] {
+	case "RMC":
+		if len(f) > 6 && f[2] == "A" {
+			return LatLon(f[3], f[4], f[5], f[6])
+		}
+	case "GGA":
+		if len(f) > 6 && f[6] != "" && f[6] != "0" {
+			return LatLon(f[2], f[3], f[4], f[5])
+		}
+	case "GLL":
+		if len(f) > 6 && f[6] == "A" {
+			return LatLon(f[1], f[2], f[3], f[4])
+		}
+	}
+	return 0, 0, false
+}
+
+// Heading returns the heading from HDT, or course over ground from RMC/VTG;
+// isTrue is true if it is a real heading.
+func Heading(sentence string) (h float64, isTrue bool, ok bool) {
+	f := Fields(sentence)
+	if len(f[0]) < 6 || f[0][0] != '$' {
+		return 0, false, false
+	}
+	field := 0
+	switch f[0][3:] {
+	case "HDT":
+		field, isTrue = 1, true
+	case "RMC":
+		if len(f) > 2 && f[2] != "A" {
+			return 0, false, false
+		}
+		field = 8
+	case "VTG":
+		field = 1
+	default:
+		return 0, false, false
+	}
+	if field >= len(f) {
+		return 0, false, false
+	}
+	h, err := strconv.ParseFloat(f[field], 64)
+	if err != nil || h < 0 || h > 360 {
+		return 0, false, false
+	}
+	return h, isTrue, true
+}
+
+// Time returns the UTC date and time of a valid RMC fix or a ZDA sentence.
+func Time(sentence string) (time.Time, bool) {
+	f := Fields(sentence)
+	if len(f[0]) < 6 || f[0][0] != '$' || len(f) < 2 || len(f[1]) < 6 {
+		return time.Time{}, false
+	}
+	var date string
+	switch f[0][3:] {
+	case "RMC":
+		if len(f) < 10 || f[2] != "A" || len(f[9]) != 6 {
+			return time.Time{}, false
+		}
+		date = "20" + f[9][4:6] + f[9][2:4] + f[9][0:2]
+	case "ZDA":
+		if len(f) < 5 || len(f[2]) != 2 || len(f[3]) != 2 || len(f[4]) != 4 {
+			return time.Time{}, false
+		}
+		date = f[4] + f[3] + f[2]
+	default:
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102150405", date+f[1][:6])
+	if err != nil {
+		return time.Time{}, false
+	}
+	if frac := f[1][6:]; frac != "" {
+		s, err := strconv.ParseFloat("0"+frac, 64)
+		if err != nil || frac[0] != '.' {
+			return time.Time{}, false
+		}
+		t = t.Add(time.Duration(s * float64(time.Second)))
+	}
+	return t, true
+}
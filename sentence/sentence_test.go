@@ -0,0 +1,274 @@
+package sentence
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const (
+	posA = "!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*5F"
+	rmc  = "$GPRMC,123519.50,A,4807.038,N,01131.000,E,022.4,084.4,161026,003.1,W*4C"
+)
+
+func TestType(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{posA, "AIVDM"},
+		{rmc, "GPRMC"},
+		{"$CDDSC,20,3380400790,00,21,26,1423108312,2021,,,S,E*6A", "CDDSC"},
+		{"", ""},
+		{"junk", "junk"},
+	} {
+		if got := Type(c.in); got != c.want {
+			t.Errorf("Type(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestIsAIS(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		talkers map[string]bool
+		want    bool
+	}{
+		{posA, nil, true},
+		{"!AIVDO,1,1,,,B00000000000000000000000000,0*00", nil, true},
+		{"!BSVDM,1,1,,A,x,0*00", nil, true},
+		{"!BSVDM,1,1,,A,x,0*00", map[string]bool{"AI": true}, false},
+		{posA, map[string]bool{"AI": true}, true},
+		{"$AIVDM,1,1,,A,x,0*00", nil, false},
+		{"!AIALR,1,1*00", nil, false},
+		{"!AIVDMX,1", nil, false},
+		{"!AI", nil, false},
+		{"", nil, false},
+	} {
+		if got := IsAIS(c.in, c.talkers); got != c.want {
+			t.Errorf("IsAIS(%q, %v) = %v, want %v", c.in, c.talkers, got, c.want)
+		}
+	}
+}
+
+func TestDSC(t *testing.T) {
+	for _, c := range []struct {
+		in            string
+		dsc, distress bool
+	}{
+		{"$CDDSC,12,3380400790,12,06,00,1423108312,2021,,,S,E*6A", true, true},
+		{"$CDDSC,16,3380400790,12,06,00,1423108312,2021,,,S,E*6A", true, true},
+		{"$CDDSC,20,3380400790,00,21,26,1423108312,2021,,,S,E*6A", true, false},
+		{"$CDDSE,1,1,A,3380400790,00,45894494*1B", true, false},
+		{rmc, false, false},
+		{"$A,1,2,3", false, false},
+		{"$A,12,2,12", false, false},
+		{"$,12,,12", false, false},
+		{"", false, false},
+	} {
+		if got := IsDSC(c.in); got != c.dsc {
+			t.Errorf("IsDSC(%q) = %v, want %v", c.in, got, c.dsc)
+		}
+		if got := DSCDistress(c.in); got != c.distress {
+			t.Errorf("DSCDistress(%q) = %v, want %v", c.in, got, c.distress)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want bool
+	}{
+		{posA, true},
+		{rmc, true},
+		{"!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*5E", false},
+		{"!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*5f", true},
+		{"!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*5", false},
+		{"!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*ZZ", false},
+		{"!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0", false},
+		{"*00", false},
+		{"", false},
+	} {
+		if got := ChecksumOK(c.in); got != c.want {
+			t.Errorf("ChecksumOK(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+	if got := WithChecksum(rmc[:len(rmc)-3]); got != rmc {
+		t.Errorf("WithChecksum = %q, want %q", got, rmc)
+	}
+}
+
+func TestParseVDM(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want *VDM
+	}{
+		{posA, &VDM{Total: 1, Part: 1, Channel: "A", Payload: "15M67FC000G?ufbE`FepT@3n00Sa"}},
+		{"!AIVDM,2,1,3,B,55P5TL01VIaAL@7WKO@mBplU@<PDhh000000001S;AJ::4A80?4i@E53,0*3E",
+			&VDM{Total: 2, Part: 1, SeqID: "3", Channel: "B", Payload: "55P5TL01VIaAL@7WKO@mBplU@<PDhh000000001S;AJ::4A80?4i@E53"}},
+		{"!AIVDM,2,2,3,B,1@0000000000000,2*55", &VDM{Total: 2, Part: 2, SeqID: "3", Channel: "B", Payload: "1@0000000000000", Fill: 2}},
+		{"!AIVDO,1,1,,,B00000000000000000000000000,0*00", &VDM{Own: true, Total: 1, Part: 1, Payload: "B00000000000000000000000000"}},
+		{"!AIVDM,1,1,,2,15M67FC000G?ufbE`FepT@3n00Sa,0*5F", &VDM{Total: 1, Part: 1, Channel: "B", Payload: "15M67FC000G?ufbE`FepT@3n00Sa"}},
+		{"!AIVDM,1,2,,A,x,0*00", nil},
+		{"!AIVDM,1,0,,A,x,0*00", nil},
+		{"!AIVDM,a,1,,A,x,0*00", nil},
+		{"!AIVDM,1,1,,A,x*00", nil},
+		{"!AIALR,1,1,,A,x,0*00", nil},
+		{"$AIVDM,1,1,,A,x,0*00", nil},
+		{"!AIV,1,1,,A,x,0*00", nil},
+		{"", nil},
+	} {
+		got, ok := ParseVDM(c.in)
+		switch {
+		case ok != (c.want != nil):
+			t.Errorf("ParseVDM(%q) ok = %v", c.in, ok)
+		case ok && *got != *c.want:
+			t.Errorf("ParseVDM(%q) = %+v, want %+v", c.in, *got, *c.want)
+		}
+	}
+	if got := Channel(posA); got != "A" {
+		t.Errorf("Channel = %q, want A", got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if _, err := Decode("!AIVDM,2,1,3,B,55P5TL01VIaAL@7WKO@mBplU@<PDhh000000001S;AJ::4A80?4i@E53,0*3E"); err != ErrMultipart {
+		t.Errorf("Decode of a part = %v, want ErrMultipart", err)
+	}
+	if _, err := Decode(rmc); err != ErrNotVDM {
+		t.Errorf("Decode of RMC = %v, want ErrNotVDM", err)
+	}
+	m, err := Decode(posA)
+	if err != nil || m.Base().MMSI != 366053209 {
+		t.Errorf("Decode = %v, %v, want MMSI 366053209", m, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	type raw = Raw
+	for _, c := range []struct {
+		in   string
+		want []raw
+	}{
+		{posA + "\r\n", []raw{{Text: posA}}},
+		{posA + ",s28234,d-107\r\n" + rmc + "\r\n", []raw{{Text: posA, Trailer: ",s28234,d-107"}, {Text: rmc}}},
+		{"\\s:r1,c:1000000000*7E\\" + posA + "\n" + posA, []raw{{Text: posA, Tag: "s:r1,c:1000000000*7E"}, {Text: posA}}},
+		{"\\s:r1*00\\\r\n" + posA, []raw{{Text: posA}}},
+		{"noise" + posA + posA, []raw{{Text: posA}, {Text: posA}}},
+		{"!AIVDM,1,1,,A,15M6" + posA, []raw{{Text: posA}}},
+		{posA[:len(posA)-2], nil},
+		{"", nil},
+		{"\r\n\r\n", nil},
+	} {
+		got := Scan([]byte(c.in))
+		if len(got) != len(c.want) {
+			t.Errorf("Scan(%q) = %q, want %q", c.in, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("Scan(%q)[%d] = %+v, want %+v", c.in, i, got[i], c.want[i])
+			}
+		}
+	}
+}
+
+func TestLatLon(t *testing.T) {
+	for _, c := range []struct {
+		lat, ns, lon, ew string
+		la, lo           float64
+		ok               bool
+	}{
+		{"4807.038", "N", "01131.000", "E", 48.1173, 11.516667, true},
+		{"3650.400", "S", "17445.600", "E", -36.84, 174.76, true},
+		{"4807.038", "N", "12220.500", "W", 48.1173, -122.341667, true},
+		{"0000.000", "N", "00000.000", "E", 0, 0, true},
+		{"9000.000", "S", "18000.000", "W", -90, -180, true},
+		{"9500.000", "S", "01131.000", "E", 0, 0, false},
+		{"4807.038", "N", "18100.000", "W", 0, 0, false},
+		{"-4807.038", "N", "01131.000", "E", 0, 0, false},
+		{"NaN", "N", "01131.000", "E", 0, 0, false},
+		{"", "N", "01131.000", "E", 0, 0, false},
+		{"4807.038", "N", "x", "E", 0, 0, false},
+		{"4807.038", "", "01131.000", "E", 0, 0, false},
+		{"4807.038", "n", "01131.000", "E", 0, 0, false},
+		{"4807.038", "N", "01131.000", "S", 0, 0, false},
+		{"4807.038", "E", "01131.000", "N", 0, 0, false},
+	} {
+		la, lo, ok := LatLon(c.lat, c.ns, c.lon, c.ew)
+		if ok != c.ok || math.Abs(la-c.la) > 1e-6 || math.Abs(lo-c.lo) > 1e-6 {
+			t.Errorf("LatLon(%s %s %s %s) = %v, %v, %v, want %v, %v, %v", c.lat, c.ns, c.lon, c.ew, la, lo, ok, c.la, c.lo, c.ok)
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		la, lo float64
+		ok     bool
+	}{
+		{rmc, 48.1173, 11.516667, true},
+		{"$GPRMC,123519,V,4807.038,N,01131.000,E,,,161026,,*00", 0, 0, false},
+		{"$GPGGA,123519,4807.038,N,01131.000,W,1,08,0.9,545.4,M,46.9,M,,*00", 48.1173, -11.516667, true},
+		{"$GPGGA,123519,4807.038,N,01131.000,W,0,00,,,M,,M,,*00", 0, 0, false},
+		{"$GPGLL,4807.038,S,01131.000,E,123519,A*00", -48.1173, 11.516667, true},
+		{"$GPGLL,4807.038,S,01131.000,E,123519,V*00", 0, 0, false},
+		{"$GPGGA,123519", 0, 0, false},
+		{"$GPHDT,123.4,T*00", 0, 0, false},
+		{posA, 0, 0, false},
+		{"$GP", 0, 0, false},
+		{"", 0, 0, false},
+	} {
+		la, lo, ok := Position(c.in)
+		if ok != c.ok || math.Abs(la-c.la) > 1e-6 || math.Abs(lo-c.lo) > 1e-6 {
+			t.Errorf("Position(%q) = %v, %v, %v, want %v, %v, %v", c.in, la, lo, ok, c.la, c.lo, c.ok)
+		}
+	}
+}
+
+func TestHeading(t *testing.T) {
+	for _, c := range []struct {
+		in         string
+		h          float64
+		isTrue, ok bool
+	}{
+		{"$GPHDT,123.4,T*00", 123.4, true, true},
+		{rmc, 84.4, false, true},
+		{"$GPRMC,123519,V,,,,,,,161026,,*00", 0, false, false},
+		{"$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*00", 54.7, false, true},
+		{"$GPHDT,,T*00", 0, false, false},
+		{"$GPHDT,400,T*00", 0, false, false},
+		{"$GPRMC,123519,A", 0, false, false},
+		{"$GPGGA,123519*00", 0, false, false},
+		{"", 0, false, false},
+	} {
+		h, isTrue, ok := Heading(c.in)
+		if h != c.h || isTrue != c.isTrue || ok != c.ok {
+			t.Errorf("Heading(%q) = %v, %v, %v, want %v, %v, %v", c.in, h, isTrue, ok, c.h, c.isTrue, c.ok)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want time.Time
+	}{
+		{rmc, time.Date(2026, 10, 16, 12, 35, 19, 5e8, time.UTC)},
+		{"$GPZDA,201530.00,04,07,2026,00,00*00", time.Date(2026, 7, 4, 20, 15, 30, 0, time.UTC)},
+		{"$GPZDA,201530,04,07,2026,,*00", time.Date(2026, 7, 4, 20, 15, 30, 0, time.UTC)},
+		{"$GPRMC,123519,V,4807.038,N,01131.000,E,,,161026,,*00", time.Time{}},
+		{"$GPRMC,123519,A,4807.038,N,01131.000,E,,,1610,,*00", time.Time{}},
+		{"$GPZDA,201530,4,7,2026*00", time.Time{}},
+		{"$GPZDA,2015,04,07,2026*00", time.Time{}},
+		{"$GPZDA,201530x5,04,07,2026*00", time.Time{}},
+		{"$GPZDA,251530,04,07,2026*00", time.Time{}},
+		{"$GPGGA,123519,4807.038,N*00", time.Time{}},
+		{posA, time.Time{}},
+		{"", time.Time{}},
+	} {
+		got, ok := Time(c.in)
+		if ok != !c.want.IsZero() || !got.Equal(c.want) {
+			t.Errorf("Time(%q) = %v, %v, want %v", c.in, got, ok, c.want)
+		}
+	}
+}
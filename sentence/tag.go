@@ -0,0 +1,95 @@
+package sentence
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tag is an NMEA 4.10 TAG block, the backslash delimited prefix some base
+// stations and networks put in front of sentences, eg
+//
+//	\s:station1,c:1672531200*5A\!AIVDM,1,1,,A,...*hh
+//
+// Fields read: s source, c UNIX time in seconds (milliseconds if too big to
+// be seconds), n line count. Other fields are kept in Raw only.
+type Tag struct {
+	Raw    string    // between the backslashes, including the checksum
+	Valid  bool      // checksum ok, fields are empty if not
+	Source string    // s: source station
+	Time   time.Time // c: zero if not present
+	Seq    uint64    // n: 0 if not present
+}
+
+// ParseTag reads a TAG block's contents, nil if raw is empty.
+func ParseTag(raw string) *Tag {
+	if raw == "" {
+		return nil
+	}
+	t := &Tag{Raw: raw, Valid: ChecksumOK("\\" + raw)}
+	if !t.Valid {
+		return t
+	}
+	body, _, _ := strings.Cut(raw, "*")
+	for _, f := range strings.Split(body, ",") {
+		name, value, _ := strings.Cut(f, ":")
+		switch name {
+		case "s":
+			t.Source = value
+		case "n":
+			t.Seq, _ = strconv.ParseUint(value, 10, 64)
+		case "c":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				continue
+			}
+			if n > 1e11 {
+				// milliseconds, seconds that big are thousands of years away
+				t.Time = time.UnixMilli(n).UTC()
+			} else {
+				t.Time = time.Unix(n, 0).UTC()
+			}
+		}
+	}
+	return t
+}
+
+// NumberTag returns TAG block contents with the n: field set, raw may be empty.
+func NumberTag(raw string, n uint64) string {
+	body, _, _ := strings.Cut(raw, "*")
+	var fields []string
+	for _, f := range strings.Split(body, ",") {
+		if f != "" && !strings.HasPrefix(f, "n:") {
+			fields = append(fields, f)
+		}
+	}
+	fields = append(fields, "n:"+strconv.FormatUint(n, 10))
+	return WithChecksum("\\" + strings.Join(fields, ","))[1:]
+}
+
+// StampTag returns TAG block contents with a c: field of t in milliseconds
+// unless it has a time already, raw may be empty.
+func StampTag(raw string, t time.Time) string {
+	if raw != "" && (!ChecksumOK("\\"+raw) || !ParseTag(raw).Time.IsZero()) {
+		return raw
+	}
+	body, _, _ := strings.Cut(raw, "*")
+	fields := []string{"c:" + strconv.FormatInt(t.UnixMilli(), 10)}
+	if body != "" {
+		fields = append([]string{body}, fields...)
+	}
+	return WithChecksum("\\" + strings.Join(fields, ","))[1:]
+}
+
+// SplitTag splits a line into its TAG block contents, empty if it has none,
+// and the sentence.
+func SplitTag(line string) (string, string) {
+	if !strings.HasPrefix(line, "\\") {
+		return "", line
+	}
+	tag, sentence, ok := strings.Cut(line[1:], "\\")
+	if !ok {
+		return "", line
+	}
+	return tag, sentence
+}
@@ -0,0 +1,81 @@
+package sentence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTag(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want *Tag
+	}{
+		{"", nil},
+		{"s:r1,c:1000000000*7E", &Tag{Raw: "s:r1,c:1000000000*7E", Valid: true, Source: "r1", Time: time.Unix(1000000000, 0).UTC()}},
+		{"c:1700000000000*6F", &Tag{Raw: "c:1700000000000*6F", Valid: true, Time: time.UnixMilli(1700000000000).UTC()}},
+		{WithChecksum("\\n:42,x:y")[1:], &Tag{Raw: WithChecksum("\\n:42,x:y")[1:], Valid: true, Seq: 42}},
+		{WithChecksum("\\c:0,c:-5,c:abc")[1:], &Tag{Raw: WithChecksum("\\c:0,c:-5,c:abc")[1:], Valid: true}},
+		{"s:r1,c:1000000000*00", &Tag{Raw: "s:r1,c:1000000000*00"}},
+		{"s:r1", &Tag{Raw: "s:r1"}},
+	} {
+		got := ParseTag(c.in)
+		switch {
+		case (got == nil) != (c.want == nil):
+			t.Errorf("ParseTag(%q) = %v, want %v", c.in, got, c.want)
+		case got != nil && *got != *c.want:
+			t.Errorf("ParseTag(%q) = %+v, want %+v", c.in, *got, *c.want)
+		}
+	}
+}
+
+func TestNumberTag(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		n    uint64
+		want string
+	}{
+		{"", 7, WithChecksum("\\n:7")[1:]},
+		{"s:r1,c:1000000000*7E", 8, WithChecksum("\\s:r1,c:1000000000,n:8")[1:]},
+		{WithChecksum("\\n:3,s:r1")[1:], 9, WithChecksum("\\s:r1,n:9")[1:]},
+	} {
+		got := NumberTag(c.in, c.n)
+		if got != c.want {
+			t.Errorf("NumberTag(%q, %d) = %q, want %q", c.in, c.n, got, c.want)
+		}
+		if tag := ParseTag(got); !tag.Valid || tag.Seq != c.n {
+			t.Errorf("NumberTag(%q, %d) reads back as %+v", c.in, c.n, *tag)
+		}
+	}
+}
+
+func TestStampTag(t *testing.T) {
+	at := time.UnixMilli(1700000000123).UTC()
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"", "c:1700000000123*" + WithChecksum("\\c:1700000000123")[len("\\c:1700000000123*"):]},
+		{"s:r1*" + WithChecksum("\\s:r1")[len("\\s:r1*"):], WithChecksum("\\s:r1,c:1700000000123")[1:]},
+		{"s:r1,c:1000000000*7E", "s:r1,c:1000000000*7E"},
+		{"s:r1*00", "s:r1*00"},
+	} {
+		if got := StampTag(c.in, at); got != c.want {
+			t.Errorf("StampTag(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSplitTag(t *testing.T) {
+	for _, c := range []struct {
+		in, tag, sentence string
+	}{
+		{"\\s:r1*00\\" + posA, "s:r1*00", posA},
+		{posA, "", posA},
+		{"\\s:r1*00" + posA, "", "\\s:r1*00" + posA},
+		{"", "", ""},
+	} {
+		tag, s := SplitTag(c.in)
+		if tag != c.tag || s != c.sentence {
+			t.Errorf("SplitTag(%q) = %q, %q, want %q, %q", c.in, tag, s, c.tag, c.sentence)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+//go:build !edge
+
+package logais
+
+/*
+First time setup, asking questions instead of editing the sample config file:
+ logais setup
+asks for the data and log folders, then each stream's UDP port, description
+and options (checked as they are typed), and an optional station position and ID,
+writes LogAIS.txt to the data folder (an existing one is kept as LogAIS.txt.bak)
+and checks it as logais check does. On Linux it can also install and start a
+systemd service, on macOS a launchd agent; on Windows it prints the command
+that installs a service.
+*/
+
+import (
+	"bufio"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"example.com/logais/config"
+)
+
+const (
+	systemdUnit  = "/etc/systemd/system/logais.service"
+	launchdLabel = "nz.co.compais.logais"
+)
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *prompter) ask(question string, def string) string {
+	// one line answer, def if empty
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		// nothing more to answer with, the questions would go round forever
+		fmt.Fprintln(p.out, "\nInput ended, setup cancelled.")
+		os.Exit(1)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+func (p *prompter) yes(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(p.ask(question+" ("+hint+")", ""))
+	if answer == "" {
+		return def
+	}
+	return strings.HasPrefix(answer, "y")
+}
+
+func setupCmd(args []string) int {
+	fset := flag.NewFlagSet("setup", flag.ExitOnError)
+	fset.Parse(args)
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	fmt.Println("LogAIS setup: press Enter to accept the [default].")
+
+	defData, defLog := Datapath, Logpath
+	Datapath = dirPath(p.ask("Folder for recordings and the config file", Datapath))
+	Logpath = dirPath(p.ask("Folder for the log file", Logpath))
+	for _, dir := range []string{Datapath, Logpath} {
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			fmt.Printf("Can't make %s: %v\n", dir, err)
+			return 1
+		}
+	}
+
+	var lines []string
+	ports := make(map[string]bool)
+	fmt.Println("\nStreams: one for each UDP port a receiver sends to. Leave the port empty when done.")
+	for {
+		port := p.ask("UDP port", "")
+		if port == "" {
+			if len(lines) == 0 {
+				fmt.Println("At least one stream is needed.")
+				continue
+			}
+			break
+		}
+		if _, err := checkPort(port); err != nil {
+			fmt.Println("Ports are numbers from 1025 to 65535.")
+			continue
+		}
+		if ports[port] {
+			fmt.Println("That port already has a stream.")
+			continue
+		}
+		name := ""
+		for name == "" {
+			name = p.ask("Description, eg Harbour receiver", "")
+		}
+		var opts []string
+		for {
+			opts = strings.Fields(p.ask("Options, space separated, eg dedup tags=drop (see README)", ""))
+			if _, err := config.ParseOptions(config.RawOptions(opts)); err != nil {
+				fmt.Printf("%v, try again\n", err)
+				continue
+			}
+			break
+		}
+		ports[port] = true
+		lines = append(lines, strings.Join(append([]string{port, name}, opts...), "\t"))
+	}
+	for {
+		pos := p.ask("\nStation position as lat,lon in decimal degrees, if it's fixed", "")
+		if pos == "" {
+			break
+		}
+		if _, _, err := config.ParseLatLon(pos); err != nil {
+			fmt.Printf("%v, try again\n", err)
+			continue
+		}
+		lines = append(lines, "station\t"+pos)
+		break
+	}
+	if id := p.ask("Station ID for the file headers, eg AKL-01", ""); id != "" {
+		lines = append(lines, "station-id\t"+id)
+	}
+
+	path := Datapath + ConfName + ".txt"
+	if _, err := os.Stat(path); err == nil {
+		if !p.yes(path+" exists, replace it (the old one is kept as .bak)?", false) {
+			fmt.Println("Nothing written.")
+			return 1
+		}
+		if err = os.Rename(path, path+".bak"); err != nil {
+			fmt.Printf("Can't keep the old config: %v\n", err)
+			return 1
+		}
+	}
+	content := "# written by logais setup, tab separated: port, description, options\n" + strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+		fmt.Printf("Can't write %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("Wrote %s\n", path)
+	conf, err := readConfig(path)
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return 1
+	}
+	for _, problem := range checkConfig(path, conf) {
+		fmt.Printf("%s: %s\n", path, problem)
+	}
+	for _, f := range config.Lint(conf.Config) {
+		fmt.Printf("%s: warning %s\n", path, f)
+	}
+
+	// flags the service needs to find the folders chosen
+	var flags []string
+	if Datapath != defData {
+		flags = append(flags, "-data-dir", Datapath)
+	}
+	if Logpath != defLog {
+		flags = append(flags, "-log-dir", Logpath)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "logais"
+	}
+	switch runtime.GOOS {
+	case "linux":
+		if p.yes("\nInstall and start the systemd service "+systemdUnit+"?", false) {
+			return installService(exe, flags)
+		}
+	case "darwin":
+		if p.yes("\nInstall and start a launchd agent so LogAIS runs whenever you are logged in?", false) {
+			return installLaunchAgent(exe, flags)
+		}
+	case "freebsd", "dragonfly":
+		fmt.Println("\nTo keep LogAIS running, restarted if it fails, eg from /etc/rc.local:")
+		fmt.Printf(" daemon -r -f -P /var/run/logais.pid %s %s\n", exe, strings.Join(flags, " "))
+	case "openbsd", "netbsd":
+		fmt.Println("\nTo start LogAIS at boot, add to /etc/rc.local:")
+		fmt.Printf(" %s %s >/dev/null 2>&1 &\n", exe, strings.Join(flags, " "))
+	case "windows":
+		fmt.Println("\nTo run LogAIS as a service, from an administrator prompt:")
+		fmt.Printf(" sc.exe create LogAIS start= auto binPath= \"\\\"%s\\\" %s\"\n", exe, strings.Join(flags, " "))
+	}
+	fmt.Printf("\nTo start recording: %s %s\n", exe, strings.Join(flags, " "))
+	return 0
+}
+
+func installService(exe string, flags []string) int {
+	unit := "[Unit]\nDescription=LogAIS AIS recorder\nAfter=network-online.target\nWants=network-online.target\n\n" +
+		"[Service]\nType=notify\nWatchdogSec=60\nExecStart=" + strings.TrimSpace(exe+" "+strings.Join(flags, " ")) + "\nExecReload=/bin/kill -HUP $MAINPID\n" +
+		"Restart=on-failure\n\n[Install]\nWantedBy=multi-user.target\n"
+	if err := os.WriteFile(systemdUnit, []byte(unit), 0644); err != nil {
+		fmt.Printf("Can't write %s (run setup as root?): %v\n", systemdUnit, err)
+		return 1
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", "logais"}} {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			fmt.Printf("systemctl %s: %v\n%s", strings.Join(args, " "), err, out)
+			return 1
+		}
+	}
+	fmt.Printf("Installed %s and started it, see systemctl status logais\n", systemdUnit)
+	return 0
+}
+
+func installLaunchAgent(exe string, flags []string) int {
+	// a per user agent, started at login and again if it fails
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Can't find your home folder: %v\n", err)
+		return 1
+	}
+	path := filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist")
+	var args strings.Builder
+	for _, a := range append([]string{exe}, flags...) {
+		args.WriteString("\t\t<string>")
+		xml.EscapeText(&args, []byte(a))
+		args.WriteString("</string>\n")
+	}
+	plist := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + launchdLabel + `</string>
+	<key>ProgramArguments</key>
+	<array>
+` + args.String() + `	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+</dict>
+</plist>
+`
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		err = os.WriteFile(path, []byte(plist), 0644)
+	}
+	if err != nil {
+		fmt.Printf("Can't write %s: %v\n", path, err)
+		return 1
+	}
+	domain := "gui/" + strconv.Itoa(os.Getuid())
+	if out, err := exec.Command("launchctl", "bootstrap", domain, path).CombinedOutput(); err != nil {
+		fmt.Printf("launchctl bootstrap %s: %v\n%s", domain, err, out)
+		return 1
+	}
+	fmt.Printf("Installed %s and started it, see launchctl print %s/%s\n", path, domain, launchdLabel)
+	return 0
+}
@@ -0,0 +1,70 @@
+//go:build !edge
+
+package logais
+
+/*
+Stopping cleanly on Ctrl-C or SIGTERM (systemd, docker stop), which the logais
+command passes on to Stop: every stream is asked to stop, writes what it holds
+(merged and smoothed messages), adds a "# Stopped" line to its data file and
+closes its files, then the vessel registry is saved and the log closed as on a
+normal exit. If the streams haven't stopped within shutdownWait Stop says so,
+and logais exits anyway.
+A config reload can't start while stopping.
+*/
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const shutdownWait = 15 * time.Second
+
+var (
+	// closed once every stream has been asked to stop, Wait waits for it, not
+	// for the streams, as the last stream can stop and start again (reload, control API)
+	stopAll  = make(chan struct{})
+	stopOnce sync.Once
+	stopped  bool // by stopStreams, within shutdownWait
+)
+
+func stopStreams() bool {
+	// ask every stream to stop, false if they haven't within shutdownWait
+	// reloads stay locked out, the program is about to end; only the first
+	// call stops them, later ones wait for it and get the same answer
+	stopOnce.Do(func() {
+		reloadMu.Lock()
+		for _, st := range Conf.Streams {
+			if !st.stopping() {
+				close(st.quit)
+			}
+		}
+		close(stopAll)
+		done := make(chan struct{})
+		go func() {
+			Running.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			stopped = true
+		case <-time.After(shutdownWait):
+		}
+	})
+	return stopped
+}
+
+// Stop asks every stream of the recorder Start started to stop, as Ctrl-C and
+// SIGTERM do logais, and returns once they have; Wait then finishes up. If
+// they haven't within 15 seconds what can be is saved and an error returned,
+// for the caller to exit anyway.
+func Stop() error {
+	sdNotify("STOPPING=1")
+	if !stopStreams() {
+		// Wait's wait for the streams won't return
+		closeManifest("stopped")
+		Vessels.save()
+		return errors.New("streams still running after " + shutdownWait.String())
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+//go:build !edge
+
+package logais
+
+/*
+Vessel lost and acquired events, for harbour operations that want the
+transitions rather than the sentences. With the config line
+ vessel-lost <tab> minutes
+a vessel (any MMSI, base stations and aids to navigation included) heard on any
+stream raises vessel_acquired the first time since starting or since it was
+lost, and vessel_lost when it hasn't been heard for that many minutes. Only
+messages with good checksums count. Without the line nothing is tracked.
+*/
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const sightingCheck = 10 * time.Second // how often lost vessels are looked for
+
+type sighting struct {
+	mmsi uint32
+	last time.Time
+	port string // stream that last heard it
+}
+
+type sightings struct {
+	mu   sync.Mutex
+	m    map[uint32]*sighting
+	lost atomic.Int64 // time.Duration from the config, 0 when off
+}
+
+var Sightings = &sightings{m: make(map[uint32]*sighting)}
+
+func vesselText(mmsi uint32) string {
+	// MMSI and the name if the registry knows it
+	text := strconv.FormatUint(uint64(mmsi), 10)
+	if v, ok := Vessels.Lookup(mmsi); ok && v.Name != "" {
+		text += " " + v.Name
+	}
+	return text
+}
+
+func (s *sightings) heard(mmsi uint32, port string, now time.Time) {
+	if s.lost.Load() == 0 || mmsi == 0 {
+		return
+	}
+	s.mu.Lock()
+	v, ok := s.m[mmsi]
+	if !ok {
+		v = &sighting{mmsi: mmsi}
+		s.m[mmsi] = v
+	}
+	v.last, v.port = now, port
+	s.mu.Unlock()
+	if !ok {
+		Events.publish(EventAcquired, port, "vessel acquired: "+vesselText(mmsi))
+	}
+}
+
+func (s *sightings) keep() {
+	for {
+		time.Sleep(sightingCheck)
+		lost := currentConfig().VesselLost
+		s.lost.Store(int64(lost))
+		now := time.Now()
+		s.mu.Lock()
+		var gone []*sighting
+		for mmsi, v := range s.m {
+			if lost == 0 || now.Sub(v.last) > lost {
+				delete(s.m, mmsi)
+				gone = append(gone, v)
+			}
+		}
+		s.mu.Unlock()
+		if lost == 0 {
+			// turned off by a reload
+			continue
+		}
+		for _, v := range gone {
+			Events.publish(EventLost, v.port, "vessel lost: "+vesselText(v.mmsi)+", last heard "+v.last.UTC().Format(time.TimeOnly)+"Z")
+		}
+	}
+}
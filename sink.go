@@ -0,0 +1,84 @@
+//go:build !edge
+
+package logais
+
+/*
+Sinks: outputs of a stream's records besides its daily file, eg a proprietary
+archive, chosen with the stream option
+ sink=name[:param]
+The records go to the sink as they are written to the daily file (own ship
+sentences split off by ownship=split don't), and only from the logger owning
+the stream in a cluster (see cluster.go). A sink is Go code registering itself
+with package sink (example.com/logais/sink) from an init function, in a file in
+this folder or a package imported here, or a program of its own through the
+built-in exec sink:
+ sink=exec:command [args]
+runs the command for each daily file with the record lines on its stdin, and
+logs what it writes to stderr; records it doesn't take in time are dropped
+and counted in the log rather than hold up the daily file. Sink errors are
+logged when they start and stop, the daily file is written regardless; a sink
+that can't be opened is tried again with the next daily file.
+*/
+
+import (
+	"log/slog"
+
+	"example.com/logais/sink"
+)
+
+// a stream's sink, with its failures logged once
+type streamSink struct {
+	sink    sink.Sink
+	opened  bool
+	failing bool
+}
+
+func newStreamSink(value string, logit *slog.Logger) (*streamSink, error) {
+	s, err := sink.New(value, logit)
+	if err != nil {
+		return nil, err
+	}
+	return &streamSink{sink: s}, nil
+}
+
+func (ss *streamSink) rotate(port string, file string, logit *slog.Logger) {
+	// on to a new daily file, opening the sink the first time; nil safe
+	if ss == nil {
+		return
+	}
+	var err error
+	if ss.opened {
+		err = ss.sink.Rotate(file)
+	} else {
+		err = ss.sink.Open(port, file)
+		ss.opened = err == nil
+	}
+	if err != nil {
+		logit.Error("sink: can't start", "file", file, "err", err)
+	}
+}
+
+func (ss *streamSink) write(port string, rec sink.Record, logit *slog.Logger) {
+	if ss == nil || !ss.opened || !Cluster.owns(port) {
+		return
+	}
+	if err := ss.sink.WriteRecord(rec); err != nil {
+		if !ss.failing {
+			logit.Error("sink: write failed, records aren't reaching it", "err", err)
+		}
+		ss.failing = true
+	} else if ss.failing {
+		logit.Info("sink: writing again")
+		ss.failing = false
+	}
+}
+
+func (ss *streamSink) close(logit *slog.Logger) {
+	if ss == nil || !ss.opened {
+		return
+	}
+	if err := ss.sink.Close(); err != nil {
+		logit.Error("sink: close", "err", err)
+	}
+	ss.opened = false
+}
@@ -0,0 +1,180 @@
+package sink
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	execWait      = 5 * time.Second // for the command to finish before it's killed
+	execQueue     = 4096            // record lines waiting for the command, more are dropped
+	execDropEvery = time.Minute     // at most one records dropped warning this often
+)
+
+// The exec sink, sink=exec:command [args], runs the command for each daily
+// file with LOGAIS_PORT and LOGAIS_FILE (the daily file's path) in its
+// environment, and writes it every record line, as in the daily file, to its
+// stdin; at midnight and on rollover stdin is closed and the command run
+// again. Each line it writes to stderr goes to the stream's log. Lines wait in
+// a queue for the command, so one that stalls or stops reading never holds up
+// the daily file; once the queue is full they're dropped and counted in the log.
+type execSink struct {
+	args []string
+	log  *slog.Logger
+	port string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+	// lines for the command, fed to its stdin until closed, then fed is closed
+	lines chan string
+	fed   chan struct{}
+	err   atomic.Pointer[error] // writing to stdin failed, the command has gone
+
+	dropped   int64 // lines dropped since the last warning
+	droppedAt time.Time
+}
+
+func newExec(param string, log *slog.Logger) (Sink, error) {
+	args := strings.Fields(param)
+	if len(args) == 0 {
+		return nil, errors.New("sink=exec needs a command, eg sink=exec:/usr/local/bin/archive")
+	}
+	return &execSink{args: args, log: log}, nil
+}
+
+func (s *execSink) Open(port string, file string) error {
+	s.port = port
+	cmd := exec.Command(s.args[0], s.args[1:]...)
+	cmd.Env = append(os.Environ(), "LOGAIS_PORT="+port, "LOGAIS_FILE="+file)
+	cmd.Stderr = &logLines{log: s.log, cmd: s.args[0]}
+	// a child left holding stderr doesn't keep Close waiting
+	cmd.WaitDelay = execWait
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	s.cmd, s.in = cmd, in
+	s.lines, s.fed = make(chan string, execQueue), make(chan struct{})
+	s.err.Store(nil)
+	go s.feed(in, s.lines, s.fed)
+	return nil
+}
+
+func (s *execSink) feed(in io.Writer, lines <-chan string, fed chan<- struct{}) {
+	// the queue to the command's stdin, what's left after a write fails is thrown away
+	defer close(fed)
+	for line := range lines {
+		if _, err := io.WriteString(in, line); err != nil {
+			s.err.Store(&err)
+			for range lines {
+			}
+			return
+		}
+	}
+}
+
+func (s *execSink) WriteRecord(rec Record) error {
+	if s.cmd == nil {
+		return errors.New("command not running")
+	}
+	if err := s.err.Load(); err != nil {
+		return *err
+	}
+	select {
+	case s.lines <- rec.Line:
+	default:
+		s.dropped++
+		if now := time.Now(); now.Sub(s.droppedAt) >= execDropEvery {
+			s.logDropped()
+			s.droppedAt = now
+		}
+	}
+	return nil
+}
+
+func (s *execSink) logDropped() {
+	if s.dropped > 0 {
+		s.log.Warn("sink: command not keeping up, records dropped", "command", s.args[0], "records", s.dropped)
+		s.dropped = 0
+	}
+}
+
+func (s *execSink) Rotate(file string) error {
+	err := s.Close()
+	if oerr := s.Open(s.port, file); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+func (s *execSink) Close() error {
+	// what's queued written and stdin closed for the command to finish, killed if it doesn't
+	if s.cmd == nil {
+		return nil
+	}
+	close(s.lines)
+	s.logDropped()
+	timeout := time.After(execWait)
+	select {
+	case <-s.fed:
+	case <-timeout:
+		// stalled, closing stdin ends the write it's stuck in
+		s.cmd.Process.Kill()
+		s.in.Close()
+		<-s.fed
+	}
+	s.in.Close()
+	done := make(chan error, 1)
+	go func() { done <- s.cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-timeout:
+		s.cmd.Process.Kill()
+		err = <-done
+	}
+	s.cmd.Stderr.(*logLines).flush()
+	s.cmd = nil
+	return err
+}
+
+// the command's stderr, logged a line at a time
+type logLines struct {
+	log  *slog.Logger
+	cmd  string
+	part []byte // a line not ended yet
+}
+
+func (l *logLines) Write(p []byte) (int, error) {
+	l.part = append(l.part, p...)
+	for {
+		i := bytes.IndexByte(l.part, '\n')
+		if i < 0 {
+			break
+		}
+		l.line(l.part[:i])
+		l.part = l.part[i+1:]
+	}
+	return len(p), nil
+}
+
+func (l *logLines) line(b []byte) {
+	if s := strings.TrimRight(string(b), "\r"); s != "" {
+		l.log.Warn("sink: "+s, "command", l.cmd)
+	}
+}
+
+func (l *logLines) flush() {
+	// what's left when the command ends without a last line ending
+	l.line(l.part)
+	l.part = nil
+}
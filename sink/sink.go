@@ -0,0 +1,95 @@
+// Package sink is the interface for outputs of a stream's records besides its
+// daily file, eg a proprietary archive. A sink registers itself from an init
+// function in a package the program imports,
+//
+//	func init() {
+//		sink.Register("archive", func(param string, log *slog.Logger) (sink.Sink, error) {
+//			return newArchive(param)
+//		})
+//	}
+//
+// and a stream takes it with the option sink=archive[:param]. The built-in
+// exec sink, sink=exec:command [args], runs a program of its own for each
+// daily file with the record lines on its stdin.
+package sink
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Record is one record as written to a stream's daily file.
+type Record struct {
+	Time     string // timestamp as written
+	Source   string // id column
+	Sentence string // with its TAG block in front if the stream keeps them
+	Valid    bool   // checksum ok or not checked
+	Line     string // the whole line written, with its line ending
+}
+
+type Sink interface {
+	// Open starts the sink for a stream, file is the path of its daily file
+	Open(port string, file string) error
+	// WriteRecord takes a record the stream has written to the daily file; it's
+	// called by the stream's writer, so a sink that can block should queue
+	WriteRecord(rec Record) error
+	// Rotate moves on to a new daily file, at midnight or on rollover
+	Rotate(file string) error
+	// Close is called when the stream stops
+	Close() error
+}
+
+// Factory makes a stream's sink from what follows the name in its sink
+// option; log is the stream's, for anything the sink has to say besides the
+// errors it returns.
+type Factory func(param string, log *slog.Logger) (Sink, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{"exec": newExec}
+)
+
+// Register adds a sink for the sink option, usually from an init function.
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = f
+}
+
+// Names returns the sinks registered, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for n := range factories {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Known reports whether a sink option, name[:param], names a registered sink.
+func Known(value string) bool {
+	name, _, _ := strings.Cut(value, ":")
+	mu.RLock()
+	defer mu.RUnlock()
+	return factories[name] != nil
+}
+
+// New makes the sink a sink option, name[:param], asks for.
+func New(value string, log *slog.Logger) (Sink, error) {
+	name, param, _ := strings.Cut(value, ":")
+	mu.RLock()
+	f := factories[name]
+	mu.RUnlock()
+	if f == nil {
+		return nil, errors.New("unknown sink: " + name)
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+	return f(param, log)
+}
@@ -0,0 +1,128 @@
+package sink
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopSink struct{}
+
+func (nopSink) Open(port string, file string) error { return nil }
+func (nopSink) WriteRecord(rec Record) error        { return nil }
+func (nopSink) Rotate(file string) error            { return nil }
+func (nopSink) Close() error                        { return nil }
+
+func TestRegistry(t *testing.T) {
+	var got string
+	Register("test", func(param string, log *slog.Logger) (Sink, error) {
+		got = param
+		return nopSink{}, nil
+	})
+	for _, c := range []struct {
+		value string
+		known bool
+	}{
+		{"test", true},
+		{"test:a:b", true},
+		{"exec:/bin/true", true},
+		{"exec", true},
+		{"archive", false},
+		{"", false},
+	} {
+		if Known(c.value) != c.known {
+			t.Errorf("Known(%q) = %v", c.value, !c.known)
+		}
+	}
+	if _, err := New("test:a:b", nil); err != nil || got != "a:b" {
+		t.Errorf("New = %v, param %q", err, got)
+	}
+	if _, err := New("archive:x", nil); err == nil {
+		t.Errorf("New of an unregistered sink didn't fail")
+	}
+	if _, err := New("exec", nil); err == nil {
+		t.Errorf("exec without a command didn't fail")
+	}
+	if names := strings.Join(Names(), ","); names != "exec,test" {
+		t.Errorf("Names = %s", names)
+	}
+}
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	var logged bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logged, nil))
+	// copies stdin after its environment, and says something on stderr, the last without a line ending
+	script := filepath.Join(dir, "archive.sh")
+	os.WriteFile(script, []byte("echo $LOGAIS_PORT $LOGAIS_FILE >>$1\ncat >>$1\necho problem >&2\nprintf 'at end' >&2\n"), 0644)
+	s, err := New("exec:sh "+script+" "+out, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open("10110", "day1.csv"); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteRecord(Record{Line: "a\r\n"})
+	if err := s.Rotate("day2.csv"); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteRecord(Record{Line: "b\r\n"})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteRecord(Record{Line: "c\r\n"}); err == nil {
+		t.Errorf("write after Close didn't fail")
+	}
+	b, _ := os.ReadFile(out)
+	if want := "10110 day1.csv\na\r\n10110 day2.csv\nb\r\n"; string(b) != want {
+		t.Errorf("command got %q, want %q", b, want)
+	}
+	for _, line := range []string{`msg="sink: problem"`, `msg="sink: at end"`} {
+		if n := strings.Count(logged.String(), line); n != 2 {
+			t.Errorf("%s logged %d times, want once a file:\n%s", line, n, logged.String())
+		}
+	}
+}
+
+func TestExecStalled(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	var logged bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logged, nil))
+	// doesn't read for a second, records written meanwhile mustn't wait for it
+	script := filepath.Join(t.TempDir(), "slow.sh")
+	os.WriteFile(script, []byte("sleep 1\ncat >/dev/null\n"), 0644)
+	s, err := New("exec:sh "+script, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open("10110", "day1.csv"); err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("x", 100) + "\r\n"
+	start := time.Now()
+	for range 3 * execQueue {
+		if err := s.WriteRecord(Record{Line: line}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("writing took %v, waiting for the command", d)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), "records dropped") {
+		t.Errorf("drops not logged:\n%s", logged.String())
+	}
+}
@@ -0,0 +1,137 @@
+//go:build !edge
+
+package logais
+
+/*
+Buffered writing for recorders on SD cards. A stream's data file and side files
+(quality, invalid, repaired, own ship, GeoJSON lines) are written through a
+bufio.Writer flushed once every smoothDefault, so a burst of messages is one
+write and a quiet channel doesn't rewrite the same flash page all the time.
+Per stream options:
+ smooth=seconds	flush this often instead
+ smooth-size=size	buffer size, eg 16KB, flushed early once full (default smoothMax)
+ batch=n[,seconds]	also write as soon as n records are held, and every
+	seconds (may be under one, eg batch=100,0.25) rather than every smoothDefault
+ write-through	write every message as it comes, no buffering
+Up to a period of data can be lost if the power goes, and anything reading
+today's files sees it that much later. Lines are never split between writes.
+The buffers are flushed when the files close: at midnight, on rollover through
+the control API, and when the stream stops. A GeoJSON collection file is
+rewritten in place and isn't buffered.
+*/
+
+import (
+	"bufio"
+	"time"
+)
+
+const (
+	smoothDefault = time.Second // how often buffered files are written unless smooth is given
+	smoothMax     = 64 * 1024   // default buffer, bytes held before writing early
+)
+
+type smoothFile struct {
+	f     storageFile
+	w     *bufio.Writer // nil to write through
+	every time.Duration
+	batch int       // records held before writing early, 0 for no limit
+	held  int       // records written to w since the last flush
+	last  time.Time // last flush
+
+	offset int64      // file size once what's held is written, when set at open, see index.go
+	chain  *hashChain // hash of everything written, with the chain option, see chain.go
+}
+
+func smoothing(o *Options) (time.Duration, int, int) {
+	// flush period, buffer size and batch for the stream's files, 0 to write through
+	if o.Unbuffered {
+		return 0, 0, 0
+	}
+	every, size := smoothDefault, smoothMax
+	if o.Smooth > 0 {
+		every = o.Smooth
+	}
+	if o.SmoothSize > 0 {
+		size = o.SmoothSize
+	}
+	return every, size, o.Batch
+}
+
+func newSmoothFile(f storageFile, every time.Duration, size int, batch int) *smoothFile {
+	s := &smoothFile{f: f, every: every, batch: batch, last: time.Now()}
+	if every > 0 {
+		s.w = bufio.NewWriterSize(f, size)
+	}
+	return s
+}
+
+func (s *smoothFile) WriteString(text string) (int, error) {
+	if s.w == nil {
+		n, err := s.f.WriteString(text)
+		s.offset += int64(n)
+		s.chain.add(text[:n])
+		return n, err
+	}
+	if s.w.Buffered() > 0 && s.w.Available() < len(text) {
+		// write what's held first rather than split the line
+		if err := s.w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.w.WriteString(text)
+	s.offset += int64(n)
+	s.chain.add(text[:n])
+	return n, err
+}
+
+func (s *smoothFile) buffered() int {
+	if s.w == nil {
+		return 0
+	}
+	return s.w.Buffered()
+}
+
+func (s *smoothFile) writeRecord(text string) error {
+	// as WriteString, counting the record for batch
+	if _, err := s.WriteString(text); err != nil {
+		return err
+	}
+	if s.held++; s.batch > 0 && s.held >= s.batch {
+		return s.flush(time.Now(), true)
+	}
+	return nil
+}
+
+func (s *smoothFile) seal(now time.Time, closed bool) error {
+	// a chain line if one is due, or the closing one
+	if s == nil || s.f == nil || s.chain == nil || !closed && !s.chain.due(now) {
+		return nil
+	}
+	_, err := s.WriteString(s.chain.line(now, closed))
+	return err
+}
+
+func (s *smoothFile) flush(now time.Time, force bool) error {
+	// write what's held if the period is up
+	if s == nil || s.w == nil || s.w.Buffered() == 0 || !force && now.Sub(s.last) < s.every {
+		return nil
+	}
+	s.last, s.held = now, 0
+	return s.w.Flush()
+}
+
+func (s *smoothFile) Close() error {
+	// nil safe, and safe to close twice, as the stream closes at midnight and on exit
+	if s == nil || s.f == nil {
+		return nil
+	}
+	err := s.seal(time.Now(), true)
+	if ferr := s.flush(time.Now(), true); err == nil {
+		err = ferr
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
@@ -0,0 +1,135 @@
+//go:build !edge
+
+package logais
+
+/*
+Station position, fixed from the config file:
+ station <tab> lat,lon	decimal degrees
+or updated from a stream with the gps option, for loggers on a moving vessel.
+When the station is moving, ranges and bearings to targets are also given
+relative to own heading (HDT, or course over ground if no heading).
+*/
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+type stationPos struct {
+	mu     sync.RWMutex
+	lat    float64
+	lon    float64
+	valid  bool
+	when   time.Time // last update
+	source string    // "config" or the port of the gps stream
+
+	heading  float64 // own heading or course, degrees true
+	hdgValid bool
+	hdgTrue  bool // heading from a gyro/compass rather than course over ground
+	hdgWhen  time.Time
+}
+
+// how long a heading stays usable without an update
+const headingTimeout = 30 * time.Second
+
+var Station stationPos
+
+func (sp *stationPos) set(lat float64, lon float64, source string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.lat, sp.lon, sp.valid = lat, lon, true
+	sp.when = time.Now().UTC()
+	sp.source = source
+}
+
+func (sp *stationPos) get() (float64, float64, bool) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.lat, sp.lon, sp.valid
+}
+
+func (sp *stationPos) setHeading(hdg float64, isTrue bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	// course over ground only used if no true heading lately
+	if !isTrue && sp.hdgTrue && time.Since(sp.hdgWhen) < headingTimeout {
+		return
+	}
+	sp.heading, sp.hdgValid, sp.hdgTrue = normBearing(hdg), true, isTrue
+	sp.hdgWhen = time.Now().UTC()
+}
+
+func (sp *stationPos) mobile() bool {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.valid && sp.source != "config"
+}
+
+// target range and bearing from the station
+type relPos struct {
+	Range   float64 // nautical miles
+	Bearing float64 // degrees true
+	RelBrg  float64 // degrees clockwise from own heading, moving platform only
+	HasRel  bool
+}
+
+func (sp *stationPos) relative(lat float64, lon float64) (relPos, bool) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	if !sp.valid {
+		return relPos{}, false
+	}
+	var r relPos
+	r.Range, r.Bearing = rangeBearing(sp.lat, sp.lon, lat, lon)
+	if sp.source != "config" && sp.hdgValid && time.Since(sp.hdgWhen) < headingTimeout {
+		r.RelBrg = normBearing(r.Bearing - sp.heading)
+		r.HasRel = true
+	}
+	return r, true
+}
+
+func (sp *stationPos) String() string {
+	// for file headers and logs
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	if !sp.valid {
+		return "unknown"
+	}
+	return strconv.FormatFloat(sp.lat, 'f', 5, 64) + "," + strconv.FormatFloat(sp.lon, 'f', 5, 64) +
+		" (" + sp.source + " " + sp.when.Format(time.RFC3339) + ")"
+}
+
+func updateStation(port string, sentence string) {
+	// own position from GPS sentences or our transponder's VDO reports
+	if hdg, isTrue, ok := gpsHeading(sentence); ok {
+		Station.setHeading(hdg, isTrue)
+	}
+	lat, lon, ok := gpsPosition(sentence)
+	if !ok {
+		if v, isVDM := parseVDM(sentence); isVDM && v.Own {
+			if msg, err := decodeSentence(sentence); err == nil {
+				if p, isPos := msg.(*ais.Position); isPos && p.HasPosition() {
+					lat, lon, ok = p.Lat, p.Lon, true
+					if p.HasHeading() {
+						Station.setHeading(float64(p.Heading), true)
+					} else if p.HasCOG() {
+						Station.setHeading(p.COG, false)
+					}
+				}
+			}
+		}
+	}
+	if !ok {
+		return
+	}
+	Station.mu.RLock()
+	first := Station.source != "gps "+port
+	Station.mu.RUnlock()
+	Station.set(lat, lon, "gps "+port)
+	if first {
+		Logit.Info("station position now from GPS", "port", port, "position", Station.String())
+	}
+}
@@ -0,0 +1,196 @@
+//go:build !edge
+
+package logais
+
+/*
+Per-stream counters, logged every hour and when a stream's daily file rolls over,
+with the host's resources, and served in /api/status
+*/
+
+import (
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const statsInterval = 60 // minutes between stats log entries
+
+type streamStats struct {
+	Sentences   atomic.Int64 // AIS sentences written
+	BadChecksum atomic.Int64 // sentences failing checksum, whatever the policy did with them
+	Repaired    atomic.Int64 // of those, recorded after a single bit repair, see repair.go
+	DiffCommon  atomic.Int64 // differential recording, not written because the reference stream had them
+	Incomplete  atomic.Int64 // multipart messages with parts missing after the timeout
+	Filtered    atomic.Int64 // messages not recorded because of the stream's filters
+	Duplicates  atomic.Int64 // messages not recorded because the same one was just written
+	Downsampled atomic.Int64 // position reports not recorded because of the rate option
+	Lost        atomic.Int64 // merged stream, messages lost because it fell behind
+	Late        atomic.Int64 // merged stream, messages written after later ones, see reorder
+	RelayErrors atomic.Int64 // datagrams the relay option couldn't send, one for each address
+	Pushed      atomic.Int64 // sentences a collector accepted from the push option
+	PushDropped atomic.Int64 // sentences dropped unsent because the collector was away too long
+	Restarts    atomic.Int64 // times the stream failed and was started again, see supervise.go
+	Overflow    atomic.Int64 // datagrams dropped because the writer was behind, see pipeline.go
+	Dropped     atomic.Int64 // sentences in those
+	Rejected    atomic.Int64 // datagrams from senders allow-from doesn't list
+
+	Sockets atomic.Pointer[[]*socketStats] // each socket's counts with the sockets option, else empty
+}
+
+type socketStats struct {
+	Received atomic.Int64 // datagrams read from the socket
+	Dropped  atomic.Int64 // of those, dropped because the writer was behind
+}
+
+type socketCount struct {
+	Socket   int   `json:"socket"`
+	Received int64 `json:"received"`
+	Dropped  int64 `json:"dropped"`
+}
+
+func (s *streamStats) sockets() []socketCount {
+	p := s.Sockets.Load()
+	if p == nil {
+		return nil
+	}
+	var c []socketCount
+	for i, sock := range *p {
+		c = append(c, socketCount{Socket: i + 1, Received: sock.Received.Load(), Dropped: sock.Dropped.Load()})
+	}
+	return c
+}
+
+func (s *streamStats) summary() string {
+	text := "sentences " + itoa(s.Sentences.Load()) + ", bad checksums " + itoa(s.BadChecksum.Load())
+	if n := s.Repaired.Load(); n > 0 {
+		text += ", repaired " + itoa(n)
+	}
+	if n := s.Incomplete.Load(); n > 0 {
+		text += ", incomplete multipart " + itoa(n)
+	}
+	if n := s.Filtered.Load(); n > 0 {
+		text += ", filtered out " + itoa(n)
+	}
+	if n := s.Duplicates.Load(); n > 0 {
+		text += ", duplicates " + itoa(n)
+	}
+	if n := s.Downsampled.Load(); n > 0 {
+		text += ", downsampled " + itoa(n)
+	}
+	if n := s.Lost.Load(); n > 0 {
+		text += ", lost " + itoa(n)
+	}
+	if n := s.Late.Load(); n > 0 {
+		text += ", late " + itoa(n)
+	}
+	if n := s.RelayErrors.Load(); n > 0 {
+		text += ", relay errors " + itoa(n)
+	}
+	if n := s.Pushed.Load(); n > 0 {
+		text += ", pushed " + itoa(n)
+	}
+	if n := s.PushDropped.Load(); n > 0 {
+		text += ", push dropped " + itoa(n)
+	}
+	if n := s.DiffCommon.Load(); n > 0 {
+		text += ", also on reference " + itoa(n)
+	}
+	if n := s.Restarts.Load(); n > 0 {
+		text += ", restarts " + itoa(n)
+	}
+	if n := s.Overflow.Load(); n > 0 {
+		text += ", overflow " + itoa(n)
+	}
+	if n := s.Dropped.Load(); n > 0 {
+		text += ", dropped sentences " + itoa(n)
+	}
+	if n := s.Rejected.Load(); n > 0 {
+		text += ", rejected " + itoa(n)
+	}
+	for _, c := range s.sockets() {
+		text += ", socket " + strconv.Itoa(c.Socket) + " received " + itoa(c.Received) + " dropped " + itoa(c.Dropped)
+	}
+	return text
+}
+
+func (s *streamStats) counts() map[string]int64 {
+	return map[string]int64{
+		"sentences":    s.Sentences.Load(),
+		"bad_checksum": s.BadChecksum.Load(),
+		"repaired":     s.Repaired.Load(),
+		"diff_common":  s.DiffCommon.Load(),
+		"incomplete":   s.Incomplete.Load(),
+		"filtered":     s.Filtered.Load(),
+		"duplicates":   s.Duplicates.Load(),
+		"downsampled":  s.Downsampled.Load(),
+		"lost":         s.Lost.Load(),
+		"late":         s.Late.Load(),
+		"relay_errors": s.RelayErrors.Load(),
+		"pushed":       s.Pushed.Load(),
+		"push_dropped": s.PushDropped.Load(),
+		"restarts":     s.Restarts.Load(),
+		"overflow":     s.Overflow.Load(),
+		"dropped":      s.Dropped.Load(),
+		"rejected":     s.Rejected.Load(),
+	}
+}
+
+func (s *streamStats) attrs() []any {
+	// for the log, sentences and bad checksums and the other counters that aren't zero
+	c := s.counts()
+	args := []any{"sentences", c["sentences"], "bad_checksum", c["bad_checksum"]}
+	for _, name := range []string{"repaired", "incomplete", "filtered", "duplicates", "downsampled", "lost", "late",
+		"relay_errors", "pushed", "push_dropped", "diff_common", "restarts", "overflow", "dropped", "rejected"} {
+		if c[name] > 0 {
+			args = append(args, name, c[name])
+		}
+	}
+	for _, c := range s.sockets() {
+		args = append(args, slog.Group("socket"+strconv.Itoa(c.Socket), "received", c.Received, "dropped", c.Dropped))
+	}
+	return args
+}
+
+type streamStatus struct {
+	Port  string           `json:"port"`
+	Name  string           `json:"name"`
+	Stats map[string]int64 `json:"stats"`
+	// per socket with the sockets option, see pipeline.go
+	Sockets []socketCount `json:"sockets,omitempty"`
+}
+
+type status struct {
+	Version string         `json:"version"`
+	Started time.Time      `json:"started"`
+	Profile string         `json:"profile"`
+	Streams []streamStatus `json:"streams"`
+	Host    hostStatus     `json:"host"`
+	Clock   *clockStatus   `json:"clock,omitempty"` // last clock check, see clock.go
+}
+
+var started = time.Now().UTC()
+
+func currentStatus() status {
+	profMutex.Lock()
+	s := status{Version: Version, Started: started, Profile: ActiveProf, Host: readHost(), Clock: Clock.Load()}
+	profMutex.Unlock()
+	for _, st := range Conf.Streams {
+		s.Streams = append(s.Streams, streamStatus{Port: st.Port, Name: st.Name, Stats: st.stats.counts(), Sockets: st.stats.sockets()})
+	}
+	return s
+}
+
+func reportStats() {
+	for {
+		time.Sleep(statsInterval * time.Minute)
+		for _, st := range Conf.Streams {
+			Logit.Info("stats", append([]any{"port", st.Port, "stream", st.Name}, st.stats.attrs()...)...)
+		}
+		Logit.Info("host: " + readHost().summary())
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
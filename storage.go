@@ -0,0 +1,212 @@
+//go:build !edge
+
+package logais
+
+/*
+Storage behind the files a stream writes: the daily data file, its side files
+(quality, invalid, repaired, own ship) and GeoJSON. Streams write through Store
+instead of the os package, so recording and rollover can run against something
+other than a disk:
+ localStore	files in the data folder, the default
+ memStore	files held in memory, for tests, and with -storage memory for diskless
+	loggers that only relay, serve or push what they receive; the files are
+	gone when the program stops and only today's are kept
+Another backend, eg an object store, implements Storage and storageFile.
+The vessel registry, run manifest, catalog and logs stay in the data and log
+folders whatever the storage.
+*/
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type storageFile interface {
+	io.Writer
+	io.StringWriter
+	io.Seeker
+	io.Closer
+}
+
+type Storage interface {
+	// MkdirAll makes a folder for files, with its parents
+	MkdirAll(dir string) error
+	// Append opens a file to add to, made if need be; created is true if it was
+	Append(path string) (f storageFile, created bool, err error)
+	// Update opens a file to read and write anywhere in, made if need be
+	Update(path string) (storageFile, error)
+	// Size is a file's length in bytes
+	Size(path string) (int64, error)
+}
+
+var Store Storage = localStore{}
+
+func setStorage(kind string) error {
+	switch kind {
+	case "", "local":
+		Store = localStore{}
+	case "memory":
+		Store = newMemStore()
+	default:
+		return errors.New("storage must be local or memory: " + kind)
+	}
+	return nil
+}
+
+type localStore struct{}
+
+func (localStore) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0775)
+}
+
+func (localStore) Append(path string) (storageFile, bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0664)
+	if err == nil {
+		return f, false, nil
+	}
+	// file does not exist, create new
+	f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	return f, err == nil, err
+}
+
+func (localStore) Update(path string) (storageFile, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0664)
+}
+
+func (localStore) Size(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+type memStore struct {
+	mu    sync.Mutex
+	files map[string]*[]byte
+	day   string // folder of the files kept
+}
+
+func newMemStore() *memStore {
+	return &memStore{files: make(map[string]*[]byte)}
+}
+
+func (m *memStore) MkdirAll(dir string) error {
+	// a new day folder drops the files of the days before
+	dir = filepath.Clean(dir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dir > m.day {
+		for path := range m.files {
+			if !strings.HasPrefix(path, dir) {
+				delete(m.files, path)
+			}
+		}
+		m.day = dir
+	}
+	return nil
+}
+
+func (m *memStore) open(path string) (*memFile, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.files[path]
+	if !ok {
+		b = new([]byte)
+		m.files[path] = b
+	}
+	return &memFile{store: m, b: b}, !ok
+}
+
+func (m *memStore) Append(path string) (storageFile, bool, error) {
+	f, created := m.open(path)
+	f.append = true
+	return f, created, nil
+}
+
+func (m *memStore) Update(path string) (storageFile, error) {
+	f, _ := m.open(path)
+	return f, nil
+}
+
+func (m *memStore) Size(path string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.files[path]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	return int64(len(*b)), nil
+}
+
+// ReadFile returns a copy of a file's contents
+func (m *memStore) ReadFile(path string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), *b...), nil
+}
+
+type memFile struct {
+	store  *memStore
+	b      *[]byte
+	off    int64
+	append bool // writes go to the end, as O_APPEND
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	if f.b == nil {
+		return 0, os.ErrClosed
+	}
+	if f.append {
+		f.off = int64(len(*f.b))
+	}
+	if end := f.off + int64(len(p)); end > int64(len(*f.b)) {
+		*f.b = append(*f.b, make([]byte, end-int64(len(*f.b)))...)
+	}
+	n := copy((*f.b)[f.off:], p)
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	if f.b == nil {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(*f.b))
+	}
+	if offset < 0 {
+		return 0, errors.New("memstore: seek before the start")
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	if f.b == nil {
+		return os.ErrClosed
+	}
+	f.b = nil
+	return nil
+}
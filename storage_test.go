@@ -0,0 +1,162 @@
+//go:build !edge
+
+package logais
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func useMemStore(t *testing.T) *memStore {
+	// Store is a memStore for the test, put back after
+	old := Store
+	m := newMemStore()
+	Store = m
+	t.Cleanup(func() { Store = old })
+	return m
+}
+
+func readMem(t *testing.T, m *memStore, path string) string {
+	t.Helper()
+	b, err := m.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile(%q): %v", path, err)
+	}
+	return string(b)
+}
+
+func TestMemStoreFiles(t *testing.T) {
+	m := newMemStore()
+	const path = "/data/2026/10/16/20261016-10110.csv"
+	if _, err := m.Size(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Size of a missing file = %v, want ErrNotExist", err)
+	}
+	f, created, err := m.Append(path)
+	if err != nil || !created {
+		t.Fatalf("Append = %v, %v, want created", created, err)
+	}
+	f.WriteString("header\r\n")
+	// appends go to the end wherever the file was seeked to
+	f.Seek(0, io.SeekStart)
+	f.WriteString("one\r\n")
+	f.Close()
+	if _, err := f.WriteString("closed"); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after Close = %v, want ErrClosed", err)
+	}
+	f, created, _ = m.Append(path)
+	if created {
+		t.Errorf("Append of a file there already says created")
+	}
+	f.WriteString("two\r\n")
+	f.Close()
+	if got := readMem(t, m, path); got != "header\r\none\r\ntwo\r\n" {
+		t.Errorf("file = %q", got)
+	}
+	if n, _ := m.Size(path); n != int64(len("header\r\none\r\ntwo\r\n")) {
+		t.Errorf("Size = %d", n)
+	}
+
+	// a collection file is rewritten in place, as geojson.go does
+	const gpath = "/data/2026/10/16/20261016-10110.geojson"
+	u, _ := m.Update(gpath)
+	u.WriteString(`{"features":[]}`)
+	end, _ := u.Seek(-2, io.SeekEnd)
+	u.WriteString(`1]}`)
+	if _, err := u.Seek(-100, io.SeekCurrent); err == nil {
+		t.Errorf("seek before the start didn't fail")
+	}
+	u.Close()
+	if got := readMem(t, m, gpath); got != `{"features":[1]}` || end != 13 {
+		t.Errorf("updated file = %q, seeked to %d", got, end)
+	}
+}
+
+func TestMemStoreRollover(t *testing.T) {
+	// only today's files are kept, a new day folder drops the others
+	m := newMemStore()
+	day1, day2 := "/data/2026/10/16/", "/data/2026/10/17/"
+	m.MkdirAll(day1)
+	for _, path := range []string{day1 + "20261016-10110.csv", day1 + "20261016-10111.csv"} {
+		f, _, _ := m.Append(path)
+		f.WriteString("x\r\n")
+		f.Close()
+	}
+	// another stream making the same folder, or a restart, keeps them
+	m.MkdirAll(day1)
+	if _, err := m.Size(day1 + "20261016-10111.csv"); err != nil {
+		t.Errorf("day folder made again dropped a file: %v", err)
+	}
+	m.MkdirAll(day2)
+	f, _, _ := m.Append(day2 + "20261017-10110.csv")
+	f.WriteString("y\r\n")
+	f.Close()
+	// a stream still on yesterday doesn't bring it back
+	m.MkdirAll(day1)
+	for path, want := range map[string]bool{
+		day1 + "20261016-10110.csv": false,
+		day1 + "20261016-10111.csv": false,
+		day2 + "20261017-10110.csv": true,
+	} {
+		if _, err := m.Size(path); (err == nil) != want {
+			t.Errorf("after rollover %s kept %v, want %v", path, err == nil, want)
+		}
+	}
+}
+
+func TestSideFileRollover(t *testing.T) {
+	m := useMemStore(t)
+	day1, day2 := "/data/2026/10/16/", "/data/2026/10/17/"
+	sf := &sideFile{suffix: "-quality", header: "timestamp,port,issue\r\n", every: time.Hour, size: 1024}
+	m.MkdirAll(day1)
+	if err := sf.write(day1, "20261016-10110", "a\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	sf.write(day1, "20261016-10110", "b\r\n")
+	q1 := day1 + "20261016-10110-quality.csv"
+	// buffered for the smoothing period, only the header is written yet
+	if got := readMem(t, m, q1); got != sf.header {
+		t.Errorf("buffered file = %q, want only the header", got)
+	}
+	if err := sf.flush(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readMem(t, m, q1); got != sf.header+"a\r\nb\r\n" {
+		t.Errorf("flushed file = %q", got)
+	}
+
+	// the stream restarting carries on the same file without a header
+	sf.write(day1, "20261016-10110", "c\r\n")
+	sf.Close()
+	sf.write(day1, "20261016-10110", "d\r\n")
+	sf.flush(time.Now().Add(2 * time.Hour))
+	if got := readMem(t, m, q1); got != sf.header+"a\r\nb\r\nc\r\nd\r\n" {
+		t.Errorf("file carried on = %q", got)
+	}
+	// at midnight the next record goes to the new day folder, yesterday's file is gone
+	m.MkdirAll(day2)
+	sf.write(day2, "20261017-10110", "e\r\n")
+	if _, err := m.Size(q1); err == nil {
+		t.Errorf("yesterday's file is still kept")
+	}
+	q2 := day2 + "20261017-10110-quality.csv"
+	sf.Close()
+	if got := readMem(t, m, q2); got != sf.header+"e\r\n" {
+		t.Errorf("new day's file = %q", got)
+	}
+
+	// with batch the records are written once there are enough
+	sf = &sideFile{suffix: "-invalid", header: "h\r\n", every: time.Hour, size: 1024, batch: 2}
+	sf.write(day2, "20261017-10110", "1\r\n")
+	i2 := day2 + "20261017-10110-invalid.csv"
+	if got := readMem(t, m, i2); got != "h\r\n" {
+		t.Errorf("one record of a batch of two written: %q", got)
+	}
+	sf.write(day2, "20261017-10110", "2\r\n")
+	if got := readMem(t, m, i2); got != "h\r\n1\r\n2\r\n" {
+		t.Errorf("full batch = %q", got)
+	}
+	sf.Close()
+}
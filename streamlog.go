@@ -0,0 +1,182 @@
+//go:build !edge
+
+package logais
+
+/*
+Per-stream log files, per stream option:
+ log-file	also write the stream's log entries to LogAIS-port.log in the log folder
+so a station with many streams can be looked at one stream at a time. Every
+entry with the stream's port goes there as well as to LogAIS.log (and syslog):
+connects, files, read errors, restarts, feeds, relays, stats, control API
+changes. Written in the -log-format, and rotated by the same rules as
+LogAIS.log (see logrotate.go), old files named LogAIS-port.1.log and so on, or
+by date, eg LogAIS-10110-20261016.log; with no log-rotate line they are only
+rotated by size. Not in a container, where the log goes to stdout.
+*/
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	logStreams sync.Map // port -> *Stream running, for routing log entries
+	streamLogs sync.Map // port -> *streamLog opened
+	LogFormat  string   // -log-format, for the stream logs too
+)
+
+type streamLog struct {
+	mu     sync.Mutex
+	port   string
+	base   string // eg /var/log/LogAIS/LogAIS-10110, without .log
+	f      *os.File
+	period time.Time // of the file's entries, with time rotation
+	h      slog.Handler
+}
+
+func streamLogFor(port string) *streamLog {
+	// the open log of the stream on port if it has log-file, else nil
+	v, ok := logStreams.Load(port)
+	if !ok || Container || !v.(*Stream).opts().LogFile {
+		return nil
+	}
+	if l, ok := streamLogs.Load(port); ok {
+		return l.(*streamLog)
+	}
+	l := &streamLog{port: port, base: Logpath + LogfName + "-" + port}
+	h, err := newLogHandler(l, LogFormat, LogLevel)
+	if err != nil {
+		return nil
+	}
+	l.h = h
+	if v, loaded := streamLogs.LoadOrStore(port, l); loaded {
+		return v.(*streamLog)
+	}
+	l.open(*logRules.Load())
+	return l
+}
+
+func (l *streamLog) open(r LogRotate) {
+	// carry on with the file, rotating it first if it's from an earlier period
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if info, err := os.Stat(l.base + ".log"); err == nil && r.Every > 0 {
+		l.period = info.ModTime().UTC().Truncate(r.Every)
+		if l.due(r, time.Now()) {
+			l.rotate(r)
+			return
+		}
+	}
+	l.f, _ = os.OpenFile(l.base+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	l.period = time.Now().UTC().Truncate(max(r.Every, 1))
+}
+
+func (l *streamLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, errors.New("stream log " + l.base + ".log not open")
+	}
+	return l.f.Write(p)
+}
+
+func (l *streamLog) due(r LogRotate, now time.Time) bool {
+	return r.Every > 0 && now.UTC().Truncate(r.Every).After(l.period)
+}
+
+func (l *streamLog) check(r LogRotate) {
+	// called from logCheck
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	if info, err := l.f.Stat(); err == nil && r.Size > 0 && info.Size() > r.Size || l.due(r, time.Now()) {
+		l.rotate(r)
+	}
+}
+
+func (l *streamLog) rotate(r LogRotate) {
+	// as rotateLog does for LogAIS.log, l.mu held
+	if l.f != nil {
+		l.f.Close()
+	}
+	if r.Every > 0 {
+		os.Rename(l.base+".log", datedLogName(l.base, l.period, r.Every))
+		pruneLogs(LogfName+"-"+l.port+"-[0-9]*.log", r.Keep)
+	} else {
+		os.Remove(l.base + "." + strconv.Itoa(r.Keep) + ".log")
+		for i := r.Keep; i > 1; i-- {
+			os.Rename(l.base+"."+strconv.Itoa(i-1)+".log", l.base+"."+strconv.Itoa(i)+".log")
+		}
+		os.Rename(l.base+".log", l.base+".1.log")
+	}
+	l.f, _ = os.OpenFile(l.base+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	l.period = time.Now().UTC().Truncate(max(r.Every, 1))
+}
+
+func checkStreamLogs(r LogRotate) {
+	streamLogs.Range(func(_, v any) bool {
+		v.(*streamLog).check(r)
+		return true
+	})
+}
+
+// passes entries on, and those with a port to the stream's own log too
+type streamRouter struct {
+	next slog.Handler
+	port string                            // from With
+	with []func(slog.Handler) slog.Handler // With and WithGroup calls, in order, for the stream's handler
+}
+
+func (h *streamRouter) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *streamRouter) Handle(ctx context.Context, r slog.Record) error {
+	err := h.next.Handle(ctx, r)
+	port := h.port
+	if port == "" {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "port" {
+				port = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if port == "" {
+		return err
+	}
+	if l := streamLogFor(port); l != nil {
+		sh := l.h
+		for _, w := range h.with {
+			sh = w(sh)
+		}
+		err = errors.Join(err, sh.Handle(ctx, r))
+	}
+	return err
+}
+
+func (h *streamRouter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := &streamRouter{next: h.next.WithAttrs(attrs), port: h.port, with: append(h.with[:len(h.with):len(h.with)], func(sh slog.Handler) slog.Handler {
+		return sh.WithAttrs(attrs)
+	})}
+	for _, a := range attrs {
+		if a.Key == "port" {
+			h2.port = a.Value.String()
+		}
+	}
+	return h2
+}
+
+func (h *streamRouter) WithGroup(name string) slog.Handler {
+	return &streamRouter{next: h.next.WithGroup(name), port: h.port, with: append(h.with[:len(h.with):len(h.with)], func(sh slog.Handler) slog.Handler {
+		return sh.WithGroup(name)
+	})}
+}
@@ -0,0 +1,50 @@
+//go:build !edge
+
+package logais
+
+/*
+Stream supervisor: a stream that fails, eg its day folder can't be made, its
+file can't be written or its UDP port can't be opened again, is started again
+after a pause that doubles with each failure in a row, from restartFirst up to
+restartMax. A run that lasted restartReset counts as recovered, the next pause
+is restartFirst again. Each restart is logged with the stream's count, which is
+also in its stats (/api/status), /healthz and the status page. A stream with
+a bad port number isn't restarted, nor one being stopped.
+A feed or tcp-serve is started once and kept through restarts.
+*/
+
+import (
+	"time"
+)
+
+const (
+	restartFirst = 5 * time.Second  // pause before restarting a failed stream
+	restartMax   = 5 * time.Minute  // longest pause, after repeated failures
+	restartReset = 10 * time.Minute // a run this long resets the pause
+)
+
+func supervise(st *Stream) {
+	defer close(st.stopped)
+	wait := restartFirst
+	logit := Logit.With("port", st.Port, "stream", st.Name)
+	for {
+		began := time.Now()
+		startAIS(st, logit)
+		if _, err := checkPort(st.Port); err != nil || st.stopping() {
+			return
+		}
+		if time.Since(began) >= restartReset {
+			wait = restartFirst
+		}
+		n := st.stats.Restarts.Add(1)
+		logit.Warn("stream failed", "restart", n, "in", wait)
+		// waiting isn't stuck, see sdnotify.go
+		st.beat.Store(0)
+		select {
+		case <-st.quit:
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, restartMax)
+	}
+}
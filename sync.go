@@ -0,0 +1,318 @@
+//go:build !edge
+
+package logais
+
+/*
+Warm standby: two LogAIS instances recording the same feeds fill each other's
+gaps after an outage. Both run with -http and name each other in the config:
+ peer <tab> http://standby:8080
+At startup and after each UTC midnight every finished day of the last week is
+checked: a daily file this instance doesn't have is copied from the peer, and
+gaps of more than two minutes in a file it has are filled with the peer's
+records from that time, marked with a "# Filled from peer" comment.
+Today's files are filled after midnight. Both instances should use the same
+ports and stream options so the files match.
+
+API used between peers:
+ GET /api/sync?day=yyyy-mm-dd	names of the main daily files for a day
+ GET /api/sync/{name}[?from=time&until=time]	a daily file's lines, or only the records strictly between from and until (RFC3339)
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/logais/rotation"
+)
+
+const (
+	syncGap  = 2 * time.Minute // shorter quiet spells aren't worth asking about
+	syncDays = 7               // finished days checked
+)
+
+var syncClient = &http.Client{Timeout: time.Minute}
+
+func syncDayFiles(day time.Time) []string {
+	// names of the main daily files for a day in the data and cold storage folders
+	seen := make(map[string]bool)
+	var names []string
+	dir := rotation.Folder(day)
+	for _, root := range archiveRoots() {
+		found, _ := filepath.Glob(filepath.Join(root, dir, rotation.Name(day, "*", "", ".csv")))
+		for _, path := range found {
+			name := filepath.Base(path)
+			if fileFormat(name) == "csv" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lineTime(line string) (time.Time, bool) {
+	// timestamp of a record line, false for comments and headers
+	if line == "" || line[0] == '#' {
+		return time.Time{}, false
+	}
+	stamp, _, _ := strings.Cut(line, ",")
+	return parseStamp(stamp)
+}
+
+func readLines(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 65536), 1<<20)
+	for sc.Scan() {
+		lines = append(lines, strings.TrimRight(sc.Text(), "\r"))
+	}
+	return lines, sc.Err()
+}
+
+func syncListHandler(w http.ResponseWriter, r *http.Request) {
+	day, err := time.Parse(time.DateOnly, r.URL.Query().Get("day"))
+	if err != nil {
+		http.Error(w, "day must be yyyy-mm-dd", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, syncDayFiles(day))
+}
+
+func syncFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, _, ok := dailyFileDay(name); !ok || filepath.Base(name) != name {
+		http.Error(w, "not a daily file name", http.StatusBadRequest)
+		return
+	}
+	path := findRecording(name)
+	lines, err := readLines(path)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	from, err1 := time.Parse(time.RFC3339Nano, q.Get("from"))
+	until, err2 := time.Parse(time.RFC3339Nano, q.Get("until"))
+	ranged := q.Get("from") != "" || q.Get("until") != ""
+	if ranged && (err1 != nil || err2 != nil) {
+		http.Error(w, "from and until must be RFC3339 times", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	for _, line := range lines {
+		if ranged {
+			t, ok := lineTime(line)
+			if !ok || !t.After(from) || !t.Before(until) {
+				continue
+			}
+		}
+		io.WriteString(w, line+"\r\n")
+	}
+}
+
+func peerGet(peer string, path string, query url.Values) ([]byte, error) {
+	u := strings.TrimRight(peer, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	resp, err := syncClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", redactURL(u), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// a stretch of a recording with no records, filled with the peer's lines at index at
+type syncGapFill struct {
+	from, until time.Time
+	at          int
+	lines       []string
+}
+
+func findGaps(lines []string, day time.Time) []*syncGapFill {
+	// quiet spells longer than syncGap, including the start and end of the day
+	var gaps []*syncGapFill
+	prev, at := day, -1
+	for i, line := range lines {
+		t, ok := lineTime(line)
+		if !ok {
+			continue
+		}
+		if at < 0 {
+			at = i
+		}
+		if t.Sub(prev) > syncGap {
+			gaps = append(gaps, &syncGapFill{from: prev, until: t, at: at})
+		}
+		if t.After(prev) {
+			prev = t
+		}
+		at = i + 1
+	}
+	if at < 0 {
+		at = len(lines)
+	}
+	if end := day.AddDate(0, 0, 1); end.Sub(prev) > syncGap {
+		gaps = append(gaps, &syncGapFill{from: prev, until: end, at: at})
+	}
+	return gaps
+}
+
+func fillFile(peer string, day time.Time, name string) (int, error) {
+	// copy a missing file or fill the gaps in one, returns the number of records added
+	path := findRecording(name)
+	lines, err := readLines(path)
+	if errors.Is(err, os.ErrNotExist) {
+		b, err := peerGet(peer, "/api/sync/"+url.PathEscape(name), nil)
+		if err != nil {
+			return 0, err
+		}
+		dir := Datapath + rotation.Folder(day) + Sep
+		if err = os.MkdirAll(dir, 0775); err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, line := range strings.Split(string(b), "\n") {
+			if _, ok := lineTime(line); ok {
+				n++
+			}
+		}
+		if !chained(strings.Split(string(b), "\n")) {
+			// a chained file is copied as it is, to verify as the peer's does
+			b = append(b, "# Copied from peer "+redactURL(peer)+"\r\n"...)
+		}
+		if err = os.WriteFile(dir+name+".tmp", b, 0664); err != nil {
+			return 0, err
+		}
+		return n, os.Rename(dir+name+".tmp", dir+name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if chained(lines) {
+		// filling would break its chain, see chain.go
+		return 0, nil
+	}
+
+	added := 0
+	gaps := findGaps(lines, day)
+	for _, g := range gaps {
+		q := url.Values{"from": {g.from.Format(time.RFC3339Nano)}, "until": {g.until.Format(time.RFC3339Nano)}}
+		b, err := peerGet(peer, "/api/sync/"+url.PathEscape(name), q)
+		if errors.Is(err, os.ErrNotExist) {
+			return added, nil
+		}
+		if err != nil {
+			return added, err
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(b), "\r\n"), "\r\n") {
+			if _, ok := lineTime(line); ok {
+				g.lines = append(g.lines, line)
+			}
+		}
+		added += len(g.lines)
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	var out strings.Builder
+	next := 0
+	for i, line := range lines {
+		for next < len(gaps) && gaps[next].at == i {
+			writeFill(&out, peer, gaps[next])
+			next++
+		}
+		out.WriteString(line + "\r\n")
+	}
+	for ; next < len(gaps); next++ {
+		writeFill(&out, peer, gaps[next])
+	}
+	if err = os.WriteFile(path+".tmp", []byte(out.String()), 0664); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return 0, err
+	}
+	return added, reindex(path)
+}
+
+func writeFill(out *strings.Builder, peer string, g *syncGapFill) {
+	if len(g.lines) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "# Filled from peer %s: %d records\r\n", redactURL(peer), len(g.lines))
+	for _, line := range g.lines {
+		out.WriteString(line + "\r\n")
+	}
+}
+
+func reconcile(peer string, now time.Time) (int, error) {
+	// fill the finished days of the last week from the peer
+	today := now.UTC().Truncate(24 * time.Hour)
+	added := 0
+	var errs []error
+	for d := 1; d <= syncDays; d++ {
+		day := today.AddDate(0, 0, -d)
+		b, err := peerGet(peer, "/api/sync", url.Values{"day": {day.Format(time.DateOnly)}})
+		if err != nil {
+			return added, err
+		}
+		var names []string
+		if err = json.Unmarshal(b, &names); err != nil {
+			return added, err
+		}
+		for _, name := range names {
+			n, err := fillFile(peer, day, name)
+			added += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+	}
+	return added, errors.Join(errs...)
+}
+
+func keepSync(peer string) {
+	// give the peer a minute to start too, then after each UTC midnight
+	time.Sleep(time.Minute)
+	for {
+		n, err := reconcile(peer, time.Now())
+		if err != nil {
+			Logit.Error("reconciling with peer", "peer", redactURL(peer), "err", err)
+		}
+		if n > 0 {
+			Logit.Info("records filled in from peer", "records", n, "peer", redactURL(peer))
+		}
+		now := time.Now().UTC()
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 15, 0, 0, time.UTC)
+		time.Sleep(next.Sub(now))
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !edge
+
+package logais
+
+/*
+Application log to syslog as well as, or instead of, LogAIS.log, so a station's
+log lands in a central log system. The config line
+ syslog <tab> local|[udp://|tcp://]host:port [<tab> only]
+sends every entry to the local syslog (/dev/log, which journald reads too) or
+to a remote collector, over UDP unless tcp:// is given, eg
+ syslog	tcp://logs.example.org:514
+Entries go with facility daemon and tag logais, their level as the severity
+(fatal as crit) and the message and fields as text, eg
+ connected for input port=10110 stream="Harbour receiver"
+only stops writing LogAIS.log; without it both get every entry. Read at
+startup, a changed syslog line needs a restart. Not on Windows, see
+syslog_other.go. If syslog can't be reached at startup LogAIS.log is
+written anyway.
+*/
+
+import (
+	"log/slog"
+)
+
+func withSyslog(file slog.Handler, t *SyslogTarget) (*slog.Logger, error) {
+	// the application logger for the config's syslog line
+	h, err := openSyslog(t)
+	switch {
+	case err != nil:
+		return slog.New(file), err
+	case t.Only:
+		return slog.New(h), nil
+	}
+	return slog.New(teeHandler{file, h}), nil
+}
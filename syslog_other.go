@@ -0,0 +1,13 @@
+//go:build (windows || plan9) && !edge
+
+package logais
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// no log/syslog on Windows, LogAIS.log only
+func openSyslog(t *SyslogTarget) (slog.Handler, error) {
+	return nil, errors.New("syslog isn't available on this system")
+}
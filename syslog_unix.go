@@ -0,0 +1,50 @@
+//go:build !windows && !plan9 && !edge
+
+package logais
+
+import (
+	"context"
+	"log/slog"
+	"log/syslog"
+	"sync"
+)
+
+type syslogHandler struct {
+	w    *syslog.Writer
+	text *textHandler // formats the message and fields
+}
+
+func openSyslog(t *SyslogTarget) (slog.Handler, error) {
+	w, err := syslog.Dial(t.Network, t.Addr, syslog.LOG_DAEMON|syslog.LOG_INFO, "logais")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHandler{w: w, text: &textHandler{mu: new(sync.Mutex), level: LogLevel}}, nil
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.text.Enabled(ctx, l)
+}
+
+func (h *syslogHandler) Handle(_ context.Context, r slog.Record) error {
+	text := string(h.text.format(r, false))
+	switch {
+	case r.Level >= LevelFatal:
+		return h.w.Crit(text)
+	case r.Level >= slog.LevelError:
+		return h.w.Err(text)
+	case r.Level >= slog.LevelWarn:
+		return h.w.Warning(text)
+	case r.Level >= slog.LevelInfo:
+		return h.w.Info(text)
+	}
+	return h.w.Debug(text)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{w: h.w, text: h.text.WithAttrs(attrs).(*textHandler)}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{w: h.w, text: h.text.WithGroup(name).(*textHandler)}
+}
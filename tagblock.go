@@ -0,0 +1,35 @@
+package logais
+
+/*
+NMEA 4.10 TAG blocks, a backslash delimited prefix some base stations and
+networks put in front of sentences, eg
+ \s:station1,c:1672531200*5A\!AIVDM,1,1,,A,...*hh
+Fields used here: s source, c UNIX time in seconds (milliseconds if too big
+to be seconds), n line count. Other fields are kept in the raw block only.
+They are read in package sentence.
+
+The tags option chooses what is recorded:
+ keep	TAG block written in front of the sentence in the message column, as received (default)
+ fields	TAG block removed, its source used as the record source unless a receiver is configured
+ drop	TAG block removed
+tagtime uses the TAG block time instead of the receive time for the timestamp column.
+
+The seq option numbers every sentence the stream receives, in an n: field of
+its TAG block (added if it had none, replacing any n: it had), so programs
+reading the files or the relayed data can spot what they lost. Numbering starts
+at 1 when LogAIS starts; numbers missing from a file can also be sentences the
+stream's filters left out. With tags=fields or drop only the n: field is written.
+*/
+
+import (
+	"example.com/logais/sentence"
+)
+
+type tagBlock = sentence.Tag
+
+var (
+	parseTag  = sentence.ParseTag
+	numberTag = sentence.NumberTag
+	stampTag  = sentence.StampTag
+	splitTag  = sentence.SplitTag
+)
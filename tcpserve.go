@@ -0,0 +1,146 @@
+//go:build !edge
+
+package logais
+
+/*
+Live rebroadcast over TCP, so chartplotters and OpenCPN can use LogAIS as their
+NMEA source:
+ tcp-serve=[host]:port	serve everything the stream receives to any client connecting here
+ tcp-serve=tls://[host]:port	the same over TLS, see config/tls.go
+Clients get the same data as relay, from when they connect. Each client has its
+own queue; a client that lets it fill (a slow link or a stalled program) is
+disconnected rather than holding up the stream or the other clients.
+Started with the stream, a profile changing the address has no effect.
+*/
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"example.com/logais/config"
+)
+
+const (
+	tcpClientQueue = 512              // packets waiting for a client
+	tcpMaxClients  = 64               // connections refused beyond this
+	tcpWriteWait   = 10 * time.Second // longest a write to a client may take
+)
+
+type tcpServer struct {
+	logit *slog.Logger // with the stream's port
+
+	mu      sync.Mutex
+	clients map[*tcpClient]bool
+}
+
+type tcpClient struct {
+	conn net.Conn
+	out  chan []byte
+	once sync.Once
+}
+
+func startTCPServer(addr string, secure *config.TLSFiles, logit *slog.Logger) (*tcpServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if secure != nil {
+		ln = tls.NewListener(ln, secure.ServerConfig(logit))
+	}
+	s := &tcpServer{logit: logit, clients: make(map[*tcpClient]bool)}
+	logit.Info("serving on TCP", "addr", addr, "tls", secure != nil)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				logit.Error("TCP server", "err", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			if tc, ok := conn.(*tls.Conn); ok {
+				go s.handshake(tc)
+			} else {
+				s.add(conn)
+			}
+		}
+	}()
+	return s, nil
+}
+
+func (s *tcpServer) handshake(conn *tls.Conn) {
+	// before the client is added, so ones failing it are logged as such
+	conn.SetDeadline(time.Now().Add(tcpWriteWait))
+	if err := conn.Handshake(); err != nil {
+		s.logit.Warn("TCP client failed the TLS handshake", "client", conn.RemoteAddr(), "err", err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	s.add(conn)
+}
+
+func (s *tcpServer) add(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) >= tcpMaxClients {
+		s.logit.Error("TCP client refused", "client", conn.RemoteAddr(), "clients", tcpMaxClients)
+		conn.Close()
+		return
+	}
+	c := &tcpClient{conn: conn, out: make(chan []byte, tcpClientQueue)}
+	s.clients[c] = true
+	s.logit.Info("TCP client connected", "client", conn.RemoteAddr())
+	go func() {
+		for p := range c.out {
+			conn.SetWriteDeadline(time.Now().Add(tcpWriteWait))
+			if _, err := conn.Write(p); err != nil {
+				s.drop(c, err.Error())
+				return
+			}
+		}
+	}()
+	go func() {
+		// nothing is read from clients, this only notices them going
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				s.drop(c, "disconnected")
+				return
+			}
+		}
+	}()
+}
+
+func (s *tcpServer) drop(c *tcpClient, why string) {
+	c.once.Do(func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		close(c.out)
+		s.mu.Unlock()
+		c.conn.Close()
+		s.logit.Info("TCP client "+why, "client", c.conn.RemoteAddr())
+	})
+}
+
+func (s *tcpServer) broadcast(packet []byte) {
+	if s == nil {
+		return
+	}
+	p := append([]byte(nil), packet...)
+	s.mu.Lock()
+	var slow []*tcpClient
+	for c := range s.clients {
+		select {
+		case c.out <- p:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range slow {
+		s.drop(c, "too slow, disconnected")
+	}
+}
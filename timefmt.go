@@ -0,0 +1,75 @@
+//go:build !edge
+
+package logais
+
+/*
+How a stream writes its timestamps, for programs reading the daily files that
+want something else than the default UTC ISO 8601 with milliseconds
+(2026-10-16T10:30:00.123Z):
+ time-format=iso|iso-us|epoch|epoch-ms|epoch-us	epoch is seconds since 1970 with
+	milliseconds (1760610600.123), epoch-ms milliseconds (1760610600123); iso-us
+	and epoch-us are to the microsecond, for research (see rxclock.go)
+ timezone=name	iso times in this timezone with its offset
+	(2026-10-16T23:30:00.123+13:00), an IANA name, eg Pacific/Auckland, Local
+	for the system's, or a fixed offset, eg +05:30; the names are built in, so
+	they work on Windows too
+The timestamp column, the quality log, GeoJSON, sinks and the -invalid and
+-repaired files use it; comment lines stay UTC, and the daily file is still
+chosen by the UTC day. Merged, aggregated and reordered streams write their
+own format. The tools read all
+of them. Not with vdr-strict or the output presets, whose formats are fixed.
+*/
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // for timezone names where the system has no zoneinfo, eg Windows
+
+	"example.com/logais/config"
+)
+
+type timeFormat = config.TimeFormat
+
+func formatTime(f *timeFormat, t time.Time) string {
+	// a time as the stream writes it
+	if f == nil {
+		return t.UTC().Format(timeLayout)
+	}
+	return f.Format(t)
+}
+
+func timeStamp(f *timeFormat, rec *record) string {
+	// a record's timestamp as the stream writes it
+	if f == nil {
+		return rec.Time
+	}
+	return f.Format(rec.at)
+}
+
+func parseStamp(stamp string) (time.Time, bool) {
+	// a record's timestamp in any time-format
+	if t, err := time.Parse(time.RFC3339Nano, stamp); err == nil {
+		return t.UTC(), true
+	}
+	secs, frac, dotted := strings.Cut(stamp, ".")
+	n, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	if !dotted {
+		if n > 1e14 {
+			return time.UnixMicro(n).UTC(), true
+		}
+		if n > 1e11 {
+			// milliseconds, as for TAG block times
+			return time.UnixMilli(n).UTC(), true
+		}
+		return time.Unix(n, 0).UTC(), true
+	}
+	f, err := strconv.ParseFloat("0."+frac, 64)
+	if err != nil || frac == "" {
+		return time.Time{}, false
+	}
+	return time.Unix(n, int64(f*1e9)).UTC(), true
+}
@@ -0,0 +1,144 @@
+//go:build !edge
+
+package logais
+
+/*
+Archive storage use by stream, month and format, for planning retention and disks.
+ logais du [-json]
+Formats are the daily file kinds: csv (main recording), ownship, invalid,
+quality, geojsonl, geojson, idx (see index.go), with .gz added for files
+compressed by retention.
+Cold storage folders are included.
+Also served as /api/du (see api.go).
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"example.com/logais/rotation"
+)
+
+type usageRow struct {
+	Stream string `json:"stream"`
+	Month  string `json:"month"` // yyyy-mm
+	Format string `json:"format"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type archiveUsage struct {
+	Rows     []usageRow       `json:"rows"`
+	ByStream map[string]int64 `json:"by_stream"`
+	ByMonth  map[string]int64 `json:"by_month"`
+	ByFormat map[string]int64 `json:"by_format"`
+	Total    int64            `json:"total"`
+}
+
+// kind of daily file from its name, yyyymmdd-port[-suffix].ext, with .gz if compressed
+var fileFormat = rotation.Format
+
+func measureArchive(roots []string) (*archiveUsage, error) {
+	u := &archiveUsage{ByStream: make(map[string]int64), ByMonth: make(map[string]int64), ByFormat: make(map[string]int64)}
+	rows := make(map[usageRow]*usageRow)
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		day, port, ok := dailyFileDay(d.Name())
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		key := usageRow{Stream: port, Month: day.Format("2006-01"), Format: fileFormat(d.Name())}
+		r, ok := rows[key]
+		if !ok {
+			r = &usageRow{Stream: key.Stream, Month: key.Month, Format: key.Format}
+			rows[key] = r
+		}
+		r.Files++
+		r.Bytes += info.Size()
+		u.ByStream[key.Stream] += info.Size()
+		u.ByMonth[key.Month] += info.Size()
+		u.ByFormat[key.Format] += info.Size()
+		u.Total += info.Size()
+		return nil
+	}
+	var err error
+	for _, root := range roots {
+		if werr := filepath.WalkDir(root, walk); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	for _, r := range rows {
+		u.Rows = append(u.Rows, *r)
+	}
+	sort.Slice(u.Rows, func(i, j int) bool {
+		a, b := u.Rows[i], u.Rows[j]
+		if a.Stream != b.Stream {
+			return a.Stream < b.Stream
+		}
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		return a.Format < b.Format
+	})
+	return u, err
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func duCmd(args []string) int {
+	fset := flag.NewFlagSet("du", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "print JSON instead of a table")
+	fset.Parse(args)
+	u, err := measureArchive(archiveRoots())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(u, "", " ")
+		fmt.Println(string(b))
+		return 0
+	}
+	fmt.Printf("%-8s %-8s %-10s %6s %10s\n", "stream", "month", "format", "files", "size")
+	for _, r := range u.Rows {
+		fmt.Printf("%-8s %-8s %-10s %6d %10s\n", r.Stream, r.Month, r.Format, r.Files, humanBytes(r.Bytes))
+	}
+	total := func(title string, m map[string]int64) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Printf("\nby %s\n", title)
+		for _, k := range keys {
+			fmt.Printf("%-10s %10s\n", k, humanBytes(m[k]))
+		}
+	}
+	total("stream", u.ByStream)
+	total("month", u.ByMonth)
+	total("format", u.ByFormat)
+	fmt.Printf("\ntotal %s\n", humanBytes(u.Total))
+	return 0
+}
@@ -0,0 +1,191 @@
+//go:build !edge
+
+package logais
+
+/*
+Vessel registry: MMSI to name, callsign, type and dimensions, learned from
+static data messages (types 5, 19, 21 and 24) on every stream.
+Kept in memory and saved to vessels.json in the data folder every few minutes.
+ logais vessels [mmsi or part of a name]	query the saved registry
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/logais/ais"
+)
+
+const vesselSave = 10 // minutes between saving the registry
+
+type Vessel struct {
+	MMSI        uint32    `json:"mmsi"`
+	Name        string    `json:"name,omitempty"`
+	CallSign    string    `json:"callsign,omitempty"`
+	IMO         uint32    `json:"imo,omitempty"`
+	ShipType    int       `json:"ship_type,omitempty"`
+	Length      int       `json:"length,omitempty"` // metres
+	Beam        int       `json:"beam,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Updated     time.Time `json:"updated"`
+}
+
+type registry struct {
+	mu    sync.RWMutex
+	m     map[uint32]*Vessel
+	dirty bool
+	path  string
+}
+
+var Vessels = &registry{m: make(map[uint32]*Vessel)}
+
+func (r *registry) learn(msg ais.Message) {
+	// update from a static data message, other types ignored
+	var upd func(v *Vessel)
+	switch m := msg.(type) {
+	case *ais.StaticVoyage:
+		upd = func(v *Vessel) {
+			v.Name, v.CallSign, v.IMO, v.ShipType = m.Name, m.CallSign, m.IMO, m.ShipType
+			v.Length, v.Beam, v.Destination = m.Length(), m.Beam(), m.Destination
+		}
+	case *ais.StaticData:
+		upd = func(v *Vessel) {
+			if m.PartNo == 0 {
+				v.Name = m.Name
+				return
+			}
+			v.CallSign, v.ShipType = m.CallSign, m.ShipType
+			if !m.Auxiliary() {
+				v.Length, v.Beam = m.Length(), m.Beam()
+			}
+		}
+	case *ais.ExtendedB:
+		upd = func(v *Vessel) {
+			v.Name, v.ShipType, v.Length, v.Beam = m.Name, m.ShipType, m.Length(), m.Beam()
+		}
+	case *ais.AidToNav:
+		upd = func(v *Vessel) {
+			v.Name, v.Length, v.Beam = m.Name, m.Length(), m.Beam()
+		}
+	default:
+		return
+	}
+	mmsi := msg.Base().MMSI
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.m[mmsi]
+	if !ok {
+		v = &Vessel{MMSI: mmsi}
+		r.m[mmsi] = v
+	}
+	upd(v)
+	v.Updated = time.Now().UTC()
+	r.dirty = true
+}
+
+// Lookup returns what is known about a vessel.
+func (r *registry) Lookup(mmsi uint32) (Vessel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if v, ok := r.m[mmsi]; ok {
+		return *v, true
+	}
+	return Vessel{}, false
+}
+
+// Find returns vessels whose MMSI starts with or whose name contains query, sorted by MMSI.
+func (r *registry) Find(query string) []Vessel {
+	query = strings.ToUpper(strings.TrimSpace(query))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found []Vessel
+	for mmsi, v := range r.m {
+		if query == "" || strings.HasPrefix(strconv.FormatUint(uint64(mmsi), 10), query) || strings.Contains(v.Name, query) {
+			found = append(found, *v)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].MMSI < found[j].MMSI })
+	return found
+}
+
+func (r *registry) forget(mmsi uint32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.m[mmsi]; !ok {
+		return false
+	}
+	delete(r.m, mmsi)
+	r.dirty = true
+	return true
+}
+
+func (r *registry) load() error {
+	b, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var list []*Vessel
+	if err = json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range list {
+		r.m[v.MMSI] = v
+	}
+	return nil
+}
+
+func (r *registry) save() error {
+	// write to a temporary file first so a crash can't leave half a registry
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return nil
+	}
+	list := make([]*Vessel, 0, len(r.m))
+	for _, v := range r.m {
+		c := *v
+		list = append(list, &c)
+	}
+	r.dirty = false
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].MMSI < list[j].MMSI })
+	b, err := json.MarshalIndent(list, "", " ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(r.path+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(r.path+".tmp", r.path)
+}
+
+func (r *registry) keep() {
+	for {
+		time.Sleep(vesselSave * time.Minute)
+		if err := r.save(); err != nil {
+			Logit.Error("saving vessel registry", "err", err)
+		}
+	}
+}
+
+func vesselsCmd(args []string) int {
+	Vessels.path = Datapath + "vessels.json"
+	if err := Vessels.load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, v := range Vessels.Find(strings.Join(args, " ")) {
+		fmt.Printf("%09d\t%-20s\t%-7s\tIMO %d\ttype %d\t%dx%dm\t%s\t%s\n", v.MMSI, v.Name, v.CallSign,
+			v.IMO, v.ShipType, v.Length, v.Beam, v.Destination, v.Updated.Format(time.DateTime))
+	}
+	return 0
+}